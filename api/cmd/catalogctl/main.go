@@ -0,0 +1,194 @@
+//catalogctl imports and exports the catalog of the store.
+//
+//	catalogctl import -format csv|json [-dry-run] file
+//	catalogctl export -format csv|json [-o file]
+//
+//The import validates every row of the file before writing anything, upserts
+//the categories and items and prints the changes applied to the catalog.
+//With -dry-run it only prints the changes
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	saws "github.com/roloum/store/api/internal/aws"
+	"github.com/roloum/store/api/internal/config"
+	"github.com/roloum/store/api/internal/store/catalog"
+)
+
+func main() {
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "import":
+		err = runImport(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "catalogctl: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+//usage prints the usage of the command and exits
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	fmt.Fprintln(os.Stderr, "  catalogctl import -format csv|json [-dry-run] file")
+	fmt.Fprintln(os.Stderr, "  catalogctl export -format csv|json [-o file]")
+	os.Exit(2)
+}
+
+//runImport validates the file, prints the diff with the current catalog and
+//imports it unless dry-run is set
+func runImport(args []string) error {
+
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "", "file format: csv or json. "+
+		"Defaults to the file extension")
+	dryRun := fs.Bool("dry-run", false, "print the changes without importing")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		usage()
+	}
+	file := fs.Arg(0)
+
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(file), ".")
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	products, err := catalog.Read(f, *format)
+	if err != nil {
+		return err
+	}
+
+	if errs := catalog.Validate(products); len(errs) > 0 {
+		for _, e := range errs {
+			fmt.Fprintln(os.Stderr, e.Error())
+		}
+		return fmt.Errorf("%d validation errors in %s", len(errs), file)
+	}
+
+	ctx := context.Background()
+
+	h, err := getHandler()
+	if err != nil {
+		return err
+	}
+
+	current, err := h.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	current.KeepMedia(products)
+	printDiff(os.Stdout, current.Diff(products))
+
+	if *dryRun {
+		return nil
+	}
+
+	if err := h.Import(ctx, current, products); err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d products\n", len(products))
+
+	return nil
+}
+
+//runExport writes the current catalog to stdout or to a file
+func runExport(args []string) error {
+
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", catalog.FormatJSON, "file format: csv or json")
+	out := fs.String("o", "", "output file. Defaults to stdout")
+	fs.Parse(args)
+
+	h, err := getHandler()
+	if err != nil {
+		return err
+	}
+
+	current, err := h.Load(context.Background())
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return catalog.Write(w, *format, current.Products)
+}
+
+//getHandler loads the configuration and returns a catalog Handler
+func getHandler() (*catalog.Handler, error) {
+
+	var cfg config.Configuration
+	if err := config.Load(&cfg); err != nil {
+		return nil, err
+	}
+
+	sess, err := saws.GetSession(cfg.AWS.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	retry := saws.Retry{
+		MaxAttempts: cfg.AWS.DynamoDB.Retry.MaxAttempts,
+		BaseDelay:   cfg.AWS.DynamoDB.Retry.BaseDelay,
+		MaxDelay:    cfg.AWS.DynamoDB.Retry.MaxDelay,
+	}
+
+	return catalog.New(saws.NewRetryDynamoDB(saws.GetDynamoDB(sess), retry),
+		cfg.AWS.DynamoDB.Table.Store)
+}
+
+//printDiff prints the changes an import applies to the catalog
+func printDiff(w io.Writer, d *catalog.Diff) {
+
+	for _, categoryID := range d.Categories {
+		fmt.Fprintf(w, "* category %s\n", categoryID)
+	}
+	for _, p := range d.Added {
+		fmt.Fprintf(w, "+ item %s %q %.2f\n", p.ItemID, p.Description, p.Price)
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(w, "~ item %s %q: %s\n", c.After.ItemID, c.After.Description,
+			strings.Join(c.Fields, ", "))
+	}
+	for _, p := range d.Missing {
+		fmt.Fprintf(w, "? item %s %q is not in the file and is kept\n", p.ItemID,
+			p.Description)
+	}
+
+	fmt.Fprintf(w, "%d added, %d changed, %d unchanged\n", len(d.Added),
+		len(d.Changed), d.Unchanged)
+}
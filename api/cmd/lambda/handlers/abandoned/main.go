@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/roloum/store/api/internal/app"
+	"github.com/roloum/store/api/internal/config"
+	sevents "github.com/roloum/store/api/internal/events"
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/roloum/store/api/internal/store/cart"
+)
+
+const (
+	//batchSize maximum number of carts reported by every query
+	batchSize = 100
+)
+
+//Handler is our lambda handler invoked by the `lambda.Start` function call.
+//It publishes a CartAbandoned event for every cart idle for longer than
+//STORE_CART_ABANDONED_AFTER, and marks the cart so it is reported once.
+//Carts without lines are marked without publishing an event. The carts are
+//marked before the events are published, so a cart modified in between is
+//not announced, and the marks are cleared if the events can not be
+//published, so the carts are reported again in the next run
+func Handler(ctx context.Context, ch *cart.Handler, sink sevents.Sink,
+	cfg config.Configuration) error {
+
+	var reported int
+	for {
+		carts, err := ch.Abandoned(ctx, cfg.Cart.AbandonedAfter, batchSize)
+		if err != nil {
+			return err
+		}
+
+		var marked int
+		var announced []*cart.AbandonedCart
+		for n := range carts {
+			switch err := ch.MarkAbandoned(ctx, &carts[n]); err {
+			case nil:
+				marked++
+				if len(carts[n].Items) > 0 {
+					announced = append(announced, &carts[n])
+				}
+			case cart.ErrCartWasModified:
+				logging.Ctx(logging.WithCart(ctx, carts[n].CartID)).Info().
+					Msg("Cart was modified, it is not abandoned")
+			default:
+				return err
+			}
+		}
+
+		if err := publish(ctx, ch, sink, announced); err != nil {
+			return err
+		}
+		reported += len(announced)
+
+		//The marked carts leave the index, so the next query returns the
+		//following ones
+		if len(carts) < batchSize || marked == 0 {
+			break
+		}
+	}
+
+	logging.Ctx(ctx).Info().Int("carts", reported).Msg("Reported abandoned carts")
+
+	return nil
+}
+
+//publish publishes the CartAbandoned events of the marked carts. When the
+//events can not be published, the marks of the carts are cleared
+func publish(ctx context.Context, ch *cart.Handler, sink sevents.Sink,
+	carts []*cart.AbandonedCart) error {
+
+	if len(carts) == 0 {
+		return nil
+	}
+
+	evs := make([]sevents.Event, 0, len(carts))
+	for _, c := range carts {
+		evs = append(evs, sevents.NewCartAbandoned(c))
+	}
+
+	err := sink.Publish(ctx, evs)
+	if err == nil {
+		return nil
+	}
+
+	for _, c := range carts {
+		if uerr := ch.UnmarkAbandoned(ctx, c); uerr != nil {
+			logging.Ctx(logging.WithCart(ctx, c.CartID)).Error().Err(uerr).
+				Msg("Abandoned cart will not be reported again")
+		}
+	}
+
+	return err
+}
+
+//initHandler is the function invoked by lambda that sets up the Configuration
+//for the real Handler. This allows for the implementation of test cases
+//for the Handler function
+func initHandler(ctx context.Context, event events.CloudWatchEvent) (err error) {
+
+	//The App is built by the first invocation of the container
+	a, err := app.Get()
+	if err != nil {
+		return err
+	}
+
+	ctx, span := a.Tracer.Start(ctx, "abandoned", nil)
+	defer func() { span.End(err) }()
+
+	return Handler(ctx, a.Cart, a.Sink, a.Config)
+}
+
+func main() {
+	lambda.Start(initHandler)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/roloum/store/api/internal/app"
+	"github.com/roloum/store/api/internal/webhook"
+)
+
+//Handler is our lambda handler invoked by the `lambda.Start` function call.
+//It attempts the deliveries to the webhooks that are due, which the stream
+//only enqueues, so the stream is not held by slow or failing endpoints
+func Handler(ctx context.Context, wh *webhook.Handler) error {
+	return wh.DeliverPending(ctx)
+}
+
+//initHandler is the function invoked by lambda that sets up the Configuration
+//for the real Handler. This allows for the implementation of test cases
+//for the Handler function
+func initHandler(ctx context.Context, event events.CloudWatchEvent) (err error) {
+
+	//The App is built by the first invocation of the container
+	a, err := app.Get()
+	if err != nil {
+		return err
+	}
+
+	ctx, span := a.Tracer.Start(ctx, "deliveries", nil)
+	defer func() { span.End(err) }()
+
+	return Handler(ctx, a.Webhook)
+}
+
+func main() {
+	lambda.Start(initHandler)
+}
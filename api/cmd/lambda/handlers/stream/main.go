@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/roloum/store/api/internal/app"
+	sevents "github.com/roloum/store/api/internal/events"
+	"github.com/roloum/store/api/internal/logging"
+)
+
+//Handler is our lambda handler invoked by the `lambda.Start` function call.
+//It decodes the records of the store table stream into cart events and
+//publishes them to the sink. Returning an error makes lambda retry the batch
+func Handler(ctx context.Context, event events.DynamoDBEvent,
+	sink sevents.Sink) error {
+
+	var evs []sevents.Event
+	for _, record := range event.Records {
+		e, err := sevents.Decode(record)
+		if err != nil {
+			//Invalid records are skipped, retrying would not fix them
+			logging.Ctx(ctx).Error().Err(err).Str("record_id", record.EventID).
+				Msg("Error decoding record")
+			continue
+		}
+		if e != nil {
+			evs = append(evs, e)
+		}
+	}
+
+	logging.Ctx(ctx).Debug().Int("events", len(evs)).
+		Int("records", len(event.Records)).Msg("Decoded records")
+
+	if len(evs) == 0 {
+		return nil
+	}
+
+	return sink.Publish(ctx, evs)
+}
+
+//initHandler is the function invoked by lambda that sets up the Configuration
+//for the real Handler. This allows for the implementation of test cases
+//for the Handler function
+func initHandler(ctx context.Context, event events.DynamoDBEvent) (err error) {
+
+	//The App is built by the first invocation of the container
+	a, err := app.Get()
+	if err != nil {
+		return err
+	}
+
+	ctx, span := a.Tracer.Start(ctx, "stream", nil)
+	span.SetAttribute("records", len(event.Records))
+	defer func() { span.End(err) }()
+
+	return Handler(ctx, event, a.Sink)
+}
+
+func main() {
+	lambda.Start(initHandler)
+}
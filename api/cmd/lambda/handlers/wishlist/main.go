@@ -0,0 +1,12 @@
+package main
+
+import (
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/roloum/store/api/internal/api"
+)
+
+//main starts the lambda function that serves the wishlist routes. The routes
+//are declared in the api package, which dispatches the requests
+func main() {
+	lambda.Start(api.Lambda(api.Wishlist))
+}
@@ -0,0 +1,37 @@
+//openapi writes the OpenAPI document of the API, generated from its routes.
+//
+//	openapi [-o file]
+//
+//The document is committed in openapi.json, and a test of the api package
+//fails when it is not the document of the routes
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+
+	"github.com/roloum/store/api/internal/api"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+
+	out := flag.String("o", "", "output file, standard output by default")
+	flag.Parse()
+
+	js, err := json.MarshalIndent(api.Document(), "", "  ")
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error marshalling document")
+	}
+	js = append(js, '\n')
+
+	if *out == "" {
+		os.Stdout.Write(js)
+		return
+	}
+	if err := ioutil.WriteFile(*out, js, 0644); err != nil {
+		log.Fatal().Err(err).Msg("Error writing document")
+	}
+}
@@ -0,0 +1,59 @@
+//server is the local development server. It serves every route of the API,
+//with the same router as the lambda functions, its OpenAPI document, and the
+//images uploaded to the local blob store under /media/, the path of the
+//default STORE_BLOB_BASE_URL. Prometheus scrapes the metrics of the server
+//from /metrics. The rate limits of the configuration are kept in memory
+package main
+
+import (
+	"flag"
+	"net/http"
+
+	"github.com/roloum/store/api/internal/api"
+	"github.com/roloum/store/api/internal/app"
+	"github.com/roloum/store/api/internal/blob"
+	"github.com/roloum/store/api/internal/metrics"
+	"github.com/roloum/store/api/internal/ratelimit"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	//mediaPath path where the blob store is served
+	mediaPath = "/media/"
+
+	//metricsPath path where the metrics are served
+	metricsPath = "/metrics"
+)
+
+func main() {
+
+	addr := flag.String("addr", ":8080", "address the server listens on")
+	flag.Parse()
+
+	prometheus := metrics.NewPrometheus()
+
+	a, err := app.Load(app.WithRecorder(prometheus),
+		app.WithRateLimitStore(ratelimit.NewMemory()))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error loading application")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", api.Routes(a, append(api.Groups, api.Docs, api.Health)...))
+	mux.Handle(metricsPath, prometheus)
+
+	//Uploaded images are only supported when there is a blob directory
+	if a.Config.Blob.Dir != "" {
+		store, err := blob.NewLocal(a.Config.Blob.Dir, a.Config.Blob.BaseURL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error opening blob store")
+		}
+		mux.Handle(mediaPath, http.StripPrefix(mediaPath, store))
+	}
+
+	log.Info().Str("addr", *addr).Msg("Listening")
+
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		log.Fatal().Err(err).Msg("Error running server")
+	}
+}
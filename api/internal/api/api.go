@@ -0,0 +1,278 @@
+//Package api contains the endpoints of the store. The routes are declared
+//once, and served by the lambda functions and by the local HTTP server
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roloum/store/api/internal/app"
+	"github.com/roloum/store/api/internal/auth"
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/roloum/store/api/internal/ratelimit"
+	"github.com/roloum/store/api/internal/tracing"
+	"github.com/roloum/store/api/internal/web"
+)
+
+const (
+	//PathParamCartID parameter name for the cart_id
+	PathParamCartID = "cart_id"
+
+	//PathParamItemID parameter name for the item_id
+	PathParamItemID = "item_id"
+
+	//PathParamCategoryID parameter name for the category_id
+	PathParamCategoryID = "category_id"
+
+	//PathParamWishlistID parameter name for the wishlist_id
+	PathParamWishlistID = "wishlist_id"
+
+	//PathParamWebhookID parameter name for the webhook_id
+	PathParamWebhookID = "webhook_id"
+
+	//PathParamToken parameter name for the share token
+	PathParamToken = "token"
+
+	//QueryParamSKU parameter name for the SKU of an item variant
+	QueryParamSKU = "sku"
+
+	//QueryParamSearch parameter name for the search query
+	QueryParamSearch = "q"
+
+	//QueryParamLimit parameter name for the maximum number of results
+	QueryParamLimit = "limit"
+
+	//ErrRequestBodyContainsCartID error returned when adding item to existing
+	//cart and there is a cart_id in the body
+	ErrRequestBodyContainsCartID = "RequestBodyContainsCartID"
+
+	//ErrMissingRequestParameters error returned when request.Body is empty
+	ErrMissingRequestParameters = "MissingRequestParameters"
+)
+
+var (
+	//bodyErrors contains the errors of the routes with a request body
+	bodyErrors = web.Errors{
+		http.StatusBadRequest: {ErrMissingRequestParameters},
+	}
+
+	//adminErrors contains the errors of the routes that require the admin
+	//role
+	adminErrors = web.Errors{
+		http.StatusUnauthorized: {auth.ErrTokenIsMissing.Error()},
+		http.StatusForbidden:    {auth.ErrForbidden.Error()},
+	}
+)
+
+//Group adds a group of routes to the Router
+type Group func(r *web.Router, a *app.App)
+
+//Groups are all the groups of routes of the store
+var Groups = []Group{Cart, Item, Wishlist, Webhook}
+
+//Routes returns a Router with the routes of the groups. Requests can be
+//authenticated with a bearer token in every route, are traced when the App
+//has a Tracer and are rate limited when it has a Limiter
+func Routes(a *app.App, groups ...Group) *web.Router {
+
+	r := web.NewRouter()
+	r.AllowCORS(getCORS(a))
+	r.Use(trace(a.Tracer), authenticate(a.Verifier), limit(a.Limiter), correlate)
+	for _, g := range groups {
+		g(r, a)
+	}
+
+	return r
+}
+
+//getCORS returns the CORS policy of the configuration of the App. The
+//browsers can read the ID of the request of every response, and how long to
+//wait after a rate limited request
+func getCORS(a *app.App) web.CORS {
+	return web.CORS{
+		AllowedOrigins:   a.Config.CORS.AllowedOrigins,
+		AllowedMethods:   a.Config.CORS.AllowedMethods,
+		AllowedHeaders:   a.Config.CORS.AllowedHeaders,
+		ExposedHeaders:   []string{web.HeaderRequestID, web.HeaderRetryAfter},
+		MaxAge:           a.Config.CORS.MaxAge,
+		AllowCredentials: a.Config.CORS.AllowCredentials,
+	}
+}
+
+//Lambda returns the handler of a lambda function that serves the routes of
+//the groups. The App and the Router are built by the first invocation of
+//the container. When the App can not be built, the invocations fail, except
+//the health checks, so monitoring gets the error of the configuration
+func Lambda(groups ...Group) func(context.Context, events.APIGatewayProxyRequest) (
+	events.APIGatewayProxyResponse, error) {
+
+	var once sync.Once
+	var router, health *web.Router
+	var err error
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse, error) {
+
+		once.Do(func() {
+			var a *app.App
+			if a, err = app.Get(); err == nil {
+				router = Routes(a, groups...)
+				return
+			}
+			health = web.NewRouter()
+			Health(health, nil)
+		})
+		if err != nil {
+			response, herr := health.Serve(ctx, request)
+			if response.StatusCode == http.StatusNotFound {
+				return events.APIGatewayProxyResponse{}, err
+			}
+			return response, herr
+		}
+
+		return router.Serve(ctx, request)
+	}
+}
+
+//trace starts the span of the request, child of the span of the trace
+//context headers. The trace is added to the logger of the context
+func trace(tracer *tracing.Tracer) web.Middleware {
+	return func(next web.HandlerFunc) web.HandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest) (
+			events.APIGatewayProxyResponse, error) {
+
+			ctx, span := tracer.Start(ctx, request.HTTPMethod+" "+request.Resource,
+				tracing.Headers(request.Headers))
+			if span == nil {
+				return next(ctx, request)
+			}
+
+			ctx = logging.With(ctx, logging.FieldTraceID,
+				span.SpanContext().TraceID().String())
+			span.SetAttribute("http.method", request.HTTPMethod)
+			span.SetAttribute("http.route", request.Resource)
+			span.SetAttribute("http.target", request.Path)
+
+			response, err := next(ctx, request)
+
+			//The responses with a server error end the span with an error, the
+			//handlers return them without error
+			span.SetAttribute("http.status_code", response.StatusCode)
+			serr := err
+			if serr == nil && response.StatusCode >= http.StatusInternalServerError {
+				serr = errors.New(http.StatusText(response.StatusCode))
+			}
+			span.End(serr)
+
+			return response, err
+		}
+	}
+}
+
+//authenticate adds the user of the bearer token to the context. Requests
+//without token are anonymous, requests with an invalid token are rejected
+func authenticate(verifier *auth.Verifier) web.Middleware {
+	return func(next web.HandlerFunc) web.HandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest) (
+			events.APIGatewayProxyResponse, error) {
+
+			ctx, err := verifier.Authenticate(ctx, request.Headers)
+			if err != nil {
+				return web.GetResponse(ctx, err.Error(), http.StatusUnauthorized)
+			}
+
+			return next(ctx, request)
+		}
+	}
+}
+
+//limit rejects with 429 the requests of the clients that exceed the rate
+//limit of the route, or the requests to a cart that exceeds the limit of the
+//carts. The Retry-After header has the seconds until the request is allowed.
+//Requests are allowed when the buckets can not be read or updated, the
+//store is not taken down with the API
+func limit(limiter *ratelimit.Limiter) web.Middleware {
+	return func(next web.HandlerFunc) web.HandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest) (
+			events.APIGatewayProxyResponse, error) {
+
+			wait, err := limiter.Allow(ctx,
+				request.HTTPMethod+" "+request.Resource, getClient(ctx, request),
+				request.PathParameters[PathParamCartID])
+			switch err {
+			case nil:
+			case ratelimit.ErrRateLimitExceeded:
+				logging.Ctx(ctx).Warn().Dur("retry_after", wait).
+					Msg("Rate limit exceeded")
+				response, err := web.GetResponse(ctx, err.Error(),
+					http.StatusTooManyRequests)
+				response.Headers[web.HeaderRetryAfter] = strconv.Itoa(
+					int(math.Ceil(wait.Seconds())))
+				return response, err
+			default:
+				logging.Ctx(ctx).Error().Err(err).Msg("Error checking rate limit")
+			}
+
+			return next(ctx, request)
+		}
+	}
+}
+
+//getClient returns the key of the bucket of the client of the request: its
+//API Gateway API key, which is hashed so the table does not keep it, its user
+//or its source IP
+func getClient(ctx context.Context, request events.APIGatewayProxyRequest) string {
+
+	if key := request.RequestContext.Identity.APIKey; key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return "KEY#" + hex.EncodeToString(sum[:16])
+	}
+	if user := auth.UserID(ctx); user != "" {
+		return "USER#" + user
+	}
+
+	return "IP#" + request.RequestContext.Identity.SourceIP
+}
+
+//correlate adds the cart and the item of the path to the logger of the
+//context
+func correlate(next web.HandlerFunc) web.HandlerFunc {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse, error) {
+
+		ctx = logging.With(ctx, logging.FieldCartID,
+			request.PathParameters[PathParamCartID])
+		ctx = logging.With(ctx, logging.FieldItemID,
+			request.PathParameters[PathParamItemID])
+
+		return next(ctx, request)
+	}
+}
+
+//handleAdmin adds a route that requires a user with the admin role
+func handleAdmin(r *web.Router, method, path string, handler web.HandlerFunc) *web.Route {
+	return r.Handle(method, path, handler, admin).Secure().Fails(adminErrors)
+}
+
+//admin rejects the requests of users without the admin role
+func admin(next web.HandlerFunc) web.HandlerFunc {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse, error) {
+
+		switch err := auth.RequireRole(ctx, auth.RoleAdmin); err {
+		case auth.ErrTokenIsMissing:
+			return web.GetResponse(ctx, err.Error(), http.StatusUnauthorized)
+		case auth.ErrForbidden:
+			return web.GetResponse(ctx, err.Error(), http.StatusForbidden)
+		}
+
+		return next(ctx, request)
+	}
+}
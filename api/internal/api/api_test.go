@@ -0,0 +1,327 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roloum/store/api/internal/app"
+	"github.com/roloum/store/api/internal/config"
+	"github.com/roloum/store/api/internal/ratelimit"
+	"github.com/roloum/store/api/internal/test"
+	"github.com/roloum/store/api/internal/tracing"
+	"github.com/roloum/store/api/internal/web"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const (
+	//serverless path of the configuration of the lambda functions
+	serverless = "../../serverless.yml"
+
+	//specification path of the committed OpenAPI document
+	specification = "../../openapi.json"
+)
+
+func init() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	os.Setenv("STORE_AWS_DYNAMODB_TABLE_STORE", "Store")
+	os.Setenv("STORE_AWS_REGION", "us-west-2")
+}
+
+//getApp returns an App with a mock of the DynamoDB client
+func getApp(t *testing.T) *app.App {
+
+	var cfg config.Configuration
+	if err := config.Load(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := app.New(cfg, &test.MockDynamoDB{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a
+}
+
+//getFunctionRoutes returns the "METHOD /path" of the http events of every
+//function declared in serverless.yml
+func getFunctionRoutes(t *testing.T) map[string][]string {
+
+	f, err := os.Open(serverless)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	routes := map[string][]string{}
+	var function, path string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(line, "  ") && !strings.HasPrefix(line, "   ") &&
+			strings.HasSuffix(trimmed, ":"):
+			function = strings.TrimSuffix(trimmed, ":")
+		case strings.HasPrefix(trimmed, "path:"):
+			path = "/" + strings.TrimSpace(strings.TrimPrefix(trimmed, "path:"))
+		case strings.HasPrefix(trimmed, "method:"):
+			method := strings.TrimSpace(strings.TrimPrefix(trimmed, "method:"))
+			routes[function] = append(routes[function],
+				strings.ToUpper(method)+" "+path)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return routes
+}
+
+//TestRoutes tests that the routes of every group are the http events of its
+//lambda function, so API Gateway sends every route to the function that
+//serves it, along with the preflight requests of its paths
+func TestRoutes(t *testing.T) {
+
+	a := getApp(t)
+	functions := getFunctionRoutes(t)
+
+	tests := []struct {
+		function string
+		groups   []Group
+	}{
+		{"items", []Group{Item, Docs, Health}},
+		{"cart", []Group{Cart}},
+		{"wishlist", []Group{Wishlist}},
+		{"webhook", []Group{Webhook}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.function, func(t *testing.T) {
+
+			//The preflight requests of every path go to the function, which
+			//answers them with the CORS policy
+			var declared []string
+			preflight := map[string]bool{}
+			for _, r := range Routes(a, tc.groups...).Routes() {
+				declared = append(declared, r.Method+" "+r.Path)
+				if !preflight[r.Path] {
+					preflight[r.Path] = true
+					declared = append(declared, http.MethodOptions+" "+r.Path)
+				}
+			}
+
+			configured := functions[tc.function]
+			sort.Strings(declared)
+			sort.Strings(configured)
+
+			if strings.Join(declared, "\n") != strings.Join(configured, "\n") {
+				t.Errorf("Routes of %s do not match serverless.yml.\nRouter:\n%s\nserverless.yml:\n%s",
+					tc.function, strings.Join(declared, "\n"), strings.Join(configured, "\n"))
+			}
+		})
+	}
+}
+
+//TestDocument tests that the committed OpenAPI document is the document of
+//the routes, and that every route is described
+func TestDocument(t *testing.T) {
+
+	js, err := json.MarshalIndent(Document(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	js = append(js, '\n')
+
+	committed, err := ioutil.ReadFile(specification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(js, committed) {
+		t.Errorf("%s is not the document of the routes, run make openapi",
+			specification)
+	}
+
+	for _, r := range Routes(getApp(t), append(Groups, Docs, Health)...).Routes() {
+		if r.Summary == "" {
+			t.Errorf("Route %s %s does not have a summary", r.Method, r.Path)
+		}
+	}
+}
+
+//TestAdmin tests that the admin routes reject anonymous requests before
+//reaching the handlers
+func TestAdmin(t *testing.T) {
+
+	router := Routes(getApp(t), Groups...)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/admin/webhooks", http.StatusUnauthorized},
+		{http.MethodPost, "/admin/items/i1/prices", http.StatusUnauthorized},
+		{http.MethodPatch, "/cart/c1", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/carts", http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			response, err := router.Serve(context.Background(),
+				events.APIGatewayProxyRequest{HTTPMethod: tc.method, Path: tc.path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.StatusCode != tc.status {
+				t.Errorf("Expected: %d. Received: %d %s", tc.status,
+					response.StatusCode, response.Body)
+			}
+		})
+	}
+}
+
+//TestTrace tests that the spans of a request belong to the trace of its
+//traceparent header
+func TestTrace(t *testing.T) {
+
+	exported := tracetest.NewInMemoryExporter()
+	a := getApp(t)
+	a.Tracer = tracing.New(exported)
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	_, err := Routes(a, Groups...).Serve(context.Background(),
+		events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/cart/c1",
+			Headers: map[string]string{
+				"Traceparent": "00-" + traceID + "-00f067aa0ba902b7-01",
+			},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, s := range exported.GetSpans() {
+		if s.SpanContext.TraceID().String() != traceID {
+			t.Errorf("Span %s is not in the trace: %s", s.Name,
+				s.SpanContext.TraceID())
+		}
+		names = append(names, s.Name)
+	}
+
+	//The spans end before their parents
+	expected := []string{"dynamodb.Query", "cart.Load", "GET /cart/{cart_id}"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected: %v. Received: %v", expected, names)
+	}
+}
+
+//TestRateLimit tests that the requests of a client that exceed the limit of
+//the route are rejected with the Retry-After header
+func TestRateLimit(t *testing.T) {
+
+	a := getApp(t)
+	a.Limiter = ratelimit.New(ratelimit.NewMemory(),
+		ratelimit.WithRoute("GET /cart/{cart_id}", ratelimit.Limit{
+			Requests: 1, Period: time.Minute}))
+	router := Routes(a, Groups...)
+
+	tests := []struct {
+		desc   string
+		ip     string
+		apiKey string
+		status int
+	}{
+		{"Allowed", "192.0.2.1", "", http.StatusOK},
+		{"Exceeded", "192.0.2.1", "", http.StatusTooManyRequests},
+		{"OtherIP", "192.0.2.2", "", http.StatusOK},
+		{"APIKey", "192.0.2.1", "key", http.StatusOK},
+		{"APIKeyExceeded", "192.0.2.2", "key", http.StatusTooManyRequests},
+	}
+
+	for _, tc := range tests {
+		request := events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet,
+			Path: "/cart/c1"}
+		request.RequestContext.Identity.SourceIP = tc.ip
+		request.RequestContext.Identity.APIKey = tc.apiKey
+
+		response, err := router.Serve(context.Background(), request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != tc.status {
+			t.Errorf("%s: expected %d. Received: %d %s", tc.desc, tc.status,
+				response.StatusCode, response.Body)
+		}
+
+		retryAfter := response.Headers[web.HeaderRetryAfter]
+		if tc.status == http.StatusTooManyRequests && retryAfter != "60" {
+			t.Errorf("%s: expected Retry-After 60. Received: %q", tc.desc,
+				retryAfter)
+		}
+	}
+}
+
+//TestHealth tests the health checks and the build metadata
+func TestHealth(t *testing.T) {
+
+	unreachable := getApp(t)
+	unreachable.DynamoDB = &test.MockDynamoDB{
+		OutputError: errors.New("RequestError")}
+
+	tests := []struct {
+		desc     string
+		app      *app.App
+		path     string
+		status   int
+		expected string
+	}{
+		{"Health", getApp(t), "/health", http.StatusOK, `{"status":"ok"}`},
+		{"Ready", getApp(t), "/ready", http.StatusOK, `{"status":"ready"}`},
+		{"StoreIsUnreachable", unreachable, "/ready",
+			http.StatusServiceUnavailable, `"StoreIsUnreachable"`},
+		{"ConfigurationIsInvalid", nil, "/ready", http.StatusServiceUnavailable,
+			`"ConfigurationIsInvalid"`},
+		{"HealthWithoutApp", nil, "/health", http.StatusOK, `{"status":"ok"}`},
+		{"Version", getApp(t), "/version", http.StatusOK,
+			`{"version":"dev","go_version":"` + runtime.Version() + `"}`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+
+			router := web.NewRouter()
+			Health(router, tc.app)
+
+			response, err := router.Serve(context.Background(),
+				events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet,
+					Path: tc.path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.StatusCode != tc.status || response.Body != tc.expected {
+				t.Errorf("Expected: %d %s. Received: %d %s", tc.status, tc.expected,
+					response.StatusCode, response.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roloum/store/api/internal/app"
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/roloum/store/api/internal/store/cart"
+	"github.com/roloum/store/api/internal/web"
+)
+
+//cartAPI contains the endpoints of the cart Handler
+type cartAPI struct {
+	*cart.Handler
+}
+
+//mergeInfo contains the cart of the user that receives the guest cart
+type mergeInfo struct {
+	UserCartID string `json:"user_cart_id" validate:"required"`
+}
+
+//cartErrors contains the status of the errors of the cart Handler. The
+//errors that are not listed are server errors
+var cartErrors = web.Errors{
+	http.StatusBadRequest: {
+		cart.ErrCartIDIsEmpty, cart.ErrItemIDIsEmpty, cart.ErrDescriptionIsEmpty,
+		cart.ErrPriceIsEmpty, cart.ErrPriceIsInvalid, cart.ErrQuantityIsEmpty,
+		cart.ErrQuantityIsInvalid, cart.ErrQuantityLimitExceeded.Error(),
+		cart.ErrCreateCartWithExistingCartID.Error(), cart.ErrCartIsEmpty.Error(),
+		cart.ErrCartIsTooLarge.Error(), cart.ErrItemDoesNotExist.Error(),
+		cart.ErrItemIsOutOfStock.Error(), cart.ErrMergeCartIntoItself.Error(),
+		cart.ErrMergeActiveCartIntoAnonymousCart.Error(),
+	},
+	http.StatusUnauthorized: {cart.ErrUserIsAnonymous.Error()},
+	http.StatusForbidden:    {cart.ErrCartAccessDenied.Error()},
+	http.StatusNotFound: {
+		cart.ErrCartNotFound.Error(), cart.ErrShareTokenIsInvalid.Error(),
+		cart.ErrShareTokenIsExpired.Error(),
+	},
+	http.StatusConflict:       {cart.ErrActiveCartAlreadyExists.Error()},
+	http.StatusNotImplemented: {cart.ErrSharingIsNotConfigured.Error()},
+	http.StatusInternalServerError: {
+		cart.ErrCreateCart.Error(), cart.ErrCouldNotAddItem.Error(),
+		cart.ErrCouldNotUpdateItem.Error(), cart.ErrCouldNotDeleteItem.Error(),
+		cart.ErrCouldNotLoadItems.Error(), cart.ErrCouldNotLoadCart.Error(),
+		cart.ErrCouldNotMergeCarts.Error(), cart.ErrCouldNotLoadPrices.Error(),
+		cart.ErrCouldNotRepriceCart.Error(), cart.ErrCouldNotLoadActiveCart.Error(),
+	},
+}
+
+//Cart adds the routes of the shopping carts
+func Cart(r *web.Router, a *app.App) {
+
+	ch := cartAPI{a.Cart}
+
+	r.Handle(http.MethodGet, "/cart/{cart_id}", ch.getCart).
+		Doc("Returns the shopping cart").
+		Returns(http.StatusOK, cart.Cart{}).
+		Fails(cartErrors)
+	r.Handle(http.MethodGet, "/me/cart", ch.getActiveCart).
+		Doc("Returns the active cart of the user, creating it if the user does "+
+			"not have one").
+		Returns(http.StatusOK, cart.Cart{}).
+		Fails(cartErrors)
+	r.Handle(http.MethodPost, "/cart", ch.createCart).
+		Doc("Creates a shopping cart with its first item").
+		Accepts(cart.NewItemInfo{}, "cart_id").
+		Returns(http.StatusCreated, cart.Cart{}).
+		Fails(bodyErrors, cartErrors)
+	r.Handle(http.MethodPost, "/cart/{cart_id}", ch.addItem).
+		Doc("Adds an item to the shopping cart").
+		Accepts(cart.NewItemInfo{}).
+		Returns(http.StatusCreated, cart.Cart{}).
+		Fails(bodyErrors, web.Errors{
+			http.StatusBadRequest: {ErrRequestBodyContainsCartID},
+		}, cartErrors)
+	r.Handle(http.MethodPost, "/cart/{cart_id}/merge", ch.mergeCart).
+		Doc("Merges the guest cart into the cart of the user").
+		Accepts(mergeInfo{}).
+		Returns(http.StatusOK, cart.Cart{}).
+		Fails(bodyErrors, cartErrors)
+	r.Handle(http.MethodPost, "/cart/{cart_id}/reprice", ch.repriceCart).
+		Doc("Updates the lines of the cart to the current prices of the "+
+			"catalog, and deletes the lines of removed items").
+		Returns(http.StatusOK, cart.Cart{}).
+		Fails(cartErrors)
+	r.Handle(http.MethodPost, "/cart/{cart_id}/share", ch.shareCart).
+		Doc("Issues a token that grants read-only access to the cart").
+		Returns(http.StatusCreated, cart.SharedCart{}).
+		Fails(cartErrors)
+	r.Handle(http.MethodGet, "/shared-carts/{token}", ch.getSharedCart).
+		Doc("Returns the cart of a share token").
+		Returns(http.StatusOK, cart.Cart{}).
+		Fails(cartErrors)
+	r.Handle(http.MethodPost, "/shared-carts/{token}/clone", ch.cloneSharedCart).
+		Doc("Copies the cart of a share token into a new cart of the caller, "+
+			"which does not become their active cart").
+		Returns(http.StatusCreated, cart.Cart{}).
+		Fails(cartErrors)
+	r.Handle(http.MethodPatch, "/cart/{cart_id}/items/{item_id}", ch.updateItem).
+		Doc("Updates the quantity of an item of the cart").
+		WithQuery(QueryParamSKU, "").
+		Accepts(cart.UpdateItemInfo{}).
+		Returns(http.StatusOK, cart.Cart{}).
+		Fails(bodyErrors, cartErrors)
+	r.Handle(http.MethodDelete, "/cart/{cart_id}/items/{item_id}", ch.deleteItem).
+		Doc("Deletes an item from the cart").
+		WithQuery(QueryParamSKU, "").
+		Returns(http.StatusOK, cart.Cart{}).
+		Fails(cartErrors)
+}
+
+//createCart Creates a shopping cart with its first item
+func (ch cartAPI) createCart(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	if request.Body == "" {
+		return web.GetResponse(ctx, ErrMissingRequestParameters, http.StatusBadRequest)
+	}
+
+	var newItem cart.NewItemInfo
+	err := json.Unmarshal([]byte(request.Body), &newItem)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error unmarshalling JSON")
+		return web.GetResponse(ctx, err.Error(), http.StatusInternalServerError)
+	}
+
+	shoppingCart, err := ch.CreateAndAddItem(ctx, &newItem)
+	if err != nil {
+		return getCartErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, shoppingCart, http.StatusCreated)
+}
+
+//addItem Adds a item to the shopping cart request.PathParameters["cart_id"]
+func (ch cartAPI) addItem(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	if request.Body == "" {
+		return web.GetResponse(ctx, ErrMissingRequestParameters, http.StatusBadRequest)
+	}
+
+	var newItem cart.NewItemInfo
+	err := json.Unmarshal([]byte(request.Body), &newItem)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error unmarshalling JSON")
+		return web.GetResponse(ctx, err.Error(), http.StatusInternalServerError)
+	}
+
+	//If cart_id is set in the path and body, return error
+	if newItem.CartID != "" {
+		return web.GetResponse(ctx, ErrRequestBodyContainsCartID,
+			http.StatusBadRequest)
+	}
+	newItem.CartID = request.PathParameters[PathParamCartID]
+
+	shoppingCart, err := ch.AddItem(ctx, &newItem)
+	if err != nil {
+		return getCartErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, shoppingCart, http.StatusCreated)
+}
+
+//updateItem Udpdates the quantity for item request.PathParameters["item_id"]
+//in cartId request.PathParameters["cart_id"]
+func (ch cartAPI) updateItem(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	if request.Body == "" {
+		return web.GetResponse(ctx, ErrMissingRequestParameters, http.StatusBadRequest)
+	}
+
+	//Unmarshal the request body
+	var updateItem cart.UpdateItemInfo
+	err := json.Unmarshal([]byte(request.Body), &updateItem)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error unmarshalling JSON")
+		return web.GetResponse(ctx, err.Error(), http.StatusInternalServerError)
+	}
+
+	//Add parameters to the updateItem struct
+	updateItem.CartID = request.PathParameters[PathParamCartID]
+	updateItem.ItemID = request.PathParameters[PathParamItemID]
+	if sku, ok := request.QueryStringParameters[QueryParamSKU]; ok {
+		updateItem.SKU = sku
+	}
+
+	shoppingCart, err := ch.UpdateItem(ctx, &updateItem)
+	if err != nil {
+		return getCartErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, shoppingCart, http.StatusOK)
+
+}
+
+//deleteItem Deletes item request.PathParameters["itemId"]
+//from cartId request.PathParameters["cartId"]
+func (ch cartAPI) deleteItem(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	var deleteItem cart.DeleteItemInfo
+	//Add parameters to the updateItem struct
+	deleteItem.CartID = request.PathParameters[PathParamCartID]
+	deleteItem.ItemID = request.PathParameters[PathParamItemID]
+	deleteItem.SKU = request.QueryStringParameters[QueryParamSKU]
+
+	shoppingCart, err := ch.DeleteItem(ctx, &deleteItem)
+	if err != nil {
+		return getCartErrorResponse(ctx, err)
+	}
+	return web.GetResponse(ctx, shoppingCart, http.StatusOK)
+}
+
+//mergeCart Merges the guest cart request.PathParameters["cart_id"] into the
+//cart of the user, user_cart_id in the body
+func (ch cartAPI) mergeCart(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	if request.Body == "" {
+		return web.GetResponse(ctx, ErrMissingRequestParameters, http.StatusBadRequest)
+	}
+
+	var merge mergeInfo
+	err := json.Unmarshal([]byte(request.Body), &merge)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error unmarshalling JSON")
+		return web.GetResponse(ctx, err.Error(), http.StatusBadRequest)
+	}
+
+	shoppingCart, err := ch.Merge(ctx, request.PathParameters[PathParamCartID],
+		merge.UserCartID)
+	if err != nil {
+		return getCartErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, shoppingCart, http.StatusOK)
+}
+
+//repriceCart Updates the lines of the cart request.PathParameters["cart_id"]
+//to the current prices of the catalog and deletes the lines of removed items
+func (ch cartAPI) repriceCart(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	shoppingCart, err := ch.Reprice(ctx, request.PathParameters[PathParamCartID])
+	if err != nil {
+		return getCartErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, shoppingCart, http.StatusOK)
+}
+
+//getCart Returns the information of the shopping cart. The shopping cart id
+//is in the path parameters
+func (ch cartAPI) getCart(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	shoppingCart, err := ch.Load(ctx, request.PathParameters[PathParamCartID])
+	if err != nil {
+		return getCartErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, shoppingCart, http.StatusOK)
+}
+
+//getActiveCart Returns the active cart of the authenticated user, creating it
+//if the user does not have one
+func (ch cartAPI) getActiveCart(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	shoppingCart, err := ch.ActiveCart(ctx)
+	if err != nil {
+		return getCartErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, shoppingCart, http.StatusOK)
+}
+
+//shareCart Issues a token that grants read-only access to the cart
+//request.PathParameters["cart_id"]
+func (ch cartAPI) shareCart(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	shared, err := ch.Share(ctx, request.PathParameters[PathParamCartID])
+	if err != nil {
+		return getCartErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, shared, http.StatusCreated)
+}
+
+//getSharedCart Returns the cart of the share token
+//request.PathParameters["token"]
+func (ch cartAPI) getSharedCart(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	shoppingCart, err := ch.LoadShared(ctx, request.PathParameters[PathParamToken])
+	if err != nil {
+		return getCartErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, shoppingCart, http.StatusOK)
+}
+
+//cloneSharedCart Copies the cart of the share token
+//request.PathParameters["token"] into a new cart of the caller
+func (ch cartAPI) cloneSharedCart(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	shoppingCart, err := ch.CloneShared(ctx, request.PathParameters[PathParamToken])
+	if err != nil {
+		return getCartErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, shoppingCart, http.StatusCreated)
+}
+
+//getCartErrorResponse returns the response for the errors of the cart
+//Handler. Carts of other users are forbidden
+func getCartErrorResponse(ctx context.Context, err error) (
+	events.APIGatewayProxyResponse, error) {
+
+	//The limit errors describe the limit that was exceeded
+	if errors.Is(err, cart.ErrQuantityLimitExceeded) {
+		return web.GetResponse(ctx, err.Error(), http.StatusBadRequest)
+	}
+
+	return web.GetErrorResponse(ctx, err, cartErrors,
+		http.StatusInternalServerError)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roloum/store/api/internal/app"
+	"github.com/roloum/store/api/internal/build"
+	"github.com/roloum/store/api/internal/web"
+)
+
+const (
+	//StatusOK status of the health check of a running process
+	StatusOK = "ok"
+
+	//StatusReady status of the readiness check of a process that can serve
+	//the requests
+	StatusReady = "ready"
+)
+
+var (
+	//ErrConfigurationIsInvalid error returned by the readiness check when the
+	//App could not be built from the configuration
+	ErrConfigurationIsInvalid = errors.New("ConfigurationIsInvalid")
+
+	//readyErrors contains the errors of the readiness check
+	readyErrors = web.Errors{
+		http.StatusServiceUnavailable: {ErrConfigurationIsInvalid.Error(),
+			app.ErrStoreIsUnreachable.Error()},
+	}
+)
+
+//Status is the response of the health checks
+type Status struct {
+	Status string `json:"status"`
+}
+
+//Health adds the routes of the health checks and of the build metadata, so
+//monitoring can check the API without reading or writing carts. A nil App
+//is an App that could not be built from the configuration, which is not
+//ready
+func Health(r *web.Router, a *app.App) {
+
+	r.Handle(http.MethodGet, "/health", getHealth).
+		Doc("Returns ok while the process is running").
+		Returns(http.StatusOK, Status{})
+
+	r.Handle(http.MethodGet, "/ready", getReady(a)).
+		Doc("Returns ready when the configuration is valid and the store table "+
+			"can be read").
+		Returns(http.StatusOK, Status{}).
+		Fails(readyErrors)
+
+	r.Handle(http.MethodGet, "/version", getVersion).
+		Doc("Returns the version, commit and date of the build").
+		Returns(http.StatusOK, build.Info{})
+}
+
+//getHealth Returns the status of a running process
+func getHealth(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return web.GetResponse(ctx, Status{Status: StatusOK}, http.StatusOK)
+}
+
+//getReady returns the handler of the readiness check of the App
+func getReady(a *app.App) web.HandlerFunc {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse, error) {
+
+		if a == nil {
+			return web.GetErrorResponse(ctx, ErrConfigurationIsInvalid, readyErrors,
+				http.StatusServiceUnavailable)
+		}
+
+		if err := a.Ready(ctx); err != nil {
+			return web.GetErrorResponse(ctx, err, readyErrors,
+				http.StatusServiceUnavailable)
+		}
+
+		return web.GetResponse(ctx, Status{Status: StatusReady}, http.StatusOK)
+	}
+}
+
+//getVersion Returns the metadata of the build
+func getVersion(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	return web.GetResponse(ctx, build.Get(), http.StatusOK)
+}
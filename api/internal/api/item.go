@@ -0,0 +1,258 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roloum/store/api/internal/app"
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/roloum/store/api/internal/store/item"
+	"github.com/roloum/store/api/internal/store/search"
+	"github.com/roloum/store/api/internal/web"
+)
+
+//itemAPI contains the endpoints of the item Handler and the search
+type itemAPI struct {
+	*item.Handler
+	search *search.Handler
+}
+
+var (
+	//itemErrors contains the status of the errors of the item routes
+	itemErrors = web.Errors{
+		http.StatusNotFound: {item.ErrItemNotFound.Error()},
+		http.StatusInternalServerError: {
+			item.ErrCouldNotLoadItem.Error(), item.ErrCouldNotLoadPrices.Error(),
+		},
+	}
+
+	//searchErrors contains the status of the errors of the search
+	searchErrors = web.Errors{
+		http.StatusBadRequest: {
+			search.ErrQueryIsEmpty.Error(), search.ErrLimitIsInvalid.Error(),
+		},
+		http.StatusInternalServerError: {search.ErrCouldNotBuildIndex.Error()},
+	}
+
+	//mediaErrors contains the status of the errors of the media routes.
+	//Only storage errors are server errors
+	mediaErrors = web.Errors{
+		http.StatusBadRequest: {
+			item.ErrItemIDIsEmpty.Error(), item.ErrMediaSourceIsEmpty,
+			item.ErrMediaURLIsInvalid, item.ErrContentTypeIsEmpty,
+			item.ErrContentTypeIsInvalid.Error(), item.ErrAltIsEmpty,
+			item.ErrMediaSizeIsInvalid, item.ErrMediaRoleIsInvalid,
+			item.ErrMediaIDsAreInvalid,
+		},
+		http.StatusNotFound:       {item.ErrItemNotFound.Error()},
+		http.StatusNotImplemented: {item.ErrBlobStoreIsNotConfigured.Error()},
+		http.StatusInternalServerError: {
+			item.ErrCouldNotLoadItem.Error(), item.ErrCouldNotAttachMedia.Error(),
+			item.ErrCouldNotReorderMedia.Error(),
+		},
+	}
+
+	//priceErrors contains the status of the errors of the scheduled prices.
+	//Only storage errors are server errors
+	priceErrors = web.Errors{
+		http.StatusBadRequest: {
+			item.ErrItemIDIsEmpty.Error(), item.ErrPriceIsEmpty,
+			item.ErrPriceIsInvalid, item.ErrEffectiveFromIsInThePast,
+			item.ErrEffectiveFromIsDuplicated, item.ErrEffectiveToIsInvalid,
+		},
+		http.StatusNotFound: {item.ErrItemNotFound.Error()},
+		http.StatusInternalServerError: {
+			item.ErrCouldNotSchedulePrice.Error(), item.ErrCouldNotLoadPrices.Error(),
+			item.ErrCouldNotLoadItem.Error(),
+		},
+	}
+)
+
+//Item adds the routes of the catalog. The catalog is public, only the admin
+//endpoints require a user
+func Item(r *web.Router, a *app.App) {
+
+	ih := itemAPI{a.Item, a.Search}
+
+	r.Handle(http.MethodGet, "/items/{category_id}", ih.getItems).
+		Doc("Returns the items of a category").
+		Returns(http.StatusOK, item.List{}).
+		Fails(web.Errors{
+			http.StatusInternalServerError: {item.ErrCouldNotLoadItems.Error()},
+		})
+	r.Handle(http.MethodGet, "/item/{item_id}", ih.getItem).
+		Doc("Returns an item along with its variants").
+		Returns(http.StatusOK, item.Item{}).
+		Fails(itemErrors)
+	r.Handle(http.MethodGet, "/item/{item_id}/prices", ih.getPrices).
+		Doc("Returns the current, past and scheduled prices of an item").
+		Returns(http.StatusOK, item.PriceHistory{}).
+		Fails(itemErrors)
+	r.Handle(http.MethodGet, "/search", ih.searchItems).
+		Doc("Searches the catalog by description and attributes").
+		WithQuery(QueryParamSearch, "").
+		WithQuery(QueryParamLimit, 0).
+		Returns(http.StatusOK, search.Results{}).
+		Fails(searchErrors)
+	handleAdmin(r, http.MethodPost, "/admin/items/{item_id}/media", ih.attachMedia).
+		Doc("Attaches an image to an item, from a URL or uploaded in the "+
+			"content").
+		Accepts(item.NewMediaInfo{}).
+		Returns(http.StatusCreated, item.Item{}).
+		Fails(bodyErrors, mediaErrors)
+	handleAdmin(r, http.MethodPut, "/admin/items/{item_id}/media", ih.reorderMedia).
+		Doc("Sets the display order of the images of an item").
+		Accepts(item.ReorderMediaInfo{}).
+		Returns(http.StatusOK, item.Item{}).
+		Fails(bodyErrors, mediaErrors)
+	handleAdmin(r, http.MethodPost, "/admin/items/{item_id}/prices",
+		ih.schedulePrice).
+		Doc("Schedules a price change or a sale of an item").
+		Accepts(item.NewPriceInfo{}).
+		Returns(http.StatusCreated, item.PriceHistory{}).
+		Fails(bodyErrors, priceErrors)
+}
+
+//getItems Returns the list of items
+func (ih itemAPI) getItems(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	var list *item.List
+
+	list, err := ih.List(ctx, request.PathParameters[PathParamCategoryID])
+	if err != nil {
+		return web.GetResponse(ctx, err.Error(), http.StatusInternalServerError)
+	}
+
+	return web.GetResponse(ctx, list, http.StatusOK)
+}
+
+//getItem Returns the information of an item along with its variant matrix
+func (ih itemAPI) getItem(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	i, err := ih.Get(ctx, request.PathParameters[PathParamItemID])
+	if err != nil {
+		return web.GetErrorResponse(ctx, err, itemErrors,
+			http.StatusInternalServerError)
+	}
+
+	return web.GetResponse(ctx, i, http.StatusOK)
+}
+
+//getPrices Returns the current price of item request.PathParameters["item_id"]
+//along with its past and scheduled prices
+func (ih itemAPI) getPrices(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	history, err := ih.Prices(ctx, request.PathParameters[PathParamItemID])
+	if err != nil {
+		return web.GetErrorResponse(ctx, err, itemErrors,
+			http.StatusInternalServerError)
+	}
+
+	return web.GetResponse(ctx, history, http.StatusOK)
+}
+
+//schedulePrice Stores a new price for item request.PathParameters["item_id"]
+func (ih itemAPI) schedulePrice(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	if request.Body == "" {
+		return web.GetResponse(ctx, ErrMissingRequestParameters, http.StatusBadRequest)
+	}
+
+	var newPrice item.NewPriceInfo
+	err := json.Unmarshal([]byte(request.Body), &newPrice)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error unmarshalling JSON")
+		return web.GetResponse(ctx, err.Error(), http.StatusBadRequest)
+	}
+	newPrice.ItemID = request.PathParameters[PathParamItemID]
+
+	history, err := ih.SchedulePrice(ctx, &newPrice)
+	if err != nil {
+		return web.GetErrorResponse(ctx, err, priceErrors, http.StatusBadRequest)
+	}
+
+	return web.GetResponse(ctx, history, http.StatusCreated)
+}
+
+//attachMedia Adds an image to item request.PathParameters["item_id"]
+func (ih itemAPI) attachMedia(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	if request.Body == "" {
+		return web.GetResponse(ctx, ErrMissingRequestParameters, http.StatusBadRequest)
+	}
+
+	var newMedia item.NewMediaInfo
+	err := json.Unmarshal([]byte(request.Body), &newMedia)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error unmarshalling JSON")
+		return web.GetResponse(ctx, err.Error(), http.StatusBadRequest)
+	}
+	newMedia.ItemID = request.PathParameters[PathParamItemID]
+
+	i, err := ih.AttachMedia(ctx, &newMedia)
+	if err != nil {
+		return getMediaErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, i, http.StatusCreated)
+}
+
+//reorderMedia Sets the display order of the images of item
+//request.PathParameters["item_id"]
+func (ih itemAPI) reorderMedia(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	if request.Body == "" {
+		return web.GetResponse(ctx, ErrMissingRequestParameters, http.StatusBadRequest)
+	}
+
+	var reorder item.ReorderMediaInfo
+	err := json.Unmarshal([]byte(request.Body), &reorder)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error unmarshalling JSON")
+		return web.GetResponse(ctx, err.Error(), http.StatusBadRequest)
+	}
+	reorder.ItemID = request.PathParameters[PathParamItemID]
+
+	i, err := ih.ReorderMedia(ctx, &reorder)
+	if err != nil {
+		return getMediaErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, i, http.StatusOK)
+}
+
+//getMediaErrorResponse returns the response for the errors of the media
+//endpoints
+func getMediaErrorResponse(ctx context.Context, err error) (
+	events.APIGatewayProxyResponse, error) {
+
+	return web.GetErrorResponse(ctx, err, mediaErrors, http.StatusBadRequest)
+}
+
+//searchItems Returns the items matching the query string parameter "q"
+func (ih itemAPI) searchItems(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	limit, err := web.QueryInt(request, QueryParamLimit, 0)
+	if err != nil {
+		return web.GetResponse(ctx, search.ErrLimitIsInvalid.Error(),
+			http.StatusBadRequest)
+	}
+
+	results, err := ih.search.Search(ctx,
+		request.QueryStringParameters[QueryParamSearch], limit)
+	if err != nil {
+		return web.GetErrorResponse(ctx, err, searchErrors,
+			http.StatusInternalServerError)
+	}
+
+	return web.GetResponse(ctx, results, http.StatusOK)
+}
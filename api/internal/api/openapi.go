@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roloum/store/api/internal/app"
+	"github.com/roloum/store/api/internal/openapi"
+	"github.com/roloum/store/api/internal/web"
+)
+
+const (
+	//Title title of the OpenAPI document
+	Title = "Store API"
+
+	//Version version of the API in the OpenAPI document
+	Version = "1.0.0"
+)
+
+var (
+	//documentOnce builds the document on the first request of the container
+	documentOnce sync.Once
+	document     *openapi.Document
+)
+
+//Docs adds the route of the OpenAPI document. The document describes the
+//routes of every group, whatever the groups served with it
+func Docs(r *web.Router, a *app.App) {
+
+	r.Handle(http.MethodGet, "/openapi.json", getDocument).
+		Doc("Returns the OpenAPI document of the API").
+		Returns(http.StatusOK, map[string]interface{}{})
+}
+
+//Document returns the OpenAPI document of the routes of the store. The
+//schemas of the bodies are built from the types of the routes, and the
+//constraints from their validate tags
+func Document() *openapi.Document {
+
+	groups := append([]Group{}, Groups...)
+	groups = append(groups, Docs, Health)
+
+	//The handlers are not called, so the routes do not need the dependencies
+	//of the App
+	routes := Routes(&app.App{}, groups...).Routes()
+
+	g := openapi.New(
+		openapi.Info{
+			Title: Title,
+			Description: "Shopping carts, wishlists and catalog of the store. The " +
+				"errors are returned as a JSON string with the error code",
+			Version: Version,
+		},
+		openapi.WithConstraint("validPrice", openapi.Minimum(0)),
+		openapi.WithConstraint("validQuantity", openapi.Minimum(1)),
+	)
+
+	return g.Document(routes)
+}
+
+//getDocument Returns the OpenAPI document
+func getDocument(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	documentOnce.Do(func() {
+		document = Document()
+	})
+
+	return web.GetResponse(ctx, document, http.StatusOK)
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roloum/store/api/internal/app"
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/roloum/store/api/internal/web"
+	"github.com/roloum/store/api/internal/webhook"
+)
+
+//webhookAPI contains the endpoints of the webhook Handler
+type webhookAPI struct {
+	*webhook.Handler
+}
+
+//webhookErrors contains the status of the errors of the webhook Handler
+var webhookErrors = web.Errors{
+	http.StatusBadRequest: {
+		webhook.ErrWebhookIDIsEmpty.Error(), webhook.ErrURLIsInvalid,
+		webhook.ErrEventTypeIsInvalid, webhook.ErrSecretIsTooShort,
+	},
+	http.StatusNotFound: {webhook.ErrWebhookNotFound.Error()},
+	http.StatusInternalServerError: {
+		webhook.ErrCouldNotCreateWebhook.Error(),
+		webhook.ErrCouldNotLoadWebhooks.Error(),
+		webhook.ErrCouldNotDeleteWebhook.Error(),
+		webhook.ErrCouldNotLoadDeliveries.Error(),
+	},
+}
+
+//Webhook adds the routes of the webhook subscriptions. Every webhook
+//endpoint is an admin endpoint
+func Webhook(r *web.Router, a *app.App) {
+
+	wh := webhookAPI{a.Webhook}
+
+	handleAdmin(r, http.MethodGet, "/admin/webhooks", wh.getWebhooks).
+		Doc("Returns the webhook subscriptions, without their secrets").
+		Returns(http.StatusOK, webhook.List{}).
+		Fails(webhookErrors)
+	handleAdmin(r, http.MethodPost, "/admin/webhooks", wh.createWebhook).
+		Doc("Creates a webhook subscription. The response contains the secret "+
+			"that signs the deliveries").
+		Accepts(webhook.NewSubscriptionInfo{}).
+		Returns(http.StatusCreated, webhook.Subscription{}).
+		Fails(bodyErrors, webhookErrors)
+	handleAdmin(r, http.MethodDelete, "/admin/webhooks/{webhook_id}",
+		wh.deleteWebhook).
+		Doc("Deletes a webhook subscription").
+		Returns(http.StatusOK, struct{}{}).
+		Fails(webhookErrors)
+	handleAdmin(r, http.MethodGet, "/admin/webhooks/{webhook_id}/deliveries",
+		wh.getDeliveries).
+		Doc("Returns the latest delivery attempts of a webhook").
+		Returns(http.StatusOK, webhook.Deliveries{}).
+		Fails(webhookErrors)
+}
+
+//getWebhooks Returns the webhook subscriptions
+func (wh webhookAPI) getWebhooks(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	list, err := wh.List(ctx)
+	if err != nil {
+		return web.GetErrorResponse(ctx, err, webhookErrors,
+			http.StatusInternalServerError)
+	}
+
+	return web.GetResponse(ctx, list, http.StatusOK)
+}
+
+//createWebhook Creates a webhook subscription. The response contains the
+//secret that signs the deliveries
+func (wh webhookAPI) createWebhook(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	if request.Body == "" {
+		return web.GetResponse(ctx, ErrMissingRequestParameters, http.StatusBadRequest)
+	}
+
+	var ns webhook.NewSubscriptionInfo
+	err := json.Unmarshal([]byte(request.Body), &ns)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error unmarshalling JSON")
+		return web.GetResponse(ctx, err.Error(), http.StatusBadRequest)
+	}
+
+	s, err := wh.Create(ctx, &ns)
+	if err != nil {
+		return web.GetErrorResponse(ctx, err, webhookErrors, http.StatusBadRequest)
+	}
+
+	return web.GetResponse(ctx, s, http.StatusCreated)
+}
+
+//deleteWebhook Deletes webhook request.PathParameters["webhook_id"]
+func (wh webhookAPI) deleteWebhook(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	err := wh.Delete(ctx, request.PathParameters[PathParamWebhookID])
+	if err != nil {
+		return web.GetErrorResponse(ctx, err, webhookErrors,
+			http.StatusInternalServerError)
+	}
+
+	return web.GetResponse(ctx, struct{}{}, http.StatusOK)
+}
+
+//getDeliveries Returns the latest delivery attempts of webhook
+//request.PathParameters["webhook_id"]
+func (wh webhookAPI) getDeliveries(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	d, err := wh.Deliveries(ctx, request.PathParameters[PathParamWebhookID])
+	if err != nil {
+		return web.GetErrorResponse(ctx, err, webhookErrors,
+			http.StatusInternalServerError)
+	}
+
+	return web.GetResponse(ctx, d, http.StatusOK)
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roloum/store/api/internal/app"
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/roloum/store/api/internal/store/cart"
+	"github.com/roloum/store/api/internal/store/wishlist"
+	"github.com/roloum/store/api/internal/web"
+)
+
+//wishlistAPI contains the endpoints of the wishlist Handler
+type wishlistAPI struct {
+	*wishlist.Handler
+}
+
+//wishlistErrors contains the status of the errors of the wishlist Handler.
+//Only storage errors are server errors
+var wishlistErrors = web.Errors{
+	http.StatusBadRequest: {
+		wishlist.ErrWishlistIDIsEmpty, wishlist.ErrCartIDIsEmpty,
+		wishlist.ErrItemIDIsEmpty, wishlist.ErrNameIsEmpty, wishlist.ErrNameIsTooLong,
+		wishlist.ErrQuantityIsInvalid, wishlist.ErrItemDoesNotExist.Error(),
+		cart.ErrQuantityLimitExceeded.Error(), cart.ErrItemIsOutOfStock.Error(),
+	},
+	http.StatusUnauthorized: {wishlist.ErrUserIsAnonymous.Error()},
+	http.StatusForbidden:    {cart.ErrCartAccessDenied.Error()},
+	http.StatusNotFound: {
+		wishlist.ErrWishlistNotFound.Error(), wishlist.ErrItemNotInCart.Error(),
+		wishlist.ErrItemNotInWishlist.Error(), cart.ErrCartNotFound.Error(),
+	},
+	http.StatusInternalServerError: {
+		wishlist.ErrCouldNotCreateWishlist.Error(),
+		wishlist.ErrCouldNotLoadWishlists.Error(),
+		wishlist.ErrCouldNotLoadWishlist.Error(), wishlist.ErrCouldNotAddItem.Error(),
+		wishlist.ErrCouldNotDeleteItem.Error(), wishlist.ErrCouldNotMoveItem.Error(),
+		cart.ErrCouldNotLoadItems.Error(), cart.ErrCouldNotLoadCart.Error(),
+	},
+}
+
+//Wishlist adds the routes of the wishlists, including saving a cart line
+//for later
+func Wishlist(r *web.Router, a *app.App) {
+
+	wh := wishlistAPI{a.Wishlist}
+
+	r.Handle(http.MethodGet, "/wishlists", wh.getWishlists).
+		Doc("Returns the wishlists of the user").
+		Returns(http.StatusOK, wishlist.List{}).
+		Fails(wishlistErrors)
+	r.Handle(http.MethodPost, "/wishlists", wh.createWishlist).
+		Doc("Creates a wishlist for the user").
+		Accepts(wishlist.NewWishlistInfo{}).
+		Returns(http.StatusCreated, wishlist.Wishlist{}).
+		Fails(bodyErrors, wishlistErrors)
+	r.Handle(http.MethodGet, "/wishlists/{wishlist_id}", wh.getWishlist).
+		Doc("Returns a wishlist with the current price of its items").
+		Returns(http.StatusOK, wishlist.Wishlist{}).
+		Fails(wishlistErrors)
+	r.Handle(http.MethodPost, "/wishlists/{wishlist_id}", wh.addItem).
+		Doc("Saves an item in the wishlist").
+		Accepts(wishlist.NewItemInfo{}).
+		Returns(http.StatusCreated, wishlist.Wishlist{}).
+		Fails(bodyErrors, wishlistErrors)
+	r.Handle(http.MethodDelete, "/wishlists/{wishlist_id}/items/{item_id}",
+		wh.deleteItem).
+		Doc("Deletes an item from the wishlist").
+		WithQuery(QueryParamSKU, "").
+		Returns(http.StatusOK, wishlist.Wishlist{}).
+		Fails(wishlistErrors)
+	r.Handle(http.MethodPost, "/wishlists/{wishlist_id}/items/{item_id}/cart",
+		wh.moveToCart).
+		Doc("Moves an item from the wishlist to a cart").
+		WithQuery(QueryParamSKU, "").
+		Accepts(wishlist.MoveItemInfo{}).
+		Returns(http.StatusOK, wishlist.Move{}).
+		Fails(bodyErrors, wishlistErrors)
+	r.Handle(http.MethodPost, "/cart/{cart_id}/items/{item_id}/save",
+		wh.saveForLater).
+		Doc("Moves an item from the cart to a wishlist").
+		WithQuery(QueryParamSKU, "").
+		Accepts(wishlist.MoveItemInfo{}).
+		Returns(http.StatusOK, wishlist.Move{}).
+		Fails(bodyErrors, wishlistErrors)
+}
+
+//getWishlists Returns the wishlists of the user
+func (wh wishlistAPI) getWishlists(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	list, err := wh.Lists(ctx)
+	if err != nil {
+		return getWishlistErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, list, http.StatusOK)
+}
+
+//getWishlist Returns the wishlist request.PathParameters["wishlist_id"] with
+//the current price of its items
+func (wh wishlistAPI) getWishlist(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	w, err := wh.Load(ctx, request.PathParameters[PathParamWishlistID])
+	if err != nil {
+		return getWishlistErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, w, http.StatusOK)
+}
+
+//createWishlist Creates a wishlist for the user
+func (wh wishlistAPI) createWishlist(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	if request.Body == "" {
+		return web.GetResponse(ctx, ErrMissingRequestParameters, http.StatusBadRequest)
+	}
+
+	var newWishlist wishlist.NewWishlistInfo
+	err := json.Unmarshal([]byte(request.Body), &newWishlist)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error unmarshalling JSON")
+		return web.GetResponse(ctx, err.Error(), http.StatusBadRequest)
+	}
+
+	w, err := wh.Create(ctx, &newWishlist)
+	if err != nil {
+		return getWishlistErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, w, http.StatusCreated)
+}
+
+//addItem Saves an item in the wishlist request.PathParameters["wishlist_id"]
+func (wh wishlistAPI) addItem(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	if request.Body == "" {
+		return web.GetResponse(ctx, ErrMissingRequestParameters, http.StatusBadRequest)
+	}
+
+	var newItem wishlist.NewItemInfo
+	err := json.Unmarshal([]byte(request.Body), &newItem)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error unmarshalling JSON")
+		return web.GetResponse(ctx, err.Error(), http.StatusBadRequest)
+	}
+	newItem.WishlistID = request.PathParameters[PathParamWishlistID]
+
+	w, err := wh.AddItem(ctx, &newItem)
+	if err != nil {
+		return getWishlistErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, w, http.StatusCreated)
+}
+
+//deleteItem Deletes item request.PathParameters["item_id"] from wishlist
+//request.PathParameters["wishlist_id"]
+func (wh wishlistAPI) deleteItem(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	w, err := wh.DeleteItem(ctx, &wishlist.DeleteItemInfo{
+		WishlistID: request.PathParameters[PathParamWishlistID],
+		ItemID:     request.PathParameters[PathParamItemID],
+		SKU:        request.QueryStringParameters[QueryParamSKU],
+	})
+	if err != nil {
+		return getWishlistErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, w, http.StatusOK)
+}
+
+//moveToCart Moves item request.PathParameters["item_id"] from wishlist
+//request.PathParameters["wishlist_id"] to cart_id in the body
+func (wh wishlistAPI) moveToCart(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	if request.Body == "" {
+		return web.GetResponse(ctx, ErrMissingRequestParameters, http.StatusBadRequest)
+	}
+
+	var move wishlist.MoveItemInfo
+	err := json.Unmarshal([]byte(request.Body), &move)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error unmarshalling JSON")
+		return web.GetResponse(ctx, err.Error(), http.StatusBadRequest)
+	}
+	move.WishlistID = request.PathParameters[PathParamWishlistID]
+	move.ItemID = request.PathParameters[PathParamItemID]
+	move.SKU = request.QueryStringParameters[QueryParamSKU]
+
+	m, err := wh.MoveToCart(ctx, &move)
+	if err != nil {
+		return getWishlistErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, m, http.StatusOK)
+}
+
+//saveForLater Moves item request.PathParameters["item_id"] from cart
+//request.PathParameters["cart_id"] to wishlist_id in the body
+func (wh wishlistAPI) saveForLater(ctx context.Context,
+	request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	if request.Body == "" {
+		return web.GetResponse(ctx, ErrMissingRequestParameters, http.StatusBadRequest)
+	}
+
+	var move wishlist.MoveItemInfo
+	err := json.Unmarshal([]byte(request.Body), &move)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error unmarshalling JSON")
+		return web.GetResponse(ctx, err.Error(), http.StatusBadRequest)
+	}
+	move.CartID = request.PathParameters[PathParamCartID]
+	move.ItemID = request.PathParameters[PathParamItemID]
+	move.SKU = request.QueryStringParameters[QueryParamSKU]
+
+	m, err := wh.MoveFromCart(ctx, &move)
+	if err != nil {
+		return getWishlistErrorResponse(ctx, err)
+	}
+
+	return web.GetResponse(ctx, m, http.StatusOK)
+}
+
+//getWishlistErrorResponse returns the response for the errors of the
+//wishlist Handler. Only storage errors are server errors
+func getWishlistErrorResponse(ctx context.Context, err error) (
+	events.APIGatewayProxyResponse, error) {
+
+	//The limit errors describe the limit of the cart that was exceeded
+	if errors.Is(err, cart.ErrQuantityLimitExceeded) {
+		return web.GetResponse(ctx, err.Error(), http.StatusBadRequest)
+	}
+
+	return web.GetErrorResponse(ctx, err, wishlistErrors, http.StatusBadRequest)
+}
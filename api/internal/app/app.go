@@ -0,0 +1,350 @@
+//Package app builds the dependencies of the lambda handlers once per
+//container. Lambda reuses a container for many invocations, so the
+//configuration, the AWS session and the handlers are shared by them instead
+//of being built by every invocation
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/roloum/store/api/internal/auth"
+	saws "github.com/roloum/store/api/internal/aws"
+	"github.com/roloum/store/api/internal/blob"
+	"github.com/roloum/store/api/internal/config"
+	"github.com/roloum/store/api/internal/events"
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/roloum/store/api/internal/metrics"
+	"github.com/roloum/store/api/internal/ratelimit"
+	"github.com/roloum/store/api/internal/store/cart"
+	"github.com/roloum/store/api/internal/store/item"
+	"github.com/roloum/store/api/internal/store/search"
+	"github.com/roloum/store/api/internal/store/wishlist"
+	"github.com/roloum/store/api/internal/tracing"
+	"github.com/roloum/store/api/internal/webhook"
+	"github.com/rs/zerolog/log"
+)
+
+//App contains the dependencies of the handlers. The handlers do not keep
+//state of the requests, so they can be shared by concurrent invocations
+type App struct {
+	Config   config.Configuration
+	DynamoDB dynamodbiface.DynamoDBAPI
+	Verifier *auth.Verifier
+	Cart     *cart.Handler
+	Item     *item.Handler
+	Wishlist *wishlist.Handler
+	Webhook  *webhook.Handler
+
+	//Index is the search index of the catalog, it is rebuilt when it
+	//becomes stale
+	Index  *search.Index
+	Search *search.Handler
+
+	//Sink publishes the cart events to the webhooks and to the sink of the
+	//configuration
+	Sink events.Sink
+
+	//Metrics records the metrics of the operations of the carts and of the
+	//DynamoDB calls of the handlers
+	Metrics metrics.Recorder
+
+	//Tracer starts the spans of the requests. It is nil when tracing is
+	//disabled
+	Tracer *tracing.Tracer
+
+	//Limiter limits the requests of the clients. It is nil when the
+	//configuration does not have limits
+	Limiter *ratelimit.Limiter
+
+	//limits keeps the buckets of the Limiter, the store table unless an
+	//option sets another Store
+	limits ratelimit.Store
+}
+
+const (
+	//readyKey partition and sort key of the row read by Ready, which does not
+	//exist
+	readyKey = "READY"
+)
+
+var (
+	//ErrStoreIsUnreachable error returned by Ready when the store table can
+	//not be read
+	ErrStoreIsUnreachable = errors.New("StoreIsUnreachable")
+)
+
+//Option configures optional dependencies of the App
+type Option func(*App)
+
+//WithRecorder sets the Recorder of the metrics
+func WithRecorder(r metrics.Recorder) Option {
+	return func(a *App) {
+		a.Metrics = r
+	}
+}
+
+//WithRateLimitStore sets the Store of the buckets of the Limiter
+func WithRateLimitStore(s ratelimit.Store) Option {
+	return func(a *App) {
+		a.limits = s
+	}
+}
+
+var (
+	once      sync.Once
+	shared    *App
+	sharedErr error
+)
+
+//Get returns the App of the container. It is built by the first call, the
+//following calls return the same App, or the same error: the configuration
+//does not change during the life of the container
+func Get() (*App, error) {
+	once.Do(func() {
+		shared, sharedErr = Load()
+	})
+	return shared, sharedErr
+}
+
+//Load loads the configuration and returns an App with the DynamoDB client of
+//a new AWS session. The metrics are written to the standard output in the
+//CloudWatch Embedded Metric Format, unless an option sets another Recorder
+func Load(opts ...Option) (*App, error) {
+
+	//Config holds the configuration for the application
+	var cfg config.Configuration
+	if err := config.Load(&cfg); err != nil {
+		return nil, err
+	}
+
+	sess, err := saws.GetSession(cfg.AWS.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append([]Option{
+		WithRecorder(metrics.NewEMF(os.Stdout, cfg.Metrics.Namespace)),
+	}, opts...)
+
+	return New(cfg, saws.GetDynamoDB(sess), opts...)
+}
+
+//New returns an App with the configuration and the DynamoDB client. Tests
+//use it to build an App with a mock of the client. The metrics are discarded
+//unless an option sets a Recorder
+func New(cfg config.Configuration, svc dynamodbiface.DynamoDBAPI,
+	opts ...Option) (*App, error) {
+
+	log.Debug().Msg("Building application")
+
+	a := &App{Config: cfg, DynamoDB: svc, Index: search.NewIndex(),
+		Metrics: metrics.Nop{}}
+	for _, opt := range opts {
+		opt(a)
+	}
+	table := cfg.AWS.DynamoDB.Table.Store
+
+	//The handlers share the client that retries the DynamoDB calls and
+	//records them. Every attempt is recorded by the metrics, the span covers
+	//the retries
+	svc = tracing.NewDynamoDB(saws.NewRetryDynamoDB(
+		metrics.NewDynamoDB(svc, a.Metrics), getRetry(cfg)))
+
+	var err error
+	if a.Verifier, err = getVerifier(cfg); err != nil {
+		return nil, err
+	}
+
+	if a.Tracer, err = getTracer(cfg); err != nil {
+		return nil, err
+	}
+
+	if a.limits == nil {
+		if a.limits, err = ratelimit.NewDynamoDB(svc, table); err != nil {
+			return nil, err
+		}
+	}
+	if a.Limiter, err = getLimiter(cfg, a.limits); err != nil {
+		return nil, err
+	}
+
+	itemOpts := []item.Option{item.WithIndexer(a.Index)}
+
+	//Uploaded images are only supported when there is a blob directory
+	if cfg.Blob.Dir != "" {
+		store, err := blob.NewLocal(cfg.Blob.Dir, cfg.Blob.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		itemOpts = append(itemOpts, item.WithBlobStore(store))
+	}
+
+	if a.Item, err = item.New(svc, table, itemOpts...); err != nil {
+		return nil, err
+	}
+	a.Search = search.New(a.Item, a.Index, cfg.Search.RefreshInterval)
+
+	//The carts compare their lines with the prices of the catalog
+	a.Cart, err = cart.New(svc, table,
+		cart.WithShareSecret(cfg.Share.Secret, cfg.Share.TTL),
+		cart.WithLimits(getLimits(cfg)),
+		cart.WithMetrics(a.Metrics),
+		cart.WithCatalog(a.Item))
+	if err != nil {
+		return nil, err
+	}
+
+	a.Wishlist, err = wishlist.New(svc, table, a.Item,
+		cart.WithLimits(getLimits(cfg)))
+	if err != nil {
+		return nil, err
+	}
+
+	a.Webhook, err = webhook.New(svc, table,
+		webhook.WithClient(&http.Client{Timeout: cfg.Webhook.Timeout}),
+		webhook.WithRetry(cfg.Webhook.MaxAttempts, cfg.Webhook.Backoff))
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Sink, err = getSink(cfg, a.Webhook); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+//Ready returns ErrStoreIsUnreachable if the store table can not be read. It
+//reads a row that does not exist, the cheapest read of the table, without
+//the retries of the handlers, so the check fails fast
+func (a *App) Ready(ctx context.Context) error {
+
+	_, err := a.DynamoDB.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"pk": {S: aws.String(readyKey)},
+			"sk": {S: aws.String(readyKey)},
+		},
+		TableName: aws.String(a.Config.AWS.DynamoDB.Table.Store),
+	})
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error reading store table")
+		return ErrStoreIsUnreachable
+	}
+
+	return nil
+}
+
+//getLimits returns the limits of the carts of the configuration
+func getLimits(cfg config.Configuration) cart.Limits {
+	return cart.Limits{
+		LineQuantity: cfg.Cart.MaxLineQuantity,
+		Lines:        cfg.Cart.MaxLines,
+		Units:        cfg.Cart.MaxUnits,
+	}
+}
+
+//getRetry returns the retry policy of the DynamoDB calls of the configuration
+func getRetry(cfg config.Configuration) saws.Retry {
+	return saws.Retry{
+		MaxAttempts: cfg.AWS.DynamoDB.Retry.MaxAttempts,
+		BaseDelay:   cfg.AWS.DynamoDB.Retry.BaseDelay,
+		MaxDelay:    cfg.AWS.DynamoDB.Retry.MaxDelay,
+	}
+}
+
+//getVerifier returns the Verifier of the bearer tokens with the keys of the
+//configuration
+func getVerifier(cfg config.Configuration) (*auth.Verifier, error) {
+	return auth.New(
+		auth.WithSecret(cfg.Auth.Secret),
+		auth.WithPublicKey(cfg.Auth.PublicKey),
+		auth.WithJWKSFile(cfg.Auth.JWKSFile),
+		auth.WithIssuer(cfg.Auth.Issuer),
+		auth.WithAudience(cfg.Auth.Audience),
+	)
+}
+
+//getTracer returns the Tracer of the exporter of the configuration, or nil
+//when there is no exporter
+func getTracer(cfg config.Configuration) (*tracing.Tracer, error) {
+
+	if cfg.Tracing.Exporter == "" {
+		return nil, nil
+	}
+
+	exporter, err := tracing.NewExporter(cfg.Tracing.Exporter, cfg.Tracing.File)
+	if err != nil {
+		return nil, err
+	}
+
+	return tracing.New(exporter), nil
+}
+
+//getLimiter returns the Limiter of the limits of the configuration, or nil
+//when there are no limits
+func getLimiter(cfg config.Configuration, store ratelimit.Store) (
+	*ratelimit.Limiter, error) {
+
+	rl := cfg.RateLimit
+	if len(rl.Routes) == 0 && rl.Default == "" && rl.Cart == "" {
+		return nil, nil
+	}
+
+	var opts []ratelimit.Option
+	for route, limit := range rl.Routes {
+		l, err := ratelimit.ParseLimit(limit)
+		if err != nil {
+			log.Error().Err(err).Str("route", route).Str("limit", limit).
+				Msg("Invalid rate limit")
+			return nil, err
+		}
+		opts = append(opts, ratelimit.WithRoute(route, l))
+	}
+
+	def, err := ratelimit.ParseLimit(rl.Default)
+	if err != nil {
+		log.Error().Err(err).Str("limit", rl.Default).Msg("Invalid default rate limit")
+		return nil, err
+	}
+	cart, err := ratelimit.ParseLimit(rl.Cart)
+	if err != nil {
+		log.Error().Err(err).Str("limit", rl.Cart).Msg("Invalid cart rate limit")
+		return nil, err
+	}
+	opts = append(opts, ratelimit.WithDefault(def), ratelimit.WithCart(cart))
+
+	return ratelimit.New(store, opts...), nil
+}
+
+//getSink returns a sink that enqueues the events to the webhooks, and to the
+//File sink if the configuration has a file, or logs the events otherwise. The
+//sink lives as long as the container, so it does not keep the events like the
+//Memory sink
+func getSink(cfg config.Configuration, webhooks *webhook.Handler) (
+	events.Sink, error) {
+
+	var sink events.Sink = events.SinkFunc(
+		func(ctx context.Context, evs []events.Event) error {
+			for _, e := range evs {
+				logging.Ctx(logging.WithCart(ctx, e.Metadata().CartID)).Info().
+					Str("event_type", e.Type()).Msg("Event published")
+			}
+			return nil
+		})
+	if cfg.Events.File != "" {
+		file, err := events.NewFile(cfg.Events.File)
+		if err != nil {
+			return nil, err
+		}
+		sink = file
+	}
+
+	return events.NewMulti(sink, webhooks), nil
+}
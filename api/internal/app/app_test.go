@@ -0,0 +1,89 @@
+package app
+
+import (
+	"os"
+	"testing"
+
+	"github.com/roloum/store/api/internal/config"
+	"github.com/roloum/store/api/internal/ratelimit"
+	"github.com/roloum/store/api/internal/test"
+	"github.com/rs/zerolog"
+)
+
+func init() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	//Required configuration, the session does not connect to AWS until the
+	//first request
+	os.Setenv("STORE_AWS_DYNAMODB_TABLE_STORE", "Store")
+	os.Setenv("STORE_AWS_REGION", "us-west-2")
+}
+
+//TestNew tests that the App is built with a mock of the DynamoDB client
+func TestNew(t *testing.T) {
+
+	var cfg config.Configuration
+	if err := config.Load(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := New(cfg, &test.MockDynamoDB{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Cart == nil || a.Item == nil || a.Wishlist == nil || a.Webhook == nil ||
+		a.Search == nil || a.Verifier == nil || a.Sink == nil {
+		t.Errorf("Expected every dependency. Got: %+v", a)
+	}
+	if a.Limiter != nil {
+		t.Errorf("Expected no Limiter without limits")
+	}
+
+	cfg.RateLimit.Routes = map[string]string{"POST /cart": "20/1m"}
+	if a, err = New(cfg, &test.MockDynamoDB{}); err != nil || a.Limiter == nil {
+		t.Errorf("Expected a Limiter. Received: %v", err)
+	}
+	cfg.RateLimit.Cart = "20"
+	if _, err := New(cfg, &test.MockDynamoDB{}); err != ratelimit.ErrRateLimitIsInvalid {
+		t.Errorf("Expected: %v. Received: %v", ratelimit.ErrRateLimitIsInvalid, err)
+	}
+	cfg.RateLimit.Cart = ""
+
+	cfg.AWS.DynamoDB.Table.Store = ""
+	if _, err := New(cfg, &test.MockDynamoDB{}); err == nil {
+		t.Errorf("Expected error without table name")
+	}
+}
+
+//TestGet tests that every invocation gets the same App
+func TestGet(t *testing.T) {
+
+	a, err := Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := Get()
+	if a != b {
+		t.Errorf("Expected the same App")
+	}
+}
+
+//BenchmarkLoad measures the setup of every invocation before the App was
+//shared: the configuration, the AWS session and the handlers
+func BenchmarkLoad(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		if _, err := Load(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+//BenchmarkGet measures the setup of every invocation with the shared App
+func BenchmarkGet(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		if _, err := Get(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
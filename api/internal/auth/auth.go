@@ -0,0 +1,365 @@
+//Package auth validates the bearer JWTs sent to the API and carries the
+//authenticated user in the context of the request
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	//AlgorithmHS256 HMAC using SHA-256
+	AlgorithmHS256 = "HS256"
+
+	//AlgorithmRS256 RSASSA-PKCS1-v1_5 using SHA-256
+	AlgorithmRS256 = "RS256"
+
+	//RoleAdmin role required by the endpoints that modify the catalog
+	RoleAdmin = "admin"
+
+	//HeaderAuthorization header that contains the bearer token
+	HeaderAuthorization = "Authorization"
+
+	//leeway is the clock skew tolerated when validating exp and nbf
+	leeway = time.Minute
+)
+
+var (
+	//ErrTokenIsMissing error returned when a user is required and the request
+	//has no bearer token
+	ErrTokenIsMissing = errors.New("TokenIsMissing")
+
+	//ErrTokenIsInvalid error returned when the token is malformed, its
+	//signature does not match or its claims are not valid
+	ErrTokenIsInvalid = errors.New("TokenIsInvalid")
+
+	//ErrTokenIsExpired error returned when the token has expired
+	ErrTokenIsExpired = errors.New("TokenIsExpired")
+
+	//ErrAlgorithmIsNotSupported error returned when the token is not signed
+	//with HS256 or RS256
+	ErrAlgorithmIsNotSupported = errors.New("AlgorithmIsNotSupported")
+
+	//ErrKeyIsNotFound error returned when there is no key to verify the token
+	ErrKeyIsNotFound = errors.New("KeyIsNotFound")
+
+	//ErrKeyIsInvalid error returned when a configured key can not be parsed
+	ErrKeyIsInvalid = errors.New("KeyIsInvalid")
+
+	//ErrForbidden error returned when the user does not have the required role
+	ErrForbidden = errors.New("Forbidden")
+)
+
+//Verifier validates JWTs signed with the configured keys. HMAC keys verify
+//HS256 tokens and RSA keys verify RS256 tokens, so a public key can never be
+//used as an HMAC secret
+type Verifier struct {
+	secrets  map[string][]byte
+	keys     map[string]*rsa.PublicKey
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+//Option configures the Verifier
+type Option func(*Verifier) error
+
+//WithSecret adds the HMAC secret used to verify HS256 tokens without kid
+func WithSecret(secret string) Option {
+	return func(v *Verifier) error {
+		if secret != "" {
+			v.secrets[""] = []byte(secret)
+		}
+		return nil
+	}
+}
+
+//WithPublicKey adds the PEM encoded RSA public key used to verify RS256
+//tokens without kid
+func WithPublicKey(pemKey string) Option {
+	return func(v *Verifier) error {
+		if pemKey == "" {
+			return nil
+		}
+		key, err := parsePublicKey([]byte(pemKey))
+		if err != nil {
+			return err
+		}
+		v.keys[""] = key
+		return nil
+	}
+}
+
+//WithJWKSFile adds the keys of a JSON Web Key Set file. RSA keys verify RS256
+//tokens and oct keys verify HS256 tokens with the same kid
+func WithJWKSFile(file string) Option {
+	return func(v *Verifier) error {
+		if file == "" {
+			return nil
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Error().Err(err).Str("file", file).Msg("Error reading JWKS file")
+			return ErrKeyIsInvalid
+		}
+		return v.addJWKS(data)
+	}
+}
+
+//WithIssuer sets the issuer the tokens must have in the iss claim
+func WithIssuer(issuer string) Option {
+	return func(v *Verifier) error {
+		v.issuer = issuer
+		return nil
+	}
+}
+
+//WithAudience sets the audience the tokens must include in the aud claim
+func WithAudience(audience string) Option {
+	return func(v *Verifier) error {
+		v.audience = audience
+		return nil
+	}
+}
+
+//New returns a Verifier. Without keys every token is rejected, but anonymous
+//requests are still allowed
+func New(opts ...Option) (*Verifier, error) {
+
+	v := &Verifier{
+		secrets: map[string][]byte{},
+		keys:    map[string]*rsa.PublicKey{},
+		now:     time.Now,
+	}
+
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+//Verify validates the signature and the claims of the token and returns its
+//claims
+func (v *Verifier) Verify(token string) (*Claims, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenIsInvalid
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, ErrTokenIsInvalid
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenIsInvalid
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	digest := sha256.Sum256(signed)
+
+	switch h.Algorithm {
+	case AlgorithmHS256:
+		secret, ok := v.secrets[h.KeyID]
+		if !ok {
+			return nil, ErrKeyIsNotFound
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, ErrTokenIsInvalid
+		}
+	case AlgorithmRS256:
+		key, ok := v.keys[h.KeyID]
+		if !ok {
+			return nil, ErrKeyIsNotFound
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:],
+			signature); err != nil {
+			return nil, ErrTokenIsInvalid
+		}
+	default:
+		return nil, ErrAlgorithmIsNotSupported
+	}
+
+	var c Claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, ErrTokenIsInvalid
+	}
+
+	if err := v.validate(&c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+//Authenticate verifies the bearer token in the headers of the request and
+//returns a context that carries its claims. Requests without token are
+//anonymous and the context is returned unchanged
+func (v *Verifier) Authenticate(ctx context.Context,
+	headers map[string]string) (context.Context, error) {
+
+	token := getBearerToken(headers)
+	if token == "" {
+		return ctx, nil
+	}
+
+	c, err := v.Verify(token)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error verifying token")
+		return ctx, err
+	}
+
+	ctx = logging.With(NewContext(ctx, c), logging.FieldUserID, c.Subject)
+	logging.Ctx(ctx).Debug().Msg("Authenticated user")
+
+	return ctx, nil
+}
+
+//validate checks the time, issuer and audience claims
+func (v *Verifier) validate(c *Claims) error {
+
+	if c.Subject == "" || c.ExpiresAt == 0 {
+		return ErrTokenIsInvalid
+	}
+
+	now := v.now()
+	if now.Add(-leeway).After(time.Unix(c.ExpiresAt, 0)) {
+		return ErrTokenIsExpired
+	}
+	if c.NotBefore != 0 && now.Add(leeway).Before(time.Unix(c.NotBefore, 0)) {
+		return ErrTokenIsInvalid
+	}
+
+	if v.issuer != "" && c.Issuer != v.issuer {
+		return ErrTokenIsInvalid
+	}
+	if v.audience != "" && !c.Audience.contains(v.audience) {
+		return ErrTokenIsInvalid
+	}
+
+	return nil
+}
+
+//addJWKS adds the keys of a JSON Web Key Set
+func (v *Verifier) addJWKS(data []byte) error {
+
+	var set struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+			K       string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		log.Error().Err(err).Msg("Error parsing JWKS")
+		return ErrKeyIsInvalid
+	}
+
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		switch k.KeyType {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil {
+				return ErrKeyIsInvalid
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil {
+				return ErrKeyIsInvalid
+			}
+			v.keys[k.KeyID] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return ErrKeyIsInvalid
+			}
+			v.secrets[k.KeyID] = secret
+		}
+	}
+
+	return nil
+}
+
+//parsePublicKey parses a PEM encoded PKIX or PKCS1 RSA public key
+func parsePublicKey(data []byte) (*rsa.PublicKey, error) {
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrKeyIsInvalid
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		log.Error().Err(err).Msg("Error parsing public key")
+		return nil, ErrKeyIsInvalid
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrKeyIsInvalid
+	}
+
+	return rsaKey, nil
+}
+
+//decodeSegment decodes a base64url encoded JSON segment of the token
+func decodeSegment(segment string, v interface{}) error {
+
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+//getBearerToken returns the bearer token of the Authorization header. Header
+//names are case insensitive
+func getBearerToken(headers map[string]string) string {
+
+	for name, value := range headers {
+		if !strings.EqualFold(name, HeaderAuthorization) {
+			continue
+		}
+		if len(value) > 7 && strings.EqualFold(value[:7], "Bearer ") {
+			return strings.TrimSpace(value[7:])
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const testSecret = "s3cr3t"
+
+func init() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+//sign returns a token with the header and claims signed with key
+func sign(t *testing.T, h header, c interface{}, key interface{}) string {
+
+	hs, _ := json.Marshal(h)
+	cs, _ := json.Marshal(c)
+	signed := base64.RawURLEncoding.EncodeToString(hs) + "." +
+		base64.RawURLEncoding.EncodeToString(cs)
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+//TestVerify tests the validation of the signature and claims of the tokens
+func TestVerify(t *testing.T) {
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwksKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	publicKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"k1","use":"sig","n":%q,"e":%q}]}`,
+		base64.RawURLEncoding.EncodeToString(jwksKey.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(jwksKey.E)).Bytes()))
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := ioutil.WriteFile(jwksFile, []byte(jwks), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := New(WithSecret(testSecret), WithPublicKey(string(publicKey)),
+		WithJWKSFile(jwksFile), WithIssuer("store"), WithAudience("api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	valid := map[string]interface{}{"sub": "u1", "iss": "store", "aud": "api",
+		"exp": exp}
+
+	tests := []struct {
+		desc  string
+		token string
+		err   error
+	}{
+		{
+			desc:  "HS256",
+			token: sign(t, header{Algorithm: AlgorithmHS256}, valid, []byte(testSecret)),
+		},
+		{
+			desc:  "RS256",
+			token: sign(t, header{Algorithm: AlgorithmRS256}, valid, rsaKey),
+		},
+		{
+			desc:  "JWKS",
+			token: sign(t, header{Algorithm: AlgorithmRS256, KeyID: "k1"}, valid, jwksKey),
+		},
+		{
+			desc: "AudienceList",
+			token: sign(t, header{Algorithm: AlgorithmHS256},
+				map[string]interface{}{"sub": "u1", "iss": "store",
+					"aud": []string{"web", "api"}, "exp": exp}, []byte(testSecret)),
+		},
+		{
+			desc:  ErrTokenIsInvalid.Error(),
+			token: sign(t, header{Algorithm: AlgorithmHS256}, valid, []byte("other")),
+			err:   ErrTokenIsInvalid,
+		},
+		{
+			desc:  "WrongRSAKey",
+			token: sign(t, header{Algorithm: AlgorithmRS256}, valid, jwksKey),
+			err:   ErrTokenIsInvalid,
+		},
+		{
+			desc:  ErrKeyIsNotFound.Error(),
+			token: sign(t, header{Algorithm: AlgorithmRS256, KeyID: "k2"}, valid, jwksKey),
+			err:   ErrKeyIsNotFound,
+		},
+		{
+			desc:  ErrAlgorithmIsNotSupported.Error(),
+			token: sign(t, header{Algorithm: "none"}, valid, nil),
+			err:   ErrAlgorithmIsNotSupported,
+		},
+		{
+			desc: ErrTokenIsExpired.Error(),
+			token: sign(t, header{Algorithm: AlgorithmHS256},
+				map[string]interface{}{"sub": "u1", "iss": "store", "aud": "api",
+					"exp": time.Now().Add(-time.Hour).Unix()}, []byte(testSecret)),
+			err: ErrTokenIsExpired,
+		},
+		{
+			desc: "WrongIssuer",
+			token: sign(t, header{Algorithm: AlgorithmHS256},
+				map[string]interface{}{"sub": "u1", "iss": "other", "aud": "api",
+					"exp": exp}, []byte(testSecret)),
+			err: ErrTokenIsInvalid,
+		},
+		{
+			desc: "WrongAudience",
+			token: sign(t, header{Algorithm: AlgorithmHS256},
+				map[string]interface{}{"sub": "u1", "iss": "store", "aud": "web",
+					"exp": exp}, []byte(testSecret)),
+			err: ErrTokenIsInvalid,
+		},
+		{
+			desc: "MissingSubject",
+			token: sign(t, header{Algorithm: AlgorithmHS256},
+				map[string]interface{}{"iss": "store", "aud": "api", "exp": exp},
+				[]byte(testSecret)),
+			err: ErrTokenIsInvalid,
+		},
+		{
+			desc:  "Malformed",
+			token: "abc.def",
+			err:   ErrTokenIsInvalid,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			c, err := v.Verify(tc.token)
+			if !reflect.DeepEqual(err, tc.err) {
+				t.Errorf("Expected: %v. Received: %v", tc.err, err)
+			}
+			if err == nil && c.Subject != "u1" {
+				t.Errorf("Expected subject: u1. Received: %s", c.Subject)
+			}
+		})
+	}
+}
+
+//TestAuthenticate tests that the claims of the bearer token are added to the
+//context and that anonymous requests are allowed
+func TestAuthenticate(t *testing.T) {
+
+	v, _ := New(WithSecret(testSecret))
+	token := sign(t, header{Algorithm: AlgorithmHS256},
+		map[string]interface{}{"sub": "u1", "roles": []string{RoleAdmin},
+			"exp": time.Now().Add(time.Hour).Unix()}, []byte(testSecret))
+
+	tests := []struct {
+		desc    string
+		headers map[string]string
+		userID  string
+		roleErr error
+		err     error
+	}{
+		{"Anonymous", map[string]string{}, "", ErrTokenIsMissing, nil},
+		{"Bearer", map[string]string{"authorization": "Bearer " + token}, "u1", nil, nil},
+		{"Invalid", map[string]string{"Authorization": "Bearer x.y.z"}, "", ErrTokenIsMissing,
+			ErrTokenIsInvalid},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx, err := v.Authenticate(context.Background(), tc.headers)
+			if !reflect.DeepEqual(err, tc.err) {
+				t.Errorf("Expected: %v. Received: %v", tc.err, err)
+			}
+			if userID := UserID(ctx); userID != tc.userID {
+				t.Errorf("Expected user: %s. Received: %s", tc.userID, userID)
+			}
+			if err := RequireRole(ctx, RoleAdmin); !reflect.DeepEqual(err, tc.roleErr) {
+				t.Errorf("Expected: %v. Received: %v", tc.roleErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+)
+
+//contextKey type of the keys stored by this package in the context
+type contextKey int
+
+const claimsKey contextKey = iota
+
+//header contains the fields of the JOSE header used to verify the token
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+//Claims contains the registered claims of the token and the roles of the user
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+//HasRole returns true if the user has the role
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+//audience is the aud claim, which can be a string or an array of strings
+type audience []string
+
+//UnmarshalJSON accepts both forms of the aud claim
+func (a *audience) UnmarshalJSON(data []byte) error {
+
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+
+	var l []string
+	if err := json.Unmarshal(data, &l); err != nil {
+		return err
+	}
+	*a = l
+
+	return nil
+}
+
+//contains returns true if aud is one of the audiences
+func (a audience) contains(aud string) bool {
+	for _, s := range a {
+		if s == aud {
+			return true
+		}
+	}
+	return false
+}
+
+//NewContext returns a context that carries the claims of the user
+func NewContext(ctx context.Context, c *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey, c)
+}
+
+//FromContext returns the claims of the authenticated user, if any
+func FromContext(ctx context.Context) (*Claims, bool) {
+	c, ok := ctx.Value(claimsKey).(*Claims)
+	return c, ok
+}
+
+//UserID returns the ID of the authenticated user, or an empty string if the
+//request is anonymous
+func UserID(ctx context.Context) string {
+	if c, ok := FromContext(ctx); ok {
+		return c.Subject
+	}
+	return ""
+}
+
+//RequireRole returns ErrTokenIsMissing if the request is anonymous and
+//ErrForbidden if the user does not have the role
+func RequireRole(ctx context.Context, role string) error {
+	c, ok := FromContext(ctx)
+	if !ok {
+		return ErrTokenIsMissing
+	}
+	if !c.HasRole(role) {
+		return ErrForbidden
+	}
+	return nil
+}
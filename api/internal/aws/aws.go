@@ -1,6 +1,10 @@
 package aws
 
 import (
+	"net"
+	"net/http"
+	"time"
+
 	"github.com/rs/zerolog/log"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -8,13 +12,18 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
-//GetSession returns an AWS session
+//GetSession returns an AWS session. Its HTTP client keeps the connections
+//alive, so the invocations of a lambda container reuse them. The SDK does not
+//retry the requests, the DynamoDB calls are retried by RetryDynamoDB, with
+//the policy of the configuration
 func GetSession(region string) (*session.Session, error) {
 
 	log.Debug().Msg("Retrieving AWS Session")
 
 	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(region),
+		Region:     aws.String(region),
+		HTTPClient: NewHTTPClient(),
+		MaxRetries: aws.Int(0),
 	})
 	if err != nil {
 		return nil, err
@@ -30,3 +39,26 @@ func GetDynamoDB(sess *session.Session) *dynamodb.DynamoDB {
 
 	return dynamoSvc
 }
+
+//NewHTTPClient returns the HTTP client of the AWS sessions. The default
+//transport only keeps two idle connections per host, every request above
+//them pays a new TLS handshake. The timeouts bound the setup of the
+//connections, the requests that time out are retried
+func NewHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   5 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: 10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
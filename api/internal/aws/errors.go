@@ -0,0 +1,92 @@
+package aws
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+//IsErrorOfType returns true if err has the AWS error code. When err is a
+//cancelled transaction, the code of the reasons of the actions at
+//cancellationIdxs is compared, or the code of every reason when there are no
+//indexes
+func IsErrorOfType(err error, awsErrorCode string, cancellationIdxs ...int) bool {
+
+	var t *dynamodb.TransactionCanceledException
+	if errors.As(err, &t) {
+		for _, reason := range getCancellationReasons(t, cancellationIdxs) {
+			if aws.StringValue(reason.Code) == awsErrorCode {
+				return true
+			}
+		}
+		return false
+	}
+
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == awsErrorCode
+}
+
+//getCancellationReasons returns the reasons of the actions at
+//cancellationIdxs, or every reason when there are no indexes. The indexes out
+//of range are ignored
+func getCancellationReasons(t *dynamodb.TransactionCanceledException,
+	cancellationIdxs []int) []*dynamodb.CancellationReason {
+
+	if len(cancellationIdxs) == 0 {
+		return t.CancellationReasons
+	}
+
+	var reasons []*dynamodb.CancellationReason
+	for _, idx := range cancellationIdxs {
+		if idx >= 0 && idx < len(t.CancellationReasons) &&
+			t.CancellationReasons[idx] != nil {
+			reasons = append(reasons, t.CancellationReasons[idx])
+		}
+	}
+	return reasons
+}
+
+//IsRetryable returns true if the DynamoDB call that returned err can succeed
+//when it is retried: conflicts with other transactions, throttling and
+//transient errors. A cancelled transaction is retryable when at least one of
+//its actions was cancelled by a conflict or by throttling and the rest were
+//not cancelled: a condition that failed fails again
+func IsRetryable(err error) bool {
+
+	var t *dynamodb.TransactionCanceledException
+	if errors.As(err, &t) {
+		var retryable bool
+		for _, reason := range t.CancellationReasons {
+			switch aws.StringValue(reason.Code) {
+			case dynamodb.BatchStatementErrorCodeEnumTransactionConflict,
+				dynamodb.BatchStatementErrorCodeEnumThrottlingError,
+				dynamodb.BatchStatementErrorCodeEnumProvisionedThroughputExceeded:
+				retryable = true
+			case "", "None":
+			default:
+				return false
+			}
+		}
+		return retryable
+	}
+
+	//Errors that do not come from AWS are not transient
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return false
+	}
+
+	switch aerr.Code() {
+	case dynamodb.ErrCodeTransactionConflictException,
+		dynamodb.ErrCodeTransactionInProgressException,
+		dynamodb.ErrCodeProvisionedThroughputExceededException,
+		dynamodb.ErrCodeRequestLimitExceeded,
+		dynamodb.ErrCodeInternalServerError:
+		return true
+	}
+
+	return request.IsErrorThrottle(aerr) || request.IsErrorRetryable(aerr)
+}
@@ -0,0 +1,236 @@
+package aws
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/google/uuid"
+	"github.com/roloum/store/api/internal/logging"
+)
+
+//Retry is the policy of the retries of the DynamoDB calls that fail with a
+//retryable error. The delay before every retry is random, between zero and
+//BaseDelay doubled by every previous retry, up to MaxDelay. The jitter keeps
+//the requests that conflicted from retrying at the same time
+type Retry struct {
+	//MaxAttempts maximum number of attempts of a call, including the first
+	MaxAttempts int
+
+	//BaseDelay maximum delay before the first retry
+	BaseDelay time.Duration
+
+	//MaxDelay maximum delay before any retry
+	MaxDelay time.Duration
+}
+
+//Do calls fn until it succeeds, it returns an error that is not retryable or
+//the attempts run out. A retry that would not start before the deadline of
+//ctx is not attempted. The error of the last attempt is returned, so the
+//callers handle it as if there were no retries
+func (r Retry) Do(ctx context.Context, fn func() error) error {
+
+	var err error
+	for attempt := 1; ; attempt++ {
+
+		if err = fn(); err == nil || !IsRetryable(err) || attempt >= r.MaxAttempts {
+			return err
+		}
+
+		delay := r.delay(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return err
+		}
+
+		logging.Ctx(ctx).Debug().Err(err).
+			Int("attempt", attempt).
+			Dur("delay", delay).
+			Msg("Retrying DynamoDB call")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+//delay returns the random delay before the retry that follows the attempt
+func (r Retry) delay(attempt int) time.Duration {
+
+	max := r.BaseDelay
+	for n := 1; n < attempt && max < r.MaxDelay; n++ {
+		max *= 2
+	}
+	if r.MaxDelay > 0 && max > r.MaxDelay {
+		max = r.MaxDelay
+	}
+	if max <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
+
+//RetryDynamoDB is a DynamoDB client that retries the calls of the store that
+//fail with a retryable error. The calls that are not used by the store go
+//straight to the client
+type RetryDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	retry Retry
+}
+
+//NewRetryDynamoDB returns a client that retries the calls of svc with the
+//policy
+func NewRetryDynamoDB(svc dynamodbiface.DynamoDBAPI, retry Retry) *RetryDynamoDB {
+	return &RetryDynamoDB{DynamoDBAPI: svc, retry: retry}
+}
+
+//GetItemWithContext retries GetItem
+func (d *RetryDynamoDB) GetItemWithContext(ctx aws.Context,
+	input *dynamodb.GetItemInput, opts ...request.Option) (
+	*dynamodb.GetItemOutput, error) {
+
+	var out *dynamodb.GetItemOutput
+	err := d.retry.Do(ctx, func() error {
+		var err error
+		out, err = d.DynamoDBAPI.GetItemWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return out, err
+}
+
+//PutItemWithContext retries PutItem
+func (d *RetryDynamoDB) PutItemWithContext(ctx aws.Context,
+	input *dynamodb.PutItemInput, opts ...request.Option) (
+	*dynamodb.PutItemOutput, error) {
+
+	var out *dynamodb.PutItemOutput
+	err := d.retry.Do(ctx, func() error {
+		var err error
+		out, err = d.DynamoDBAPI.PutItemWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return out, err
+}
+
+//UpdateItemWithContext retries UpdateItem
+func (d *RetryDynamoDB) UpdateItemWithContext(ctx aws.Context,
+	input *dynamodb.UpdateItemInput, opts ...request.Option) (
+	*dynamodb.UpdateItemOutput, error) {
+
+	var out *dynamodb.UpdateItemOutput
+	err := d.retry.Do(ctx, func() error {
+		var err error
+		out, err = d.DynamoDBAPI.UpdateItemWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return out, err
+}
+
+//DeleteItemWithContext retries DeleteItem
+func (d *RetryDynamoDB) DeleteItemWithContext(ctx aws.Context,
+	input *dynamodb.DeleteItemInput, opts ...request.Option) (
+	*dynamodb.DeleteItemOutput, error) {
+
+	var out *dynamodb.DeleteItemOutput
+	err := d.retry.Do(ctx, func() error {
+		var err error
+		out, err = d.DynamoDBAPI.DeleteItemWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return out, err
+}
+
+//QueryWithContext retries Query
+func (d *RetryDynamoDB) QueryWithContext(ctx aws.Context,
+	input *dynamodb.QueryInput, opts ...request.Option) (
+	*dynamodb.QueryOutput, error) {
+
+	var out *dynamodb.QueryOutput
+	err := d.retry.Do(ctx, func() error {
+		var err error
+		out, err = d.DynamoDBAPI.QueryWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return out, err
+}
+
+//ScanWithContext retries Scan
+func (d *RetryDynamoDB) ScanWithContext(ctx aws.Context,
+	input *dynamodb.ScanInput, opts ...request.Option) (
+	*dynamodb.ScanOutput, error) {
+
+	var out *dynamodb.ScanOutput
+	err := d.retry.Do(ctx, func() error {
+		var err error
+		out, err = d.DynamoDBAPI.ScanWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return out, err
+}
+
+//BatchGetItemWithContext retries BatchGetItem
+func (d *RetryDynamoDB) BatchGetItemWithContext(ctx aws.Context,
+	input *dynamodb.BatchGetItemInput, opts ...request.Option) (
+	*dynamodb.BatchGetItemOutput, error) {
+
+	var out *dynamodb.BatchGetItemOutput
+	err := d.retry.Do(ctx, func() error {
+		var err error
+		out, err = d.DynamoDBAPI.BatchGetItemWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return out, err
+}
+
+//BatchWriteItemWithContext retries BatchWriteItem
+func (d *RetryDynamoDB) BatchWriteItemWithContext(ctx aws.Context,
+	input *dynamodb.BatchWriteItemInput, opts ...request.Option) (
+	*dynamodb.BatchWriteItemOutput, error) {
+
+	var out *dynamodb.BatchWriteItemOutput
+	err := d.retry.Do(ctx, func() error {
+		var err error
+		out, err = d.DynamoDBAPI.BatchWriteItemWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return out, err
+}
+
+//TransactWriteItemsWithContext retries TransactWriteItems
+func (d *RetryDynamoDB) TransactWriteItemsWithContext(ctx aws.Context,
+	input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (
+	*dynamodb.TransactWriteItemsOutput, error) {
+
+	//Every attempt has the token of the first one, so a transaction that
+	//succeeded but whose response was lost is not applied twice
+	if input.ClientRequestToken == nil {
+		in := *input
+		in.ClientRequestToken = aws.String(uuid.New().String())
+		input = &in
+	}
+
+	var out *dynamodb.TransactWriteItemsOutput
+	err := d.retry.Do(ctx, func() error {
+		var err error
+		out, err = d.DynamoDBAPI.TransactWriteItemsWithContext(ctx, input, opts...)
+		return err
+	})
+
+	return out, err
+}
@@ -0,0 +1,192 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/rs/zerolog"
+)
+
+func init() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+//canceled returns a cancelled transaction with the codes of the reasons of
+//its actions
+func canceled(codes ...string) error {
+	t := &dynamodb.TransactionCanceledException{}
+	for _, code := range codes {
+		t.CancellationReasons = append(t.CancellationReasons,
+			&dynamodb.CancellationReason{Code: aws.String(code)})
+	}
+	return t
+}
+
+//transactions is a DynamoDB client whose transactions fail with errs, one
+//per attempt, and keeps the tokens of the attempts
+type transactions struct {
+	dynamodbiface.DynamoDBAPI
+	errs   []error
+	tokens []string
+}
+
+//TransactWriteItemsWithContext returns the error of the attempt
+func (t *transactions) TransactWriteItemsWithContext(ctx aws.Context,
+	input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (
+	*dynamodb.TransactWriteItemsOutput, error) {
+
+	t.tokens = append(t.tokens, aws.StringValue(input.ClientRequestToken))
+	if len(t.tokens) > len(t.errs) {
+		return &dynamodb.TransactWriteItemsOutput{}, nil
+	}
+	return nil, t.errs[len(t.tokens)-1]
+}
+
+//TestIsErrorOfType tests the codes of the errors and of the reasons of the
+//cancelled transactions
+func TestIsErrorOfType(t *testing.T) {
+
+	failed := dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed
+
+	tests := []struct {
+		desc     string
+		err      error
+		idxs     []int
+		expected bool
+	}{
+		{"Index", canceled("None", failed), []int{1}, true},
+		{"OtherIndex", canceled("None", failed), []int{0}, false},
+		{"AnyIndex", canceled("None", failed), []int{0, 1}, true},
+		{"EveryReason", canceled("None", "None", failed), nil, true},
+		{"IndexOutOfRange", canceled(failed), []int{3}, false},
+		{"NoReason", canceled(), nil, false},
+		{"AWSError", awserr.New(failed, "", nil), nil, true},
+		{"OtherError", errors.New(failed), nil, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			if IsErrorOfType(tc.err, failed, tc.idxs...) != tc.expected {
+				t.Errorf("Expected: %v", tc.expected)
+			}
+		})
+	}
+}
+
+//TestIsRetryable tests which errors are retried
+func TestIsRetryable(t *testing.T) {
+
+	tests := []struct {
+		desc     string
+		err      error
+		expected bool
+	}{
+		{"Conflict", canceled("None", "TransactionConflict"), true},
+		{"Throttling", canceled("ThrottlingError", "None"), true},
+		{"ConditionFailed", canceled("TransactionConflict", "ConditionalCheckFailed"), false},
+		{"NotCancelled", canceled("None"), false},
+		{"TransactionConflictException", awserr.New(
+			dynamodb.ErrCodeTransactionConflictException, "", nil), true},
+		{"ProvisionedThroughputExceeded", awserr.New(
+			dynamodb.ErrCodeProvisionedThroughputExceededException, "", nil), true},
+		{"ThrottlingException", awserr.New("ThrottlingException", "", nil), true},
+		{"ConditionalCheckFailedException", awserr.New(
+			dynamodb.ErrCodeConditionalCheckFailedException, "", nil), false},
+		{"Validation", awserr.New("ValidationException", "", nil), false},
+		{"NotAWS", errors.New("CouldNotAddItem"), false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			if IsRetryable(tc.err) != tc.expected {
+				t.Errorf("Expected: %v", tc.expected)
+			}
+		})
+	}
+}
+
+//TestRetry tests the attempts of the transactions
+func TestRetry(t *testing.T) {
+
+	conflict := canceled("None", "TransactionConflict")
+	failed := canceled("None", "ConditionalCheckFailed")
+	retry := Retry{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+
+	tests := []struct {
+		desc     string
+		errs     []error
+		timeout  time.Duration
+		attempts int
+		expected error
+	}{
+		{"Success", nil, 0, 1, nil},
+		{"Retried", []error{conflict, conflict}, 0, 3, nil},
+		{"AttemptsRunOut", []error{conflict, conflict, conflict}, 0, 3, conflict},
+		{"NotRetryable", []error{conflict, failed}, 0, 2, failed},
+		{"Deadline", []error{conflict}, time.Nanosecond, 1, conflict},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+
+			svc := &transactions{errs: tc.errs}
+			_, err := NewRetryDynamoDB(svc, retry).TransactWriteItemsWithContext(ctx,
+				&dynamodb.TransactWriteItemsInput{})
+			if err != tc.expected {
+				t.Errorf("Expected: %v. Received: %v", tc.expected, err)
+			}
+			if len(svc.tokens) != tc.attempts {
+				t.Errorf("Expected %d attempts. Received: %d", tc.attempts,
+					len(svc.tokens))
+			}
+
+			//Every attempt is the same transaction
+			for _, token := range svc.tokens {
+				if token == "" || token != svc.tokens[0] {
+					t.Errorf("Expected the same token. Received: %v", svc.tokens)
+				}
+			}
+		})
+	}
+}
+
+//TestDelay tests that the delays grow up to the maximum delay
+func TestDelay(t *testing.T) {
+
+	retry := Retry{MaxAttempts: 10, BaseDelay: 10 * time.Millisecond,
+		MaxDelay: 50 * time.Millisecond}
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 10 * time.Millisecond},
+		{2, 20 * time.Millisecond},
+		{3, 40 * time.Millisecond},
+		{4, 50 * time.Millisecond},
+		{9, 50 * time.Millisecond},
+	}
+
+	for _, tc := range tests {
+		for n := 0; n < 100; n++ {
+			if d := retry.delay(tc.attempt); d < 0 || d > tc.max {
+				t.Errorf("Attempt %d: expected a delay up to %s. Received: %s",
+					tc.attempt, tc.max, d)
+			}
+		}
+	}
+}
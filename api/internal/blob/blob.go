@@ -0,0 +1,131 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/roloum/store/api/internal/logging"
+)
+
+var (
+	//ErrKeyIsInvalid error returned when the key is empty or tries to escape
+	//the root of the store
+	ErrKeyIsInvalid = errors.New("BlobKeyIsInvalid")
+
+	//ErrCouldNotStoreBlob error returned if we failed to write the blob
+	ErrCouldNotStoreBlob = errors.New("CouldNotStoreBlob")
+
+	//ErrBlobDirIsEmpty error returned when the directory of the local store
+	//is not set
+	ErrBlobDirIsEmpty = errors.New("BlobDirIsEmpty")
+)
+
+//Store stores binary objects, like the images of the catalog, by key.
+//Keys use "/" as separator, e.g. items/{item_id}/{media_id}.jpg
+type Store interface {
+	//Put stores the content under the key, replacing any previous content
+	Put(ctx context.Context, key, contentType string, r io.Reader) error
+
+	//Delete removes the content stored under the key
+	Delete(ctx context.Context, key string) error
+
+	//URL returns the URL clients use to download the content of the key
+	URL(key string) string
+}
+
+//Local is a Store that saves the objects in a directory of the local
+//filesystem. It serves the files over HTTP, so it is meant for development
+type Local struct {
+	dir     string
+	baseURL string
+}
+
+//NewLocal returns a Local store that saves the objects in dir. baseURL is the
+//URL where the store is served, e.g. http://localhost:8080/media
+func NewLocal(dir, baseURL string) (*Local, error) {
+	if dir == "" {
+		return nil, ErrBlobDirIsEmpty
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Local{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+//Put saves the content in a file named after the key
+func (l *Local) Put(ctx context.Context, key, contentType string,
+	r io.Reader) error {
+
+	file, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	logging.Ctx(ctx).Debug().Str("key", key).Str("file", file).Msg("Storing blob")
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Error creating blob directory")
+		return ErrCouldNotStoreBlob
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Error creating blob")
+		return ErrCouldNotStoreBlob
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Error writing blob")
+		return ErrCouldNotStoreBlob
+	}
+
+	return nil
+}
+
+//Delete removes the file of the key. It does not fail if the file does not
+//exist
+func (l *Local) Delete(ctx context.Context, key string) error {
+
+	file, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+//URL returns the URL of the key under the base URL
+func (l *Local) URL(key string) string {
+	return l.baseURL + "/" + key
+}
+
+//ServeHTTP serves the files of the store. The handler has to be mounted with
+//http.StripPrefix on the path of the base URL
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	http.FileServer(http.Dir(l.dir)).ServeHTTP(w, r)
+}
+
+//path returns the path of the file of the key, making sure it is inside the
+//directory of the store
+func (l *Local) path(key string) (string, error) {
+
+	clean := path.Clean("/" + key)
+	if key == "" || clean == "/" || clean != "/"+key {
+		return "", ErrKeyIsInvalid
+	}
+
+	return filepath.Join(l.dir, filepath.FromSlash(clean)), nil
+}
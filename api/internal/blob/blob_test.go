@@ -0,0 +1,58 @@
+package blob
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//TestLocal tests storing and serving a blob from the local filesystem
+func TestLocal(t *testing.T) {
+
+	store, err := NewLocal(t.TempDir(), "http://localhost:8080/media/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	key := "items/11aa/image.png"
+	err = store.Put(context.Background(), key, "image/png", strings.NewReader("png"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if url := store.URL(key); url != "http://localhost:8080/media/items/11aa/image.png" {
+		t.Errorf("Unexpected URL: %s", url)
+	}
+
+	rec := httptest.NewRecorder()
+	http.StripPrefix("/media/", store).ServeHTTP(rec,
+		httptest.NewRequest(http.MethodGet, "/media/"+key, nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "png" {
+		t.Errorf("Expected blob to be served. Received: %d %s", rec.Code,
+			rec.Body.String())
+	}
+
+	if err := store.Delete(context.Background(), key); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+//TestLocalInvalidKey tests that keys can not escape the directory
+func TestLocalInvalidKey(t *testing.T) {
+
+	store, err := NewLocal(t.TempDir(), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, key := range []string{"", "/", "../secret", "items/../../secret"} {
+		t.Run(key, func(t *testing.T) {
+			err := store.Put(context.Background(), key, "", strings.NewReader(""))
+			if err != ErrKeyIsInvalid {
+				t.Errorf("Expected: %v. Received: %v", ErrKeyIsInvalid, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+//Package build contains the metadata of the build of the binaries. The
+//Makefile sets it with the -X flag of the linker, the binaries built without
+//it are dev builds
+package build
+
+import (
+	"runtime"
+)
+
+var (
+	//Version version of the build, the git tag or commit it was built from
+	Version = "dev"
+
+	//Commit git commit the binary was built from
+	Commit = ""
+
+	//Date UTC time of the build, in RFC 3339 format
+	Date = ""
+)
+
+//Info is the metadata of the build of the binary
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+//Get returns the metadata of the build
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+	}
+}
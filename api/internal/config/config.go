@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/rs/zerolog"
@@ -17,9 +18,65 @@ type (
 				Table struct {
 					Store string `required:"true"`
 				}
+				Retry struct {
+					MaxAttempts int           `split_words:"true" default:"4"`
+					BaseDelay   time.Duration `split_words:"true" default:"25ms"`
+					MaxDelay    time.Duration `split_words:"true" default:"1s"`
+				}
 			}
 			Region string `required:"true"`
 		}
+		Auth struct {
+			Secret    string
+			PublicKey string `split_words:"true"`
+			JWKSFile  string `split_words:"true"`
+			Issuer    string
+			Audience  string
+		}
+		Blob struct {
+			Dir     string
+			BaseURL string `split_words:"true" default:"http://localhost:8080/media"`
+		}
+		Cart struct {
+			MaxLineQuantity int           `split_words:"true" default:"99"`
+			MaxLines        int           `split_words:"true" default:"50"`
+			MaxUnits        int           `split_words:"true" default:"500"`
+			AbandonedAfter  time.Duration `split_words:"true" default:"24h"`
+		}
+		Share struct {
+			Secret string
+			TTL    time.Duration `default:"168h"`
+		}
+		CORS struct {
+			AllowedOrigins   []string      `split_words:"true"`
+			AllowedMethods   []string      `split_words:"true" default:"GET,POST,PUT,PATCH,DELETE"`
+			AllowedHeaders   []string      `split_words:"true" default:"Authorization,Content-Type,X-Request-ID,traceparent"`
+			MaxAge           time.Duration `split_words:"true" default:"10m"`
+			AllowCredentials bool          `split_words:"true" default:"false"`
+		}
+		RateLimit struct {
+			Routes  map[string]string
+			Default string
+			Cart    string
+		} `split_words:"true"`
+		Events struct {
+			File string
+		}
+		Webhook struct {
+			MaxAttempts int           `split_words:"true" default:"5"`
+			Backoff     time.Duration `default:"1m"`
+			Timeout     time.Duration `default:"5s"`
+		}
+		Metrics struct {
+			Namespace string `default:"Store"`
+		}
+		Tracing struct {
+			Exporter string
+			File     string
+		}
+		Search struct {
+			RefreshInterval time.Duration `split_words:"true" default:"5m"`
+		}
 	}
 )
 
@@ -62,7 +119,7 @@ func Load(cfg interface{}) error {
 
 	err := envconfig.Process("store", cfg)
 	if err != nil {
-		log.Error().Msgf("Error loading the configuration. %s\n", err.Error())
+		log.Error().Err(err).Msg("Error loading the configuration")
 		return err
 	}
 
@@ -0,0 +1,292 @@
+package events
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roloum/store/api/internal/store/cart"
+)
+
+const (
+	//TypeCartCreated name of the event of a new cart
+	TypeCartCreated = "CartCreated"
+
+	//TypeItemAdded name of the event of a new line in a cart
+	TypeItemAdded = "ItemAdded"
+
+	//TypeQuantityChanged name of the event of a line whose quantity changed
+	TypeQuantityChanged = "QuantityChanged"
+
+	//TypeItemRemoved name of the event of a line deleted from a cart
+	TypeItemRemoved = "ItemRemoved"
+
+	//TypeCartAbandoned name of the event of a cart that has not been
+	//modified for a while
+	TypeCartAbandoned = "CartAbandoned"
+
+	//streamInsert, streamModify and streamRemove are the names of the
+	//changes of the stream records
+	streamInsert = "INSERT"
+	streamModify = "MODIFY"
+	streamRemove = "REMOVE"
+)
+
+var (
+	//ErrRecordIsInvalid error returned when a record of a cart row does not
+	//have the attributes of the row
+	ErrRecordIsInvalid = errors.New("StreamRecordIsInvalid")
+)
+
+//Event is a change of a cart. Every event embeds the Meta of the stream
+//record it was decoded from
+type Event interface {
+	//Type returns the name of the event, e.g. ItemAdded
+	Type() string
+
+	//Metadata returns the information of the stream record of the event
+	Metadata() Meta
+}
+
+//Meta contains the information common to every event. EventID is the ID of
+//the stream record, so consumers can discard the events delivered twice
+type Meta struct {
+	EventID    string    `json:"event_id"`
+	CartID     string    `json:"cart_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+//Metadata returns the Meta of the event
+func (m Meta) Metadata() Meta {
+	return m
+}
+
+//CartCreated is published when a cart is created. OwnerID is set for the
+//carts of authenticated users
+type CartCreated struct {
+	Meta
+	OwnerID string `json:"owner_id,omitempty"`
+}
+
+//Type returns TypeCartCreated
+func (CartCreated) Type() string {
+	return TypeCartCreated
+}
+
+//ItemAdded is published when a line is added to a cart
+type ItemAdded struct {
+	Meta
+	ItemID      string  `json:"item_id"`
+	SKU         string  `json:"sku,omitempty"`
+	Description string  `json:"description"`
+	Price       float32 `json:"price"`
+	Quantity    int     `json:"quantity"`
+}
+
+//Type returns TypeItemAdded
+func (ItemAdded) Type() string {
+	return TypeItemAdded
+}
+
+//QuantityChanged is published when the quantity of a line changes
+type QuantityChanged struct {
+	Meta
+	ItemID      string `json:"item_id"`
+	SKU         string `json:"sku,omitempty"`
+	OldQuantity int    `json:"old_quantity"`
+	Quantity    int    `json:"quantity"`
+}
+
+//Type returns TypeQuantityChanged
+func (QuantityChanged) Type() string {
+	return TypeQuantityChanged
+}
+
+//ItemRemoved is published when a line is deleted from a cart, including the
+//lines moved to a wishlist or merged into another cart
+type ItemRemoved struct {
+	Meta
+	ItemID   string `json:"item_id"`
+	SKU      string `json:"sku,omitempty"`
+	Quantity int    `json:"quantity"`
+}
+
+//Type returns TypeItemRemoved
+func (ItemRemoved) Type() string {
+	return TypeItemRemoved
+}
+
+//CartAbandoned is published by the abandoned cart job when a cart has not
+//been modified for a while. It is not decoded from the stream, the EventID is
+//derived from the cart and its last modification, so a cart reported twice
+//has the same EventID
+type CartAbandoned struct {
+	Meta
+	OwnerID      string    `json:"owner_id,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+	Total        float32   `json:"total"`
+	Count        int       `json:"count"`
+	Lines        []Line    `json:"lines"`
+}
+
+//Line is a line of the cart of a CartAbandoned event
+type Line struct {
+	ItemID      string  `json:"item_id"`
+	SKU         string  `json:"sku,omitempty"`
+	Description string  `json:"description"`
+	Price       float32 `json:"price"`
+	Quantity    int     `json:"quantity"`
+}
+
+//Type returns TypeCartAbandoned
+func (CartAbandoned) Type() string {
+	return TypeCartAbandoned
+}
+
+//NewCartAbandoned returns the CartAbandoned event of an abandoned cart
+func NewCartAbandoned(c *cart.AbandonedCart) CartAbandoned {
+
+	lastModified := c.LastModified.UTC()
+	e := CartAbandoned{
+		Meta: Meta{
+			EventID:    c.CartID + "#" + lastModified.Format(time.RFC3339Nano),
+			CartID:     c.CartID,
+			OccurredAt: time.Now().UTC(),
+		},
+		OwnerID:      c.OwnerID,
+		LastModified: lastModified,
+		Total:        c.Total,
+		Count:        c.Count,
+		Lines:        []Line{},
+	}
+	for _, i := range c.Items {
+		e.Lines = append(e.Lines, Line{
+			ItemID:      i.ItemID,
+			SKU:         i.SKU,
+			Description: i.Description,
+			Price:       i.Price,
+			Quantity:    i.Quantity,
+		})
+	}
+
+	return e
+}
+
+//Decode returns the event of a stream record of the store table. Records of
+//rows that are not carts or cart lines, and changes that are not events, like
+//the update of the counters of a cart, return a nil Event
+func Decode(record events.DynamoDBEventRecord) (Event, error) {
+
+	image := record.Change.NewImage
+	if record.EventName == streamRemove {
+		image = record.Change.OldImage
+	}
+
+	meta := Meta{
+		EventID:    record.EventID,
+		CartID:     getString(image, "cart_id"),
+		OccurredAt: record.Change.ApproximateCreationDateTime.UTC(),
+	}
+
+	switch getString(image, "type") {
+	case cart.DynamoDBRowTypeCart:
+		if record.EventName != streamInsert {
+			return nil, nil
+		}
+		if meta.CartID == "" {
+			return nil, ErrRecordIsInvalid
+		}
+		return CartCreated{Meta: meta, OwnerID: getString(image, "owner_id")}, nil
+
+	case cart.DynamoDBRowTypeCartItem:
+		return decodeLine(record, meta)
+	}
+
+	return nil, nil
+}
+
+//decodeLine returns the event of a stream record of a cart line
+func decodeLine(record events.DynamoDBEventRecord, meta Meta) (Event, error) {
+
+	newImage, oldImage := record.Change.NewImage, record.Change.OldImage
+
+	switch record.EventName {
+	case streamInsert:
+		quantity, err := getInt(newImage, "quantity")
+		if err != nil || meta.CartID == "" {
+			return nil, ErrRecordIsInvalid
+		}
+		price, err := strconv.ParseFloat(getNumber(newImage, "price"), 32)
+		if err != nil {
+			return nil, ErrRecordIsInvalid
+		}
+		return ItemAdded{
+			Meta:        meta,
+			ItemID:      getString(newImage, "item_id"),
+			SKU:         getString(newImage, "sku"),
+			Description: getString(newImage, "description"),
+			Price:       float32(price),
+			Quantity:    quantity,
+		}, nil
+
+	case streamModify:
+		quantity, err := getInt(newImage, "quantity")
+		if err != nil {
+			return nil, ErrRecordIsInvalid
+		}
+		oldQuantity, err := getInt(oldImage, "quantity")
+		if err != nil {
+			return nil, ErrRecordIsInvalid
+		}
+
+		//Lines are also modified when they are repriced
+		if quantity == oldQuantity {
+			return nil, nil
+		}
+		return QuantityChanged{
+			Meta:        meta,
+			ItemID:      getString(newImage, "item_id"),
+			SKU:         getString(newImage, "sku"),
+			OldQuantity: oldQuantity,
+			Quantity:    quantity,
+		}, nil
+
+	case streamRemove:
+		quantity, err := getInt(oldImage, "quantity")
+		if err != nil {
+			return nil, ErrRecordIsInvalid
+		}
+		return ItemRemoved{
+			Meta:     meta,
+			ItemID:   getString(oldImage, "item_id"),
+			SKU:      getString(oldImage, "sku"),
+			Quantity: quantity,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+//getString returns the value of a string attribute of the image, or an empty
+//string if the image does not have it
+func getString(image map[string]events.DynamoDBAttributeValue, name string) string {
+	if v, ok := image[name]; ok && v.DataType() == events.DataTypeString {
+		return v.String()
+	}
+	return ""
+}
+
+//getNumber returns the value of a number attribute of the image, or an empty
+//string if the image does not have it
+func getNumber(image map[string]events.DynamoDBAttributeValue, name string) string {
+	if v, ok := image[name]; ok && v.DataType() == events.DataTypeNumber {
+		return v.Number()
+	}
+	return ""
+}
+
+//getInt returns the value of a number attribute of the image as an int
+func getInt(image map[string]events.DynamoDBAttributeValue, name string) (int, error) {
+	return strconv.Atoi(getNumber(image, name))
+}
@@ -0,0 +1,137 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/rs/zerolog"
+)
+
+func init() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+//line returns the image of a cart line with the quantity
+func line(quantity string) map[string]events.DynamoDBAttributeValue {
+	return map[string]events.DynamoDBAttributeValue{
+		"type":        events.NewStringAttribute("CartItem"),
+		"cart_id":     events.NewStringAttribute("cart1"),
+		"item_id":     events.NewStringAttribute("11aa"),
+		"description": events.NewStringAttribute("Laptop"),
+		"price":       events.NewNumberAttribute("800.000000"),
+		"quantity":    events.NewNumberAttribute(quantity),
+	}
+}
+
+//TestDecode tests the events decoded from the stream records
+func TestDecode(t *testing.T) {
+
+	now := time.Unix(1600000000, 0).UTC()
+	meta := Meta{EventID: "e1", CartID: "cart1", OccurredAt: now}
+
+	cartRow := map[string]events.DynamoDBAttributeValue{
+		"type":     events.NewStringAttribute("Cart"),
+		"cart_id":  events.NewStringAttribute("cart1"),
+		"owner_id": events.NewStringAttribute("u1"),
+	}
+
+	tests := []struct {
+		desc     string
+		name     string
+		newImage map[string]events.DynamoDBAttributeValue
+		oldImage map[string]events.DynamoDBAttributeValue
+		event    Event
+		err      error
+	}{
+		{TypeCartCreated, "INSERT", cartRow, nil,
+			CartCreated{Meta: meta, OwnerID: "u1"}, nil},
+		{"CartCountersUpdated", "MODIFY", cartRow, cartRow, nil, nil},
+		{TypeItemAdded, "INSERT", line("2"), nil,
+			ItemAdded{Meta: meta, ItemID: "11aa", Description: "Laptop",
+				Price: 800, Quantity: 2}, nil},
+		{TypeQuantityChanged, "MODIFY", line("3"), line("2"),
+			QuantityChanged{Meta: meta, ItemID: "11aa", OldQuantity: 2,
+				Quantity: 3}, nil},
+		{"LineRepriced", "MODIFY", line("2"), line("2"), nil, nil},
+		{TypeItemRemoved, "REMOVE", nil, line("2"),
+			ItemRemoved{Meta: meta, ItemID: "11aa", Quantity: 2}, nil},
+		{"OtherRow", "INSERT", map[string]events.DynamoDBAttributeValue{
+			"type": events.NewStringAttribute("Wishlist")}, nil, nil, nil},
+		{ErrRecordIsInvalid.Error(), "INSERT", line("two"), nil, nil,
+			ErrRecordIsInvalid},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			e, err := Decode(events.DynamoDBEventRecord{
+				EventID:   "e1",
+				EventName: tc.name,
+				Change: events.DynamoDBStreamRecord{
+					ApproximateCreationDateTime: events.SecondsEpochTime{Time: now},
+					NewImage:                    tc.newImage,
+					OldImage:                    tc.oldImage,
+				},
+			})
+			if err != tc.err {
+				t.Errorf("Expected: %v. Received: %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(e, tc.event) {
+				t.Errorf("Expected: %v. Received: %v", tc.event, e)
+			}
+		})
+	}
+}
+
+//TestFile tests that the File sink appends one line per event
+func TestFile(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink, err := NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta := Meta{EventID: "e1", CartID: "cart1"}
+	for _, evs := range [][]Event{
+		{CartCreated{Meta: meta}},
+		{ItemAdded{Meta: meta, ItemID: "11aa"}, ItemRemoved{Meta: meta, ItemID: "11aa"}},
+	} {
+		if err := sink.Publish(context.Background(), evs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var types []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r struct {
+			Type  string `json:"type"`
+			Event Meta   `json:"event"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.Event.CartID != "cart1" {
+			t.Errorf("Expected: cart1. Received: %s", r.Event.CartID)
+		}
+		types = append(types, r.Type)
+	}
+
+	expected := []string{TypeCartCreated, TypeItemAdded, TypeItemRemoved}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("Expected: %v. Received: %v", expected, types)
+	}
+}
@@ -0,0 +1,145 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/roloum/store/api/internal/logging"
+)
+
+var (
+	//ErrEventsFileIsEmpty error returned when the file of the File sink is
+	//not set
+	ErrEventsFileIsEmpty = errors.New("EventsFileIsEmpty")
+
+	//ErrCouldNotPublishEvents error returned if a sink failed to publish
+	ErrCouldNotPublishEvents = errors.New("CouldNotPublishEvents")
+)
+
+//Sink publishes the events of the carts. Publish receives the events of a
+//batch of stream records in order, and returns an error if any of them could
+//not be published, so the batch is retried
+type Sink interface {
+	Publish(ctx context.Context, events []Event) error
+}
+
+//SinkFunc is a function that can be used as a Sink
+type SinkFunc func(ctx context.Context, events []Event) error
+
+//Publish calls f
+func (f SinkFunc) Publish(ctx context.Context, events []Event) error {
+	return f(ctx, events)
+}
+
+//Subscriber is a function that receives the events published to a Memory sink
+type Subscriber func(ctx context.Context, e Event)
+
+//Memory is a Sink that keeps the events in memory and delivers them to its
+//subscribers in the same process
+type Memory struct {
+	mu          sync.Mutex
+	events      []Event
+	subscribers []Subscriber
+}
+
+//NewMemory returns a Memory sink that delivers the events to the subscribers
+func NewMemory(subscribers ...Subscriber) *Memory {
+	return &Memory{subscribers: subscribers}
+}
+
+//Publish stores the events and delivers them to the subscribers
+func (m *Memory) Publish(ctx context.Context, events []Event) error {
+
+	m.mu.Lock()
+	m.events = append(m.events, events...)
+	m.mu.Unlock()
+
+	for _, e := range events {
+		for _, s := range m.subscribers {
+			s(ctx, e)
+		}
+	}
+
+	return nil
+}
+
+//Events returns the events published so far
+func (m *Memory) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Event(nil), m.events...)
+}
+
+//File is a Sink that appends the events to a file, one JSON object per line
+//with the type of the event and the event itself. It is meant for local
+//testing
+type File struct {
+	mu   sync.Mutex
+	path string
+}
+
+//record is the line of an event in the file of the File sink
+type record struct {
+	Type  string `json:"type"`
+	Event Event  `json:"event"`
+}
+
+//NewFile returns a File sink that appends the events to path
+func NewFile(path string) (*File, error) {
+	if path == "" {
+		return nil, ErrEventsFileIsEmpty
+	}
+	return &File{path: path}, nil
+}
+
+//Publish appends the events to the file
+func (f *File) Publish(ctx context.Context, events []Event) error {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Str("file", f.path).Msg("Error opening events file")
+		return ErrCouldNotPublishEvents
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, e := range events {
+		if err := encoder.Encode(record{Type: e.Type(), Event: e}); err != nil {
+			logging.Ctx(ctx).Error().Err(err).Str("type", e.Type()).Msg("Error writing event")
+			return ErrCouldNotPublishEvents
+		}
+	}
+
+	return nil
+}
+
+//Multi is a Sink that publishes the events to several sinks
+type Multi struct {
+	sinks []Sink
+}
+
+//NewMulti returns a Multi sink that publishes the events to the sinks in order
+func NewMulti(sinks ...Sink) *Multi {
+	return &Multi{sinks: sinks}
+}
+
+//Publish publishes the events to every sink, even if one of them fails, and
+//returns the first error
+func (m *Multi) Publish(ctx context.Context, events []Event) error {
+
+	var first error
+	for _, s := range m.sinks {
+		if err := s.Publish(ctx, events); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
@@ -0,0 +1,94 @@
+//Package logging carries a logger in the context of a request, with the
+//fields that correlate its log lines: the request ID, the trace, the user,
+//the cart and the item
+package logging
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	//FieldRequestID field of the ID of the API Gateway request
+	FieldRequestID = "request_id"
+
+	//FieldUserID field of the authenticated user
+	FieldUserID = "user_id"
+
+	//FieldCartID field of the cart
+	FieldCartID = "cart_id"
+
+	//FieldItemID field of the item
+	FieldItemID = "item_id"
+
+	//FieldTraceID field of the trace of the request
+	FieldTraceID = "trace_id"
+)
+
+//ctxKey is the key of the logger in the context
+type ctxKey struct{}
+
+//entry contains the fields of the logger of a context, so a field can be
+//replaced instead of repeated in the log lines
+type entry struct {
+	fields []field
+	logger zerolog.Logger
+}
+
+//field is a string field of the log lines
+type field struct {
+	key   string
+	value string
+}
+
+//With returns a copy of ctx whose logger has the field. The field replaces
+//the field of the logger of ctx with the same key. Empty values are not
+//added
+func With(ctx context.Context, key, value string) context.Context {
+
+	if value == "" {
+		return ctx
+	}
+
+	var fields []field
+	if e, ok := ctx.Value(ctxKey{}).(*entry); ok {
+		for _, f := range e.fields {
+			if f.key != key {
+				fields = append(fields, f)
+				continue
+			}
+			if f.value == value {
+				return ctx
+			}
+		}
+	}
+	fields = append(fields, field{key, value})
+
+	c := log.Logger.With()
+	for _, f := range fields {
+		c = c.Str(f.key, f.value)
+	}
+
+	return context.WithValue(ctx, ctxKey{}, &entry{fields: fields, logger: c.Logger()})
+}
+
+//WithCart returns a copy of ctx whose logger has the cart
+func WithCart(ctx context.Context, cartID string) context.Context {
+	return With(ctx, FieldCartID, cartID)
+}
+
+//WithItem returns a copy of ctx whose logger has the item
+func WithItem(ctx context.Context, itemID string) context.Context {
+	return With(ctx, FieldItemID, itemID)
+}
+
+//Ctx returns the logger of ctx, or the global logger when ctx does not have
+//one, e.g. outside of a request
+func Ctx(ctx context.Context) *zerolog.Logger {
+	if e, ok := ctx.Value(ctxKey{}).(*entry); ok {
+		return &e.logger
+	}
+	return &log.Logger
+}
@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+//TestWith tests the fields of the logger of the context
+func TestWith(t *testing.T) {
+
+	var buf bytes.Buffer
+	global := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = global }()
+
+	ctx := With(context.Background(), FieldRequestID, "r1")
+
+	tests := []struct {
+		desc     string
+		ctx      context.Context
+		expected map[string]interface{}
+	}{
+		{"Global", context.Background(), map[string]interface{}{}},
+		{"Request", ctx, map[string]interface{}{FieldRequestID: "r1"}},
+		{"Fields", WithItem(WithCart(ctx, "c1"), "i1"), map[string]interface{}{
+			FieldRequestID: "r1", FieldCartID: "c1", FieldItemID: "i1"}},
+		{"Replaced", WithCart(WithCart(ctx, "c1"), "c2"), map[string]interface{}{
+			FieldRequestID: "r1", FieldCartID: "c2"}},
+		{"Empty", WithCart(ctx, ""), map[string]interface{}{FieldRequestID: "r1"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+
+			buf.Reset()
+			Ctx(tc.ctx).Info().Msg("test")
+
+			//The fields are not repeated in the line
+			var line map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+				t.Fatal(err)
+			}
+			if n := bytes.Count(buf.Bytes(), []byte(`"`+FieldCartID+`"`)); n > 1 {
+				t.Errorf("Field %s repeated %d times: %s", FieldCartID, n, buf.String())
+			}
+
+			delete(line, "level")
+			delete(line, "message")
+			if len(line) != len(tc.expected) {
+				t.Errorf("Expected: %v. Received: %v", tc.expected, line)
+			}
+			for k, v := range tc.expected {
+				if line[k] != v {
+					t.Errorf("Expected %s: %v. Received: %v", k, v, line[k])
+				}
+			}
+		})
+	}
+}
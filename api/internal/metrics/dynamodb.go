@@ -0,0 +1,206 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+//total is the value of ReturnConsumedCapacity of every call
+var total = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+
+//DynamoDB is a DynamoDB client that records the latency and the outcome of
+//the calls of the store, and requests the capacity they consume. The capacity
+//is attributed to the operation of the context of the call. The calls that
+//are not used by the store go straight to the client
+type DynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	recorder Recorder
+}
+
+//NewDynamoDB returns a client that records the metrics of the calls of svc
+func NewDynamoDB(svc dynamodbiface.DynamoDBAPI, r Recorder) *DynamoDB {
+	return &DynamoDB{DynamoDBAPI: svc, recorder: r}
+}
+
+//observe records the call started at start, and the capacity it consumed
+func (d *DynamoDB) observe(ctx context.Context, call string, start time.Time,
+	err error, consumed ...*dynamodb.ConsumedCapacity) {
+
+	d.recorder.Observe("dynamodb."+call, Outcome(err), time.Since(start))
+
+	op := Operation(ctx)
+	for _, c := range consumed {
+		if c == nil || c.CapacityUnits == nil {
+			continue
+		}
+		d.recorder.Consume(op, aws.StringValue(c.TableName),
+			aws.Float64Value(c.CapacityUnits))
+	}
+}
+
+//GetItemWithContext records the metrics of GetItem
+func (d *DynamoDB) GetItemWithContext(ctx aws.Context,
+	input *dynamodb.GetItemInput, opts ...request.Option) (
+	*dynamodb.GetItemOutput, error) {
+
+	in := *input
+	in.ReturnConsumedCapacity = total
+
+	start := time.Now()
+	out, err := d.DynamoDBAPI.GetItemWithContext(ctx, &in, opts...)
+	if out == nil {
+		d.observe(ctx, "GetItem", start, err)
+		return out, err
+	}
+	d.observe(ctx, "GetItem", start, err, out.ConsumedCapacity)
+	return out, err
+}
+
+//PutItemWithContext records the metrics of PutItem
+func (d *DynamoDB) PutItemWithContext(ctx aws.Context,
+	input *dynamodb.PutItemInput, opts ...request.Option) (
+	*dynamodb.PutItemOutput, error) {
+
+	in := *input
+	in.ReturnConsumedCapacity = total
+
+	start := time.Now()
+	out, err := d.DynamoDBAPI.PutItemWithContext(ctx, &in, opts...)
+	if out == nil {
+		d.observe(ctx, "PutItem", start, err)
+		return out, err
+	}
+	d.observe(ctx, "PutItem", start, err, out.ConsumedCapacity)
+	return out, err
+}
+
+//UpdateItemWithContext records the metrics of UpdateItem
+func (d *DynamoDB) UpdateItemWithContext(ctx aws.Context,
+	input *dynamodb.UpdateItemInput, opts ...request.Option) (
+	*dynamodb.UpdateItemOutput, error) {
+
+	in := *input
+	in.ReturnConsumedCapacity = total
+
+	start := time.Now()
+	out, err := d.DynamoDBAPI.UpdateItemWithContext(ctx, &in, opts...)
+	if out == nil {
+		d.observe(ctx, "UpdateItem", start, err)
+		return out, err
+	}
+	d.observe(ctx, "UpdateItem", start, err, out.ConsumedCapacity)
+	return out, err
+}
+
+//DeleteItemWithContext records the metrics of DeleteItem
+func (d *DynamoDB) DeleteItemWithContext(ctx aws.Context,
+	input *dynamodb.DeleteItemInput, opts ...request.Option) (
+	*dynamodb.DeleteItemOutput, error) {
+
+	in := *input
+	in.ReturnConsumedCapacity = total
+
+	start := time.Now()
+	out, err := d.DynamoDBAPI.DeleteItemWithContext(ctx, &in, opts...)
+	if out == nil {
+		d.observe(ctx, "DeleteItem", start, err)
+		return out, err
+	}
+	d.observe(ctx, "DeleteItem", start, err, out.ConsumedCapacity)
+	return out, err
+}
+
+//QueryWithContext records the metrics of Query
+func (d *DynamoDB) QueryWithContext(ctx aws.Context,
+	input *dynamodb.QueryInput, opts ...request.Option) (
+	*dynamodb.QueryOutput, error) {
+
+	in := *input
+	in.ReturnConsumedCapacity = total
+
+	start := time.Now()
+	out, err := d.DynamoDBAPI.QueryWithContext(ctx, &in, opts...)
+	if out == nil {
+		d.observe(ctx, "Query", start, err)
+		return out, err
+	}
+	d.observe(ctx, "Query", start, err, out.ConsumedCapacity)
+	return out, err
+}
+
+//ScanWithContext records the metrics of Scan
+func (d *DynamoDB) ScanWithContext(ctx aws.Context,
+	input *dynamodb.ScanInput, opts ...request.Option) (
+	*dynamodb.ScanOutput, error) {
+
+	in := *input
+	in.ReturnConsumedCapacity = total
+
+	start := time.Now()
+	out, err := d.DynamoDBAPI.ScanWithContext(ctx, &in, opts...)
+	if out == nil {
+		d.observe(ctx, "Scan", start, err)
+		return out, err
+	}
+	d.observe(ctx, "Scan", start, err, out.ConsumedCapacity)
+	return out, err
+}
+
+//BatchGetItemWithContext records the metrics of BatchGetItem
+func (d *DynamoDB) BatchGetItemWithContext(ctx aws.Context,
+	input *dynamodb.BatchGetItemInput, opts ...request.Option) (
+	*dynamodb.BatchGetItemOutput, error) {
+
+	in := *input
+	in.ReturnConsumedCapacity = total
+
+	start := time.Now()
+	out, err := d.DynamoDBAPI.BatchGetItemWithContext(ctx, &in, opts...)
+	if out == nil {
+		d.observe(ctx, "BatchGetItem", start, err)
+		return out, err
+	}
+	d.observe(ctx, "BatchGetItem", start, err, out.ConsumedCapacity...)
+	return out, err
+}
+
+//BatchWriteItemWithContext records the metrics of BatchWriteItem
+func (d *DynamoDB) BatchWriteItemWithContext(ctx aws.Context,
+	input *dynamodb.BatchWriteItemInput, opts ...request.Option) (
+	*dynamodb.BatchWriteItemOutput, error) {
+
+	in := *input
+	in.ReturnConsumedCapacity = total
+
+	start := time.Now()
+	out, err := d.DynamoDBAPI.BatchWriteItemWithContext(ctx, &in, opts...)
+	if out == nil {
+		d.observe(ctx, "BatchWriteItem", start, err)
+		return out, err
+	}
+	d.observe(ctx, "BatchWriteItem", start, err, out.ConsumedCapacity...)
+	return out, err
+}
+
+//TransactWriteItemsWithContext records the metrics of TransactWriteItems
+func (d *DynamoDB) TransactWriteItemsWithContext(ctx aws.Context,
+	input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (
+	*dynamodb.TransactWriteItemsOutput, error) {
+
+	in := *input
+	in.ReturnConsumedCapacity = total
+
+	start := time.Now()
+	out, err := d.DynamoDBAPI.TransactWriteItemsWithContext(ctx, &in, opts...)
+	if out == nil {
+		d.observe(ctx, "TransactWriteItems", start, err)
+		return out, err
+	}
+	d.observe(ctx, "TransactWriteItems", start, err, out.ConsumedCapacity...)
+	return out, err
+}
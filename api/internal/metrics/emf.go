@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	//DefaultNamespace CloudWatch namespace of the metrics
+	DefaultNamespace = "Store"
+
+	//MetricOperations name of the count of the operations
+	MetricOperations = "Operations"
+
+	//MetricLatency name of the latency of the operations
+	MetricLatency = "Latency"
+
+	//MetricConsumedCapacity name of the capacity units consumed by the
+	//DynamoDB calls
+	MetricConsumedCapacity = "ConsumedCapacity"
+)
+
+type (
+	//emfMetadata is the _aws object of an EMF log line. It tells CloudWatch
+	//which properties of the line are metrics and which are dimensions
+	emfMetadata struct {
+		Timestamp         int64       `json:"Timestamp"`
+		CloudWatchMetrics []emfMetric `json:"CloudWatchMetrics"`
+	}
+
+	//emfMetric is the metric directive of a namespace
+	emfMetric struct {
+		Namespace  string       `json:"Namespace"`
+		Dimensions [][]string   `json:"Dimensions"`
+		Metrics    []emfMeasure `json:"Metrics"`
+	}
+
+	//emfMeasure is the name and the unit of a metric
+	emfMeasure struct {
+		Name string `json:"Name"`
+		Unit string `json:"Unit"`
+	}
+)
+
+//EMF is a Recorder that writes every metric as a log line in the CloudWatch
+//Embedded Metric Format. CloudWatch extracts the metrics from the logs of the
+//lambda functions, so they are recorded without calls to the CloudWatch API
+type EMF struct {
+	mu        sync.Mutex
+	w         io.Writer
+	namespace string
+	now       func() time.Time
+}
+
+//NewEMF returns an EMF Recorder that writes the lines to w, the standard
+//output in the lambda functions
+func NewEMF(w io.Writer, namespace string) *EMF {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	return &EMF{w: w, namespace: namespace, now: time.Now}
+}
+
+//Observe writes the count and the latency of an operation, with the
+//operation and the outcome as dimensions
+func (e *EMF) Observe(operation, outcome string, latency time.Duration) {
+	e.write([]string{"Operation", "Outcome"}, map[string]interface{}{
+		"Operation":      operation,
+		"Outcome":        outcome,
+		MetricOperations: 1,
+		MetricLatency:    float64(latency) / float64(time.Millisecond),
+	}, emfMeasure{MetricOperations, "Count"},
+		emfMeasure{MetricLatency, "Milliseconds"})
+}
+
+//Consume writes the capacity units consumed in a table, with the operation
+//and the table as dimensions
+func (e *EMF) Consume(operation, table string, units float64) {
+	e.write([]string{"Operation", "Table"}, map[string]interface{}{
+		"Operation":            operation,
+		"Table":                table,
+		MetricConsumedCapacity: units,
+	}, emfMeasure{MetricConsumedCapacity, "Count"})
+}
+
+//write writes a line with the properties and the directive of the metrics.
+//The lines of concurrent requests are not interleaved
+func (e *EMF) write(dimensions []string, properties map[string]interface{},
+	measures ...emfMeasure) {
+
+	properties["_aws"] = emfMetadata{
+		Timestamp: e.now().UnixNano() / int64(time.Millisecond),
+		CloudWatchMetrics: []emfMetric{{
+			Namespace:  e.namespace,
+			Dimensions: [][]string{dimensions},
+			Metrics:    measures,
+		}},
+	}
+
+	js, err := json.Marshal(properties)
+	if err != nil {
+		log.Error().Err(err).Msg("Error marshalling metric")
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, err := e.w.Write(append(js, '\n')); err != nil {
+		log.Error().Err(err).Msg("Error writing metric")
+	}
+}
@@ -0,0 +1,88 @@
+//Package metrics records the count, the latency and the outcome of the
+//operations of the store, and the capacity consumed by their DynamoDB calls.
+//The lambda functions write the metrics in the CloudWatch Embedded Metric
+//Format, the local server exposes them to Prometheus
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+const (
+	//OutcomeSuccess outcome of the operations that do not fail
+	OutcomeSuccess = "Success"
+
+	//OperationNone operation of the DynamoDB calls made outside of an
+	//operation
+	OperationNone = "None"
+)
+
+//Recorder records the metrics. Its methods are called by concurrent requests
+type Recorder interface {
+	//Observe records an operation with its outcome and its latency
+	Observe(operation, outcome string, latency time.Duration)
+
+	//Consume records the capacity units consumed in a table by an operation
+	Consume(operation, table string, units float64)
+}
+
+//Nop is a Recorder that discards the metrics
+type Nop struct{}
+
+//Observe discards the operation
+func (Nop) Observe(operation, outcome string, latency time.Duration) {}
+
+//Consume discards the capacity
+func (Nop) Consume(operation, table string, units float64) {}
+
+//ctxKey is the key of the operation in the context
+type ctxKey struct{}
+
+//WithOperation returns a copy of ctx with the operation. The capacity
+//consumed by the DynamoDB calls made with ctx is attributed to it
+func WithOperation(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, operation)
+}
+
+//Operation returns the operation of ctx, or OperationNone
+func Operation(ctx context.Context) string {
+	if op, ok := ctx.Value(ctxKey{}).(string); ok {
+		return op
+	}
+	return OperationNone
+}
+
+//Start starts an operation. It returns a copy of ctx with the operation, and
+//the function that records its outcome and its latency when it ends
+func Start(ctx context.Context, r Recorder, operation string) (
+	context.Context, func(error)) {
+
+	start := time.Now()
+	return WithOperation(ctx, operation), func(err error) {
+		r.Observe(operation, Outcome(err), time.Since(start))
+	}
+}
+
+//Outcome returns the outcome of an operation that returned err: the code of
+//the AWS errors, or the innermost error wrapped by err, so the errors that
+//describe a value, like the limits of the cart, are reported by their code
+func Outcome(err error) string {
+
+	if err == nil {
+		return OutcomeSuccess
+	}
+
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code()
+	}
+
+	for errors.Unwrap(err) != nil {
+		err = errors.Unwrap(err)
+	}
+	return err.Error()
+}
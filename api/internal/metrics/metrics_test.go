@@ -0,0 +1,234 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/roloum/store/api/internal/test"
+)
+
+//recorder keeps the metrics it records
+type recorder struct {
+	observed []string
+	consumed map[string]float64
+}
+
+//Observe keeps the operation and its outcome
+func (r *recorder) Observe(operation, outcome string, latency time.Duration) {
+	r.observed = append(r.observed, operation+" "+outcome)
+}
+
+//Consume adds the capacity consumed by the operation in the table
+func (r *recorder) Consume(operation, table string, units float64) {
+	if r.consumed == nil {
+		r.consumed = map[string]float64{}
+	}
+	r.consumed[operation+" "+table] += units
+}
+
+//limitError is an error that describes a value and wraps its code
+type limitError struct{}
+
+func (limitError) Error() string { return "QuantityLimitExceeded: lines is limited to 2" }
+func (limitError) Unwrap() error { return errors.New("QuantityLimitExceeded") }
+
+//TestOutcome tests the outcomes of the errors
+func TestOutcome(t *testing.T) {
+
+	tests := []struct {
+		desc     string
+		err      error
+		expected string
+	}{
+		{"Success", nil, OutcomeSuccess},
+		{"Sentinel", errors.New("ItemDoesNotExist"), "ItemDoesNotExist"},
+		{"Wrapped", limitError{}, "QuantityLimitExceeded"},
+		{"AWS", awserr.New(dynamodb.ErrCodeTransactionCanceledException,
+			"Transaction cancelled", nil), dynamodb.ErrCodeTransactionCanceledException},
+		{"WrappedAWS", fmt.Errorf("query: %w", awserr.New(
+			dynamodb.ErrCodeProvisionedThroughputExceededException, "", nil)),
+			dynamodb.ErrCodeProvisionedThroughputExceededException},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			if o := Outcome(tc.err); o != tc.expected {
+				t.Errorf("Expected: %s. Received: %s", tc.expected, o)
+			}
+		})
+	}
+}
+
+//TestStart tests that the operation is recorded with its outcome, and that
+//the context carries the operation
+func TestStart(t *testing.T) {
+
+	r := &recorder{}
+
+	if op := Operation(context.Background()); op != OperationNone {
+		t.Errorf("Expected: %s. Received: %s", OperationNone, op)
+	}
+
+	ctx, end := Start(context.Background(), r, "cart.AddItem")
+	if op := Operation(ctx); op != "cart.AddItem" {
+		t.Errorf("Expected: cart.AddItem. Received: %s", op)
+	}
+	end(errors.New("ItemDoesNotExist"))
+
+	expected := []string{"cart.AddItem ItemDoesNotExist"}
+	if !reflect.DeepEqual(r.observed, expected) {
+		t.Errorf("Expected: %v. Received: %v", expected, r.observed)
+	}
+}
+
+//TestEMF tests the lines in the Embedded Metric Format
+func TestEMF(t *testing.T) {
+
+	var buf bytes.Buffer
+	e := NewEMF(&buf, "")
+	e.now = func() time.Time { return time.Unix(1600000000, 0) }
+
+	e.Observe("cart.Load", OutcomeSuccess, 1500*time.Microsecond)
+	e.Consume("cart.Load", "Store", 0.5)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines. Received: %s", buf.String())
+	}
+
+	tests := []struct {
+		desc       string
+		line       string
+		dimensions []string
+		values     map[string]interface{}
+	}{
+		{"Observe", lines[0], []string{"Operation", "Outcome"}, map[string]interface{}{
+			"Operation": "cart.Load", "Outcome": OutcomeSuccess,
+			MetricOperations: 1.0, MetricLatency: 1.5}},
+		{"Consume", lines[1], []string{"Operation", "Table"}, map[string]interface{}{
+			"Operation": "cart.Load", "Table": "Store", MetricConsumedCapacity: 0.5}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+
+			var line struct {
+				AWS emfMetadata `json:"_aws"`
+			}
+			if err := json.Unmarshal([]byte(tc.line), &line); err != nil {
+				t.Fatal(err)
+			}
+			if line.AWS.Timestamp != 1600000000000 ||
+				len(line.AWS.CloudWatchMetrics) != 1 ||
+				line.AWS.CloudWatchMetrics[0].Namespace != DefaultNamespace ||
+				!reflect.DeepEqual(line.AWS.CloudWatchMetrics[0].Dimensions,
+					[][]string{tc.dimensions}) {
+				t.Errorf("Unexpected metadata: %+v", line.AWS)
+			}
+
+			//Every metric of the directive is a property of the line
+			var properties map[string]interface{}
+			json.Unmarshal([]byte(tc.line), &properties)
+			for _, m := range line.AWS.CloudWatchMetrics[0].Metrics {
+				if _, ok := properties[m.Name]; !ok {
+					t.Errorf("Metric %s is not in the line", m.Name)
+				}
+			}
+			for k, v := range tc.values {
+				if properties[k] != v {
+					t.Errorf("Expected %s: %v. Received: %v", k, v, properties[k])
+				}
+			}
+		})
+	}
+}
+
+//TestPrometheus tests the metrics in the Prometheus text format
+func TestPrometheus(t *testing.T) {
+
+	p := NewPrometheus(0.01, 0.1)
+	p.Observe("cart.AddItem", OutcomeSuccess, 5*time.Millisecond)
+	p.Observe("cart.AddItem", OutcomeSuccess, 50*time.Millisecond)
+	p.Observe("cart.AddItem", "ItemDoesNotExist", 2*time.Millisecond)
+	p.Consume("cart.Load", "Store", 0.5)
+	p.Consume("cart.Load", "Store", 1)
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Header().Get("Content-Type") != ContentTypePrometheus {
+		t.Errorf("Unexpected content type: %s", w.Header().Get("Content-Type"))
+	}
+
+	body := w.Body.String()
+	for _, expected := range []string{
+		`store_operations_total{operation="cart.AddItem",outcome="ItemDoesNotExist"} 1`,
+		`store_operations_total{operation="cart.AddItem",outcome="Success"} 2`,
+		`store_operation_duration_seconds_bucket{operation="cart.AddItem",outcome="Success",le="0.01"} 1`,
+		`store_operation_duration_seconds_bucket{operation="cart.AddItem",outcome="Success",le="0.1"} 2`,
+		`store_operation_duration_seconds_bucket{operation="cart.AddItem",outcome="Success",le="+Inf"} 2`,
+		`store_operation_duration_seconds_sum{operation="cart.AddItem",outcome="Success"} 0.055`,
+		`store_operation_duration_seconds_count{operation="cart.AddItem",outcome="Success"} 2`,
+		`store_dynamodb_consumed_capacity_total{operation="cart.Load",table="Store"} 1.5`,
+	} {
+		if !strings.Contains(body, expected+"\n") {
+			t.Errorf("Expected line %s in:\n%s", expected, body)
+		}
+	}
+
+	if strings.Index(body, `outcome="ItemDoesNotExist"`) >
+		strings.Index(body, `outcome="Success"`) {
+		t.Errorf("Expected series sorted by labels:\n%s", body)
+	}
+}
+
+//TestDynamoDB tests that the calls are recorded with the capacity they
+//consume, attributed to the operation of the context
+func TestDynamoDB(t *testing.T) {
+
+	capacity := func(units float64) *dynamodb.ConsumedCapacity {
+		return &dynamodb.ConsumedCapacity{TableName: aws.String("Store"),
+			CapacityUnits: aws.Float64(units)}
+	}
+
+	r := &recorder{}
+	svc := NewDynamoDB(&test.MockDynamoDB{
+		QueryOutput: &dynamodb.QueryOutput{ConsumedCapacity: capacity(0.5)},
+		TransactWriteItemsOutput: &dynamodb.TransactWriteItemsOutput{
+			ConsumedCapacity: []*dynamodb.ConsumedCapacity{capacity(2), capacity(4)}},
+	}, r)
+
+	input := &dynamodb.QueryInput{TableName: aws.String("Store")}
+	ctx := WithOperation(context.Background(), "cart.Load")
+	if _, err := svc.QueryWithContext(ctx, input); err != nil {
+		t.Fatal(err)
+	}
+	if input.ReturnConsumedCapacity != nil {
+		t.Errorf("Expected the input of the caller unchanged")
+	}
+	if _, err := svc.TransactWriteItemsWithContext(context.Background(),
+		&dynamodb.TransactWriteItemsInput{}); err != nil {
+		t.Fatal(err)
+	}
+
+	observed := []string{"dynamodb.Query Success", "dynamodb.TransactWriteItems Success"}
+	if !reflect.DeepEqual(r.observed, observed) {
+		t.Errorf("Expected: %v. Received: %v", observed, r.observed)
+	}
+	consumed := map[string]float64{"cart.Load Store": 0.5, OperationNone + " Store": 6}
+	if !reflect.DeepEqual(r.consumed, consumed) {
+		t.Errorf("Expected: %v. Received: %v", consumed, r.consumed)
+	}
+}
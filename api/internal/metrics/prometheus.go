@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//ContentTypePrometheus content type of the Prometheus text format
+	ContentTypePrometheus = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	//DefaultBuckets upper bounds in seconds of the buckets of the latency
+	//histograms, the default buckets of the Prometheus clients
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	//labelEscaper escapes the values of the labels
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+type (
+	//series is a pair of label values of a metric
+	series struct {
+		first  string
+		second string
+	}
+
+	//histogram counts the observations of a series by bucket
+	histogram struct {
+		buckets []uint64
+		sum     float64
+		count   uint64
+	}
+)
+
+//Prometheus is a Recorder that keeps the metrics in memory and serves them in
+//the Prometheus text format, for the local server
+type Prometheus struct {
+	mu         sync.Mutex
+	buckets    []float64
+	operations map[series]*histogram
+	capacity   map[series]float64
+}
+
+//NewPrometheus returns a Prometheus Recorder with the buckets of the latency
+//histograms, or DefaultBuckets when there are none
+func NewPrometheus(buckets ...float64) *Prometheus {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return &Prometheus{
+		buckets:    buckets,
+		operations: map[series]*histogram{},
+		capacity:   map[series]float64{},
+	}
+}
+
+//Observe counts the operation and adds its latency to its histogram
+func (p *Prometheus) Observe(operation, outcome string, latency time.Duration) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := series{operation, outcome}
+	h, ok := p.operations[s]
+	if !ok {
+		h = &histogram{buckets: make([]uint64, len(p.buckets))}
+		p.operations[s] = h
+	}
+
+	seconds := latency.Seconds()
+	for n, le := range p.buckets {
+		if seconds <= le {
+			h.buckets[n]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+//Consume adds the capacity units to the capacity consumed in the table
+func (p *Prometheus) Consume(operation, table string, units float64) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.capacity[series{operation, table}] += units
+}
+
+//ServeHTTP writes the metrics in the Prometheus text format
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	var buf bytes.Buffer
+	p.write(&buf)
+
+	w.Header().Set("Content-Type", ContentTypePrometheus)
+	w.Write(buf.Bytes())
+}
+
+//write writes the metrics, sorted by their labels so the output is stable
+func (p *Prometheus) write(buf *bytes.Buffer) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	operations := make([]series, 0, len(p.operations))
+	for s := range p.operations {
+		operations = append(operations, s)
+	}
+	sortSeries(operations)
+
+	buf.WriteString("# HELP store_operations_total Operations by outcome.\n")
+	buf.WriteString("# TYPE store_operations_total counter\n")
+	for _, s := range operations {
+		fmt.Fprintf(buf, "store_operations_total{%s} %d\n",
+			labels("operation", s.first, "outcome", s.second),
+			p.operations[s].count)
+	}
+
+	buf.WriteString("# HELP store_operation_duration_seconds Latency of the operations.\n")
+	buf.WriteString("# TYPE store_operation_duration_seconds histogram\n")
+	for _, s := range operations {
+		h := p.operations[s]
+		for n, le := range p.buckets {
+			fmt.Fprintf(buf, "store_operation_duration_seconds_bucket{%s} %d\n",
+				labels("operation", s.first, "outcome", s.second,
+					"le", formatFloat(le)), h.buckets[n])
+		}
+		fmt.Fprintf(buf, "store_operation_duration_seconds_bucket{%s} %d\n",
+			labels("operation", s.first, "outcome", s.second, "le", "+Inf"),
+			h.count)
+		fmt.Fprintf(buf, "store_operation_duration_seconds_sum{%s} %s\n",
+			labels("operation", s.first, "outcome", s.second), formatFloat(h.sum))
+		fmt.Fprintf(buf, "store_operation_duration_seconds_count{%s} %d\n",
+			labels("operation", s.first, "outcome", s.second), h.count)
+	}
+
+	capacity := make([]series, 0, len(p.capacity))
+	for s := range p.capacity {
+		capacity = append(capacity, s)
+	}
+	sortSeries(capacity)
+
+	buf.WriteString("# HELP store_dynamodb_consumed_capacity_total Capacity units consumed by the DynamoDB calls.\n")
+	buf.WriteString("# TYPE store_dynamodb_consumed_capacity_total counter\n")
+	for _, s := range capacity {
+		fmt.Fprintf(buf, "store_dynamodb_consumed_capacity_total{%s} %s\n",
+			labels("operation", s.first, "table", s.second),
+			formatFloat(p.capacity[s]))
+	}
+}
+
+//sortSeries sorts the series by their label values
+func sortSeries(s []series) {
+	sort.Slice(s, func(i, j int) bool {
+		if s[i].first != s[j].first {
+			return s[i].first < s[j].first
+		}
+		return s[i].second < s[j].second
+	})
+}
+
+//labels returns the labels of the pairs of names and values
+func labels(pairs ...string) string {
+	var l []string
+	for n := 0; n+1 < len(pairs); n += 2 {
+		l = append(l, fmt.Sprintf(`%s="%s"`, pairs[n],
+			labelEscaper.Replace(pairs[n+1])))
+	}
+	return strings.Join(l, ",")
+}
+
+//formatFloat formats a value in the shortest representation
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,111 @@
+package openapi
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+//Constraint applies the rule of a validate tag, with its parameter, to the
+//schema of a field
+type Constraint func(s *Schema, param string)
+
+//constraints are the Constraints of the validator rules used by the models.
+//The rules without a Constraint, e.g. required_with, are not described
+var constraints = map[string]Constraint{
+	"min":   lower(false),
+	"gte":   lower(false),
+	"gt":    lower(true),
+	"max":   upper(false),
+	"lte":   upper(false),
+	"lt":    upper(true),
+	"len":   length,
+	"oneof": oneOf,
+	"url":   format("uri"),
+	"email": format("email"),
+	"uuid":  format("uuid"),
+	"unique": func(s *Schema, param string) {
+		s.UniqueItems = true
+	},
+}
+
+//Minimum returns a Constraint that sets the minimum of a number, e.g. for a
+//custom rule that rejects prices below zero
+func Minimum(min float64) Constraint {
+	return func(s *Schema, param string) {
+		s.Minimum = &min
+	}
+}
+
+//lower returns the Constraint of a lower bound. The bound of the strings is
+//their length, and the bound of the arrays their number of items
+func lower(exclusive bool) Constraint {
+	return func(s *Schema, param string) {
+
+		v, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return
+		}
+
+		switch s.Type {
+		case "number", "integer":
+			s.Minimum, s.ExclusiveMinimum = &v, exclusive
+		case "string":
+			s.MinLength = count(v, exclusive, 1)
+		case "array":
+			s.MinItems = count(v, exclusive, 1)
+		}
+	}
+}
+
+//upper returns the Constraint of an upper bound
+func upper(exclusive bool) Constraint {
+	return func(s *Schema, param string) {
+
+		v, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return
+		}
+
+		switch s.Type {
+		case "number", "integer":
+			s.Maximum, s.ExclusiveMaximum = &v, exclusive
+		case "string":
+			s.MaxLength = count(v, exclusive, -1)
+		case "array":
+			s.MaxItems = count(v, exclusive, -1)
+		}
+	}
+}
+
+//length is the Constraint of the len rule
+func length(s *Schema, param string) {
+	lower(false)(s, param)
+	upper(false)(s, param)
+}
+
+//oneOf is the Constraint of the oneof rule, a list of values separated by
+//spaces
+func oneOf(s *Schema, param string) {
+	if s.Type == "string" {
+		s.Enum = strings.Fields(param)
+	}
+}
+
+//format returns the Constraint of a rule that validates a string format
+func format(f string) Constraint {
+	return func(s *Schema, param string) {
+		if s.Type == "string" {
+			s.Format = f
+		}
+	}
+}
+
+//count returns a bound of a length. An exclusive bound is moved by step
+func count(v float64, exclusive bool, step int) *int {
+	n := int(math.Ceil(v))
+	if exclusive {
+		n += step
+	}
+	return &n
+}
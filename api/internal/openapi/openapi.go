@@ -0,0 +1,342 @@
+//Package openapi generates the OpenAPI 3 document of the routes of a
+//web.Router. The schemas of the bodies are built from the Go types, with the
+//validate tags as constraints
+package openapi
+
+import (
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/roloum/store/api/internal/web"
+)
+
+const (
+	//Version version of the OpenAPI specification of the document
+	Version = "3.0.3"
+
+	//ContentType content type of the bodies of the requests and responses
+	ContentType = "application/json"
+
+	//SchemaError name of the schema of the error responses
+	SchemaError = "Error"
+
+	//SecurityBearer name of the security scheme of the bearer tokens
+	SecurityBearer = "bearerAuth"
+)
+
+//Generator builds the OpenAPI document of a list of routes
+type Generator struct {
+	info        Info
+	constraints map[string]Constraint
+	schemas     map[string]*Schema
+}
+
+//Option configures a Generator
+type Option func(g *Generator)
+
+//WithConstraint sets the Constraint of a custom validate tag
+func WithConstraint(tag string, c Constraint) Option {
+	return func(g *Generator) {
+		g.constraints[tag] = c
+	}
+}
+
+//New returns a Generator of documents with the title and version of info
+func New(info Info, opts ...Option) *Generator {
+
+	g := &Generator{info: info, constraints: map[string]Constraint{}}
+	for tag, c := range constraints {
+		g.constraints[tag] = c
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	return g
+}
+
+//Document returns the OpenAPI document of the routes
+func (g *Generator) Document(routes []web.Route) *Document {
+
+	g.schemas = map[string]*Schema{
+		SchemaError: {
+			Type: "string",
+			Description: "Error code. The codes of the limit errors are followed by " +
+				"the description of the limit, and malformed bodies return the " +
+				"error of the JSON decoder",
+		},
+	}
+
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    g.info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: g.schemas,
+			SecuritySchemes: map[string]SecurityScheme{
+				SecurityBearer: {
+					Type:         "http",
+					Scheme:       "bearer",
+					BearerFormat: "JWT",
+					Description: "Optional in the public routes, where it identifies " +
+						"the user. Invalid tokens are rejected with 401",
+				},
+			},
+		},
+	}
+
+	for _, route := range routes {
+		item, ok := doc.Paths[route.Path]
+		if !ok {
+			item = PathItem{}
+			doc.Paths[route.Path] = item
+		}
+		item[strings.ToLower(route.Method)] = g.operation(route)
+	}
+
+	return doc
+}
+
+//operation returns the Operation of a route
+func (g *Generator) operation(route web.Route) *Operation {
+
+	op := &Operation{
+		Summary:   route.Summary,
+		Responses: map[string]*Response{},
+		Security: []map[string][]string{
+			{SecurityBearer: {}},
+		},
+	}
+	if !route.Secured {
+		op.Security = append([]map[string][]string{{}}, op.Security...)
+	}
+
+	//Properties of the body that are sent as parameters
+	omit := map[string]bool{}
+	for _, name := range route.Omit {
+		omit[name] = true
+	}
+
+	for _, segment := range strings.Split(route.Path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			name := segment[1 : len(segment)-1]
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+			omit[name] = true
+		}
+	}
+
+	var query []string
+	for name := range route.Query {
+		query = append(query, name)
+	}
+	sort.Strings(query)
+	for _, name := range query {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:   name,
+			In:     "query",
+			Schema: g.schema(reflect.TypeOf(route.Query[name])),
+		})
+		omit[name] = true
+	}
+
+	if route.Body != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]MediaType{
+				ContentType: {Schema: g.body(route.Body, omit)},
+			},
+		}
+	}
+
+	response := &Response{Description: http.StatusText(route.Status)}
+	if route.Response != nil {
+		response.Content = map[string]MediaType{
+			ContentType: {Schema: g.schema(reflect.TypeOf(route.Response))},
+		}
+	}
+	op.Responses[strconv.Itoa(route.Status)] = response
+
+	for status, codes := range route.Errors {
+		op.Responses[strconv.Itoa(status)] = &Response{
+			Description: http.StatusText(status) + ". Error codes: " +
+				strings.Join(codes, ", "),
+			Content: map[string]MediaType{
+				ContentType: {Schema: &Schema{Ref: ref(SchemaError)}},
+			},
+		}
+	}
+
+	return op
+}
+
+//body returns the schema of a request body, without the omitted properties.
+//The schema is not shared with the other routes, since the omitted
+//properties depend on the route
+func (g *Generator) body(body interface{}, omit map[string]bool) *Schema {
+
+	t := reflect.TypeOf(body)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return g.schema(t)
+	}
+
+	s := g.object(t)
+	var required []string
+	for _, name := range s.Required {
+		if !omit[name] {
+			required = append(required, name)
+		}
+	}
+	s.Required = required
+	for name := range omit {
+		delete(s.Properties, name)
+	}
+
+	return s
+}
+
+//schema returns the schema of a type. Named structs are added to the
+//components, and referenced
+func (g *Generator) schema(t reflect.Type) *Schema {
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == reflect.TypeOf(time.Time{}) {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		//encoding/json encodes []byte in base64
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := path.Base(t.PkgPath()) + "." + t.Name()
+		if _, ok := g.schemas[name]; !ok {
+			//The placeholder stops the recursion of the types that contain
+			//themselves
+			g.schemas[name] = &Schema{}
+			*g.schemas[name] = *g.object(t)
+		}
+		return &Schema{Ref: ref(name)}
+	}
+
+	return &Schema{}
+}
+
+//object returns the schema of the JSON object of a struct
+func (g *Generator) object(t reflect.Type) *Schema {
+
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for n := 0; n < t.NumField(); n++ {
+		f := t.Field(n)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		//The fields of embedded structs are promoted to the object
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded := g.object(ft)
+				for p, ps := range embedded.Properties {
+					s.Properties[p] = ps
+				}
+				s.Required = append(s.Required, embedded.Required...)
+				continue
+			}
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		ps := g.schema(f.Type)
+		if g.constrain(ps, f.Tag.Get("validate")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = ps
+	}
+
+	return s
+}
+
+//constrain applies the constraints of a validate tag to the schema of a
+//field. It returns true if the field is required
+func (g *Generator) constrain(s *Schema, tag string) bool {
+
+	var required, dive bool
+	for _, rule := range strings.Split(tag, ",") {
+		name, param := rule, ""
+		if n := strings.Index(rule, "="); n >= 0 {
+			name, param = rule[:n], rule[n+1:]
+		}
+
+		switch {
+		case name == "dive":
+			//The rules after dive validate the elements
+			dive = true
+			if s != nil {
+				s = s.Items
+			}
+		case name == "required":
+			required = required || !dive
+		case s == nil || s.Ref != "":
+		default:
+			if c, ok := g.constraints[name]; ok {
+				c(s, param)
+			}
+		}
+	}
+
+	return required
+}
+
+//ref returns the reference of a schema of the components
+func ref(name string) string {
+	return "#/components/schemas/" + name
+}
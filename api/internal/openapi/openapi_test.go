@@ -0,0 +1,143 @@
+package openapi
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/roloum/store/api/internal/web"
+)
+
+type (
+	//line is a type of the response of the test route
+	line struct {
+		ItemID string `json:"item_id"`
+		Tags   []string
+		hidden string
+	}
+
+	//order is the type of the bodies of the test route
+	order struct {
+		OrderID   string    `json:"order_id" validate:"required"`
+		Name      string    `json:"name" validate:"required,max=100"`
+		Quantity  int       `json:"quantity" validate:"required,positive"`
+		Price     float32   `json:"price" validate:"gt=0"`
+		Status    string    `json:"status" validate:"oneof=open closed"`
+		Callback  string    `json:"callback" validate:"omitempty,url"`
+		Lines     []line    `json:"lines" validate:"required,min=1,dive,required"`
+		Codes     []string  `json:"codes" validate:"dive,len=3"`
+		CreatedAt time.Time `json:"created_at"`
+		Internal  string    `json:"-"`
+	}
+)
+
+//getDocument returns the document of a router with a documented route
+func getDocument() *Document {
+
+	r := web.NewRouter()
+	r.Handle(http.MethodPost, "/orders/{order_id}", func(ctx context.Context,
+		request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return events.APIGatewayProxyResponse{}, nil
+	}).
+		Doc("Updates an order").
+		WithQuery("limit", 0).
+		Accepts(order{}, "created_at").
+		Returns(http.StatusCreated, order{}).
+		Fails(web.Errors{http.StatusBadRequest: {"NameIsEmpty"}}).
+		Secure()
+
+	g := New(Info{Title: "Orders", Version: "1"},
+		WithConstraint("positive", Minimum(1)))
+
+	return g.Document(r.Routes())
+}
+
+//TestDocument tests the operations of the routes
+func TestDocument(t *testing.T) {
+
+	op := getDocument().Paths["/orders/{order_id}"]["post"]
+	if op == nil {
+		t.Fatal("Expected operation")
+	}
+
+	if op.Summary != "Updates an order" {
+		t.Errorf("Unexpected summary: %s", op.Summary)
+	}
+	if len(op.Parameters) != 2 || op.Parameters[0].In != "path" ||
+		!op.Parameters[0].Required || op.Parameters[1].Name != "limit" ||
+		op.Parameters[1].Schema.Type != "integer" {
+		t.Errorf("Unexpected parameters: %+v", op.Parameters)
+	}
+	if len(op.Security) != 1 {
+		t.Errorf("Expected required bearer token: %v", op.Security)
+	}
+
+	if op.Responses["201"] == nil ||
+		op.Responses["201"].Content[ContentType].Schema.Ref !=
+			"#/components/schemas/openapi.order" {
+		t.Errorf("Unexpected success response: %+v", op.Responses["201"])
+	}
+	if op.Responses["400"] == nil ||
+		op.Responses["400"].Description != "Bad Request. Error codes: NameIsEmpty" {
+		t.Errorf("Unexpected error response: %+v", op.Responses["400"])
+	}
+
+	//The properties from the path and the omitted ones are not in the body
+	body := op.RequestBody.Content[ContentType].Schema
+	for _, name := range []string{"order_id", "created_at", "Internal"} {
+		if _, ok := body.Properties[name]; ok {
+			t.Errorf("Unexpected property %s in the body", name)
+		}
+	}
+	if !reflect.DeepEqual(body.Required, []string{"name", "quantity", "lines"}) {
+		t.Errorf("Unexpected required properties: %v", body.Required)
+	}
+}
+
+//TestSchema tests the schemas of the fields, with the constraints of their
+//validate tags
+func TestSchema(t *testing.T) {
+
+	doc := getDocument()
+	s := doc.Components.Schemas["openapi.order"]
+	if s == nil {
+		t.Fatal("Expected the schema of the response")
+	}
+
+	one, zero := 1.0, 0.0
+	lines, hundred, three := 1, 100, 3
+
+	tests := []struct {
+		property string
+		expected Schema
+	}{
+		{"name", Schema{Type: "string", MaxLength: &hundred}},
+		{"quantity", Schema{Type: "integer", Format: "int32", Minimum: &one}},
+		{"price", Schema{Type: "number", Format: "float", Minimum: &zero,
+			ExclusiveMinimum: true}},
+		{"status", Schema{Type: "string", Enum: []string{"open", "closed"}}},
+		{"callback", Schema{Type: "string", Format: "uri"}},
+		{"lines", Schema{Type: "array", MinItems: &lines,
+			Items: &Schema{Ref: "#/components/schemas/openapi.line"}}},
+		{"codes", Schema{Type: "array", Items: &Schema{Type: "string",
+			MinLength: &three, MaxLength: &three}}},
+		{"created_at", Schema{Type: "string", Format: "date-time"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.property, func(t *testing.T) {
+			if !reflect.DeepEqual(s.Properties[tc.property], &tc.expected) {
+				t.Errorf("Expected: %+v. Received: %+v", tc.expected,
+					s.Properties[tc.property])
+			}
+		})
+	}
+
+	l := doc.Components.Schemas["openapi.line"]
+	if l == nil || len(l.Properties) != 2 || l.Properties["Tags"].Type != "array" {
+		t.Errorf("Unexpected schema of the nested type: %+v", l)
+	}
+}
@@ -0,0 +1,170 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	saws "github.com/roloum/store/api/internal/aws"
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	//DynamoDBRowTypeRateLimit Attribute used to identify a token bucket
+	DynamoDBRowTypeRateLimit = "RateLimit"
+
+	//DynamoDBPrefixRateLimit Prefix for the partition key of a token bucket
+	DynamoDBPrefixRateLimit = "RATELIMIT#"
+
+	//DynamoDBSortKeyRateLimit Sort key of a token bucket
+	DynamoDBSortKeyRateLimit = "RATELIMIT"
+
+	//ErrStoreTableNameIsEmpty Error describes when DynamoDB table name is empty
+	ErrStoreTableNameIsEmpty = "StoreTableNameIsEmpty"
+
+	//dynamoDBAttempts attempts to take a token of a bucket modified by
+	//concurrent requests
+	dynamoDBAttempts = 3
+)
+
+var (
+	//ErrCouldNotTakeToken error returned if we failed to read or write the
+	//bucket
+	ErrCouldNotTakeToken = errors.New("CouldNotTakeToken")
+)
+
+//DynamoDB is a Store that keeps the token buckets in the store table, so they
+//are shared by every lambda container and behave like the Memory buckets.
+//The row of a bucket has its tokens and the time they were updated. A token
+//is taken with an update of the bucket that was read, conditioned on its
+//update time, and the buckets expire with the TTL of the table once they have
+//been refilled
+type DynamoDB struct {
+	svc       dynamodbiface.DynamoDBAPI
+	tableName string
+	now       func() time.Time
+}
+
+//NewDynamoDB returns a DynamoDB store that keeps the buckets in the table
+func NewDynamoDB(svc dynamodbiface.DynamoDBAPI, tableName string) (*DynamoDB,
+	error) {
+
+	if tableName == "" {
+		log.Error().Msg("Table name is empty")
+		return nil, errors.New(ErrStoreTableNameIsEmpty)
+	}
+
+	return &DynamoDB{svc: svc, tableName: tableName, now: time.Now}, nil
+}
+
+//Take takes a token of the bucket of the key. When concurrent requests
+//modify the bucket, the token is taken again from the bucket they wrote.
+//A bucket that is still contended after the attempts is reported as empty:
+//the client is sending concurrent requests faster than the limit
+func (d *DynamoDB) Take(ctx context.Context, key string, l Limit) (
+	time.Duration, error) {
+
+	for n := 0; n < dynamoDBAttempts; n++ {
+
+		b, err := d.get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+
+		now := d.now()
+		taken, wait := b.take(l, now)
+		if wait > 0 {
+			return wait, nil
+		}
+
+		err = d.update(ctx, key, taken, b.UpdatedAt, now.Add(l.Period))
+		if err == nil {
+			return 0, nil
+		}
+		if !saws.IsErrorOfType(err, dynamodb.ErrCodeConditionalCheckFailedException) {
+			logging.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Error writing bucket")
+			return 0, ErrCouldNotTakeToken
+		}
+	}
+
+	return time.Duration(float64(time.Second) / l.rate()), nil
+}
+
+//get returns the bucket of the key, or an empty Bucket if it does not exist
+func (d *DynamoDB) get(ctx context.Context, key string) (Bucket, error) {
+
+	result, err := d.svc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		Key:                  d.key(key),
+		ProjectionExpression: aws.String("tokens,updated_at"),
+		ConsistentRead:       aws.Bool(true),
+		TableName:            aws.String(d.tableName),
+	})
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Error loading bucket")
+		return Bucket{}, ErrCouldNotTakeToken
+	}
+
+	if result.Item["updated_at"] == nil || result.Item["tokens"] == nil {
+		return Bucket{}, nil
+	}
+
+	tokens, err := strconv.ParseFloat(aws.StringValue(result.Item["tokens"].N), 64)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Error parsing bucket")
+		return Bucket{}, ErrCouldNotTakeToken
+	}
+	updatedAt, err := strconv.ParseInt(aws.StringValue(result.Item["updated_at"].N), 10, 64)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Error parsing bucket")
+		return Bucket{}, ErrCouldNotTakeToken
+	}
+
+	return Bucket{Tokens: tokens, UpdatedAt: time.Unix(0, updatedAt)}, nil
+}
+
+//update writes the tokens of the bucket of the key if it was not modified
+//since it was read with the previous update time
+func (d *DynamoDB) update(ctx context.Context, key string, b Bucket,
+	previous time.Time, expiresAt time.Time) error {
+
+	values := map[string]*dynamodb.AttributeValue{
+		":t": {S: aws.String(DynamoDBRowTypeRateLimit)},
+		":k": {N: aws.String(strconv.FormatFloat(b.Tokens, 'f', -1, 64))},
+		":u": {N: aws.String(strconv.FormatInt(b.UpdatedAt.UnixNano(), 10))},
+		":e": {N: aws.String(strconv.FormatInt(expiresAt.Unix()+1, 10))},
+	}
+	condition := "attribute_not_exists(#u)"
+	if !previous.IsZero() {
+		condition = "#u = :previous"
+		values[":previous"] = &dynamodb.AttributeValue{
+			N: aws.String(strconv.FormatInt(previous.UnixNano(), 10))}
+	}
+
+	_, err := d.svc.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		Key: d.key(key),
+		ExpressionAttributeNames: map[string]*string{
+			"#t": aws.String("type"),
+			"#k": aws.String("tokens"),
+			"#u": aws.String("updated_at"),
+			"#e": aws.String("expires_at"),
+		},
+		ExpressionAttributeValues: values,
+		UpdateExpression:          aws.String("SET #t = :t, #k = :k, #u = :u, #e = :e"),
+		ConditionExpression:       aws.String(condition),
+		TableName:                 aws.String(d.tableName),
+	})
+	return err
+}
+
+//key returns the key of the row of the bucket
+func (d *DynamoDB) key(key string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"pk": {S: aws.String(DynamoDBPrefixRateLimit + key)},
+		"sk": {S: aws.String(DynamoDBSortKeyRateLimit)},
+	}
+}
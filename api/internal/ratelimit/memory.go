@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	//memoryKeys number of buckets of the Memory store after which the full
+	//buckets are removed
+	memoryKeys = 10000
+)
+
+//Memory is a Store that keeps the buckets in memory. The buckets are not
+//shared between processes, so it is meant for the local server and for tests
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]Bucket
+	limits  map[string]Limit
+	now     func() time.Time
+}
+
+//NewMemory returns an empty Memory store
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: map[string]Bucket{},
+		limits:  map[string]Limit{},
+		now:     time.Now,
+	}
+}
+
+//Take takes a token of the bucket of the key
+func (m *Memory) Take(ctx context.Context, key string, l Limit) (
+	time.Duration, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if len(m.buckets) >= memoryKeys {
+		m.evict(now)
+	}
+
+	b, wait := m.buckets[key].take(l, now)
+	m.buckets[key] = b
+	m.limits[key] = l
+
+	return wait, nil
+}
+
+//evict removes the buckets that have been refilled, a new bucket is the same
+func (m *Memory) evict(now time.Time) {
+	for key, b := range m.buckets {
+		if b.full(m.limits[key], now) {
+			delete(m.buckets, key)
+			delete(m.limits, key)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+//Package ratelimit limits the requests of the clients with token buckets. A
+//bucket holds up to the requests of its limit, every request takes a token
+//and the tokens are refilled at a constant rate, so a client can make a burst
+//of requests and then a request every period divided by the requests. The
+//buckets are kept in memory or, to share them between lambda containers, in
+//DynamoDB
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	//ErrRateLimitIsInvalid error returned when a limit of the configuration is
+	//not requests/period, e.g. 20/1m
+	ErrRateLimitIsInvalid = errors.New("RateLimitIsInvalid")
+
+	//ErrRateLimitExceeded error returned when the bucket of the request does
+	//not have tokens
+	ErrRateLimitExceeded = errors.New("RateLimitExceeded")
+)
+
+//Limit is the requests allowed in a period. The zero value does not limit
+//the requests
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+//ParseLimit returns the Limit of requests/period, e.g. 20/1m. An empty string
+//is the zero Limit
+func ParseLimit(s string) (Limit, error) {
+
+	if s == "" {
+		return Limit{}, nil
+	}
+
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return Limit{}, ErrRateLimitIsInvalid
+	}
+
+	requests, err := strconv.Atoi(parts[0])
+	if err != nil || requests <= 0 {
+		return Limit{}, ErrRateLimitIsInvalid
+	}
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return Limit{}, ErrRateLimitIsInvalid
+	}
+
+	return Limit{Requests: requests, Period: period}, nil
+}
+
+//IsZero returns true if the Limit does not limit the requests
+func (l Limit) IsZero() bool {
+	return l.Requests <= 0 || l.Period <= 0
+}
+
+//String returns the Limit as requests/period
+func (l Limit) String() string {
+	return strconv.Itoa(l.Requests) + "/" + l.Period.String()
+}
+
+//rate returns the tokens refilled per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+//Bucket is the state of the token bucket of a key
+type Bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+//take refills the bucket up to the requests of the limit and takes a token.
+//When the bucket does not have a token, it returns how long until it has one,
+//and the bucket is not modified
+func (b Bucket) take(l Limit, now time.Time) (Bucket, time.Duration) {
+
+	tokens := float64(l.Requests)
+	if !b.UpdatedAt.IsZero() {
+		elapsed := now.Sub(b.UpdatedAt).Seconds()
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		tokens = math.Min(tokens, b.Tokens+elapsed*l.rate())
+	}
+
+	if tokens < 1 {
+		wait := time.Duration((1 - tokens) / l.rate() * float64(time.Second))
+		return b, wait
+	}
+
+	return Bucket{Tokens: tokens - 1, UpdatedAt: now}, 0
+}
+
+//full returns true if the bucket has been refilled at now, so it is the same
+//as a new bucket
+func (b Bucket) full(l Limit, now time.Time) bool {
+	return b.Tokens+now.Sub(b.UpdatedAt).Seconds()*l.rate() >= float64(l.Requests)
+}
+
+//Store keeps the buckets. Take takes a token of the bucket of the key, and
+//returns how long until the bucket has a token when it is empty. Its methods
+//are called by concurrent requests
+type Store interface {
+	Take(ctx context.Context, key string, l Limit) (time.Duration, error)
+}
+
+//Limiter limits the requests of every client to a route, and the requests of
+//all the clients to a cart
+type Limiter struct {
+	store  Store
+	routes map[string]Limit
+	def    Limit
+	cart   Limit
+}
+
+//Option configures the limits of the Limiter
+type Option func(*Limiter)
+
+//WithRoute sets the limit of the requests of a client to the route, its
+//method and path template, e.g. POST /cart
+func WithRoute(route string, l Limit) Option {
+	return func(lm *Limiter) {
+		lm.routes[route] = l
+	}
+}
+
+//WithDefault sets the limit of the requests of a client to the routes
+//without a limit of their own
+func WithDefault(l Limit) Option {
+	return func(lm *Limiter) {
+		lm.def = l
+	}
+}
+
+//WithCart sets the limit of the requests of all the clients to a cart
+func WithCart(l Limit) Option {
+	return func(lm *Limiter) {
+		lm.cart = l
+	}
+}
+
+//New returns a Limiter that keeps the buckets in the store. It does not limit
+//the requests until an option sets a limit
+func New(store Store, opts ...Option) *Limiter {
+
+	l := &Limiter{store: store, routes: map[string]Limit{}}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+//Allow takes a token of the bucket of the client in the route and, when the
+//request has a cart, of the bucket of the cart. It returns
+//ErrRateLimitExceeded, and how long until the request is allowed, when one of
+//the buckets is empty. A nil Limiter allows every request
+func (l *Limiter) Allow(ctx context.Context, route, client, cartID string) (
+	time.Duration, error) {
+
+	if l == nil {
+		return 0, nil
+	}
+
+	limit, ok := l.routes[route]
+	if !ok {
+		limit = l.def
+	}
+
+	var wait time.Duration
+	if !limit.IsZero() {
+		w, err := l.store.Take(ctx, route+"#"+client, limit)
+		if err != nil {
+			return 0, err
+		}
+		wait = w
+	}
+
+	//The token of the cart is not taken by the requests rejected by the
+	//limit of the client
+	if wait == 0 && cartID != "" && !l.cart.IsZero() {
+		w, err := l.store.Take(ctx, "CART#"+cartID, l.cart)
+		if err != nil {
+			return 0, err
+		}
+		wait = w
+	}
+
+	if wait > 0 {
+		return wait, ErrRateLimitExceeded
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,251 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/rs/zerolog"
+)
+
+func init() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+//clock is the time of the tests, moved forward by them
+type clock struct {
+	t time.Time
+}
+
+//now returns the time of the clock
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+//table is a DynamoDB client that keeps the buckets. The updates of the
+//bucket conflict as many times as conflicts, as if a concurrent request had
+//written it, and fail with err when it is set
+type table struct {
+	dynamodbiface.DynamoDBAPI
+	items     map[string]map[string]*dynamodb.AttributeValue
+	conflicts int
+	updates   int
+	err       error
+}
+
+//GetItemWithContext returns the bucket of the key
+func (t *table) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput,
+	opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+
+	return &dynamodb.GetItemOutput{
+		Item: t.items[aws.StringValue(input.Key["pk"].S)]}, nil
+}
+
+//UpdateItemWithContext writes the bucket if it was not modified
+func (t *table) UpdateItemWithContext(ctx aws.Context,
+	input *dynamodb.UpdateItemInput, opts ...request.Option) (
+	*dynamodb.UpdateItemOutput, error) {
+
+	if t.err != nil {
+		return nil, t.err
+	}
+
+	t.updates++
+	pk := aws.StringValue(input.Key["pk"].S)
+	current, ok := t.items[pk]
+
+	failed := t.conflicts > 0
+	if previous, set := input.ExpressionAttributeValues[":previous"]; set {
+		failed = failed || !ok ||
+			aws.StringValue(current["updated_at"].N) != aws.StringValue(previous.N)
+	} else {
+		failed = failed || ok
+	}
+	if failed {
+		t.conflicts--
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException,
+			"", nil)
+	}
+
+	values := input.ExpressionAttributeValues
+	t.items[pk] = map[string]*dynamodb.AttributeValue{
+		"type":       values[":t"],
+		"tokens":     values[":k"],
+		"updated_at": values[":u"],
+		"expires_at": values[":e"],
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+//TestParseLimit tests the limits of the configuration
+func TestParseLimit(t *testing.T) {
+
+	tests := []struct {
+		limit    string
+		expected Limit
+		err      error
+	}{
+		{"20/1m", Limit{20, time.Minute}, nil},
+		{"1/500ms", Limit{1, 500 * time.Millisecond}, nil},
+		{"", Limit{}, nil},
+		{"20", Limit{}, ErrRateLimitIsInvalid},
+		{"20/m", Limit{}, ErrRateLimitIsInvalid},
+		{"0/1m", Limit{}, ErrRateLimitIsInvalid},
+		{"20/-1m", Limit{}, ErrRateLimitIsInvalid},
+		{"20/1m/1h", Limit{}, ErrRateLimitIsInvalid},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.limit, func(t *testing.T) {
+			l, err := ParseLimit(tc.limit)
+			if l != tc.expected || err != tc.err {
+				t.Errorf("Expected: %v %v. Received: %v %v", tc.expected, tc.err, l, err)
+			}
+		})
+	}
+}
+
+//TestBucket tests that the bucket allows a burst of requests, and then a
+//request every period divided by the requests
+func TestBucket(t *testing.T) {
+
+	l := Limit{Requests: 3, Period: 3 * time.Second}
+	start := time.Unix(1600000000, 0)
+
+	tests := []struct {
+		desc    string
+		elapsed time.Duration
+		wait    time.Duration
+	}{
+		{"First", 0, 0},
+		{"Second", 0, 0},
+		{"Third", 0, 0},
+		{"Empty", 0, time.Second},
+		{"PartiallyRefilled", 500 * time.Millisecond, 500 * time.Millisecond},
+		{"Refilled", time.Second, 0},
+		{"EmptyAgain", time.Second, time.Second},
+		{"Full", 10 * time.Second, 0},
+		{"NotOverfilled", 10 * time.Second, 0},
+		{"NotOverfilledSecond", 10 * time.Second, 0},
+		{"NotOverfilledEmpty", 10 * time.Second, time.Second},
+	}
+
+	var b Bucket
+	for _, tc := range tests {
+		var wait time.Duration
+		b, wait = b.take(l, start.Add(tc.elapsed))
+		if wait != tc.wait {
+			t.Errorf("%s: expected %s. Received: %s", tc.desc, tc.wait, wait)
+		}
+	}
+}
+
+//TestLimiter tests the limits of the routes, the default limit and the limit
+//of the carts
+func TestLimiter(t *testing.T) {
+
+	c := &clock{t: time.Unix(1600000000, 0)}
+	m := NewMemory()
+	m.now = c.now
+
+	l := New(m,
+		WithRoute("POST /cart", Limit{1, time.Minute}),
+		WithRoute("GET /items", Limit{}),
+		WithDefault(Limit{2, time.Minute}),
+		WithCart(Limit{3, time.Minute}))
+
+	tests := []struct {
+		desc   string
+		route  string
+		client string
+		cartID string
+		err    error
+	}{
+		{"Route", "POST /cart", "IP#1", "", nil},
+		{"RouteExceeded", "POST /cart", "IP#1", "", ErrRateLimitExceeded},
+		{"OtherClient", "POST /cart", "IP#2", "", nil},
+		{"Unlimited", "GET /items", "IP#1", "", nil},
+		{"Unlimited", "GET /items", "IP#1", "", nil},
+		{"Unlimited", "GET /items", "IP#1", "", nil},
+		{"Default", "GET /cart/{cart_id}", "IP#1", "c1", nil},
+		{"Default", "GET /cart/{cart_id}", "IP#1", "c1", nil},
+		{"DefaultExceeded", "GET /cart/{cart_id}", "IP#1", "c1",
+			ErrRateLimitExceeded},
+		{"Cart", "GET /cart/{cart_id}", "IP#2", "c1", nil},
+		{"CartExceeded", "GET /cart/{cart_id}", "IP#3", "c1", ErrRateLimitExceeded},
+		{"OtherCart", "GET /cart/{cart_id}", "IP#3", "c2", nil},
+	}
+
+	for _, tc := range tests {
+		wait, err := l.Allow(context.Background(), tc.route, tc.client, tc.cartID)
+		if err != tc.err || (err != nil) != (wait > 0) {
+			t.Errorf("%s: expected %v. Received: %v %s", tc.desc, tc.err, err, wait)
+		}
+	}
+
+	//A nil Limiter does not limit the requests
+	var none *Limiter
+	if _, err := none.Allow(context.Background(), "POST /cart", "IP#1", ""); err != nil {
+		t.Errorf("Expected no error. Received: %v", err)
+	}
+}
+
+//TestDynamoDB tests the buckets kept in the table
+func TestDynamoDB(t *testing.T) {
+
+	c := &clock{t: time.Unix(1600000000, 0)}
+	svc := &table{items: map[string]map[string]*dynamodb.AttributeValue{}}
+	d, err := NewDynamoDB(svc, "Store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.now = c.now
+
+	l := Limit{Requests: 2, Period: 2 * time.Second}
+	ctx := context.Background()
+
+	tests := []struct {
+		desc      string
+		elapsed   time.Duration
+		conflicts int
+		wait      time.Duration
+	}{
+		{"New", 0, 0, 0},
+		{"Conflict", 0, 1, 0},
+		{"Empty", 0, 0, time.Second},
+		{"Refilled", time.Second, 0, 0},
+		{"Contended", 2 * time.Second, dynamoDBAttempts, time.Second},
+	}
+
+	for _, tc := range tests {
+		c.t = c.t.Add(tc.elapsed)
+		svc.conflicts = tc.conflicts
+		wait, err := d.Take(ctx, "POST /cart#IP#1", l)
+		if err != nil || wait != tc.wait {
+			t.Errorf("%s: expected %s. Received: %s %v", tc.desc, tc.wait, wait, err)
+		}
+	}
+
+	//The bucket was last written by the request refilled after a second
+	row := svc.items[DynamoDBPrefixRateLimit+"POST /cart#IP#1"]
+	if aws.StringValue(row["type"].S) != DynamoDBRowTypeRateLimit ||
+		aws.StringValue(row["tokens"].N) != "0" ||
+		aws.StringValue(row["updated_at"].N) != "1600000001000000000" ||
+		aws.StringValue(row["expires_at"].N) != "1600000004" {
+		t.Errorf("Unexpected row: %v", row)
+	}
+
+	svc.err = awserr.New(dynamodb.ErrCodeInternalServerError, "", nil)
+	if _, err := d.Take(ctx, "POST /cart#IP#1", l); err != ErrCouldNotTakeToken {
+		t.Errorf("Expected: %s. Received: %v", ErrCouldNotTakeToken, err)
+	}
+
+	if _, err := NewDynamoDB(svc, ""); err == nil {
+		t.Errorf("Expected: %s", ErrStoreTableNameIsEmpty)
+	}
+}
@@ -0,0 +1,258 @@
+package cart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/roloum/store/api/internal/logging"
+)
+
+const (
+	//DynamoDBIndexActivity Sparse GSI of the carts by last modification. A
+	//cart leaves the index when it is marked as abandoned, and returns to it
+	//when it is modified again
+	DynamoDBIndexActivity = "gsi2pk"
+
+	//DynamoDBPartitionActivity Prefix for the partition key of the carts in
+	//the activity index, followed by the shard of the cart
+	DynamoDBPartitionActivity = "CARTS#"
+
+	//activityShards number of partitions of the activity index. The carts are
+	//spread by the hash of their ID, so every write to a cart does not write
+	//the same partition of the index
+	activityShards = 16
+
+	//timestampLayout layout of last_modified, fixed width in UTC so the
+	//timestamps sort as strings. The nanoseconds tell apart the modifications
+	//of a cart in the same second
+	timestampLayout = "2006-01-02T15:04:05.000000000Z07:00"
+)
+
+var (
+	//ErrIdleTimeIsInvalid error returned when the idle time of the abandoned
+	//carts is not positive
+	ErrIdleTimeIsInvalid = errors.New("IdleTimeIsInvalid")
+
+	//ErrLimitIsInvalid error returned when the maximum number of abandoned
+	//carts is not positive
+	ErrLimitIsInvalid = errors.New("LimitIsInvalid")
+
+	//ErrCouldNotLoadAbandonedCarts error returned if we failed to query the
+	//activity index
+	ErrCouldNotLoadAbandonedCarts = errors.New("CouldNotLoadAbandonedCarts")
+
+	//ErrCouldNotMarkAbandonedCart error returned if we failed to mark a cart
+	//as abandoned
+	ErrCouldNotMarkAbandonedCart = errors.New("CouldNotMarkAbandonedCart")
+
+	//ErrCartWasModified error returned when the cart was modified after it
+	//was found abandoned
+	ErrCartWasModified = errors.New("CartWasModified")
+)
+
+//AbandonedCart is a cart that has not been modified since LastModified
+type AbandonedCart struct {
+	Cart
+	LastModified time.Time `json:"last_modified"`
+
+	//lastModified is last_modified as it is stored, which is compared when
+	//the cart is marked
+	lastModified string
+}
+
+//Abandoned returns up to limit carts that have not been modified for idleFor
+//and were not reported yet, the least recently modified first, with their
+//lines and owner. Every shard of the activity index is queried, and the
+//oldest carts of all the shards are returned
+func (h *Handler) Abandoned(ctx context.Context, idleFor time.Duration,
+	limit int) (_ []AbandonedCart, err error) {
+
+	ctx, end := h.start(ctx, "cart.Abandoned")
+	defer func() { end(err) }()
+
+	if idleFor <= 0 {
+		return nil, ErrIdleTimeIsInvalid
+	}
+	if limit <= 0 {
+		return nil, ErrLimitIsInvalid
+	}
+
+	cutoff := time.Now().UTC().Add(-idleFor).Format(timestampLayout)
+
+	var rows []map[string]*dynamodb.AttributeValue
+	for shard := 0; shard < activityShards; shard++ {
+		result, err := h.svc.QueryWithContext(ctx, &dynamodb.QueryInput{
+			IndexName:              aws.String(DynamoDBIndexActivity),
+			KeyConditionExpression: aws.String("gsi2pk = :pk and gsi2sk < :cutoff"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":pk":     {S: aws.String(getActivityShardPK(shard))},
+				":cutoff": {S: aws.String(cutoff)},
+			},
+			Limit:     aws.Int64(int64(limit)),
+			TableName: aws.String(h.tableName),
+		})
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Int("shard", shard).
+				Msg("Error loading abandoned carts")
+			return nil, ErrCouldNotLoadAbandonedCarts
+		}
+		rows = append(rows, result.Items...)
+	}
+
+	//Every shard returns its oldest carts, the oldest of all of them are
+	//returned
+	sort.SliceStable(rows, func(i, j int) bool {
+		return aws.StringValue(rows[i]["gsi2sk"].S) < aws.StringValue(rows[j]["gsi2sk"].S)
+	})
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+
+	carts := []AbandonedCart{}
+	for _, row := range rows {
+		stored := aws.StringValue(row["gsi2sk"].S)
+
+		//Carts modified before the nanoseconds were stored have RFC3339
+		//timestamps, which RFC3339Nano parses too
+		lastModified, err := time.Parse(time.RFC3339Nano, stored)
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("Error parsing last_modified")
+			return nil, ErrCouldNotLoadAbandonedCarts
+		}
+
+		//The job has no user, the owner is not checked
+		c, err := h.load(ctx, aws.StringValue(row["cart_id"].S))
+		if err != nil {
+			return nil, err
+		}
+
+		carts = append(carts, AbandonedCart{Cart: *c, LastModified: lastModified,
+			lastModified: stored})
+	}
+
+	logging.Ctx(ctx).Debug().
+		Int("carts", len(carts)).
+		Str("cutoff", cutoff).
+		Msg("Found idle carts")
+
+	return carts, nil
+}
+
+//MarkAbandoned removes the cart from the activity index, so it is reported
+//only once until it is modified again. The condition on last_modified, which
+//has nanoseconds, fails with ErrCartWasModified if the cart was modified
+//after it was found
+func (h *Handler) MarkAbandoned(ctx context.Context, c *AbandonedCart) (err error) {
+
+	ctx, end := h.start(ctx, "cart.MarkAbandoned")
+	defer func() { end(err) }()
+
+	ctx = logging.WithCart(ctx, c.CartID)
+
+	_, err = h.svc.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"pk": {S: aws.String(getCartPK(c.CartID))},
+			"sk": {S: aws.String(getCartPK(c.CartID))},
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {S: aws.String(time.Now().UTC().Format(timestampLayout))},
+			":lm":  {S: aws.String(c.storedLastModified())},
+		},
+		UpdateExpression:    aws.String("SET abandoned_at = :now REMOVE gsi2pk, gsi2sk"),
+		ConditionExpression: aws.String("last_modified = :lm"),
+		TableName:           aws.String(h.tableName),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok &&
+			aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return ErrCartWasModified
+		}
+		logging.Ctx(ctx).Error().Err(err).Msg("Error marking cart as abandoned")
+		return ErrCouldNotMarkAbandonedCart
+	}
+
+	logging.Ctx(ctx).Info().Msg("Cart marked as abandoned")
+
+	return nil
+}
+
+//UnmarkAbandoned returns a cart marked by MarkAbandoned to the activity
+//index, so it is reported again, e.g. when its event could not be published.
+//A cart modified after it was marked is already back in the index and is not
+//changed
+func (h *Handler) UnmarkAbandoned(ctx context.Context, c *AbandonedCart) (err error) {
+
+	ctx, end := h.start(ctx, "cart.UnmarkAbandoned")
+	defer func() { end(err) }()
+
+	ctx = logging.WithCart(ctx, c.CartID)
+
+	lastModified := c.storedLastModified()
+
+	_, err = h.svc.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"pk": {S: aws.String(getCartPK(c.CartID))},
+			"sk": {S: aws.String(getCartPK(c.CartID))},
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pk": {S: aws.String(getActivityPK(c.CartID))},
+			":lm": {S: aws.String(lastModified)},
+		},
+		UpdateExpression:    aws.String("SET gsi2pk = :pk, gsi2sk = :lm REMOVE abandoned_at"),
+		ConditionExpression: aws.String("last_modified = :lm"),
+		TableName:           aws.String(h.tableName),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok &&
+			aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			logging.Ctx(ctx).Info().Msg("Cart was modified, it is already active")
+			return nil
+		}
+		logging.Ctx(ctx).Error().Err(err).Msg("Error unmarking abandoned cart")
+		return ErrCouldNotMarkAbandonedCart
+	}
+
+	logging.Ctx(ctx).Info().Msg("Cart unmarked as abandoned")
+
+	return nil
+}
+
+//storedLastModified returns last_modified as it is stored
+func (c *AbandonedCart) storedLastModified() string {
+	if c.lastModified == "" {
+		return c.LastModified.UTC().Format(timestampLayout)
+	}
+	return c.lastModified
+}
+
+//getActivity returns the attribute values of the last modification of a
+//cart, which put the cart in its shard of the activity index
+func getActivity(cartID string) map[string]*dynamodb.AttributeValue {
+	now := time.Now().UTC().Format(timestampLayout)
+	return map[string]*dynamodb.AttributeValue{
+		"last_modified": {S: aws.String(now)},
+		"gsi2pk":        {S: aws.String(getActivityPK(cartID))},
+		"gsi2sk":        {S: aws.String(now)},
+	}
+}
+
+//getActivityPK returns the partition key of the shard of the cart in the
+//activity index
+func getActivityPK(cartID string) string {
+	h := fnv.New32a()
+	h.Write([]byte(cartID))
+	return getActivityShardPK(int(h.Sum32() % activityShards))
+}
+
+//getActivityShardPK returns the partition key of a shard of the activity
+//index
+func getActivityShardPK(shard int) string {
+	return fmt.Sprintf("%s%02d", DynamoDBPartitionActivity, shard)
+}
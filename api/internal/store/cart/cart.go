@@ -5,12 +5,19 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	"github.com/google/uuid"
+	"github.com/roloum/store/api/internal/auth"
+	saws "github.com/roloum/store/api/internal/aws"
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/roloum/store/api/internal/metrics"
+	"github.com/roloum/store/api/internal/store/item"
+	"github.com/roloum/store/api/internal/tracing"
 	"github.com/rs/zerolog/log"
 )
 
@@ -26,6 +33,9 @@ const (
 
 	//DynamoDBPrefixItem Prexix for product item key
 	DynamoDBPrefixItem = "ITEM#"
+
+	//DynamoDBPrefixSKU Prefix for the SKU of an item variant
+	DynamoDBPrefixSKU = "SKU#"
 )
 
 var (
@@ -57,37 +67,110 @@ var (
 	//ErrItemDoesNotExist error returned if we try to add to a cart an item that
 	//does not exist
 	ErrItemDoesNotExist = errors.New("ItemDoesNotExist")
+
+	//ErrItemIsOutOfStock error returned if we try to add to a cart more units
+	//of a variant than it has in stock
+	ErrItemIsOutOfStock = errors.New("ItemIsOutOfStock")
+
+	//ErrCartAccessDenied error returned when the cart belongs to another user
+	ErrCartAccessDenied = errors.New("CartAccessDenied")
 )
 
+//Catalog returns the current price of the items of the catalog
+type Catalog interface {
+	CurrentPrices(ctx context.Context, keys []item.PriceKey) (
+		map[item.PriceKey]float32, error)
+}
+
 //Handler struct is a handler for executing the actions related to the shopping cart
 type Handler struct {
-	svc       dynamodbiface.DynamoDBAPI
-	tableName string
+	svc         dynamodbiface.DynamoDBAPI
+	tableName   string
+	catalog     Catalog
+	shareSecret []byte
+	shareTTL    time.Duration
+	limits      Limits
+	metrics     metrics.Recorder
 }
 
+//Option configures optional dependencies of the Handler
+type Option func(*Handler)
+
 //New returns pointer to a struct of type Cart, that contains methods
-//For each action that can be executed on this API
-func New(svc dynamodbiface.DynamoDBAPI, tableName string) (*Handler, error) {
+//For each action that can be executed on this API. The current prices of the
+//lines are read from the catalog of the table unless WithCatalog sets another
+//catalog
+func New(svc dynamodbiface.DynamoDBAPI, tableName string, opts ...Option) (
+	*Handler, error) {
 	if tableName == "" {
 		log.Error().Msg("Table name is empty")
 		return nil, errors.New(ErrStoreTableNameIsEmpty)
 	}
 
-	return &Handler{svc, tableName}, nil
+	h := &Handler{svc: svc, tableName: tableName, limits: DefaultLimits,
+		metrics: metrics.Nop{}}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	//By default the prices are read from the catalog of the same table
+	if h.catalog == nil {
+		catalog, err := item.New(svc, tableName)
+		if err != nil {
+			return nil, err
+		}
+		h.catalog = catalog
+	}
+
+	return h, nil
+}
+
+//WithCatalog sets the catalog that resolves the current prices of the lines
+func WithCatalog(c Catalog) Option {
+	return func(h *Handler) {
+		h.catalog = c
+	}
+}
+
+//WithMetrics sets the Recorder of the count, the latency and the outcome of
+//the operations of the carts
+func WithMetrics(r metrics.Recorder) Option {
+	return func(h *Handler) {
+		h.metrics = r
+	}
+}
+
+//start starts an operation of the carts, with its span and its metrics. The
+//returned function ends the operation with its error
+func (h *Handler) start(ctx context.Context, operation string) (
+	context.Context, func(error)) {
+
+	ctx, span := tracing.Start(ctx, operation)
+	ctx, end := metrics.Start(ctx, h.metrics, operation)
+
+	return ctx, func(err error) {
+		end(err)
+		span.End(err)
+	}
 }
 
 //CreateAndAddItem Creates a shopping cart and adds the first item
 //ni contains the information about the new item
-func (h *Handler) CreateAndAddItem(ctx context.Context, ni *NewItemInfo) (*Cart, error) {
+func (h *Handler) CreateAndAddItem(ctx context.Context, ni *NewItemInfo) (_ *Cart, err error) {
+
+	ctx, end := h.start(ctx, "cart.CreateAndAddItem")
+	defer func() { end(err) }()
 
 	if ni.CartID != "" {
-		log.Error().Msgf("Error attempting to create a cart with an ID: %s", ni.CartID)
+		logging.Ctx(ctx).Error().Str("body_cart_id", ni.CartID).
+			Msg("Error attempting to create a cart with an ID")
 		return nil, ErrCreateCartWithExistingCartID
 	}
 
 	//Generate a unique ID for the shopping cart
 	cartID := uuid.New().String()
-	log.Debug().Msgf("Generated UUID: %s", cartID)
+	ctx = logging.WithItem(logging.WithCart(ctx, cartID), ni.ItemID)
+	logging.Ctx(ctx).Debug().Msg("Generated cart ID")
 
 	ni.CartID = cartID
 
@@ -96,127 +179,176 @@ func (h *Handler) CreateAndAddItem(ctx context.Context, ni *NewItemInfo) (*Cart,
 		return nil, getValidationError(err)
 	}
 
-	log.Debug().Msgf("Creating cart with ID: %s and adding item ID :%s",
-		ni.CartID, ni.ItemID)
+	logging.Ctx(ctx).Debug().Msg("Creating cart")
 
-	_, err := h.svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
-		TransactItems: []*dynamodb.TransactWriteItem{
-			{
-				Put: &dynamodb.Put{
-					Item: map[string]*dynamodb.AttributeValue{
-						"pk":      {S: aws.String(getCartPK(ni.CartID))},
-						"sk":      {S: aws.String(getCartPK(ni.CartID))},
-						"cart_id": {S: aws.String(ni.CartID)},
-						"type":    {S: aws.String(DynamoDBRowTypeCart)},
-					},
-					TableName:           aws.String(h.tableName),
-					ConditionExpression: aws.String("attribute_not_exists(pk) and attribute_not_exists(sk)"),
-				},
-			},
-			//The condition check verifies the item exists in the database
-			{
-				ConditionCheck: &dynamodb.ConditionCheck{
-					Key: map[string]*dynamodb.AttributeValue{
-						"pk": {S: aws.String(getItemPK(ni.ItemID))},
-						"sk": {S: aws.String(getItemSK(ni.ItemID))},
-					},
-					TableName:           aws.String(h.tableName),
-					ConditionExpression: aws.String("attribute_exists(pk) and attribute_exists(sk)"),
-				},
+	if err := h.create(ctx, ni.CartID, []*NewItemInfo{ni}, true); err != nil {
+		return nil, err
+	}
+
+	logging.Ctx(ctx).Info().Msg("Cart created")
+
+	return h.Load(ctx, ni.CartID)
+}
+
+//create Creates a shopping cart with its lines in a single transaction. Every
+//line is preceded by the condition check that verifies the item exists and
+//its quantity limit. The cart row starts with the counters of its lines. When
+//active is set, the cart of an authenticated user becomes their active cart
+func (h *Handler) create(ctx context.Context, cartID string, lines []*NewItemInfo,
+	active bool) error {
+
+	if err := h.checkLines(lines); err != nil {
+		return err
+	}
+
+	var units int
+	for _, ni := range lines {
+		units += ni.Quantity
+	}
+
+	row := getCartRow(ctx, cartID)
+	row["line_count"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(len(lines)))}
+	row["unit_count"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(units))}
+
+	transactItems := []*dynamodb.TransactWriteItem{
+		{
+			Put: &dynamodb.Put{
+				Item:                row,
+				TableName:           aws.String(h.tableName),
+				ConditionExpression: aws.String("attribute_not_exists(pk) and attribute_not_exists(sk)"),
 			},
-			{
+		},
+	}
+
+	for _, ni := range lines {
+		transactItems = append(transactItems,
+			h.CatalogCheck(ni.ItemID, ni.SKU, ni.Quantity),
+			&dynamodb.TransactWriteItem{
 				Put: &dynamodb.Put{
-					Item: map[string]*dynamodb.AttributeValue{
-						"pk":          {S: aws.String(getCartPK(ni.CartID))},
-						"sk":          {S: aws.String(getItemSK(ni.ItemID))},
-						"type":        {S: aws.String(DynamoDBRowTypeCartItem)},
-						"cart_id":     {S: aws.String(ni.CartID)},
-						"item_id":     {S: aws.String(ni.ItemID)},
-						"description": {S: aws.String(ni.Description)},
-						"price":       {N: aws.String(fmt.Sprintf("%f", ni.Price))},
-						"quantity":    {N: aws.String(strconv.Itoa(ni.Quantity))},
-					},
+					Item:                getCartItemRow(ni),
 					TableName:           aws.String(h.tableName),
 					ConditionExpression: aws.String("attribute_not_exists(pk) and attribute_not_exists(sk)"),
 				},
 			},
-		},
+		)
+	}
+
+	//The condition on the pointer row prevents a second active cart
+	userID := auth.UserID(ctx)
+	if active && userID != "" {
+		transactItems = append(transactItems, h.getActiveCartPut(userID, cartID))
+	}
+
+	_, err := h.svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
 	})
 
 	if err != nil {
 
 		//cancellationIdx is the index of the TransactWriteItem in the
 		//TransactWriteItems array
-		cancellationIdx := 1
-		if isAwsErrorOfType(err, cancellationIdx, dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed) {
-			log.Error().Msgf("Item does not exist: %s", err.Error())
-			return nil, ErrItemDoesNotExist
+		for n := range lines {
+			cancellationIdx := 1 + 2*n
+			if cerr := h.CatalogError(err, cancellationIdx); cerr != nil {
+				logging.Ctx(logging.WithItem(ctx, lines[n].ItemID)).Error().
+					Err(cerr).Msg("Item rejected")
+				return cerr
+			}
+		}
+		cancellationIdx := len(transactItems) - 1
+		if active && userID != "" && saws.IsErrorOfType(err, dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed, cancellationIdx) {
+			logging.Ctx(ctx).Error().Msg("User already has an active cart")
+			return ErrActiveCartAlreadyExists
 		}
 
-		log.Error().Msgf("Error creating cart: %s", err.Error())
-		return nil, ErrCreateCart
+		logging.Ctx(ctx).Error().Err(err).Msg("Error creating cart")
+		return ErrCreateCart
 	}
 
-	log.Info().Msgf("Cart created with ID: %s", ni.CartID)
-
-	return h.Load(ctx, ni.CartID)
+	return nil
 }
 
 //AddItem Adds new item to the shopping cart.
 //If the item already exists in the shopping cart, it increments the quantity
 //Receives the NewItemInfo with all the information about the new item
-//We only add the item if the shopping cart exists
-func (h *Handler) AddItem(ctx context.Context, ni *NewItemInfo) (*Cart, error) {
+//We only add the item if the shopping cart exists and the new quantity is
+//within the limits of the line, the item and the cart
+func (h *Handler) AddItem(ctx context.Context, ni *NewItemInfo) (_ *Cart, err error) {
+
+	ctx, end := h.start(ctx, "cart.AddItem")
+	defer func() { end(err) }()
+
+	ctx = logging.WithItem(logging.WithCart(ctx, ni.CartID), ni.ItemID)
 
 	if err := validate.Struct(ni); err != nil {
-		log.Error().Msgf("Error validating struct: %s", err.Error())
+		logging.Ctx(ctx).Error().Err(err).Msg("Error validating struct")
 		return nil, getValidationError(err)
 	}
 
-	log.Debug().Msgf("Adding item %s to cart %s", ni.Description, ni.CartID)
+	logging.Ctx(ctx).Debug().
+		Str("sku", ni.SKU).
+		Int("quantity", ni.Quantity).
+		Msg("Adding item")
 
-	//Check that the item exists before adding to the cart
-	_, err := h.svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+	//The current line tells whether the item adds a line to the cart
+	c, err := h.loadOwned(ctx, ni.CartID)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, quantity := 1, ni.Quantity
+	existing := c.findLine(ni.ItemID, ni.SKU)
+	if existing != nil {
+		lines, quantity = 0, existing.Quantity+ni.Quantity
+	}
+	if h.limits.LineQuantity > 0 && quantity > h.limits.LineQuantity {
+		return nil, &LimitError{Limit: LimitLineQuantity, Max: h.limits.LineQuantity}
+	}
+
+	update := &dynamodb.Update{
+		Key: LineKey(ni.CartID, ni.ItemID, ni.SKU),
+		ExpressionAttributeNames: map[string]*string{
+			"#t": aws.String("type"),
+			"#c": aws.String("cart_id"),
+			"#i": aws.String("item_id"),
+			"#s": aws.String("sku"),
+			"#d": aws.String("description"),
+			"#p": aws.String("price"),
+			"#q": aws.String("quantity"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":t":    {S: aws.String(DynamoDBRowTypeCartItem)},
+			":c":    {S: aws.String(ni.CartID)},
+			":i":    {S: aws.String(ni.ItemID)},
+			":s":    {S: aws.String(ni.SKU)},
+			":d":    {S: aws.String(ni.Description)},
+			":p":    {N: aws.String(fmt.Sprintf("%f", ni.Price))},
+			":q":    {N: aws.String(strconv.Itoa(ni.Quantity))},
+			":zero": {N: aws.String(strconv.Itoa(0))},
+		},
+		UpdateExpression: aws.String(
+			"set #t=:t, #c=:c, #i=:i, #s=:s, #d=:d, #p=:p, #q = if_not_exists(#q, :zero) + :q",
+		),
+		ConditionExpression: aws.String("attribute_not_exists(#q)"),
+		TableName:           aws.String(h.tableName),
+	}
+
+	//The quantity of an existing line is incremented only if it stays within
+	//the limit, even if the line changed since it was loaded
+	if existing != nil {
+		update.ConditionExpression = aws.String("attribute_exists(#q)")
+		if h.limits.LineQuantity > 0 {
+			update.ConditionExpression = aws.String("#q <= :room")
+			update.ExpressionAttributeValues[":room"] = &dynamodb.AttributeValue{
+				N: aws.String(strconv.Itoa(h.limits.LineQuantity - ni.Quantity))}
+		}
+	}
+
+	_, err = h.svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
 		TransactItems: []*dynamodb.TransactWriteItem{
-			{
-				ConditionCheck: &dynamodb.ConditionCheck{
-					Key: map[string]*dynamodb.AttributeValue{
-						"pk": {S: aws.String(getItemPK(ni.ItemID))},
-						"sk": {S: aws.String(getItemSK(ni.ItemID))},
-					},
-					TableName:           aws.String(h.tableName),
-					ConditionExpression: aws.String("attribute_exists(pk) and attribute_exists(sk)"),
-				},
-			},
-			{
-				Update: &dynamodb.Update{
-					Key: map[string]*dynamodb.AttributeValue{
-						"pk": {S: aws.String(getCartPK(ni.CartID))},
-						"sk": {S: aws.String(getItemSK(ni.ItemID))},
-					},
-					ExpressionAttributeNames: map[string]*string{
-						"#t": aws.String("type"),
-						"#c": aws.String("cart_id"),
-						"#i": aws.String("item_id"),
-						"#d": aws.String("description"),
-						"#p": aws.String("price"),
-						"#q": aws.String("quantity"),
-					},
-					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-						":t":    {S: aws.String(DynamoDBRowTypeCartItem)},
-						":c":    {S: aws.String(ni.CartID)},
-						":i":    {S: aws.String(ni.ItemID)},
-						":d":    {S: aws.String(ni.Description)},
-						":p":    {N: aws.String(fmt.Sprintf("%f", ni.Price))},
-						":q":    {N: aws.String(strconv.Itoa(ni.Quantity))},
-						":zero": {N: aws.String(strconv.Itoa(0))},
-					},
-					UpdateExpression: aws.String(
-						"set #t=:t, #c=:c, #i=:i, #d=:d, #p=:p, #q = if_not_exists(#q, :zero) + :q",
-					),
-					TableName: aws.String(h.tableName),
-				},
-			},
+			h.CatalogCheck(ni.ItemID, ni.SKU, quantity),
+			h.CountersUpdate(ctx, ni.CartID, lines, ni.Quantity),
+			{Update: update},
 		},
 	},
 	)
@@ -226,95 +358,215 @@ func (h *Handler) AddItem(ctx context.Context, ni *NewItemInfo) (*Cart, error) {
 		//cancellationIdx is the index of the TransactWriteItem in the
 		//TransactWriteItems array
 		cancellationIdx := 0
-		if isAwsErrorOfType(err, cancellationIdx, dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed) {
-			log.Error().Msgf("Item does not exist: %s", err.Error())
-			return nil, ErrItemDoesNotExist
+		if cerr := h.CatalogError(err, cancellationIdx); cerr != nil {
+			logging.Ctx(ctx).Error().Err(cerr).Msg("Item rejected")
+			return nil, cerr
+		}
+		cancellationIdx = 1
+		if cerr := h.CountersError(ctx, err, cancellationIdx, lines); cerr != nil {
+			logging.Ctx(ctx).Error().Err(cerr).Msg("Cart rejected the item")
+			return nil, cerr
+		}
+		cancellationIdx = 2
+		if existing != nil && h.limits.LineQuantity > 0 &&
+			saws.IsErrorOfType(err, dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed, cancellationIdx) {
+			logging.Ctx(ctx).Error().Msg("Line of the item is full")
+			return nil, &LimitError{Limit: LimitLineQuantity, Max: h.limits.LineQuantity}
 		}
 
-		log.Error().Msgf("Error adding item: %s", err.Error())
+		logging.Ctx(ctx).Error().Err(err).Msg("Error adding item")
 		return nil, ErrCouldNotAddItem
 	}
 
-	log.Info().Msgf("Item %s added to cart %s", ni.ItemID, ni.CartID)
+	logging.Ctx(ctx).Info().Msg("Item added")
 
 	return h.Load(ctx, ni.CartID)
 
 }
 
 //UpdateItem Updates the quantity for an item in the shopping cart
-func (h *Handler) UpdateItem(ctx context.Context, ui *UpdateItemInfo) (*Cart, error) {
+func (h *Handler) UpdateItem(ctx context.Context, ui *UpdateItemInfo) (_ *Cart, err error) {
+
+	ctx, end := h.start(ctx, "cart.UpdateItem")
+	defer func() { end(err) }()
+
+	ctx = logging.WithItem(logging.WithCart(ctx, ui.CartID), ui.ItemID)
 
 	if err := validate.Struct(ui); err != nil {
-		log.Error().Msgf("Error validating struct: %s", err.Error())
+		logging.Ctx(ctx).Error().Err(err).Msg("Error validating struct")
 		return nil, getValidationError(err)
 	}
 
-	log.Debug().Msgf("Updating quantity: %d for item %s in cart %s", ui.Quantity,
-		ui.ItemID, ui.CartID)
+	if h.limits.LineQuantity > 0 && ui.Quantity > h.limits.LineQuantity {
+		return nil, &LimitError{Limit: LimitLineQuantity, Max: h.limits.LineQuantity}
+	}
 
-	_, err := h.svc.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
-		ExpressionAttributeNames: map[string]*string{
-			"#Q": aws.String("quantity"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":q": {N: aws.String(strconv.Itoa(ui.Quantity))},
-		},
-		Key: map[string]*dynamodb.AttributeValue{
-			"pk": {S: aws.String(getCartPK(ui.CartID))},
-			"sk": {S: aws.String(getItemSK(ui.ItemID))},
+	logging.Ctx(ctx).Debug().
+		Str("sku", ui.SKU).
+		Int("quantity", ui.Quantity).
+		Msg("Updating quantity")
+
+	//The current quantity is needed to update the units of the cart
+	c, err := h.loadOwned(ctx, ui.CartID)
+	if err != nil {
+		return nil, err
+	}
+	existing := c.findLine(ui.ItemID, ui.SKU)
+	if existing == nil {
+		logging.Ctx(ctx).Error().Msg("Item is not in the cart")
+		return nil, ErrCouldNotUpdateItem
+	}
+
+	_, err = h.svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			h.CatalogCheck(ui.ItemID, ui.SKU, ui.Quantity),
+			h.CountersUpdate(ctx, ui.CartID, 0, ui.Quantity-existing.Quantity),
+			{
+				Update: &dynamodb.Update{
+					ExpressionAttributeNames: map[string]*string{
+						"#Q": aws.String("quantity"),
+					},
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":q":   {N: aws.String(strconv.Itoa(ui.Quantity))},
+						":old": {N: aws.String(strconv.Itoa(existing.Quantity))},
+					},
+					Key:              LineKey(ui.CartID, ui.ItemID, ui.SKU),
+					TableName:        aws.String(h.tableName),
+					UpdateExpression: aws.String("SET #Q = :q"),
+					//The condition fails if the line changed after it was
+					//loaded, so the units of the cart stay consistent
+					ConditionExpression: aws.String("#Q = :old"),
+				},
+			},
 		},
-		TableName:           aws.String(h.tableName),
-		UpdateExpression:    aws.String("SET #Q = :q"),
-		ConditionExpression: aws.String("attribute_exists(pk) and attribute_exists(sk)"),
 	})
 
 	if err != nil {
-		log.Error().Msgf("Error updating item: %s", err.Error())
+		if cerr := h.CatalogError(err, 0); cerr != nil {
+			logging.Ctx(ctx).Error().Err(cerr).Msg("Item rejected")
+			return nil, cerr
+		}
+		if cerr := h.CountersError(ctx, err, 1, 0); cerr != nil {
+			logging.Ctx(ctx).Error().Err(cerr).Msg("Cart rejected the quantity")
+			return nil, cerr
+		}
+
+		logging.Ctx(ctx).Error().Err(err).Msg("Error updating item")
 		return nil, ErrCouldNotUpdateItem
 	}
 
-	log.Info().Msgf("Quantity set to %d for item %s in cart %s", ui.Quantity,
-		ui.ItemID, ui.CartID)
+	logging.Ctx(ctx).Info().Int("quantity", ui.Quantity).Msg("Quantity updated")
 
 	return h.Load(ctx, ui.CartID)
 }
 
 //DeleteItem deletes an item from the shopping cart
-func (h *Handler) DeleteItem(ctx context.Context, di *DeleteItemInfo) (*Cart, error) {
+func (h *Handler) DeleteItem(ctx context.Context, di *DeleteItemInfo) (_ *Cart, err error) {
+
+	ctx, end := h.start(ctx, "cart.DeleteItem")
+	defer func() { end(err) }()
+
+	ctx = logging.WithItem(logging.WithCart(ctx, di.CartID), di.ItemID)
 
 	if err := validate.Struct(di); err != nil {
-		log.Error().Msgf("Error validating struct: %s", err.Error())
+		logging.Ctx(ctx).Error().Err(err).Msg("Error validating struct")
 		return nil, getValidationError(err)
 	}
 
-	log.Debug().Msgf("Deleting item %s from cart %s", di.ItemID, di.CartID)
+	logging.Ctx(ctx).Debug().Str("sku", di.SKU).Msg("Deleting item")
 
-	_, err := h.svc.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
-		Key: map[string]*dynamodb.AttributeValue{
-			"pk": {S: aws.String(getCartPK(di.CartID))},
-			"sk": {S: aws.String(getItemSK(di.ItemID))},
+	//The current quantity is needed to update the units of the cart
+	c, err := h.loadOwned(ctx, di.CartID)
+	if err != nil {
+		return nil, err
+	}
+	existing := c.findLine(di.ItemID, di.SKU)
+	if existing == nil {
+		logging.Ctx(ctx).Error().Msg("Item is not in the cart")
+		return nil, ErrCouldNotDeleteItem
+	}
+
+	_, err = h.svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			h.CountersUpdate(ctx, di.CartID, -1, -existing.Quantity),
+			{
+				Delete: &dynamodb.Delete{
+					Key: LineKey(di.CartID, di.ItemID, di.SKU),
+					ExpressionAttributeNames: map[string]*string{
+						"#q": aws.String("quantity"),
+					},
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":old": {N: aws.String(strconv.Itoa(existing.Quantity))},
+					},
+					ConditionExpression: aws.String("#q = :old"),
+					TableName:           aws.String(h.tableName),
+				},
+			},
 		},
-		ConditionExpression: aws.String("attribute_exists(pk) and attribute_exists(sk)"),
-		TableName:           aws.String(h.tableName),
 	})
 	if err != nil {
-		log.Error().Msgf("Error deleting item: %s", err.Error())
+		if cerr := h.CountersError(ctx, err, 0, 0); cerr != nil {
+			logging.Ctx(ctx).Error().Err(cerr).Msg("Cart rejected the delete")
+			return nil, cerr
+		}
+
+		logging.Ctx(ctx).Error().Err(err).Msg("Error deleting item")
 		return nil, ErrCouldNotDeleteItem
 	}
 
-	log.Info().Msgf("Item %s deleted from cart %s", di.ItemID, di.CartID)
+	logging.Ctx(ctx).Info().Msg("Item deleted")
 
 	return h.Load(ctx, di.CartID)
 }
 
-//Load Loads the shopping cart
-func (h *Handler) Load(ctx context.Context, cartID string) (*Cart, error) {
+//Load Loads the shopping cart and compares its lines with the catalog.
+//Carts with owner can only be loaded by the user that owns them
+func (h *Handler) Load(ctx context.Context, cartID string) (_ *Cart, err error) {
+
+	ctx, end := h.start(ctx, "cart.Load")
+	defer func() { end(err) }()
+
+	ctx = logging.WithCart(ctx, cartID)
+
+	c, err := h.loadOwned(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.applyCatalog(ctx, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+//loadOwned Loads the shopping cart if the user in the context can access it,
+//without comparing its lines with the catalog
+func (h *Handler) loadOwned(ctx context.Context, cartID string) (*Cart, error) {
+
+	c, err := h.load(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.OwnerID != "" && c.OwnerID != auth.UserID(ctx) {
+		logging.Ctx(ctx).Error().Str("owner_id", c.OwnerID).
+			Msg("Cart belongs to another user")
+		return nil, ErrCartAccessDenied
+	}
+
+	return c, nil
+}
+
+//load Loads the shopping cart without checking its owner
+func (h *Handler) load(ctx context.Context, cartID string) (*Cart, error) {
 
 	if cartID == "" {
 		return nil, errors.New(ErrCartIDIsEmpty)
 	}
 
-	log.Debug().Msgf("Loading shopping cart %s", cartID)
+	ctx = logging.WithCart(ctx, cartID)
+	logging.Ctx(ctx).Debug().Msg("Loading shopping cart")
 
 	result, err := h.svc.QueryWithContext(ctx, &dynamodb.QueryInput{
 		KeyConditions: map[string]*dynamodb.Condition{
@@ -324,21 +576,16 @@ func (h *Handler) Load(ctx context.Context, cartID string) (*Cart, error) {
 					{S: aws.String(getCartPK(cartID))},
 				},
 			},
-			"sk": {
-				ComparisonOperator: aws.String("BEGINS_WITH"),
-				AttributeValueList: []*dynamodb.AttributeValue{
-					{
-						S: aws.String(DynamoDBPrefixItem),
-					},
-				},
-			},
 		},
-		ProjectionExpression: aws.String("item_id,description,price,quantity"),
+		ExpressionAttributeNames: map[string]*string{
+			"#t": aws.String("type"),
+		},
+		ProjectionExpression: aws.String("#t,owner_id,item_id,sku,description,price,quantity"),
 		TableName:            aws.String(h.tableName),
 	})
 
 	if err != nil {
-		log.Error().Msgf("Error loading cart: %s", err.Error())
+		logging.Ctx(ctx).Error().Err(err).Msg("Error loading cart")
 		return nil, ErrCouldNotLoadItems
 	}
 
@@ -348,11 +595,23 @@ func (h *Handler) Load(ctx context.Context, cartID string) (*Cart, error) {
 		return &c, nil
 	}
 
-	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &c.Items)
-	if err != nil {
-		log.Error().Msgf("Error loading cart: %s", err.Error())
-		return nil, ErrCouldNotLoadCart
+	//The partition contains the cart row, with the owner, and its lines
+	for _, row := range result.Items {
+		if t, ok := row["type"]; ok && aws.StringValue(t.S) == DynamoDBRowTypeCart {
+			if owner, ok := row["owner_id"]; ok {
+				c.OwnerID = aws.StringValue(owner.S)
+			}
+			continue
+		}
+
+		var i Item
+		if err := dynamodbattribute.UnmarshalMap(row, &i); err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("Error loading cart")
+			return nil, ErrCouldNotLoadCart
+		}
+		c.Items = append(c.Items, i)
 	}
+
 	c.calculateTotal()
 
 	return &c, nil
@@ -374,13 +633,61 @@ func getItemPK(itemID string) string {
 	return fmt.Sprintf("%s%s", DynamoDBPrefixItem, itemID)
 }
 
-//isAwsErrorOfType returns true if an aws error code is of certain type
-func isAwsErrorOfType(err error, cancellationIdx int, awsErrorCode string) bool {
-	switch t := err.(type) {
-	case *dynamodb.TransactionCanceledException:
-		if *t.CancellationReasons[cancellationIdx].Code == awsErrorCode {
-			return true
-		}
+//LineSK returns the sort key of a line in the shopping cart. Lines of an
+//item variant include the SKU, so every variant is stored in its own line.
+//Wishlists use the same sort key for their lines
+func LineSK(itemID, sku string) string {
+	if sku == "" {
+		return getItemSK(itemID)
+	}
+	return fmt.Sprintf("%s#%s%s", getItemSK(itemID), DynamoDBPrefixSKU, sku)
+}
+
+//LineKey returns the key of a line in the shopping cart
+func LineKey(cartID, itemID, sku string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"pk": {S: aws.String(getCartPK(cartID))},
+		"sk": {S: aws.String(LineSK(itemID, sku))},
+	}
+}
+
+//getCatalogSK returns the sort key of the catalog row that has to exist for
+//the item to be added to a cart: the item itself or the variant with the SKU
+func getCatalogSK(itemID, sku string) string {
+	if sku == "" {
+		return getItemSK(itemID)
+	}
+	return fmt.Sprintf("%s%s", DynamoDBPrefixSKU, sku)
+}
+
+//getCartRow returns the row of a new shopping cart. Carts created by an
+//authenticated user can only be accessed by that user
+func getCartRow(ctx context.Context, cartID string) map[string]*dynamodb.AttributeValue {
+	row := getActivity(cartID)
+	row["pk"] = &dynamodb.AttributeValue{S: aws.String(getCartPK(cartID))}
+	row["sk"] = &dynamodb.AttributeValue{S: aws.String(getCartPK(cartID))}
+	row["cart_id"] = &dynamodb.AttributeValue{S: aws.String(cartID)}
+	row["type"] = &dynamodb.AttributeValue{S: aws.String(DynamoDBRowTypeCart)}
+	if userID := auth.UserID(ctx); userID != "" {
+		row["owner_id"] = &dynamodb.AttributeValue{S: aws.String(userID)}
+	}
+	return row
+}
+
+//getCartItemRow returns the row of a new line in the shopping cart
+func getCartItemRow(ni *NewItemInfo) map[string]*dynamodb.AttributeValue {
+	row := map[string]*dynamodb.AttributeValue{
+		"pk":          {S: aws.String(getCartPK(ni.CartID))},
+		"sk":          {S: aws.String(LineSK(ni.ItemID, ni.SKU))},
+		"type":        {S: aws.String(DynamoDBRowTypeCartItem)},
+		"cart_id":     {S: aws.String(ni.CartID)},
+		"item_id":     {S: aws.String(ni.ItemID)},
+		"description": {S: aws.String(ni.Description)},
+		"price":       {N: aws.String(fmt.Sprintf("%f", ni.Price))},
+		"quantity":    {N: aws.String(strconv.Itoa(ni.Quantity))},
+	}
+	if ni.SKU != "" {
+		row["sku"] = &dynamodb.AttributeValue{S: aws.String(ni.SKU)}
 	}
-	return false
+	return row
 }
@@ -4,8 +4,18 @@ import (
 	"context"
 	"errors"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/roloum/store/api/internal/auth"
+	"github.com/roloum/store/api/internal/store/item"
 	"github.com/roloum/store/api/internal/test"
 	"github.com/rs/zerolog"
 )
@@ -20,8 +30,167 @@ type (
 		item *NewItemInfo
 		err  error
 	}
+
+	//recorder keeps the operations and their outcomes
+	recorder struct {
+		observed []string
+	}
 )
 
+//Observe keeps the operation and its outcome
+func (r *recorder) Observe(operation, outcome string, latency time.Duration) {
+	r.observed = append(r.observed, operation+" "+outcome)
+}
+
+//Consume discards the capacity
+func (r *recorder) Consume(operation, table string, units float64) {}
+
+//partitions is a DynamoDB client that returns the rows of the partition of
+//every query, and keeps the actions of the transactions and the updates
+type partitions struct {
+	test.MockDynamoDB
+	rows         map[string][]map[string]*dynamodb.AttributeValue
+	transactions [][]*dynamodb.TransactWriteItem
+	updates      []*dynamodb.UpdateItemInput
+	batches      []*dynamodb.BatchGetItemInput
+}
+
+//QueryWithContext returns the rows of the partition of the query, of the
+//table or of the index
+func (p *partitions) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput,
+	opts ...request.Option) (*dynamodb.QueryOutput, error) {
+
+	var pk string
+	if input.IndexName != nil {
+		pk = aws.StringValue(input.ExpressionAttributeValues[":pk"].S)
+	} else {
+		pk = aws.StringValue(input.KeyConditions["pk"].AttributeValueList[0].S)
+	}
+	rows := p.rows[pk]
+
+	return &dynamodb.QueryOutput{Count: aws.Int64(int64(len(rows))), Items: rows}, nil
+}
+
+//TransactWriteItemsWithContext keeps the actions of the transaction
+func (p *partitions) TransactWriteItemsWithContext(ctx aws.Context,
+	input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (
+	*dynamodb.TransactWriteItemsOutput, error) {
+
+	p.transactions = append(p.transactions, input.TransactItems)
+
+	out, err := p.MockDynamoDB.TransactWriteItemsWithContext(ctx, input, opts...)
+	if err != nil {
+		return out, err
+	}
+
+	//The active cart pointers are moved, so they can be read back
+	for _, ti := range input.TransactItems {
+		if ti.Update == nil {
+			continue
+		}
+		pk := aws.StringValue(ti.Update.Key["pk"].S)
+		if strings.HasPrefix(pk, DynamoDBPrefixUser) {
+			p.rows[pk] = []map[string]*dynamodb.AttributeValue{
+				{"cart_id": ti.Update.ExpressionAttributeValues[":to"]},
+			}
+		}
+	}
+
+	return out, nil
+}
+
+//BatchGetItemWithContext returns the rows of the keys, matched by their sk
+//attribute, and the calls in batches
+func (p *partitions) BatchGetItemWithContext(ctx aws.Context,
+	input *dynamodb.BatchGetItemInput, opts ...request.Option) (
+	*dynamodb.BatchGetItemOutput, error) {
+
+	p.batches = append(p.batches, input)
+
+	var found []map[string]*dynamodb.AttributeValue
+	for _, ka := range input.RequestItems {
+		for _, key := range ka.Keys {
+			for _, row := range p.rows[aws.StringValue(key["pk"].S)] {
+				if row["sk"] != nil && aws.StringValue(row["sk"].S) == aws.StringValue(key["sk"].S) {
+					found = append(found, row)
+				}
+			}
+		}
+	}
+
+	return &dynamodb.BatchGetItemOutput{
+		Responses: map[string][]map[string]*dynamodb.AttributeValue{StoreTable: found},
+	}, nil
+}
+
+//GetItemWithContext returns the first row of the partition of the key
+func (p *partitions) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput,
+	opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+
+	if rows := p.rows[aws.StringValue(input.Key["pk"].S)]; len(rows) > 0 {
+		return &dynamodb.GetItemOutput{Item: rows[0]}, nil
+	}
+	return p.MockDynamoDB.GetItemWithContext(ctx, input, opts...)
+}
+
+//UpdateItemWithContext keeps the update
+func (p *partitions) UpdateItemWithContext(ctx aws.Context,
+	input *dynamodb.UpdateItemInput, opts ...request.Option) (
+	*dynamodb.UpdateItemOutput, error) {
+
+	p.updates = append(p.updates, input)
+	return p.MockDynamoDB.UpdateItemWithContext(ctx, input, opts...)
+}
+
+//line returns the row of a line of a cart
+func line(itemID, price, quantity string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"type":        {S: aws.String(DynamoDBRowTypeCartItem)},
+		"item_id":     {S: aws.String(itemID)},
+		"description": {S: aws.String("Some item description")},
+		"price":       {N: aws.String(price)},
+		"quantity":    {N: aws.String(quantity)},
+	}
+}
+
+//variantLine returns the row of a line of a variant of an item
+func variantLine(itemID, sku, price, quantity string) map[string]*dynamodb.AttributeValue {
+	row := line(itemID, price, quantity)
+	row["sku"] = &dynamodb.AttributeValue{S: aws.String(sku)}
+	return row
+}
+
+//catalogItem returns the row of an item of the catalog with its base price
+//and the copy of its PRICE# rows
+func catalogItem(itemID, price string, prices ...item.Price) map[string]*dynamodb.AttributeValue {
+	row := map[string]*dynamodb.AttributeValue{
+		"sk":          {S: aws.String(getItemPK(itemID))},
+		"type":        {S: aws.String(item.DynamoDBRowTypeItem)},
+		"item_id":     {S: aws.String(itemID)},
+		"description": {S: aws.String("Some item description")},
+		"price":       {N: aws.String(price)},
+	}
+	for _, p := range prices {
+		_, values, _ := item.PriceAppend(p)
+		if copies := row[item.DynamoDBAttributePrices]; copies != nil {
+			values[":prices"].L = append(copies.L, values[":prices"].L...)
+		}
+		row[item.DynamoDBAttributePrices] = values[":prices"]
+	}
+	return row
+}
+
+//catalogVariant returns the row of a variant of an item of the catalog
+func catalogVariant(itemID, sku, price string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"sk":      {S: aws.String(item.DynamoDBPrefixSKU + sku)},
+		"type":    {S: aws.String(item.DynamoDBRowTypeVariant)},
+		"item_id": {S: aws.String(itemID)},
+		"sku":     {S: aws.String(sku)},
+		"price":   {N: aws.String(price)},
+	}
+}
+
 func init() {
 	zerolog.SetGlobalLevel(zerolog.Disabled)
 	test.SetEnvironment()
@@ -193,3 +362,1046 @@ func getAddItemTestCases() []cartTest {
 		},
 	}
 }
+
+//TestLineSK tests the sort key of the cart lines with and without variants
+func TestLineSK(t *testing.T) {
+
+	tests := []struct {
+		desc   string
+		itemID string
+		sku    string
+		sk     string
+	}{
+		{"WithoutSKU", "11aa", "", "ITEM#11aa"},
+		{"WithSKU", "11aa", "CHG-USBC", "ITEM#11aa#SKU#CHG-USBC"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			if sk := LineSK(tc.itemID, tc.sku); sk != tc.sk {
+				t.Errorf("Expected: %s. Received: %s", tc.sk, sk)
+			}
+		})
+	}
+}
+
+//TestGetVariants tests that the item is loaded with its variant matrix from
+//the rows of its partition
+func TestGetVariants(t *testing.T) {
+
+	dimensions, err := dynamodbattribute.Marshal([]item.Dimension{
+		{Name: "connector", Values: []string{"USB-C", "Lightning"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	charger := catalogItem("i1", "10")
+	charger["dimensions"] = dimensions
+	usbc := catalogVariant("i1", "USB-C", "12")
+	usbc["options"] = &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+		"connector": {S: aws.String("USB-C")}}}
+	usbc["stock"] = &dynamodb.AttributeValue{N: aws.String("4")}
+	lightning := catalogVariant("i1", "Lightning", "14")
+	lightning["options"] = &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+		"connector": {S: aws.String("Lightning")}}}
+	lightning["stock"] = &dynamodb.AttributeValue{N: aws.String("0")}
+
+	tests := []struct {
+		desc     string
+		rows     []map[string]*dynamodb.AttributeValue
+		expected *item.Item
+		err      error
+	}{
+		{"ItemNotFound", nil, nil, item.ErrItemNotFound},
+		{"WithoutVariants", []map[string]*dynamodb.AttributeValue{catalogItem("i1", "10")},
+			&item.Item{ItemID: "i1", Description: "Some item description", Price: 10}, nil},
+		{"VariantMatrix", []map[string]*dynamodb.AttributeValue{charger, usbc, lightning},
+			&item.Item{
+				ItemID:      "i1",
+				Description: "Some item description",
+				Price:       10,
+				Dimensions: []item.Dimension{
+					{Name: "connector", Values: []string{"USB-C", "Lightning"}}},
+				Variants: []item.Variant{
+					{SKU: "USB-C", Options: map[string]string{"connector": "USB-C"},
+						Price: 12, Stock: 4},
+					{SKU: "Lightning", Options: map[string]string{"connector": "Lightning"},
+						Price: 14, Stock: 0},
+				},
+			}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc := &partitions{rows: map[string][]map[string]*dynamodb.AttributeValue{
+				getItemPK("i1"): tc.rows,
+			}}
+			ih, err := item.New(svc, StoreTable)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			i, err := ih.Get(context.Background(), "i1")
+			if err != tc.err {
+				t.Fatalf("Expected: %v. Received: %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(i, tc.expected) {
+				t.Errorf("Expected: %+v. Received: %+v", tc.expected, i)
+			}
+		})
+	}
+}
+
+//TestAddVariant tests that every SKU of an item is added to its own line,
+//and that the CatalogCheck of the variant rejects unknown and out of stock
+//SKUs
+func TestAddVariant(t *testing.T) {
+
+	//canceled returns the error of a transaction whose CatalogCheck failed
+	//its condition and returned the row of the variant, if it exists
+	canceled := func(row map[string]*dynamodb.AttributeValue) error {
+		return &dynamodb.TransactionCanceledException{
+			CancellationReasons: []*dynamodb.CancellationReason{
+				{
+					Code: aws.String(dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed),
+					Item: row,
+				},
+				{Code: aws.String("None")},
+				{Code: aws.String("None")},
+			},
+		}
+	}
+
+	tests := []struct {
+		desc      string
+		sku       string
+		err       error
+		expected  error
+		lines     string
+		condition string
+	}{
+		{"OtherSKU", "Lightning", nil, nil, "1", "attribute_not_exists(#q)"},
+		//The quantity of the existing line is incremented within its limit
+		{"SameSKU", "USB-C", nil, nil, "0", "#q <= :room"},
+		{"UnknownSKU", "HDMI", canceled(nil), ErrItemDoesNotExist, "", ""},
+		{"OutOfStockSKU", "Lightning", canceled(map[string]*dynamodb.AttributeValue{
+			"sku":   {S: aws.String("Lightning")},
+			"stock": {N: aws.String("0")},
+		}), ErrItemIsOutOfStock, "", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc := &partitions{rows: map[string][]map[string]*dynamodb.AttributeValue{
+				getCartPK("cart1"): {
+					{
+						"type":    {S: aws.String(DynamoDBRowTypeCart)},
+						"cart_id": {S: aws.String("cart1")},
+					},
+					variantLine("i1", "USB-C", "12", "1"),
+				},
+			}}
+			svc.OutputError = tc.err
+			handler, _ := New(svc, StoreTable)
+
+			_, err := handler.AddItem(context.Background(), &NewItemInfo{
+				CartID:      "cart1",
+				ItemID:      "i1",
+				SKU:         tc.sku,
+				Description: "Some item description",
+				Price:       12,
+				Quantity:    1,
+			})
+			if !reflect.DeepEqual(err, tc.expected) {
+				t.Fatalf("Expected: %v. Received: %v", tc.expected, err)
+			}
+			if len(svc.transactions) != 1 {
+				t.Fatalf("Expected a transaction. Received: %d", len(svc.transactions))
+			}
+
+			//The CatalogCheck reads the row of the variant
+			actions := svc.transactions[0]
+			check := actions[0].ConditionCheck
+			if sk := aws.StringValue(check.Key["sk"].S); sk != getCatalogSK("i1", tc.sku) {
+				t.Errorf("Expected: %s. Received: %s", getCatalogSK("i1", tc.sku), sk)
+			}
+			if !strings.Contains(aws.StringValue(check.ConditionExpression), "stock >= :q") {
+				t.Errorf("Expected a stock condition. Received: %s",
+					aws.StringValue(check.ConditionExpression))
+			}
+			if tc.expected != nil {
+				return
+			}
+
+			if lines := aws.StringValue(actions[1].Update.ExpressionAttributeValues[":l"].N); lines != tc.lines {
+				t.Errorf("Expected lines: %s. Received: %s", tc.lines, lines)
+			}
+			update := actions[2].Update
+			if !reflect.DeepEqual(update.Key, LineKey("cart1", "i1", tc.sku)) {
+				t.Errorf("Expected: %v. Received: %v", LineKey("cart1", "i1", tc.sku), update.Key)
+			}
+			if condition := aws.StringValue(update.ConditionExpression); condition != tc.condition {
+				t.Errorf("Expected: %s. Received: %s", tc.condition, condition)
+			}
+		})
+	}
+
+	//The lines of two SKUs of the same item are loaded as two lines
+	svc := &partitions{rows: map[string][]map[string]*dynamodb.AttributeValue{
+		getCartPK("cart1"): {
+			{
+				"type":    {S: aws.String(DynamoDBRowTypeCart)},
+				"cart_id": {S: aws.String("cart1")},
+			},
+			variantLine("i1", "USB-C", "12", "1"),
+			variantLine("i1", "Lightning", "14", "2"),
+		},
+	}}
+	handler, _ := New(svc, StoreTable)
+	c, err := handler.Load(context.Background(), "cart1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Items) != 2 || c.Items[0].SKU != "USB-C" || c.Items[1].SKU != "Lightning" ||
+		c.Items[0].ItemID != c.Items[1].ItemID {
+		t.Errorf("Unexpected lines: %+v", c.Items)
+	}
+}
+
+//TestLoadOwner tests that carts with owner can only be loaded by their owner
+func TestLoadOwner(t *testing.T) {
+
+	handler, _ := New(&test.MockDynamoDB{
+		QueryOutput: &dynamodb.QueryOutput{
+			Count: aws.Int64(2),
+			Items: []map[string]*dynamodb.AttributeValue{
+				{
+					"type":     {S: aws.String(DynamoDBRowTypeCart)},
+					"owner_id": {S: aws.String("u1")},
+				},
+				{
+					"type":        {S: aws.String(DynamoDBRowTypeCartItem)},
+					"item_id":     {S: aws.String("11aa")},
+					"description": {S: aws.String("Some item description")},
+					"price":       {N: aws.String("2")},
+					"quantity":    {N: aws.String("3")},
+				},
+			},
+		},
+	}, StoreTable)
+
+	tests := []struct {
+		desc   string
+		userID string
+		err    error
+	}{
+		{"Owner", "u1", nil},
+		{"OtherUser", "u2", ErrCartAccessDenied},
+		{"Anonymous", "", ErrCartAccessDenied},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.userID != "" {
+				ctx = auth.NewContext(ctx, &auth.Claims{Subject: tc.userID})
+			}
+
+			c, err := handler.Load(ctx, "cart1")
+			if !reflect.DeepEqual(err, tc.err) {
+				t.Errorf("Expected: %v. Received: %v", tc.err, err)
+			}
+			if err == nil && (len(c.Items) != 1 || c.Total != 6) {
+				t.Errorf("Expected 1 item with total 6. Received: %v", c)
+			}
+		})
+	}
+}
+
+//TestMerge tests the validation of the carts to merge
+func TestMerge(t *testing.T) {
+
+	handler, _ := New(&test.MockDynamoDB{}, StoreTable)
+
+	tests := []struct {
+		desc        string
+		guestCartID string
+		userCartID  string
+		err         error
+	}{
+		{ErrCartIDIsEmpty, "", "user", errors.New(ErrCartIDIsEmpty)},
+		{ErrMergeCartIntoItself.Error(), "cart1", "cart1", ErrMergeCartIntoItself},
+		{"Success", "guest", "user", nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := handler.Merge(context.Background(), tc.guestCartID, tc.userCartID)
+			if !reflect.DeepEqual(err, tc.err) {
+				t.Errorf("Expected: %v. Received: %v", tc.err, err)
+			}
+		})
+	}
+}
+
+//TestGetMergeTransactions tests that the lines are merged in chunks that fit
+//in a transaction and that the quantities are added and limited
+func TestGetMergeTransactions(t *testing.T) {
+
+	handler, _ := New(&test.MockDynamoDB{}, StoreTable,
+		WithLimits(Limits{LineQuantity: 99, Lines: 100, Units: 10000}))
+
+	guest := &Cart{CartID: "guest"}
+	for n := 0; n < 60; n++ {
+		guest.Items = append(guest.Items, Item{ItemID: strconv.Itoa(n),
+			Description: "Some item description", Price: 1, Quantity: 60})
+	}
+	user := &Cart{CartID: "user", Items: []Item{
+		{ItemID: "0", Description: "Some item description", Price: 1, Quantity: 50},
+	}}
+
+	transactions := handler.getMergeTransactions(context.Background(), guest, user, "")
+
+	if len(transactions) != 2 {
+		t.Fatalf("Expected: 2 transactions. Received: %d", len(transactions))
+	}
+
+	var puts, updates, deletes, checks, lines int
+	for _, tr := range transactions {
+		transactItems := tr.actions
+		if len(transactItems) > transactionItemLimit {
+			t.Errorf("Transaction with %d items", len(transactItems))
+		}
+		if transactItems[tr.countersIdx].Update == nil {
+			t.Errorf("Expected the update of the counters first")
+		}
+		for _, c := range tr.checks {
+			if transactItems[c.idx].ConditionCheck == nil {
+				t.Errorf("Expected the check of item %s at %d", c.itemID, c.idx)
+			}
+		}
+		checks += len(tr.checks)
+		lines += tr.lines
+		for _, ti := range transactItems[1:] {
+			switch {
+			case ti.Put != nil:
+				puts++
+			case ti.Update != nil:
+				updates++
+				if q := *ti.Update.ExpressionAttributeValues[":q"].N; q != "99" {
+					t.Errorf("Expected quantity: 99. Received: %s", q)
+				}
+			case ti.Delete != nil:
+				deletes++
+			}
+		}
+	}
+
+	if puts != 59 || updates != 1 || deletes != 61 {
+		t.Errorf("Expected 59 puts, 1 update and 61 deletes. Received: %d, %d, %d",
+			puts, updates, deletes)
+	}
+	if checks != 60 || lines != 59 {
+		t.Errorf("Expected 60 checks and 59 lines. Received: %d, %d", checks, lines)
+	}
+}
+
+//TestMergeRejected tests that the failures of the catalog checks and of the
+//counters of the user cart are mapped to their errors
+func TestMergeRejected(t *testing.T) {
+
+	//canceled returns the error of a transaction whose action at idx failed
+	//its condition and returned the row
+	canceled := func(idx int, row map[string]*dynamodb.AttributeValue) error {
+		reasons := make([]*dynamodb.CancellationReason, idx+1)
+		for n := range reasons {
+			reasons[n] = &dynamodb.CancellationReason{Code: aws.String("None")}
+		}
+		reasons[idx] = &dynamodb.CancellationReason{
+			Code: aws.String(dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed),
+			Item: row,
+		}
+		return &dynamodb.TransactionCanceledException{CancellationReasons: reasons}
+	}
+
+	//The counters are at 0, then the check, the update and the delete of 11aa
+	//and the check, the put and the delete of 22bb
+	tests := []struct {
+		desc string
+		err  error
+		exp  error
+	}{
+		{ErrItemDoesNotExist.Error(), canceled(4, nil), ErrItemDoesNotExist},
+		{LimitItemQuantity, canceled(1, map[string]*dynamodb.AttributeValue{
+			"max_quantity": {N: aws.String("1")}}),
+			&LimitError{Limit: LimitItemQuantity, Max: 1}},
+		{LimitLines, canceled(0, map[string]*dynamodb.AttributeValue{
+			"line_count": {N: aws.String("2")}}),
+			&LimitError{Limit: LimitLines, Max: 2}},
+		{ErrCartAccessDenied.Error(), canceled(0, map[string]*dynamodb.AttributeValue{
+			"owner_id": {S: aws.String("u2")}}), ErrCartAccessDenied},
+		{ErrCouldNotMergeCarts.Error(), errors.New("InternalServerError"),
+			ErrCouldNotMergeCarts},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc := &partitions{
+				MockDynamoDB: test.MockDynamoDB{OutputError: tc.err},
+				rows: map[string][]map[string]*dynamodb.AttributeValue{
+					getCartPK("guest"): {line("11aa", "2", "1"), line("22bb", "5", "2")},
+					getCartPK("user"):  {line("11aa", "2", "1")},
+				},
+			}
+			handler, _ := New(svc, StoreTable,
+				WithLimits(Limits{LineQuantity: 5, Lines: 2, Units: 10}))
+
+			_, err := handler.Merge(context.Background(), "guest", "user")
+			if !reflect.DeepEqual(err, tc.exp) {
+				t.Errorf("Expected: %v. Received: %v", tc.exp, err)
+			}
+		})
+	}
+}
+
+//TestMergeActiveCart tests that the user cart becomes the active cart when
+//the active cart is merged into it
+func TestMergeActiveCart(t *testing.T) {
+
+	user := auth.NewContext(context.Background(), &auth.Claims{Subject: "u1"})
+
+	tests := []struct {
+		desc   string
+		owner  string
+		active string
+		err    error
+	}{
+		{"Moved", "u1", "user", nil},
+		{ErrMergeActiveCartIntoAnonymousCart.Error(), "", "guest",
+			ErrMergeActiveCartIntoAnonymousCart},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			userCart := map[string]*dynamodb.AttributeValue{
+				"type": {S: aws.String(DynamoDBRowTypeCart)},
+			}
+			if tc.owner != "" {
+				userCart["owner_id"] = &dynamodb.AttributeValue{S: aws.String(tc.owner)}
+			}
+			svc := &partitions{
+				rows: map[string][]map[string]*dynamodb.AttributeValue{
+					getUserPK("u1"):    {{"cart_id": {S: aws.String("guest")}}},
+					getCartPK("guest"): {line("11aa", "2", "1")},
+					getCartPK("user"):  {userCart, line("22bb", "5", "2")},
+				},
+			}
+			handler, _ := New(svc, StoreTable)
+
+			if _, err := handler.Merge(user, "guest", "user"); !reflect.DeepEqual(err, tc.err) {
+				t.Errorf("Expected: %v. Received: %v", tc.err, err)
+			}
+
+			c, err := handler.ActiveCart(user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.CartID != tc.active {
+				t.Errorf("Expected active cart: %s. Received: %s", tc.active, c.CartID)
+			}
+		})
+	}
+}
+
+//TestActiveCart tests that the active cart is loaded from the pointer row of
+//the user or created if there is none
+func TestActiveCart(t *testing.T) {
+
+	user := auth.NewContext(context.Background(), &auth.Claims{Subject: "u1"})
+
+	tests := []struct {
+		desc   string
+		ctx    context.Context
+		output *dynamodb.GetItemOutput
+		cartID string
+		err    error
+	}{
+		{
+			desc: ErrUserIsAnonymous.Error(),
+			ctx:  context.Background(),
+			err:  ErrUserIsAnonymous,
+		},
+		{
+			desc: "Existing",
+			ctx:  user,
+			output: &dynamodb.GetItemOutput{
+				Item: map[string]*dynamodb.AttributeValue{
+					"cart_id": {S: aws.String("cart1")},
+				},
+			},
+			cartID: "cart1",
+		},
+		{
+			desc: "Created",
+			ctx:  user,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			handler, _ := New(&test.MockDynamoDB{GetItemOutput: tc.output}, StoreTable)
+
+			c, err := handler.ActiveCart(tc.ctx)
+			if !reflect.DeepEqual(err, tc.err) {
+				t.Errorf("Expected: %v. Received: %v", tc.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if c.CartID == "" || (tc.cartID != "" && c.CartID != tc.cartID) {
+				t.Errorf("Expected cart: %s. Received: %s", tc.cartID, c.CartID)
+			}
+		})
+	}
+}
+
+//TestShare tests the share tokens of a cart
+func TestShare(t *testing.T) {
+
+	svc := &test.MockDynamoDB{
+		QueryOutput: &dynamodb.QueryOutput{
+			Count: aws.Int64(1),
+			Items: []map[string]*dynamodb.AttributeValue{
+				{
+					"type":        {S: aws.String(DynamoDBRowTypeCartItem)},
+					"item_id":     {S: aws.String("11aa")},
+					"description": {S: aws.String("Some item description")},
+					"price":       {N: aws.String("2")},
+					"quantity":    {N: aws.String("3")},
+				},
+			},
+		},
+	}
+
+	handler, _ := New(svc, StoreTable, WithShareSecret("s3cr3t", time.Hour))
+	expired, _ := New(svc, StoreTable, WithShareSecret("s3cr3t", -time.Hour))
+	other, _ := New(svc, StoreTable, WithShareSecret("other", time.Hour))
+	unconfigured, _ := New(svc, StoreTable)
+
+	if _, err := unconfigured.Share(context.Background(), "cart1"); err != ErrSharingIsNotConfigured {
+		t.Errorf("Expected: %v. Received: %v", ErrSharingIsNotConfigured, err)
+	}
+
+	shared, err := handler.Share(context.Background(), "cart1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredShare, err := expired.Share(context.Background(), "cart1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc    string
+		handler *Handler
+		token   string
+		err     error
+	}{
+		{"Success", handler, shared.Token, nil},
+		{ErrShareTokenIsExpired.Error(), expired, expiredShare.Token, ErrShareTokenIsExpired},
+		{ErrShareTokenIsInvalid.Error(), other, shared.Token, ErrShareTokenIsInvalid},
+		{"Malformed", handler, "abc", ErrShareTokenIsInvalid},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			c, err := tc.handler.LoadShared(context.Background(), tc.token)
+			if !reflect.DeepEqual(err, tc.err) {
+				t.Errorf("Expected: %v. Received: %v", tc.err, err)
+			}
+			if err == nil && (c.CartID != "cart1" || len(c.Items) != 1) {
+				t.Errorf("Expected cart1 with 1 item. Received: %v", c)
+			}
+		})
+	}
+}
+
+//TestCloneShared tests that the clone copies the lines at the current prices
+//of the catalog, without the removed items, and does not claim the active
+//cart of the caller
+func TestCloneShared(t *testing.T) {
+
+	user := auth.NewContext(context.Background(), &auth.Claims{Subject: "u1"})
+
+	catalog := map[string][]map[string]*dynamodb.AttributeValue{
+		getItemPK("11aa"): {catalogItem("11aa", "2.5")},
+		getItemPK("22bb"): {catalogItem("22bb", "5")},
+	}
+
+	tests := []struct {
+		desc   string
+		ctx    context.Context
+		lines  []map[string]*dynamodb.AttributeValue
+		active *dynamodb.GetItemOutput
+		owner  string
+		prices map[string]string
+		err    error
+	}{
+		{
+			desc: "Anonymous",
+			ctx:  context.Background(),
+			lines: []map[string]*dynamodb.AttributeValue{
+				line("11aa", "2.500000", "1"), line("22bb", "5.000000", "2")},
+			prices: map[string]string{"11aa": "2.500000", "22bb": "5.000000"},
+		},
+		{
+			desc: "WithActiveCart",
+			ctx:  user,
+			lines: []map[string]*dynamodb.AttributeValue{
+				line("11aa", "2.500000", "1"), line("22bb", "5.000000", "2")},
+			active: &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+				"cart_id": {S: aws.String("active1")}}},
+			owner:  "u1",
+			prices: map[string]string{"11aa": "2.500000", "22bb": "5.000000"},
+		},
+		{
+			desc: "Repriced",
+			ctx:  user,
+			lines: []map[string]*dynamodb.AttributeValue{
+				line("11aa", "2.000000", "1"), line("22bb", "5.000000", "2")},
+			owner:  "u1",
+			prices: map[string]string{"11aa": "2.500000", "22bb": "5.000000"},
+		},
+		{
+			desc: "RemovedItem",
+			ctx:  context.Background(),
+			lines: []map[string]*dynamodb.AttributeValue{
+				line("11aa", "2.500000", "1"), line("33cc", "1.000000", "1")},
+			prices: map[string]string{"11aa": "2.500000"},
+		},
+		{
+			desc:  ErrCartIsEmpty.Error(),
+			ctx:   context.Background(),
+			lines: []map[string]*dynamodb.AttributeValue{line("33cc", "1.000000", "1")},
+			err:   ErrCartIsEmpty,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+
+			rows := map[string][]map[string]*dynamodb.AttributeValue{
+				getCartPK("cart1"): tc.lines,
+			}
+			for pk, r := range catalog {
+				rows[pk] = r
+			}
+			svc := &partitions{
+				MockDynamoDB: test.MockDynamoDB{GetItemOutput: tc.active},
+				rows:         rows,
+			}
+			handler, _ := New(svc, StoreTable, WithShareSecret("s3cr3t", time.Hour))
+
+			shared, err := handler.Share(context.Background(), "cart1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = handler.CloneShared(tc.ctx, shared.Token)
+			if err != tc.err {
+				t.Fatalf("Expected: %v. Received: %v", tc.err, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(svc.transactions) != 1 {
+				t.Fatalf("Expected one transaction. Received: %v", svc.transactions)
+			}
+			prices := map[string]string{}
+			for _, action := range svc.transactions[0] {
+				if action.Put == nil {
+					continue
+				}
+				row := action.Put.Item
+				switch aws.StringValue(row["type"].S) {
+				case DynamoDBRowTypeCart:
+					var owner string
+					if row["owner_id"] != nil {
+						owner = aws.StringValue(row["owner_id"].S)
+					}
+					if owner != tc.owner {
+						t.Errorf("Expected owner %q. Received: %q", tc.owner, owner)
+					}
+				case DynamoDBRowTypeCartItem:
+					prices[aws.StringValue(row["item_id"].S)] =
+						aws.StringValue(row["price"].N)
+				default:
+					t.Errorf("Unexpected row: %v", row)
+				}
+			}
+			if !reflect.DeepEqual(prices, tc.prices) {
+				t.Errorf("Expected prices: %v. Received: %v", tc.prices, prices)
+			}
+		})
+	}
+}
+
+//TestLimits tests the limits of the lines and the cart that are checked
+//before writing to the database
+func TestLimits(t *testing.T) {
+
+	svc := &test.MockDynamoDB{
+		QueryOutput: &dynamodb.QueryOutput{
+			Count: aws.Int64(1),
+			Items: []map[string]*dynamodb.AttributeValue{
+				{
+					"type":        {S: aws.String(DynamoDBRowTypeCartItem)},
+					"item_id":     {S: aws.String("11aa")},
+					"description": {S: aws.String("Some item description")},
+					"price":       {N: aws.String("2")},
+					"quantity":    {N: aws.String("3")},
+				},
+			},
+		},
+	}
+
+	handler, _ := New(svc, StoreTable,
+		WithLimits(Limits{LineQuantity: 5, Lines: 2, Units: 8}))
+
+	lineQuantity := &LimitError{Limit: LimitLineQuantity, Max: 5}
+
+	tests := []struct {
+		desc string
+		run  func() error
+		err  error
+	}{
+		{"AddItemAboveLineQuantity", func() error {
+			_, err := handler.AddItem(context.Background(), &NewItemInfo{
+				CartID: "cart1", ItemID: "11aa", Description: "Some item description",
+				Price: 2, Quantity: 3})
+			return err
+		}, lineQuantity},
+		{"AddItem", func() error {
+			_, err := handler.AddItem(context.Background(), &NewItemInfo{
+				CartID: "cart1", ItemID: "11aa", Description: "Some item description",
+				Price: 2, Quantity: 2})
+			return err
+		}, nil},
+		{"UpdateItemAboveLineQuantity", func() error {
+			_, err := handler.UpdateItem(context.Background(), &UpdateItemInfo{
+				CartID: "cart1", ItemID: "11aa", Quantity: 6})
+			return err
+		}, lineQuantity},
+		{"UpdateItem", func() error {
+			_, err := handler.UpdateItem(context.Background(), &UpdateItemInfo{
+				CartID: "cart1", ItemID: "11aa", Quantity: 5})
+			return err
+		}, nil},
+		{"CreateAboveLines", func() error {
+			return handler.create(context.Background(), "cart2", []*NewItemInfo{
+				{ItemID: "11aa", Quantity: 1},
+				{ItemID: "22bb", Quantity: 1},
+				{ItemID: "33cc", Quantity: 1},
+			}, true)
+		}, &LimitError{Limit: LimitLines, Max: 2}},
+		{"CreateAboveUnits", func() error {
+			return handler.create(context.Background(), "cart2", []*NewItemInfo{
+				{ItemID: "11aa", Quantity: 5},
+				{ItemID: "22bb", Quantity: 4},
+			}, true)
+		}, &LimitError{Limit: LimitUnits, Max: 8}},
+		{"MergeClampsLineQuantity", func() error {
+			return handler.checkMerge(
+				&Cart{CartID: "guest", Items: []Item{{ItemID: "11aa", Quantity: 5}}},
+				&Cart{CartID: "user", Items: []Item{{ItemID: "11aa", Quantity: 4},
+					{ItemID: "22bb", Quantity: 3}}})
+		}, nil},
+		{"MergeAboveLines", func() error {
+			return handler.checkMerge(
+				&Cart{CartID: "guest", Items: []Item{{ItemID: "33cc", Quantity: 1}}},
+				&Cart{CartID: "user", Items: []Item{{ItemID: "11aa", Quantity: 4},
+					{ItemID: "22bb", Quantity: 3}}})
+		}, &LimitError{Limit: LimitLines, Max: 2}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := tc.run()
+			if !reflect.DeepEqual(err, tc.err) {
+				t.Errorf("Expected: %v. Received: %v", tc.err, err)
+			}
+			if err != nil && !errors.Is(err, ErrQuantityLimitExceeded) {
+				t.Errorf("Expected %v to be %v", err, ErrQuantityLimitExceeded)
+			}
+		})
+	}
+}
+
+//TestLimitErrors tests the errors returned for the conditions of the catalog
+//check and the update of the counters that fail
+func TestLimitErrors(t *testing.T) {
+
+	handler, _ := New(&test.MockDynamoDB{}, StoreTable,
+		WithLimits(Limits{LineQuantity: 5, Lines: 2, Units: 8}))
+	user := auth.NewContext(context.Background(), &auth.Claims{Subject: "u1"})
+
+	//canceled returns the error of a transaction whose first action failed
+	//its condition and returned the row
+	canceled := func(row map[string]*dynamodb.AttributeValue) error {
+		return &dynamodb.TransactionCanceledException{
+			CancellationReasons: []*dynamodb.CancellationReason{
+				{
+					Code: aws.String(dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed),
+					Item: row,
+				},
+				{Code: aws.String("None")},
+			},
+		}
+	}
+	cartRow := func(owner, lines string) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{
+			"pk":         {S: aws.String("CART#cart1")},
+			"owner_id":   {S: aws.String(owner)},
+			"line_count": {N: aws.String(lines)},
+		}
+	}
+
+	tests := []struct {
+		desc     string
+		catalog  bool
+		err      error
+		idx      int
+		expected error
+	}{
+		{"ItemDoesNotExist", true, canceled(nil), 0, ErrItemDoesNotExist},
+		{"ItemQuantity", true, canceled(map[string]*dynamodb.AttributeValue{
+			"max_quantity": {N: aws.String("3")}}), 0,
+			&LimitError{Limit: LimitItemQuantity, Max: 3}},
+		{"OutOfStock", true, canceled(map[string]*dynamodb.AttributeValue{
+			"stock": {N: aws.String("0")}}), 0, ErrItemIsOutOfStock},
+		{"StockBelowItemQuantity", true, canceled(map[string]*dynamodb.AttributeValue{
+			"max_quantity": {N: aws.String("3")}, "stock": {N: aws.String("2")}}), 0,
+			ErrItemIsOutOfStock},
+		{"ItemQuantityBelowStock", true, canceled(map[string]*dynamodb.AttributeValue{
+			"max_quantity": {N: aws.String("3")}, "stock": {N: aws.String("9")}}), 0,
+			&LimitError{Limit: LimitItemQuantity, Max: 3}},
+		{"CatalogCheckSucceeded", true, canceled(nil), 1, nil},
+		{"CartNotFound", false, canceled(nil), 0, ErrCartNotFound},
+		{"CartAccessDenied", false, canceled(cartRow("u2", "0")), 0, ErrCartAccessDenied},
+		{"Lines", false, canceled(cartRow("u1", "2")), 0, &LimitError{Limit: LimitLines, Max: 2}},
+		{"Units", false, canceled(cartRow("u1", "1")), 0, &LimitError{Limit: LimitUnits, Max: 8}},
+		{"OtherError", false, errors.New("InternalServerError"), 0, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			var err error
+			if tc.catalog {
+				err = handler.CatalogError(tc.err, tc.idx)
+			} else {
+				err = handler.CountersError(user, tc.err, tc.idx, 1)
+			}
+			if !reflect.DeepEqual(err, tc.expected) {
+				t.Errorf("Expected: %v. Received: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+//TestReprice tests that the lines are compared with the price of the catalog
+//effective now, including the scheduled prices, and that the cart is
+//repriced with it
+func TestReprice(t *testing.T) {
+
+	yesterday := time.Now().Add(-24 * time.Hour).UTC()
+
+	svc := &partitions{
+		rows: map[string][]map[string]*dynamodb.AttributeValue{
+			getCartPK("cart1"): {
+				line("11aa", "2.500000", "1"),
+				line("22bb", "10.990000", "1"),
+				variantLine("22bb", "CHG-USBC", "12.5", "1"),
+				line("33cc", "1.000000", "1"),
+			},
+			//The base price of 11aa is 2.5, the price effective since yesterday
+			//is 3
+			getItemPK("11aa"): {
+				catalogItem("11aa", "2.5",
+					item.Price{Price: 3, EffectiveFrom: yesterday}),
+			},
+			getItemPK("22bb"): {
+				catalogItem("22bb", "10.99"),
+				catalogVariant("22bb", "CHG-USBC", "12.5"),
+			},
+		},
+	}
+	handler, _ := New(svc, StoreTable)
+
+	c, err := handler.Load(context.Background(), "cart1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Stale {
+		t.Errorf("Expected a stale cart")
+	}
+
+	//The prices of every line are read with a single BatchGetItem
+	if len(svc.batches) != 1 {
+		t.Errorf("Expected 1 batch. Received: %d", len(svc.batches))
+	}
+
+	expected := []struct {
+		current float32
+		changed bool
+		removed bool
+	}{
+		{3, true, false},
+		{10.99, false, false},
+		{12.5, false, false},
+		{0, false, true},
+	}
+	for n, e := range expected {
+		i := c.Items[n]
+		if i.CurrentPrice != e.current || i.PriceChanged != e.changed ||
+			i.Removed != e.removed {
+			t.Errorf("Item %s. Expected: %v. Received: %v/%v/%v", i.ItemID, e,
+				i.CurrentPrice, i.PriceChanged, i.Removed)
+		}
+	}
+
+	if _, err := handler.Reprice(context.Background(), "cart1"); err != nil {
+		t.Errorf("Expected: <nil>. Received: %v", err)
+	}
+
+	//The counters, the price of 11aa and the delete of 33cc
+	if len(svc.transactions) != 1 || len(svc.transactions[0]) != 3 {
+		t.Fatalf("Expected one transaction with 3 actions. Received: %v",
+			svc.transactions)
+	}
+	update := svc.transactions[0][1].Update
+	if price := aws.StringValue(update.ExpressionAttributeValues[":p"].N); price != "3" {
+		t.Errorf("Expected the effective price 3. Received: %s", price)
+	}
+}
+
+//TestAbandoned tests the query of the abandoned carts of every shard and
+//their marking
+func TestAbandoned(t *testing.T) {
+
+	modified := map[string]string{
+		"cart1": time.Date(2021, 3, 1, 10, 30, 0, 5, time.UTC).Format(timestampLayout),
+		//Stored before the timestamps had nanoseconds
+		"cart2": "2021-03-01T09:00:00Z",
+		"cart3": time.Date(2021, 3, 1, 11, 0, 0, 0, time.UTC).Format(timestampLayout),
+	}
+	svc := &partitions{rows: map[string][]map[string]*dynamodb.AttributeValue{}}
+	for cartID, lastModified := range modified {
+		pk := getActivityPK(cartID)
+		svc.rows[pk] = append(svc.rows[pk], map[string]*dynamodb.AttributeValue{
+			"cart_id": {S: aws.String(cartID)},
+			"gsi2sk":  {S: aws.String(lastModified)},
+		})
+		svc.rows[getCartPK(cartID)] = []map[string]*dynamodb.AttributeValue{{
+			"type":     {S: aws.String(DynamoDBRowTypeCart)},
+			"cart_id":  {S: aws.String(cartID)},
+			"owner_id": {S: aws.String("u1")},
+		}}
+	}
+	handler, _ := New(svc, StoreTable)
+
+	if _, err := handler.Abandoned(context.Background(), 0, 10); err != ErrIdleTimeIsInvalid {
+		t.Errorf("Expected: %v. Received: %v", ErrIdleTimeIsInvalid, err)
+	}
+	if _, err := handler.Abandoned(context.Background(), 24*time.Hour, 0); err != ErrLimitIsInvalid {
+		t.Errorf("Expected: %v. Received: %v", ErrLimitIsInvalid, err)
+	}
+
+	carts, err := handler.Abandoned(context.Background(), 24*time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(carts) != 2 || carts[0].CartID != "cart2" || carts[1].CartID != "cart1" ||
+		carts[0].OwnerID != "u1" || carts[1].LastModified.Nanosecond() != 5 {
+		t.Fatalf("Unexpected abandoned carts: %+v", carts)
+	}
+
+	conditionFailed := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "", nil)
+
+	tests := []struct {
+		desc     string
+		op       func(context.Context, *AbandonedCart) error
+		err      error
+		expected error
+	}{
+		{"Marked", handler.MarkAbandoned, nil, nil},
+		{ErrCartWasModified.Error(), handler.MarkAbandoned, conditionFailed,
+			ErrCartWasModified},
+		{ErrCouldNotMarkAbandonedCart.Error(), handler.MarkAbandoned,
+			errors.New("InternalServerError"), ErrCouldNotMarkAbandonedCart},
+		{"Unmarked", handler.UnmarkAbandoned, nil, nil},
+		//The cart is already back in the activity index
+		{"UnmarkModified", handler.UnmarkAbandoned, conditionFailed, nil},
+		{"UnmarkFailed", handler.UnmarkAbandoned, errors.New("InternalServerError"),
+			ErrCouldNotMarkAbandonedCart},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc.OutputError = tc.err
+			if err := tc.op(context.Background(), &carts[0]); err != tc.expected {
+				t.Errorf("Expected: %v. Received: %v", tc.expected, err)
+			}
+		})
+	}
+
+	//The condition compares last_modified as it is stored
+	for _, u := range svc.updates {
+		if lm := aws.StringValue(u.ExpressionAttributeValues[":lm"].S); lm != modified["cart2"] {
+			t.Errorf("Expected: %s. Received: %s", modified["cart2"], lm)
+		}
+	}
+
+	//Unmarking returns the cart to its shard of the activity index
+	unmark := svc.updates[len(svc.updates)-1]
+	if pk := aws.StringValue(unmark.ExpressionAttributeValues[":pk"].S); pk != getActivityPK("cart2") {
+		t.Errorf("Expected: %s. Received: %s", getActivityPK("cart2"), pk)
+	}
+}
+
+//TestMetrics tests that the operations are recorded with their outcome
+func TestMetrics(t *testing.T) {
+
+	tests := []struct {
+		desc     string
+		quantity int
+		err      error
+		expected []string
+	}{
+		{"Success", 1, nil,
+			[]string{"cart.Load Success", "cart.CreateAndAddItem Success"}},
+		{"ItemDoesNotExist", 1, &dynamodb.TransactionCanceledException{
+			CancellationReasons: []*dynamodb.CancellationReason{
+				{Code: aws.String("None")},
+				{Code: aws.String(dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed)},
+			},
+		}, []string{"cart.CreateAndAddItem ItemDoesNotExist"}},
+		{"QuantityIsInvalid", -1, nil,
+			[]string{"cart.CreateAndAddItem QuantityIsInvalid"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+
+			r := &recorder{}
+			handler, _ := New(&test.MockDynamoDB{OutputError: tc.err}, StoreTable,
+				WithMetrics(r))
+
+			handler.CreateAndAddItem(context.Background(), &NewItemInfo{
+				ItemID: "item1", Description: "Item", Price: 10, Quantity: tc.quantity})
+
+			if !reflect.DeepEqual(r.observed, tc.expected) {
+				t.Errorf("Expected: %v. Received: %v", tc.expected, r.observed)
+			}
+		})
+	}
+}
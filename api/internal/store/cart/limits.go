@@ -0,0 +1,263 @@
+package cart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/roloum/store/api/internal/auth"
+)
+
+const (
+	//LimitLineQuantity name of the limit of the quantity of a line
+	LimitLineQuantity = "line_quantity"
+
+	//LimitItemQuantity name of the limit of the quantity of a line set by the
+	//max_quantity attribute of the item, or its variant, in the catalog
+	LimitItemQuantity = "item_quantity"
+
+	//LimitLines name of the limit of distinct lines in a cart
+	LimitLines = "lines"
+
+	//LimitUnits name of the limit of the total quantity of a cart
+	LimitUnits = "units"
+)
+
+var (
+	//ErrQuantityLimitExceeded error returned when a change would leave the
+	//cart above one of its limits. The error is always a *LimitError
+	ErrQuantityLimitExceeded = errors.New("QuantityLimitExceeded")
+
+	//ErrCartNotFound error returned when modifying a cart that does not exist
+	ErrCartNotFound = errors.New("CartNotFound")
+
+	//DefaultLimits limits of the carts of a Handler created without WithLimits
+	DefaultLimits = Limits{LineQuantity: 99, Lines: 50, Units: 500}
+)
+
+//Limits contains the maximum quantities of a cart. A limit of zero disables it
+type Limits struct {
+	//LineQuantity maximum quantity of a line
+	LineQuantity int
+
+	//Lines maximum number of distinct lines
+	Lines int
+
+	//Units maximum total quantity, the sum of the quantity of every line
+	Units int
+}
+
+//LimitError describes which limit of the cart a change exceeds
+type LimitError struct {
+	Limit string
+	Max   int
+}
+
+//Error returns the name of the limit along with its maximum
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s is limited to %d", ErrQuantityLimitExceeded,
+		e.Limit, e.Max)
+}
+
+//Unwrap allows to check the error with errors.Is(err, ErrQuantityLimitExceeded)
+func (e *LimitError) Unwrap() error {
+	return ErrQuantityLimitExceeded
+}
+
+//WithLimits sets the limits of the carts
+func WithLimits(l Limits) Option {
+	return func(h *Handler) {
+		h.limits = l
+	}
+}
+
+//Limits returns the limits of the carts
+func (h *Handler) Limits() Limits {
+	return h.limits
+}
+
+//ClampQuantity returns the quantity reduced to the limit of the lines
+func (h *Handler) ClampQuantity(quantity int) int {
+	if h.limits.LineQuantity > 0 && quantity > h.limits.LineQuantity {
+		return h.limits.LineQuantity
+	}
+	return quantity
+}
+
+//checkLines verifies the lines of a new cart are within the limits
+func (h *Handler) checkLines(lines []*NewItemInfo) error {
+
+	if h.limits.Lines > 0 && len(lines) > h.limits.Lines {
+		return &LimitError{Limit: LimitLines, Max: h.limits.Lines}
+	}
+
+	var units int
+	for _, ni := range lines {
+		if h.limits.LineQuantity > 0 && ni.Quantity > h.limits.LineQuantity {
+			return &LimitError{Limit: LimitLineQuantity, Max: h.limits.LineQuantity}
+		}
+		units += ni.Quantity
+	}
+
+	if h.limits.Units > 0 && units > h.limits.Units {
+		return &LimitError{Limit: LimitUnits, Max: h.limits.Units}
+	}
+
+	return nil
+}
+
+//CatalogCheck returns the condition check that verifies the item, or its
+//variant, exists in the catalog and that quantity does not exceed its
+//max_quantity and stock attributes, if it has them. Only variants have stock
+func (h *Handler) CatalogCheck(itemID, sku string, quantity int) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		ConditionCheck: &dynamodb.ConditionCheck{
+			Key: map[string]*dynamodb.AttributeValue{
+				"pk": {S: aws.String(getItemPK(itemID))},
+				"sk": {S: aws.String(getCatalogSK(itemID, sku))},
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":q": {N: aws.String(strconv.Itoa(quantity))},
+			},
+			ConditionExpression: aws.String(
+				"attribute_exists(pk) and attribute_exists(sk) and (attribute_not_exists(max_quantity) or max_quantity >= :q) and (attribute_not_exists(stock) or stock >= :q)"),
+			ReturnValuesOnConditionCheckFailure: aws.String(
+				dynamodb.ReturnValuesOnConditionCheckFailureAllOld),
+			TableName: aws.String(h.tableName),
+		},
+	}
+}
+
+//CatalogError returns the error of the CatalogCheck at cancellationIdx, or
+//nil if its condition did not fail. The catalog row is only returned when
+//the item exists, so its quantity limit or its stock, whichever is lower,
+//was exceeded
+func (h *Handler) CatalogError(err error, cancellationIdx int) error {
+
+	reason := getConditionalCheckFailure(err, cancellationIdx)
+	if reason == nil {
+		return nil
+	}
+	if len(reason.Item) == 0 {
+		return ErrItemDoesNotExist
+	}
+
+	maxQuantity := getNumber(reason.Item, "max_quantity")
+	if _, ok := reason.Item["stock"]; ok &&
+		(maxQuantity == 0 || getNumber(reason.Item, "stock") < maxQuantity) {
+		return ErrItemIsOutOfStock
+	}
+
+	return &LimitError{Limit: LimitItemQuantity, Max: maxQuantity}
+}
+
+//CountersUpdate returns the update of the counters of the cart row by the
+//lines and units added to the cart, negative when they are removed. The
+//condition verifies the cart exists, the user in the context can modify it
+//and, when lines or units are added, that the cart stays within its limits.
+//Carts without owner can be modified by anyone that knows their ID. Every
+//mutation of a cart goes through this update, so it also sets the time of
+//the last modification and puts the cart back in the activity index
+func (h *Handler) CountersUpdate(ctx context.Context, cartID string, lines,
+	units int) *dynamodb.TransactWriteItem {
+
+	activity := getActivity(cartID)
+	values := map[string]*dynamodb.AttributeValue{
+		":zero": {N: aws.String(strconv.Itoa(0))},
+		":l":    {N: aws.String(strconv.Itoa(lines))},
+		":u":    {N: aws.String(strconv.Itoa(units))},
+		":lm":   activity["last_modified"],
+		":g":    activity["gsi2pk"],
+	}
+
+	condition := "attribute_exists(pk) and (attribute_not_exists(owner_id)"
+	if userID := auth.UserID(ctx); userID != "" {
+		condition += " or owner_id = :o"
+		values[":o"] = &dynamodb.AttributeValue{S: aws.String(userID)}
+	}
+	condition += ")"
+
+	//The counters after the update can not exceed the limits
+	if lines > 0 && h.limits.Lines > 0 {
+		condition += " and (attribute_not_exists(line_count) or line_count <= :lroom)"
+		values[":lroom"] = &dynamodb.AttributeValue{
+			N: aws.String(strconv.Itoa(h.limits.Lines - lines))}
+	}
+	if units > 0 && h.limits.Units > 0 {
+		condition += " and (attribute_not_exists(unit_count) or unit_count <= :uroom)"
+		values[":uroom"] = &dynamodb.AttributeValue{
+			N: aws.String(strconv.Itoa(h.limits.Units - units))}
+	}
+
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			Key: map[string]*dynamodb.AttributeValue{
+				"pk": {S: aws.String(getCartPK(cartID))},
+				"sk": {S: aws.String(getCartPK(cartID))},
+			},
+			ExpressionAttributeValues: values,
+			UpdateExpression: aws.String(
+				"SET line_count = if_not_exists(line_count, :zero) + :l, unit_count = if_not_exists(unit_count, :zero) + :u, last_modified = :lm, gsi2pk = :g, gsi2sk = :lm REMOVE abandoned_at"),
+			ConditionExpression: aws.String(condition),
+			ReturnValuesOnConditionCheckFailure: aws.String(
+				dynamodb.ReturnValuesOnConditionCheckFailureAllOld),
+			TableName: aws.String(h.tableName),
+		},
+	}
+}
+
+//CountersError returns the error of the CountersUpdate at cancellationIdx,
+//or nil if its condition did not fail. The cart row returned by the failed
+//condition tells which part of the condition failed
+func (h *Handler) CountersError(ctx context.Context, err error,
+	cancellationIdx int, lines int) error {
+
+	reason := getConditionalCheckFailure(err, cancellationIdx)
+	if reason == nil {
+		return nil
+	}
+
+	row := reason.Item
+	if len(row) == 0 {
+		return ErrCartNotFound
+	}
+	if owner, ok := row["owner_id"]; ok && aws.StringValue(owner.S) != auth.UserID(ctx) {
+		return ErrCartAccessDenied
+	}
+	if lines > 0 && h.limits.Lines > 0 &&
+		getNumber(row, "line_count")+lines > h.limits.Lines {
+		return &LimitError{Limit: LimitLines, Max: h.limits.Lines}
+	}
+
+	return &LimitError{Limit: LimitUnits, Max: h.limits.Units}
+}
+
+//getConditionalCheckFailure returns the cancellation reason of the action at
+//cancellationIdx if the transaction was cancelled because its condition failed
+func getConditionalCheckFailure(err error, cancellationIdx int) *dynamodb.CancellationReason {
+
+	t, ok := err.(*dynamodb.TransactionCanceledException)
+	if !ok || cancellationIdx >= len(t.CancellationReasons) {
+		return nil
+	}
+
+	reason := t.CancellationReasons[cancellationIdx]
+	if aws.StringValue(reason.Code) != dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed {
+		return nil
+	}
+
+	return reason
+}
+
+//getNumber returns the value of a number attribute of the row, or zero if
+//the row does not have it
+func getNumber(row map[string]*dynamodb.AttributeValue, name string) int {
+	if v, ok := row[name]; ok && v.N != nil {
+		n, _ := strconv.Atoi(*v.N)
+		return n
+	}
+	return 0
+}
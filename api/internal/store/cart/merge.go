@@ -0,0 +1,310 @@
+package cart
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/roloum/store/api/internal/auth"
+	"github.com/roloum/store/api/internal/logging"
+)
+
+const (
+	//transactionItemLimit maximum number of actions of a DynamoDB transaction
+	transactionItemLimit = 100
+)
+
+var (
+	//ErrMergeCartIntoItself error returned when the guest and the user cart
+	//are the same
+	ErrMergeCartIntoItself = errors.New("MergeCartIntoItself")
+
+	//ErrMergeActiveCartIntoAnonymousCart error returned when the guest cart
+	//is the active cart of the user and the user cart does not belong to the
+	//user, so it cannot become the active cart
+	ErrMergeActiveCartIntoAnonymousCart = errors.New("MergeActiveCartIntoAnonymousCart")
+
+	//ErrCouldNotMergeCarts error returned if we failed to merge the carts
+	ErrCouldNotMergeCarts = errors.New("CouldNotMergeCarts")
+)
+
+//Merge moves the lines of the guest cart into the user cart and deletes the
+//guest cart. The quantities of the lines that are in both carts are added, up
+//to the quantity limit of the lines. The merged cart must be within the
+//limits of lines and units.
+//Every line is moved in the same transaction that deletes it from the guest
+//cart. When the carts have more lines than fit in a transaction, the merge is
+//split in several transactions, so a merge that fails can be retried and only
+//moves the lines that are still in the guest cart.
+//If the guest cart is the active cart of the user, the user cart becomes the
+//active cart in the transaction that deletes the guest cart
+func (h *Handler) Merge(ctx context.Context, guestCartID, userCartID string) (
+	_ *Cart, err error) {
+
+	ctx, end := h.start(ctx, "cart.Merge")
+	defer func() { end(err) }()
+
+	if guestCartID == "" || userCartID == "" {
+		return nil, errors.New(ErrCartIDIsEmpty)
+	}
+	if guestCartID == userCartID {
+		return nil, ErrMergeCartIntoItself
+	}
+
+	ctx = logging.With(logging.WithCart(ctx, userCartID), "guest_cart_id",
+		guestCartID)
+
+	//loadOwned verifies that the user can access both carts
+	guest, err := h.loadOwned(ctx, guestCartID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := h.loadOwned(ctx, userCartID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.checkMerge(guest, user); err != nil {
+		return nil, err
+	}
+
+	activeUserID, err := h.getMergeActiveUser(ctx, guest, user)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Ctx(ctx).Debug().Int("lines", len(guest.Items)).Msg("Merging carts")
+
+	for _, t := range h.getMergeTransactions(ctx, guest, user, activeUserID) {
+
+		_, err := h.svc.TransactWriteItemsWithContext(ctx,
+			&dynamodb.TransactWriteItemsInput{TransactItems: t.actions})
+		if err != nil {
+
+			for _, c := range t.checks {
+				if cerr := h.CatalogError(err, c.idx); cerr != nil {
+					logging.Ctx(logging.WithItem(ctx, c.itemID)).Error().
+						Err(cerr).Msg("Item rejected the merge")
+					return nil, cerr
+				}
+			}
+
+			//The counters of the user cart check its ownership and the
+			//limits of the lines and units added by the transaction
+			if cerr := h.CountersError(ctx, err, t.countersIdx, t.lines); cerr != nil {
+				logging.Ctx(ctx).Error().Err(cerr).Msg("Cart rejected the merge")
+				return nil, cerr
+			}
+
+			logging.Ctx(ctx).Error().Err(err).Msg("Error merging carts")
+			return nil, ErrCouldNotMergeCarts
+		}
+	}
+
+	logging.Ctx(ctx).Info().Msg("Carts merged")
+
+	return h.Load(ctx, userCartID)
+}
+
+//checkMerge verifies the user cart is within its limits after the merge
+func (h *Handler) checkMerge(guest, user *Cart) error {
+
+	lines, units := len(user.Items), 0
+	for _, i := range user.Items {
+		units += i.Quantity
+	}
+
+	for _, i := range guest.Items {
+		if existing := user.findLine(i.ItemID, i.SKU); existing != nil {
+			units += h.ClampQuantity(existing.Quantity+i.Quantity) - existing.Quantity
+			continue
+		}
+		lines++
+		units += h.ClampQuantity(i.Quantity)
+	}
+
+	if h.limits.Lines > 0 && lines > h.limits.Lines {
+		return &LimitError{Limit: LimitLines, Max: h.limits.Lines}
+	}
+	if h.limits.Units > 0 && units > h.limits.Units {
+		return &LimitError{Limit: LimitUnits, Max: h.limits.Units}
+	}
+
+	return nil
+}
+
+//getMergeActiveUser returns the user whose active cart is the guest cart, or
+//an empty string if the guest cart is not the active cart of the caller
+func (h *Handler) getMergeActiveUser(ctx context.Context, guest, user *Cart) (
+	string, error) {
+
+	userID := auth.UserID(ctx)
+	if userID == "" {
+		return "", nil
+	}
+
+	activeCartID, err := h.getActiveCartID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if activeCartID != guest.CartID {
+		return "", nil
+	}
+
+	if user.OwnerID != userID {
+		return "", ErrMergeActiveCartIntoAnonymousCart
+	}
+
+	return userID, nil
+}
+
+//mergeTransaction is a transaction of a merge, with the index of the update
+//of the counters, the lines it adds to the user cart and its catalog checks
+type mergeTransaction struct {
+	actions     []*dynamodb.TransactWriteItem
+	countersIdx int
+	lines       int
+	checks      []mergeCheck
+}
+
+//mergeCheck is the index of the CatalogCheck of an item in a transaction
+type mergeCheck struct {
+	idx    int
+	itemID string
+}
+
+//getMergeTransactions returns the transactions that move the lines of the
+//guest cart into the user cart. Every transaction starts with the update of
+//the counters of the user cart, which checks its ownership, and the last one
+//deletes the guest cart row. Every merged line is preceded by the condition
+//check of the item with its quantity after the merge. When activeUserID is
+//set, the last transaction also points the active cart of the user to the
+//user cart
+func (h *Handler) getMergeTransactions(ctx context.Context, guest, user *Cart,
+	activeUserID string) (transactions []mergeTransaction) {
+
+	var chunk []*dynamodb.TransactWriteItem
+	var checks []mergeCheck
+	var lines, units int
+
+	//flush closes the chunk with the counters of the lines it moves, so the
+	//actions of the chunk follow the update of the counters
+	flush := func() {
+		transactions = append(transactions, mergeTransaction{
+			actions: append([]*dynamodb.TransactWriteItem{
+				h.CountersUpdate(ctx, user.CartID, lines, units)}, chunk...),
+			countersIdx: 0,
+			lines:       lines,
+			checks:      checks,
+		})
+		chunk, checks, lines, units = nil, nil, 0, 0
+	}
+
+	for _, i := range guest.Items {
+
+		//Every line needs three actions: the check of the item, the write in
+		//the user cart and the delete in the guest cart, plus the update of
+		//the counters
+		if 1+len(chunk)+3 > transactionItemLimit {
+			flush()
+		}
+
+		sk := LineSK(i.ItemID, i.SKU)
+
+		quantity := h.ClampQuantity(i.Quantity)
+		existing := user.findLine(i.ItemID, i.SKU)
+		if existing != nil {
+			quantity = h.ClampQuantity(existing.Quantity + i.Quantity)
+		}
+
+		checks = append(checks, mergeCheck{idx: 1 + len(chunk), itemID: i.ItemID})
+		chunk = append(chunk, h.CatalogCheck(i.ItemID, i.SKU, quantity))
+
+		if existing != nil {
+			chunk = append(chunk, h.getMergeLineUpdate(user.CartID, sk,
+				existing.Quantity, quantity))
+			units += quantity - existing.Quantity
+		} else {
+			chunk = append(chunk, &dynamodb.TransactWriteItem{
+				Put: &dynamodb.Put{
+					Item: getCartItemRow(&NewItemInfo{
+						CartID:      user.CartID,
+						ItemID:      i.ItemID,
+						SKU:         i.SKU,
+						Description: i.Description,
+						Price:       i.Price,
+						Quantity:    quantity,
+					}),
+					TableName:           aws.String(h.tableName),
+					ConditionExpression: aws.String("attribute_not_exists(pk) and attribute_not_exists(sk)"),
+				},
+			})
+			lines++
+			units += quantity
+		}
+
+		chunk = append(chunk, &dynamodb.TransactWriteItem{
+			Delete: &dynamodb.Delete{
+				Key: map[string]*dynamodb.AttributeValue{
+					"pk": {S: aws.String(getCartPK(guest.CartID))},
+					"sk": {S: aws.String(sk)},
+				},
+				ConditionExpression: aws.String("attribute_exists(pk) and attribute_exists(sk)"),
+				TableName:           aws.String(h.tableName),
+			},
+		})
+	}
+
+	last := 1
+	if activeUserID != "" {
+		last++
+	}
+	if 1+len(chunk)+last > transactionItemLimit {
+		flush()
+	}
+
+	chunk = append(chunk, &dynamodb.TransactWriteItem{
+		Delete: &dynamodb.Delete{
+			Key: map[string]*dynamodb.AttributeValue{
+				"pk": {S: aws.String(getCartPK(guest.CartID))},
+				"sk": {S: aws.String(getCartPK(guest.CartID))},
+			},
+			TableName: aws.String(h.tableName),
+		},
+	})
+	if activeUserID != "" {
+		chunk = append(chunk, h.getActiveCartMove(activeUserID, guest.CartID,
+			user.CartID))
+	}
+	flush()
+
+	return transactions
+}
+
+//getMergeLineUpdate returns the update of a line that is in both carts. The
+//condition on the current quantity fails the merge if the line is modified
+//after the carts were loaded
+func (h *Handler) getMergeLineUpdate(cartID, sk string, current,
+	quantity int) *dynamodb.TransactWriteItem {
+
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			Key: map[string]*dynamodb.AttributeValue{
+				"pk": {S: aws.String(getCartPK(cartID))},
+				"sk": {S: aws.String(sk)},
+			},
+			ExpressionAttributeNames: map[string]*string{
+				"#q": aws.String("quantity"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":q":   {N: aws.String(strconv.Itoa(quantity))},
+				":old": {N: aws.String(strconv.Itoa(current))},
+			},
+			UpdateExpression:    aws.String("SET #q = :q"),
+			ConditionExpression: aws.String("#q = :old"),
+			TableName:           aws.String(h.tableName),
+		},
+	}
+}
@@ -1,11 +1,18 @@
 package cart
 
+import "time"
+
 //Cart contains the information about the shopping cart and all its Items
+//OwnerID is set when the cart was created by an authenticated user
+//Stale is set when the price of a line is not the price of the catalog, or
+//its item was removed from the catalog, until the cart is repriced
 type Cart struct {
-	CartID string  `json:"cart_id"`
-	Total  float32 `json:"total"`
-	Count  int     `json:"count"`
-	Items  []Item  `json:"items"`
+	CartID  string  `json:"cart_id"`
+	OwnerID string  `json:"owner_id,omitempty"`
+	Total   float32 `json:"total"`
+	Count   int     `json:"count"`
+	Stale   bool    `json:"stale"`
+	Items   []Item  `json:"items"`
 }
 
 //calculateTotal calculates the total of the shopping cart
@@ -16,20 +23,39 @@ func (c *Cart) calculateTotal() {
 	}
 }
 
+//findLine returns the line of the cart with the item and SKU, if any
+func (c *Cart) findLine(itemID, sku string) *Item {
+	for n := range c.Items {
+		if c.Items[n].ItemID == itemID && c.Items[n].SKU == sku {
+			return &c.Items[n]
+		}
+	}
+	return nil
+}
+
 //Item contains the information of an item stored in the shopping cart
+//Price is the price when the item was added. CurrentPrice is the price of
+//the catalog, flagged by PriceChanged when they differ, and Removed is set
+//when the item is no longer in the catalog
 type Item struct {
-	ItemID      string  `json:"item_id"`
-	Description string  `json:"description"`
-	Price       float32 `json:"price"`
-	Quantity    int     `json:"quantity"`
+	ItemID       string  `json:"item_id"`
+	SKU          string  `json:"sku,omitempty"`
+	Description  string  `json:"description"`
+	Price        float32 `json:"price"`
+	Quantity     int     `json:"quantity"`
+	CurrentPrice float32 `json:"current_price" dynamodbav:"-"`
+	PriceChanged bool    `json:"price_changed" dynamodbav:"-"`
+	Removed      bool    `json:"removed" dynamodbav:"-"`
 }
 
 //NewItemInfo contains the information of the new item is being added to the cart
 //In case cartID is empty, a new shopping cart row is created
 //Along with the item row
+//SKU is optional, it is set when the item has variants
 type NewItemInfo struct {
 	CartID      string  `json:"cart_id" validate:"required"`
 	ItemID      string  `json:"item_id" validate:"required"`
+	SKU         string  `json:"sku,omitempty"`
 	Description string  `json:"description" validate:"required"`
 	Price       float32 `json:"price" validate:"required,validPrice"`
 	Quantity    int     `json:"quantity" validate:"required,validQuantity"`
@@ -39,6 +65,7 @@ type NewItemInfo struct {
 type UpdateItemInfo struct {
 	CartID   string `json:"cart_id" validate:"required"`
 	ItemID   string `json:"item_id" validate:"required"`
+	SKU      string `json:"sku,omitempty"`
 	Quantity int    `json:"quantity" validate:"required,validQuantity"`
 }
 
@@ -46,4 +73,17 @@ type UpdateItemInfo struct {
 type DeleteItemInfo struct {
 	CartID string `json:"cart_id" validate:"required"`
 	ItemID string `json:"item_id" validate:"required"`
+	SKU    string `json:"sku,omitempty"`
+}
+
+//SharedCart contains the token that grants read-only access to a cart
+type SharedCart struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+//shareClaims contains the cart and the expiration signed in a share token
+type shareClaims struct {
+	CartID    string `json:"c"`
+	ExpiresAt int64  `json:"e"`
 }
@@ -0,0 +1,160 @@
+package cart
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/roloum/store/api/internal/store/item"
+)
+
+var (
+	//ErrCouldNotLoadPrices error returned if we failed to load the current
+	//prices of the lines of the cart
+	ErrCouldNotLoadPrices = errors.New("CouldNotLoadPrices")
+
+	//ErrCouldNotRepriceCart error returned if we failed to update the prices
+	ErrCouldNotRepriceCart = errors.New("CouldNotRepriceCart")
+)
+
+//Reprice accepts the current catalog prices: the lines whose price changed
+//are updated to the current price and the lines whose item was removed from
+//the catalog are deleted, in a single transaction. The condition on the
+//price of every line fails the transaction if the line changed after the
+//cart was loaded
+func (h *Handler) Reprice(ctx context.Context, cartID string) (_ *Cart, err error) {
+
+	ctx, end := h.start(ctx, "cart.Reprice")
+	defer func() { end(err) }()
+
+	ctx = logging.WithCart(ctx, cartID)
+
+	c, err := h.Load(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Stale {
+		return c, nil
+	}
+
+	var lines, units int
+	var changes []*dynamodb.TransactWriteItem
+
+	for _, i := range c.Items {
+		switch {
+		case i.Removed:
+			lines--
+			units -= i.Quantity
+			changes = append(changes, h.getRemovedLineDelete(cartID, &i))
+		case i.PriceChanged:
+			changes = append(changes, h.getLinePriceUpdate(cartID, &i))
+		}
+	}
+
+	//The update of the counters and one action per line
+	if 1+len(changes) > transactionItemLimit {
+		return nil, ErrCartIsTooLarge
+	}
+
+	logging.Ctx(ctx).Debug().Int("lines", len(changes)).Msg("Repricing cart")
+
+	_, err = h.svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: append([]*dynamodb.TransactWriteItem{
+			h.CountersUpdate(ctx, cartID, lines, units)}, changes...),
+	})
+	if err != nil {
+		if cerr := h.CountersError(ctx, err, 0, 0); cerr != nil {
+			logging.Ctx(ctx).Error().Err(cerr).Msg("Cart rejected the prices")
+			return nil, cerr
+		}
+
+		logging.Ctx(ctx).Error().Err(err).Msg("Error repricing cart")
+		return nil, ErrCouldNotRepriceCart
+	}
+
+	logging.Ctx(ctx).Info().Msg("Cart repriced")
+
+	return h.Load(ctx, cartID)
+}
+
+//applyCatalog compares every line with the current price of its item, or of
+//the variant of the SKU, in the catalog. The catalog resolves the prices
+//effective now of every line at once, with the scheduled prices and the
+//sales of the items. Lines whose price is not the current price are flagged
+//with it, and lines whose item or variant is not in the catalog are flagged
+//as removed
+func (h *Handler) applyCatalog(ctx context.Context, c *Cart) error {
+
+	if len(c.Items) == 0 {
+		return nil
+	}
+
+	keys := make([]item.PriceKey, 0, len(c.Items))
+	for _, i := range c.Items {
+		keys = append(keys, item.PriceKey{ItemID: i.ItemID, SKU: i.SKU})
+	}
+
+	prices, err := h.catalog.CurrentPrices(ctx, keys)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error loading catalog prices")
+		return ErrCouldNotLoadPrices
+	}
+
+	c.Stale = false
+	for n := range c.Items {
+		i := &c.Items[n]
+
+		price, ok := prices[item.PriceKey{ItemID: i.ItemID, SKU: i.SKU}]
+		i.CurrentPrice, i.Removed = price, !ok
+		i.PriceChanged = !i.Removed && price != i.Price
+
+		if i.Removed || i.PriceChanged {
+			c.Stale = true
+		}
+	}
+
+	return nil
+}
+
+//getLinePriceUpdate returns the update of the price of a line to the current
+//price of the catalog
+func (h *Handler) getLinePriceUpdate(cartID string, i *Item) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			Key: LineKey(cartID, i.ItemID, i.SKU),
+			ExpressionAttributeNames: map[string]*string{
+				"#p": aws.String("price"),
+				"#q": aws.String("quantity"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":p":   {N: aws.String(strconv.FormatFloat(float64(i.CurrentPrice), 'f', -1, 32))},
+				":old": {N: aws.String(strconv.FormatFloat(float64(i.Price), 'f', -1, 32))},
+				":q":   {N: aws.String(strconv.Itoa(i.Quantity))},
+			},
+			UpdateExpression:    aws.String("SET #p = :p"),
+			ConditionExpression: aws.String("#p = :old and #q = :q"),
+			TableName:           aws.String(h.tableName),
+		},
+	}
+}
+
+//getRemovedLineDelete returns the delete of a line whose item is no longer
+//in the catalog
+func (h *Handler) getRemovedLineDelete(cartID string, i *Item) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Delete: &dynamodb.Delete{
+			Key: LineKey(cartID, i.ItemID, i.SKU),
+			ExpressionAttributeNames: map[string]*string{
+				"#q": aws.String("quantity"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":q": {N: aws.String(strconv.Itoa(i.Quantity))},
+			},
+			ConditionExpression: aws.String("#q = :q"),
+			TableName:           aws.String(h.tableName),
+		},
+	}
+}
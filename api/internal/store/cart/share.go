@@ -0,0 +1,217 @@
+package cart
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roloum/store/api/internal/logging"
+)
+
+var (
+	//ErrSharingIsNotConfigured error returned when there is no secret to sign
+	//the share tokens
+	ErrSharingIsNotConfigured = errors.New("SharingIsNotConfigured")
+
+	//ErrShareTokenIsInvalid error returned when the share token is malformed or
+	//its signature does not match
+	ErrShareTokenIsInvalid = errors.New("ShareTokenIsInvalid")
+
+	//ErrShareTokenIsExpired error returned when the share token has expired
+	ErrShareTokenIsExpired = errors.New("ShareTokenIsExpired")
+
+	//ErrCartIsEmpty error returned when sharing or cloning a cart without items
+	ErrCartIsEmpty = errors.New("CartIsEmpty")
+
+	//ErrCartIsTooLarge error returned when the lines of a shared cart do not
+	//fit in the transaction that creates the clone
+	ErrCartIsTooLarge = errors.New("CartIsTooLarge")
+)
+
+//WithShareSecret sets the secret used to sign the share tokens and how long
+//the tokens are valid
+func WithShareSecret(secret string, ttl time.Duration) Option {
+	return func(h *Handler) {
+		if secret != "" {
+			h.shareSecret = []byte(secret)
+		}
+		h.shareTTL = ttl
+	}
+}
+
+//Share issues a token that grants read-only access to the cart until it
+//expires. The token is signed, so it does not need to be stored
+func (h *Handler) Share(ctx context.Context, cartID string) (_ *SharedCart,
+	err error) {
+
+	ctx, end := h.start(ctx, "cart.Share")
+	defer func() { end(err) }()
+
+	if len(h.shareSecret) == 0 {
+		return nil, ErrSharingIsNotConfigured
+	}
+
+	ctx = logging.WithCart(ctx, cartID)
+
+	//loadOwned verifies that the user can access the cart
+	c, err := h.loadOwned(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Items) == 0 {
+		return nil, ErrCartIsEmpty
+	}
+
+	expiresAt := time.Now().Add(h.shareTTL).UTC().Truncate(time.Second)
+
+	token, err := h.signShareToken(&shareClaims{CartID: cartID,
+		ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Ctx(ctx).Info().Time("expires_at", expiresAt).Msg("Cart shared")
+
+	return &SharedCart{Token: token, ExpiresAt: expiresAt}, nil
+}
+
+//LoadShared returns the cart of a share token, with its lines compared with
+//the catalog. The cart is returned without its owner, since anyone with the
+//token can read it
+func (h *Handler) LoadShared(ctx context.Context, token string) (_ *Cart, err error) {
+
+	ctx, end := h.start(ctx, "cart.LoadShared")
+	defer func() { end(err) }()
+
+	claims, err := h.parseShareToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := h.load(ctx, claims.CartID)
+	if err != nil {
+		return nil, err
+	}
+	c.OwnerID = ""
+
+	if err := h.applyCatalog(ctx, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+//CloneShared copies the lines of a shared cart into a new cart owned by the
+//caller, at the current prices of the catalog. Lines whose item was removed
+//from the catalog are not copied. The cart and all its lines are created in a
+//single transaction. The clone does not become the active cart of the caller,
+//who keeps their active cart and can merge the clone into it
+func (h *Handler) CloneShared(ctx context.Context, token string) (_ *Cart, err error) {
+
+	ctx, end := h.start(ctx, "cart.CloneShared")
+	defer func() { end(err) }()
+
+	shared, err := h.LoadShared(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	cartID := uuid.New().String()
+
+	lines := make([]*NewItemInfo, 0, len(shared.Items))
+	for _, i := range shared.Items {
+		if i.Removed {
+			continue
+		}
+		lines = append(lines, &NewItemInfo{
+			CartID:      cartID,
+			ItemID:      i.ItemID,
+			SKU:         i.SKU,
+			Description: i.Description,
+			Price:       i.CurrentPrice,
+			Quantity:    i.Quantity,
+		})
+	}
+	if len(lines) == 0 {
+		return nil, ErrCartIsEmpty
+	}
+
+	//The cart row and two actions per line
+	if 1+2*len(lines) > transactionItemLimit {
+		return nil, ErrCartIsTooLarge
+	}
+
+	ctx = logging.With(logging.WithCart(ctx, cartID), "shared_cart_id",
+		shared.CartID)
+	logging.Ctx(ctx).Debug().Int("lines", len(lines)).Msg("Cloning cart")
+
+	if err := h.create(ctx, cartID, lines, false); err != nil {
+		return nil, err
+	}
+
+	logging.Ctx(ctx).Info().Msg("Cart cloned")
+
+	return h.Load(ctx, cartID)
+}
+
+//signShareToken returns the token with the claims and their signature, both
+//base64url encoded and separated by a dot
+func (h *Handler) signShareToken(claims *shareClaims) (string, error) {
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, h.shareSecret)
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+//parseShareToken verifies the signature and the expiration of the token and
+//returns its claims
+func (h *Handler) parseShareToken(token string) (*shareClaims, error) {
+
+	if len(h.shareSecret) == 0 {
+		return nil, ErrSharingIsNotConfigured
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrShareTokenIsInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrShareTokenIsInvalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrShareTokenIsInvalid
+	}
+
+	mac := hmac.New(sha256.New, h.shareSecret)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, ErrShareTokenIsInvalid
+	}
+
+	var claims shareClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.CartID == "" {
+		return nil, ErrShareTokenIsInvalid
+	}
+
+	if time.Now().After(time.Unix(claims.ExpiresAt, 0)) {
+		return nil, ErrShareTokenIsExpired
+	}
+
+	return &claims, nil
+}
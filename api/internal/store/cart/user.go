@@ -0,0 +1,167 @@
+package cart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/google/uuid"
+	"github.com/roloum/store/api/internal/auth"
+	saws "github.com/roloum/store/api/internal/aws"
+	"github.com/roloum/store/api/internal/logging"
+)
+
+const (
+	//DynamoDBRowTypeActiveCart Attribute used to identify the row that points
+	//to the active cart of a user
+	DynamoDBRowTypeActiveCart = "ActiveCart"
+
+	//DynamoDBPrefixUser Prefix for the user key
+	DynamoDBPrefixUser = "USER#"
+)
+
+var (
+	//ErrUserIsAnonymous error returned when the active cart is requested
+	//without an authenticated user
+	ErrUserIsAnonymous = errors.New("UserIsAnonymous")
+
+	//ErrActiveCartAlreadyExists error returned when an authenticated user
+	//attempts to create a second cart
+	ErrActiveCartAlreadyExists = errors.New("ActiveCartAlreadyExists")
+
+	//ErrCouldNotLoadActiveCart error returned if we failed to load or create
+	//the active cart of the user
+	ErrCouldNotLoadActiveCart = errors.New("CouldNotLoadActiveCart")
+)
+
+//ActiveCart returns the active cart of the authenticated user. The USER# row
+//points to the cart, so the user gets the same cart from any device. If the
+//user does not have a cart yet, an empty one is created
+func (h *Handler) ActiveCart(ctx context.Context) (_ *Cart, err error) {
+
+	ctx, end := h.start(ctx, "cart.ActiveCart")
+	defer func() { end(err) }()
+
+	userID := auth.UserID(ctx)
+	if userID == "" {
+		return nil, ErrUserIsAnonymous
+	}
+
+	cartID, err := h.getActiveCartID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if cartID != "" {
+		return h.Load(ctx, cartID)
+	}
+
+	cartID = uuid.New().String()
+	ctx = logging.WithCart(ctx, cartID)
+	logging.Ctx(ctx).Debug().Msg("Creating active cart")
+
+	_, err = h.svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					Item:                getCartRow(ctx, cartID),
+					TableName:           aws.String(h.tableName),
+					ConditionExpression: aws.String("attribute_not_exists(pk) and attribute_not_exists(sk)"),
+				},
+			},
+			h.getActiveCartPut(userID, cartID),
+		},
+	})
+	if err != nil {
+
+		//Another request created the active cart after we read the pointer
+		cancellationIdx := 1
+		if saws.IsErrorOfType(err, dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed, cancellationIdx) {
+			if cartID, err = h.getActiveCartID(ctx, userID); err == nil && cartID != "" {
+				return h.Load(ctx, cartID)
+			}
+		}
+
+		logging.Ctx(ctx).Error().Err(err).Msg("Error creating active cart")
+		return nil, ErrCouldNotLoadActiveCart
+	}
+
+	logging.Ctx(ctx).Info().Msg("Active cart created")
+
+	return h.Load(ctx, cartID)
+}
+
+//getActiveCartID returns the ID of the active cart of the user, or an empty
+//string if the user does not have one
+func (h *Handler) getActiveCartID(ctx context.Context, userID string) (string,
+	error) {
+
+	result, err := h.svc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"pk": {S: aws.String(getUserPK(userID))},
+			"sk": {S: aws.String(getUserPK(userID))},
+		},
+		ProjectionExpression: aws.String("cart_id"),
+		TableName:            aws.String(h.tableName),
+	})
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error loading active cart")
+		return "", ErrCouldNotLoadActiveCart
+	}
+
+	if cartID, ok := result.Item["cart_id"]; ok {
+		return aws.StringValue(cartID.S), nil
+	}
+
+	return "", nil
+}
+
+//getActiveCartPut returns the Put of the row that points to the active cart
+//of the user. It fails if the user already has an active cart
+func (h *Handler) getActiveCartPut(userID, cartID string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			Item: map[string]*dynamodb.AttributeValue{
+				"pk":      {S: aws.String(getUserPK(userID))},
+				"sk":      {S: aws.String(getUserPK(userID))},
+				"type":    {S: aws.String(DynamoDBRowTypeActiveCart)},
+				"user_id": {S: aws.String(userID)},
+				"cart_id": {S: aws.String(cartID)},
+			},
+			TableName:           aws.String(h.tableName),
+			ConditionExpression: aws.String("attribute_not_exists(pk) and attribute_not_exists(sk)"),
+		},
+	}
+}
+
+//getActiveCartMove returns the Update of the row that points to the active
+//cart of the user, from the cart being deleted to the cart that replaces it.
+//It fails if the row no longer points to the deleted cart
+func (h *Handler) getActiveCartMove(userID, fromCartID,
+	toCartID string) *dynamodb.TransactWriteItem {
+
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			Key: map[string]*dynamodb.AttributeValue{
+				"pk": {S: aws.String(getUserPK(userID))},
+				"sk": {S: aws.String(getUserPK(userID))},
+			},
+			ExpressionAttributeNames: map[string]*string{
+				"#c": aws.String("cart_id"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":to":   {S: aws.String(toCartID)},
+				":from": {S: aws.String(fromCartID)},
+			},
+			UpdateExpression:    aws.String("SET #c = :to"),
+			ConditionExpression: aws.String("#c = :from"),
+			TableName:           aws.String(h.tableName),
+		},
+	}
+}
+
+//getUserPK returns the userID formatted for the primary key column
+func getUserPK(userID string) string {
+	return fmt.Sprintf("%s%s", DynamoDBPrefixUser, userID)
+}
@@ -0,0 +1,619 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/roloum/store/api/internal/store/item"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	//DynamoDBPrefixCategory Prefix for the category key
+	DynamoDBPrefixCategory = "CATEGORY#"
+
+	//DynamoDBPrefixItem Prefix for product item key
+	DynamoDBPrefixItem = "ITEM#"
+
+	//DynamoDBRowTypeCategory Attribute used to identify a row of type category
+	DynamoDBRowTypeCategory = "Category"
+
+	//DynamoDBRowTypeItem Attribute used to identify a row of type item
+	DynamoDBRowTypeItem = "Item"
+
+	//DynamoDBPrefixSKU Prefix for the sort key of an item variant
+	DynamoDBPrefixSKU = "SKU#"
+
+	//batchWriteLimit maximum number of requests in a BatchWriteItem call
+	batchWriteLimit = 25
+
+	//maxWriteAttempts maximum number of BatchWriteItem calls for a chunk,
+	//including the retries of the unprocessed items
+	maxWriteAttempts = 8
+
+	//retryBaseDelay delay before the first retry of the unprocessed items.
+	//It doubles with every attempt
+	retryBaseDelay = 100 * time.Millisecond
+)
+
+var (
+	//ErrStoreTableNameIsEmpty Error describes when DynamoDB table name is empty
+	ErrStoreTableNameIsEmpty = "StoreTableNameIsEmpty"
+
+	//ErrCouldNotLoadCatalog error returned if we failed to load the catalog
+	ErrCouldNotLoadCatalog = errors.New("CouldNotLoadCatalog")
+
+	//ErrCouldNotImportCatalog error returned if we failed to write the catalog
+	ErrCouldNotImportCatalog = errors.New("CouldNotImportCatalog")
+
+	//ErrUnprocessedItems error returned if DynamoDB did not process all the
+	//items after all the retries
+	ErrUnprocessedItems = errors.New("UnprocessedItems")
+)
+
+//Handler struct is a handler for importing and exporting the catalog
+type Handler struct {
+	svc       dynamodbiface.DynamoDBAPI
+	tableName string
+}
+
+//catalogRow contains the attributes of the category, item, variant and
+//price rows
+type catalogRow struct {
+	Type          string            `json:"type"`
+	CategoryID    string            `json:"category_id"`
+	Name          string            `json:"name"`
+	ItemID        string            `json:"item_id"`
+	Description   string            `json:"description"`
+	Price         float32           `json:"price"`
+	Attributes    map[string]string `json:"attributes"`
+	Dimensions    []item.Dimension  `json:"dimensions"`
+	Media         []item.Media      `json:"media"`
+	GSI1PK        string            `json:"gsi1pk"`
+	SKU           string            `json:"sku"`
+	Options       map[string]string `json:"options"`
+	Stock         int               `json:"stock"`
+	MaxQuantity   int               `json:"max_quantity"`
+	EffectiveFrom time.Time         `json:"effective_from"`
+	EffectiveTo   *time.Time        `json:"effective_to"`
+}
+
+//New returns a pointer to a Handler
+func New(svc dynamodbiface.DynamoDBAPI, tableName string) (*Handler, error) {
+	if tableName == "" {
+		log.Error().Msg("Table name is empty")
+		return nil, errors.New(ErrStoreTableNameIsEmpty)
+	}
+
+	return &Handler{svc, tableName}, nil
+}
+
+//Load loads every category and item of the catalog, sorted by category and
+//description. The price of the items is their regular price, which includes
+//the prices of the PRICE# history already effective, but not the sales
+func (h *Handler) Load(ctx context.Context) (*Catalog, error) {
+
+	logging.Ctx(ctx).Debug().Msg("Loading catalog")
+
+	input := &dynamodb.ScanInput{
+		ExpressionAttributeNames: map[string]*string{
+			"#t": aws.String("type"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":c": {S: aws.String(DynamoDBRowTypeCategory)},
+			":i": {S: aws.String(DynamoDBRowTypeItem)},
+			":v": {S: aws.String(item.DynamoDBRowTypeVariant)},
+			":p": {S: aws.String(item.DynamoDBRowTypePrice)},
+		},
+		FilterExpression: aws.String("#t IN (:c, :i, :v, :p)"),
+		TableName:        aws.String(h.tableName),
+	}
+
+	var rows []catalogRow
+	for {
+		result, err := h.svc.ScanWithContext(ctx, input)
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("Error scanning catalog")
+			return nil, ErrCouldNotLoadCatalog
+		}
+
+		var page []catalogRow
+		err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("Error Unmarshaling catalog")
+			return nil, ErrCouldNotLoadCatalog
+		}
+		rows = append(rows, page...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	c := &Catalog{Products: []Product{}, Categories: map[string]string{}}
+	variants := map[string][]item.Variant{}
+	prices := map[string][]item.Price{}
+	for _, row := range rows {
+		switch row.Type {
+		case DynamoDBRowTypeCategory:
+			c.Categories[row.CategoryID] = row.Name
+		case item.DynamoDBRowTypeVariant:
+			variants[row.ItemID] = append(variants[row.ItemID], item.Variant{
+				SKU:         row.SKU,
+				Options:     row.Options,
+				Price:       row.Price,
+				Stock:       row.Stock,
+				MaxQuantity: row.MaxQuantity,
+			})
+		case item.DynamoDBRowTypePrice:
+			prices[row.ItemID] = append(prices[row.ItemID], item.Price{
+				Price:         row.Price,
+				EffectiveFrom: row.EffectiveFrom,
+				EffectiveTo:   row.EffectiveTo,
+			})
+		}
+	}
+
+	now := time.Now()
+	for _, row := range rows {
+		if row.Type != DynamoDBRowTypeItem {
+			continue
+		}
+		categoryID := strings.TrimPrefix(row.GSI1PK, DynamoDBPrefixCategory)
+		p := Product{
+			ItemID:       row.ItemID,
+			CategoryID:   categoryID,
+			CategoryName: c.Categories[categoryID],
+			Description:  row.Description,
+			Price:        item.RegularPrice(row.Price, prices[row.ItemID], now),
+			Attributes:   row.Attributes,
+			Dimensions:   row.Dimensions,
+			Media:        row.Media,
+			Variants:     variants[row.ItemID],
+		}
+		sort.Slice(p.Variants, func(a, b int) bool {
+			return p.Variants[a].SKU < p.Variants[b].SKU
+		})
+		c.Products = append(c.Products, p)
+	}
+
+	sort.Slice(c.Products, func(a, b int) bool {
+		if c.Products[a].CategoryID != c.Products[b].CategoryID {
+			return c.Products[a].CategoryID < c.Products[b].CategoryID
+		}
+		return c.Products[a].Description < c.Products[b].Description
+	})
+
+	return c, nil
+}
+
+//Diff returns the changes that importing the products would apply to the
+//catalog
+func (c *Catalog) Diff(products []Product) *Diff {
+
+	d := &Diff{}
+
+	current := map[string]Product{}
+	for _, p := range c.Products {
+		current[p.ItemID] = p
+	}
+
+	categories := map[string]bool{}
+	imported := map[string]bool{}
+	for _, p := range products {
+		imported[p.ItemID] = true
+
+		if name, ok := c.Categories[p.CategoryID]; (!ok || name != p.CategoryName) &&
+			!categories[p.CategoryID] {
+			categories[p.CategoryID] = true
+			d.Categories = append(d.Categories, p.CategoryID)
+		}
+
+		before, ok := current[p.ItemID]
+		if !ok {
+			d.Added = append(d.Added, p)
+			continue
+		}
+
+		if fields := changedFields(before, p); len(fields) > 0 {
+			d.Changed = append(d.Changed, Change{before, p, fields})
+			continue
+		}
+		d.Unchanged++
+	}
+
+	for _, p := range c.Products {
+		if !imported[p.ItemID] {
+			d.Missing = append(d.Missing, p)
+		}
+	}
+
+	return d
+}
+
+//KeepMedia sets the media stored in the database to the products that have
+//no media, so importing a file without media, like a CSV file, does not
+//remove the images of the items
+func (c *Catalog) KeepMedia(products []Product) {
+
+	media := map[string][]item.Media{}
+	for _, p := range c.Products {
+		media[p.ItemID] = p.Media
+	}
+
+	for n := range products {
+		if len(products[n].Media) == 0 {
+			products[n].Media = media[products[n].ItemID]
+		}
+	}
+}
+
+//Import upserts the categories and items of the products. The products must
+//have been validated. current is the catalog loaded before the import: the
+//items are updated with the imported fields only, so the attributes that are
+//not part of the file, like the quantity limits, are kept, and the price of
+//an existing item is changed with a new price effective now in its PRICE#
+//history. The variants of the products are upserted, the variants that are
+//not in the file are kept
+func (h *Handler) Import(ctx context.Context, current *Catalog,
+	products []Product) error {
+
+	var requests []*dynamodb.WriteRequest
+
+	categories := map[string]bool{}
+	for _, p := range products {
+		if categories[p.CategoryID] {
+			continue
+		}
+		categories[p.CategoryID] = true
+		requests = append(requests, &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{Item: getCategoryRow(p)},
+		})
+	}
+
+	logging.Ctx(ctx).Info().Int("categories", len(categories)).
+		Int("items", len(products)).Msg("Importing catalog")
+
+	//BatchWriteItem accepts a limited number of requests per call
+	for start := 0; start < len(requests); start += batchWriteLimit {
+		end := start + batchWriteLimit
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		if err := h.batchWrite(ctx, requests[start:end]); err != nil {
+			return err
+		}
+	}
+
+	prices := map[string]float32{}
+	for _, p := range current.Products {
+		prices[p.ItemID] = p.Price
+	}
+
+	now := time.Now().UTC()
+	for _, p := range products {
+		price, ok := prices[p.ItemID]
+		if err := h.importItem(ctx, p, ok && price != p.Price, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//importItem updates the item row with the fields of the product and upserts
+//its variants. When priceChanged is set, the price is stored in a PRICE# row
+//effective at now, in the same transaction that appends it to the copy of
+//the prices in the item row, so an import that fails can be run again
+//without storing the price twice
+func (h *Handler) importItem(ctx context.Context, p Product, priceChanged bool,
+	now time.Time) error {
+
+	ctx = logging.WithItem(ctx, p.ItemID)
+
+	var price *item.Price
+	if priceChanged {
+		price = &item.Price{Price: p.Price, EffectiveFrom: now, CreatedAt: now}
+	}
+
+	input, err := h.getItemUpdate(p, price)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error marshaling item")
+		return ErrCouldNotImportCatalog
+	}
+
+	if price == nil {
+		if _, err := h.svc.UpdateItemWithContext(ctx, input); err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("Error saving item")
+			return ErrCouldNotImportCatalog
+		}
+	} else if err := h.savePrice(ctx, p.ItemID, *price, input); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error saving price")
+		return ErrCouldNotImportCatalog
+	}
+
+	for _, v := range p.Variants {
+		input, err := h.getVariantUpdate(p.ItemID, v)
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Str("sku", v.SKU).Msg("Error marshaling variant")
+			return ErrCouldNotImportCatalog
+		}
+		if _, err := h.svc.UpdateItemWithContext(ctx, input); err != nil {
+			logging.Ctx(ctx).Error().Err(err).Str("sku", v.SKU).Msg("Error saving variant")
+			return ErrCouldNotImportCatalog
+		}
+	}
+
+	return nil
+}
+
+//savePrice writes the PRICE# row of the price and the update of the item row
+//in a single transaction
+func (h *Handler) savePrice(ctx context.Context, itemID string, price item.Price,
+	input *dynamodb.UpdateItemInput) error {
+
+	row, err := item.PriceRow(itemID, price)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					Item:                row,
+					TableName:           aws.String(h.tableName),
+					ConditionExpression: aws.String("attribute_not_exists(pk) and attribute_not_exists(sk)"),
+				},
+			},
+			{
+				Update: &dynamodb.Update{
+					Key:                       input.Key,
+					UpdateExpression:          input.UpdateExpression,
+					ExpressionAttributeNames:  input.ExpressionAttributeNames,
+					ExpressionAttributeValues: input.ExpressionAttributeValues,
+					TableName:                 input.TableName,
+				},
+			},
+		},
+	})
+	return err
+}
+
+//batchWrite writes a chunk of requests, retrying the unprocessed items with
+//exponential backoff
+func (h *Handler) batchWrite(ctx context.Context,
+	requests []*dynamodb.WriteRequest) error {
+
+	pending := map[string][]*dynamodb.WriteRequest{h.tableName: requests}
+
+	for attempt := 0; attempt < maxWriteAttempts; attempt++ {
+
+		if attempt > 0 {
+			delay := retryBaseDelay * time.Duration(1<<uint(attempt-1))
+			logging.Ctx(ctx).Debug().Int("items", len(pending[h.tableName])).
+				Dur("delay", delay).Msg("Retrying unprocessed items")
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		result, err := h.svc.BatchWriteItemWithContext(ctx,
+			&dynamodb.BatchWriteItemInput{RequestItems: pending})
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("Error writing catalog")
+			return ErrCouldNotImportCatalog
+		}
+
+		if len(result.UnprocessedItems[h.tableName]) == 0 {
+			return nil
+		}
+		pending = result.UnprocessedItems
+	}
+
+	logging.Ctx(ctx).Error().Int("items", len(pending[h.tableName])).
+		Msg("Items were not processed")
+	return ErrUnprocessedItems
+}
+
+//changedFields returns the name of the fields that are different
+func changedFields(before, after Product) []string {
+
+	var fields []string
+	if before.CategoryID != after.CategoryID {
+		fields = append(fields, "category_id")
+	}
+	if before.Description != after.Description {
+		fields = append(fields, "description")
+	}
+	if before.Price != after.Price {
+		fields = append(fields, "price")
+	}
+	if len(before.Attributes) > 0 || len(after.Attributes) > 0 {
+		if !reflect.DeepEqual(before.Attributes, after.Attributes) {
+			fields = append(fields, "attributes")
+		}
+	}
+	if len(before.Dimensions) > 0 || len(after.Dimensions) > 0 {
+		if !reflect.DeepEqual(before.Dimensions, after.Dimensions) {
+			fields = append(fields, "dimensions")
+		}
+	}
+	if len(before.Media) > 0 || len(after.Media) > 0 {
+		if !reflect.DeepEqual(before.Media, after.Media) {
+			fields = append(fields, "media")
+		}
+	}
+	if len(after.Variants) > 0 && !reflect.DeepEqual(before.Variants, after.Variants) {
+		fields = append(fields, "variants")
+	}
+
+	return fields
+}
+
+//getCategoryRow returns the row of the category of the product
+func getCategoryRow(p Product) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"pk":          {S: aws.String(getCategoryKey(p.CategoryID))},
+		"sk":          {S: aws.String(getCategoryKey(p.CategoryID))},
+		"type":        {S: aws.String(DynamoDBRowTypeCategory)},
+		"category_id": {S: aws.String(p.CategoryID)},
+		"name":        {S: aws.String(p.CategoryName)},
+	}
+}
+
+//getItemUpdate returns the update of the item row with the fields of the
+//product, including the GSI used to load the items by category. The price is
+//only set on new items, the price of an existing item is changed through its
+//PRICE# history, and price is appended to the copy of the history in the
+//item row. Attributes and dimensions missing from the product are removed,
+//while the media is kept, see Catalog.KeepMedia
+func (h *Handler) getItemUpdate(p Product, price *item.Price) (
+	*dynamodb.UpdateItemInput, error) {
+
+	names := map[string]*string{
+		"#t": aws.String("type"),
+		"#d": aws.String("description"),
+		"#p": aws.String("price"),
+		"#a": aws.String("attributes"),
+		"#x": aws.String("dimensions"),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":t": {S: aws.String(DynamoDBRowTypeItem)},
+		":i": {S: aws.String(p.ItemID)},
+		":d": {S: aws.String(p.Description)},
+		":p": {N: aws.String(formatPrice(p.Price))},
+		":g": {S: aws.String(getCategoryKey(p.CategoryID))},
+		":k": {S: aws.String(getItemKey(p.ItemID))},
+	}
+
+	set := []string{"#t = :t", "item_id = :i", "#d = :d",
+		"#p = if_not_exists(#p, :p)", "gsi1pk = :g", "gsi1sk = :k"}
+	var remove []string
+
+	if len(p.Attributes) > 0 {
+		av, err := dynamodbattribute.Marshal(p.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		values[":a"] = av
+		set = append(set, "#a = :a")
+	} else {
+		remove = append(remove, "#a")
+	}
+
+	if len(p.Dimensions) > 0 {
+		av, err := dynamodbattribute.Marshal(p.Dimensions)
+		if err != nil {
+			return nil, err
+		}
+		values[":x"] = av
+		set = append(set, "#x = :x")
+	} else {
+		remove = append(remove, "#x")
+	}
+
+	if len(p.Media) > 0 {
+		av, err := dynamodbattribute.Marshal(p.Media)
+		if err != nil {
+			return nil, err
+		}
+		names["#m"] = aws.String("media")
+		values[":m"] = av
+		set = append(set, "#m = :m")
+	}
+
+	if price != nil {
+		action, priceValues, err := item.PriceAppend(*price)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range priceValues {
+			values[k] = v
+		}
+		set = append(set, action)
+	}
+
+	expression := "SET " + strings.Join(set, ", ")
+	if len(remove) > 0 {
+		expression += " REMOVE " + strings.Join(remove, ", ")
+	}
+
+	return &dynamodb.UpdateItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"pk": {S: aws.String(getItemKey(p.ItemID))},
+			"sk": {S: aws.String(getItemKey(p.ItemID))},
+		},
+		UpdateExpression:          aws.String(expression),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		TableName:                 aws.String(h.tableName),
+	}, nil
+}
+
+//getVariantUpdate returns the update of the row of the variant of the item.
+//The quantity limit of the variant is only set when the file has one
+func (h *Handler) getVariantUpdate(itemID string, v item.Variant) (
+	*dynamodb.UpdateItemInput, error) {
+
+	options, err := dynamodbattribute.Marshal(v.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	set := []string{"#t = :t", "item_id = :i", "sku = :s", "#o = :o",
+		"#p = :p", "stock = :q"}
+	values := map[string]*dynamodb.AttributeValue{
+		":t": {S: aws.String(item.DynamoDBRowTypeVariant)},
+		":i": {S: aws.String(itemID)},
+		":s": {S: aws.String(v.SKU)},
+		":o": options,
+		":p": {N: aws.String(formatPrice(v.Price))},
+		":q": {N: aws.String(strconv.Itoa(v.Stock))},
+	}
+	if v.MaxQuantity > 0 {
+		set = append(set, "max_quantity = :m")
+		values[":m"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(v.MaxQuantity))}
+	}
+
+	return &dynamodb.UpdateItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"pk": {S: aws.String(getItemKey(itemID))},
+			"sk": {S: aws.String(DynamoDBPrefixSKU + v.SKU)},
+		},
+		UpdateExpression: aws.String("SET " + strings.Join(set, ", ")),
+		ExpressionAttributeNames: map[string]*string{
+			"#t": aws.String("type"),
+			"#o": aws.String("options"),
+			"#p": aws.String("price"),
+		},
+		ExpressionAttributeValues: values,
+		TableName:                 aws.String(h.tableName),
+	}, nil
+}
+
+//getCategoryKey returns the categoryID formatted for the key columns
+func getCategoryKey(categoryID string) string {
+	return fmt.Sprintf("%s%s", DynamoDBPrefixCategory, categoryID)
+}
+
+//getItemKey returns the itemID formatted for the key columns
+func getItemKey(itemID string) string {
+	return fmt.Sprintf("%s%s", DynamoDBPrefixItem, itemID)
+}
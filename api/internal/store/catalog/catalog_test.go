@@ -0,0 +1,353 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/roloum/store/api/internal/store/item"
+	"github.com/rs/zerolog"
+)
+
+func init() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+//table is a DynamoDB client that returns the rows of the scan and records
+//the writes of the import
+type table struct {
+	dynamodbiface.DynamoDBAPI
+	rows    []map[string]*dynamodb.AttributeValue
+	batches int
+	puts    []*dynamodb.PutItemInput
+	updates []*dynamodb.UpdateItemInput
+}
+
+//ScanWithContext returns the rows in a single page
+func (t *table) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput,
+	opts ...request.Option) (*dynamodb.ScanOutput, error) {
+
+	return &dynamodb.ScanOutput{Items: t.rows}, nil
+}
+
+//BatchWriteItemWithContext processes every request
+func (t *table) BatchWriteItemWithContext(ctx aws.Context,
+	input *dynamodb.BatchWriteItemInput, opts ...request.Option) (
+	*dynamodb.BatchWriteItemOutput, error) {
+
+	t.batches++
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+//PutItemWithContext records the row
+func (t *table) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput,
+	opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+
+	t.puts = append(t.puts, input)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+//TransactWriteItemsWithContext records the puts and the updates of the
+//transaction
+func (t *table) TransactWriteItemsWithContext(ctx aws.Context,
+	input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (
+	*dynamodb.TransactWriteItemsOutput, error) {
+
+	for _, ti := range input.TransactItems {
+		if ti.Put != nil {
+			t.puts = append(t.puts, &dynamodb.PutItemInput{Item: ti.Put.Item})
+		}
+		if u := ti.Update; u != nil {
+			t.updates = append(t.updates, &dynamodb.UpdateItemInput{
+				Key: u.Key, UpdateExpression: u.UpdateExpression})
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+//UpdateItemWithContext records the update
+func (t *table) UpdateItemWithContext(ctx aws.Context,
+	input *dynamodb.UpdateItemInput, opts ...request.Option) (
+	*dynamodb.UpdateItemOutput, error) {
+
+	t.updates = append(t.updates, input)
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+//TestReadCSV tests parsing a CSV file and exporting it back
+func TestReadCSV(t *testing.T) {
+
+	file := "item_id,category_id,category_name,description,price,attributes,dimensions\n" +
+		"1,1,Electronics,Phone charger,10.99,power=20W,connector=USB-C|Lightning\n" +
+		"2,1,Electronics,Mouse,4,,\n"
+
+	products, err := ReadCSV(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []Product{
+		{ItemID: "1", CategoryID: "1", CategoryName: "Electronics",
+			Description: "Phone charger", Price: 10.99,
+			Attributes: map[string]string{"power": "20W"},
+			Dimensions: []item.Dimension{
+				{Name: "connector", Values: []string{"USB-C", "Lightning"}},
+			},
+		},
+		{ItemID: "2", CategoryID: "1", CategoryName: "Electronics",
+			Description: "Mouse", Price: 4},
+	}
+	if !reflect.DeepEqual(products, expected) {
+		t.Errorf("Expected: %v. Received: %v", expected, products)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, products); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buf.String() != file {
+		t.Errorf("Expected: %s. Received: %s", file, buf.String())
+	}
+}
+
+//TestReadCSVErrors tests the errors returned while parsing CSV files
+func TestReadCSVErrors(t *testing.T) {
+
+	tests := []struct {
+		desc string
+		file string
+		err  error
+	}{
+		{"HeaderIsInvalid", "item_id,description\n1,Mouse\n", ErrHeaderIsInvalid},
+		{ErrPriceIsInvalid,
+			"item_id,category_id,category_name,description,price\n1,1,E,Mouse,abc\n",
+			RowError{1, "Price", ErrPriceIsInvalid}},
+		{ErrAttributesAreInvalid,
+			"item_id,category_id,category_name,description,price,attributes\n" +
+				"1,1,E,Mouse,4,brand\n",
+			RowError{1, "Attributes", ErrAttributesAreInvalid}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ReadCSV(strings.NewReader(tc.file))
+			if !reflect.DeepEqual(err, tc.err) {
+				t.Errorf("Expected: %v. Received: %v", tc.err, err)
+			}
+		})
+	}
+}
+
+//TestValidate tests that every row of the file is validated
+func TestValidate(t *testing.T) {
+
+	products := []Product{
+		{ItemID: "1", CategoryID: "1", CategoryName: "Electronics",
+			Description: "Mouse", Price: 4},
+		{ItemID: "", CategoryID: "1", CategoryName: "Electronics",
+			Description: "Camera", Price: -1},
+		{ItemID: "1", CategoryID: "1", CategoryName: "Computers",
+			Description: "Laptop", Price: 59.99},
+	}
+
+	products[2].Variants = []item.Variant{{SKU: "LAP-13", Price: 59.99},
+		{SKU: "LAP-13", Price: 69.99}, {Price: 0}}
+
+	expected := []RowError{
+		{2, "ItemID", ErrItemIDIsEmpty},
+		{2, "Price", ErrPriceIsInvalid},
+		{3, "SKU", ErrSKUIsDuplicated},
+		{3, "SKU", ErrSKUIsEmpty},
+		{3, "VariantPrice", ErrPriceIsInvalid},
+		{3, "ItemID", ErrItemIDIsDuplicated},
+		{3, "CategoryName", ErrCategoryNameIsInconsistent},
+	}
+
+	if errs := Validate(products); !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Expected: %v. Received: %v", expected, errs)
+	}
+}
+
+//TestDiff tests the changes reported by a dry run
+func TestDiff(t *testing.T) {
+
+	current := &Catalog{
+		Categories: map[string]string{"1": "Electronics"},
+		Products: []Product{
+			{ItemID: "1", CategoryID: "1", CategoryName: "Electronics",
+				Description: "Mouse", Price: 4},
+			{ItemID: "2", CategoryID: "1", CategoryName: "Electronics",
+				Description: "Camera", Price: 17.99},
+			{ItemID: "3", CategoryID: "1", CategoryName: "Electronics",
+				Description: "Laptop", Price: 59.99},
+		},
+	}
+
+	d := current.Diff([]Product{
+		{ItemID: "1", CategoryID: "1", CategoryName: "Electronics",
+			Description: "Mouse", Price: 4},
+		{ItemID: "2", CategoryID: "1", CategoryName: "Electronics",
+			Description: "Camera", Price: 15.99},
+		{ItemID: "4", CategoryID: "2", CategoryName: "Phones",
+			Description: "SIM Card", Price: 0.99},
+	})
+
+	if !reflect.DeepEqual(d.Categories, []string{"2"}) {
+		t.Errorf("Expected new category 2. Received: %v", d.Categories)
+	}
+	if len(d.Added) != 1 || d.Added[0].ItemID != "4" {
+		t.Errorf("Expected item 4 to be added. Received: %v", d.Added)
+	}
+	if len(d.Changed) != 1 || !reflect.DeepEqual(d.Changed[0].Fields, []string{"price"}) {
+		t.Errorf("Expected price of item 2 to change. Received: %v", d.Changed)
+	}
+	if d.Unchanged != 1 {
+		t.Errorf("Expected 1 unchanged item. Received: %d", d.Unchanged)
+	}
+	if len(d.Missing) != 1 || d.Missing[0].ItemID != "3" {
+		t.Errorf("Expected item 3 to be missing. Received: %v", d.Missing)
+	}
+}
+
+//TestLoad tests that the catalog contains the regular price of the items and
+//their variants
+func TestLoad(t *testing.T) {
+
+	yesterday := time.Now().Add(-24 * time.Hour).UTC().Format(time.RFC3339Nano)
+	tomorrow := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339Nano)
+
+	svc := &table{rows: []map[string]*dynamodb.AttributeValue{
+		{
+			"type":        {S: aws.String(DynamoDBRowTypeCategory)},
+			"category_id": {S: aws.String("1")},
+			"name":        {S: aws.String("Electronics")},
+		},
+		{
+			"type":        {S: aws.String(DynamoDBRowTypeItem)},
+			"item_id":     {S: aws.String("1")},
+			"description": {S: aws.String("Phone charger")},
+			"price":       {N: aws.String("10.99")},
+			"gsi1pk":      {S: aws.String("CATEGORY#1")},
+		},
+		{
+			"type":           {S: aws.String(item.DynamoDBRowTypePrice)},
+			"item_id":        {S: aws.String("1")},
+			"price":          {N: aws.String("12.99")},
+			"effective_from": {S: aws.String(yesterday)},
+		},
+		//A sale is not the regular price
+		{
+			"type":           {S: aws.String(item.DynamoDBRowTypePrice)},
+			"item_id":        {S: aws.String("1")},
+			"price":          {N: aws.String("9.99")},
+			"effective_from": {S: aws.String(yesterday)},
+			"effective_to":   {S: aws.String(tomorrow)},
+		},
+		{
+			"type":    {S: aws.String(item.DynamoDBRowTypeVariant)},
+			"item_id": {S: aws.String("1")},
+			"sku":     {S: aws.String("CHG-USBC")},
+			"options": {M: map[string]*dynamodb.AttributeValue{
+				"connector": {S: aws.String("USB-C")}}},
+			"price": {N: aws.String("12.99")},
+			"stock": {N: aws.String("25")},
+		},
+	}}
+	h, _ := New(svc, "Store")
+
+	c, err := h.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Product{
+		{ItemID: "1", CategoryID: "1", CategoryName: "Electronics",
+			Description: "Phone charger", Price: 12.99,
+			Variants: []item.Variant{{SKU: "CHG-USBC",
+				Options: map[string]string{"connector": "USB-C"}, Price: 12.99,
+				Stock: 25}},
+		},
+	}
+	if !reflect.DeepEqual(c.Products, expected) {
+		t.Errorf("Expected: %v. Received: %v", expected, c.Products)
+	}
+}
+
+//TestImport tests that the items are updated with the imported fields only,
+//that the price of an existing item is changed through its price history and
+//that the variants are upserted
+func TestImport(t *testing.T) {
+
+	current := &Catalog{
+		Categories: map[string]string{"1": "Electronics"},
+		Products: []Product{
+			{ItemID: "1", CategoryID: "1", CategoryName: "Electronics",
+				Description: "Mouse", Price: 4},
+			{ItemID: "2", CategoryID: "1", CategoryName: "Electronics",
+				Description: "Camera", Price: 17.99},
+		},
+	}
+
+	svc := &table{}
+	h, _ := New(svc, "Store")
+
+	err := h.Import(context.Background(), current, []Product{
+		{ItemID: "1", CategoryID: "1", CategoryName: "Electronics",
+			Description: "Mouse", Price: 4},
+		{ItemID: "2", CategoryID: "1", CategoryName: "Electronics",
+			Description: "Camera", Price: 15.99,
+			Variants: []item.Variant{{SKU: "CAM-BLK", Price: 15.99, Stock: 3}}},
+		{ItemID: "3", CategoryID: "2", CategoryName: "Phones",
+			Description: "SIM Card", Price: 0.99},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if svc.batches != 1 {
+		t.Errorf("Expected the categories in 1 batch. Received: %d", svc.batches)
+	}
+
+	//Only the price of item 2 changed
+	if len(svc.puts) != 1 {
+		t.Fatalf("Expected 1 price. Received: %v", svc.puts)
+	}
+	price := svc.puts[0].Item
+	if aws.StringValue(price["type"].S) != item.DynamoDBRowTypePrice ||
+		aws.StringValue(price["pk"].S) != "ITEM#2" ||
+		aws.StringValue(price["price"].N) != "15.99" {
+		t.Errorf("Unexpected price row: %v", price)
+	}
+
+	keys := []string{}
+	for _, u := range svc.updates {
+		keys = append(keys, aws.StringValue(u.Key["sk"].S))
+		expression := aws.StringValue(u.UpdateExpression)
+		if strings.Contains(expression, "max_quantity") {
+			t.Errorf("Expected the quantity limit to be kept: %s", expression)
+		}
+	}
+	expected := []string{"ITEM#1", "ITEM#2", "SKU#CAM-BLK", "ITEM#3"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected updates: %v. Received: %v", expected, keys)
+	}
+
+	//The new price is copied in the item row
+	if expression := aws.StringValue(svc.updates[1].UpdateExpression); !strings.Contains(
+		expression, "list_append") {
+		t.Errorf("Expected the price to be copied in the item row: %s", expression)
+	}
+
+	//The price of the item row is only set when the item is new
+	if expression := aws.StringValue(svc.updates[0].UpdateExpression); !strings.Contains(
+		expression, "#p = if_not_exists(#p, :p)") {
+		t.Errorf("Expected the price to be set on new items: %s", expression)
+	}
+}
@@ -0,0 +1,249 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/roloum/store/api/internal/store/item"
+)
+
+const (
+	//FormatCSV comma separated values, one product per row
+	FormatCSV = "csv"
+
+	//FormatJSON JSON array of products
+	FormatJSON = "json"
+)
+
+var (
+	//ErrFormatIsInvalid error returned when the file format is not supported
+	ErrFormatIsInvalid = errors.New("FormatIsInvalid")
+
+	//ErrHeaderIsInvalid error returned when the CSV header does not contain
+	//the expected columns
+	ErrHeaderIsInvalid = errors.New("HeaderIsInvalid")
+
+	//csvHeader contains the columns of a CSV catalog file. Attributes are
+	//written as name=value pairs separated by ";". Dimensions are written as
+	//name=value|value pairs separated by ";"
+	csvHeader = []string{"item_id", "category_id", "category_name",
+		"description", "price", "attributes", "dimensions"}
+)
+
+//Read reads the products from a file in the given format
+func Read(r io.Reader, format string) ([]Product, error) {
+	switch format {
+	case FormatCSV:
+		return ReadCSV(r)
+	case FormatJSON:
+		return ReadJSON(r)
+	}
+	return nil, ErrFormatIsInvalid
+}
+
+//Write writes the products to a file in the given format
+func Write(w io.Writer, format string, products []Product) error {
+	switch format {
+	case FormatCSV:
+		return WriteCSV(w, products)
+	case FormatJSON:
+		return WriteJSON(w, products)
+	}
+	return ErrFormatIsInvalid
+}
+
+//ReadJSON reads a JSON array of products
+func ReadJSON(r io.Reader) ([]Product, error) {
+	products := []Product{}
+	if err := json.NewDecoder(r).Decode(&products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+//WriteJSON writes the products as an indented JSON array
+func WriteJSON(w io.Writer, products []Product) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(products)
+}
+
+//ReadCSV reads a CSV file with a header row. The columns can be in any order
+//and the attributes and dimensions columns are optional
+func ReadCSV(r io.Reader) ([]Product, error) {
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for n, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = n
+	}
+	for _, name := range csvHeader[:5] {
+		if _, ok := columns[name]; !ok {
+			return nil, ErrHeaderIsInvalid
+		}
+	}
+
+	products := []Product{}
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		value := func(name string) string {
+			if n, ok := columns[name]; ok && n < len(record) {
+				return strings.TrimSpace(record[n])
+			}
+			return ""
+		}
+
+		p := Product{
+			ItemID:       value("item_id"),
+			CategoryID:   value("category_id"),
+			CategoryName: value("category_name"),
+			Description:  value("description"),
+		}
+
+		if price := value("price"); price != "" {
+			f, err := strconv.ParseFloat(price, 32)
+			if err != nil {
+				return nil, RowError{row, "Price", ErrPriceIsInvalid}
+			}
+			p.Price = float32(f)
+		}
+
+		if p.Attributes, err = parseAttributes(value("attributes")); err != nil {
+			return nil, RowError{row, "Attributes", ErrAttributesAreInvalid}
+		}
+
+		if p.Dimensions, err = parseDimensions(value("dimensions")); err != nil {
+			return nil, RowError{row, "Dimensions", ErrDimensionsAreInvalid}
+		}
+
+		products = append(products, p)
+	}
+
+	return products, nil
+}
+
+//WriteCSV writes the products as CSV, including the header row
+func WriteCSV(w io.Writer, products []Product) error {
+
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, p := range products {
+		err := writer.Write([]string{
+			p.ItemID,
+			p.CategoryID,
+			p.CategoryName,
+			p.Description,
+			formatPrice(p.Price),
+			formatAttributes(p.Attributes),
+			formatDimensions(p.Dimensions),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+//parseAttributes parses a list of name=value pairs separated by ";"
+func parseAttributes(s string) (map[string]string, error) {
+
+	if s == "" {
+		return nil, nil
+	}
+
+	attributes := map[string]string{}
+	for _, pair := range strings.Split(s, ";") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, errors.New(ErrAttributesAreInvalid)
+		}
+		attributes[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	return attributes, nil
+}
+
+//formatAttributes formats the attributes as name=value pairs sorted by name
+func formatAttributes(attributes map[string]string) string {
+
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, attributes[name]))
+	}
+
+	return strings.Join(pairs, ";")
+}
+
+//parseDimensions parses a list of name=value|value pairs separated by ";"
+func parseDimensions(s string) ([]item.Dimension, error) {
+
+	if s == "" {
+		return nil, nil
+	}
+
+	var dimensions []item.Dimension
+	for _, pair := range strings.Split(s, ";") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" ||
+			strings.TrimSpace(kv[1]) == "" {
+			return nil, errors.New(ErrDimensionsAreInvalid)
+		}
+
+		d := item.Dimension{Name: strings.TrimSpace(kv[0])}
+		for _, v := range strings.Split(kv[1], "|") {
+			d.Values = append(d.Values, strings.TrimSpace(v))
+		}
+		dimensions = append(dimensions, d)
+	}
+
+	return dimensions, nil
+}
+
+//formatDimensions formats the dimensions as name=value|value pairs
+func formatDimensions(dimensions []item.Dimension) string {
+
+	pairs := make([]string, 0, len(dimensions))
+	for _, d := range dimensions {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", d.Name,
+			strings.Join(d.Values, "|")))
+	}
+
+	return strings.Join(pairs, ";")
+}
+
+//formatPrice formats the price with the minimum number of decimals
+func formatPrice(price float32) string {
+	return strconv.FormatFloat(float64(price), 'f', -1, 32)
+}
@@ -0,0 +1,68 @@
+package catalog
+
+import (
+	"fmt"
+
+	"github.com/roloum/store/api/internal/store/item"
+)
+
+//Product is a row of a catalog file. It contains the item along with the
+//category it belongs to, so a file can create both
+type Product struct {
+	ItemID       string            `json:"item_id" validate:"required"`
+	CategoryID   string            `json:"category_id" validate:"required"`
+	CategoryName string            `json:"category_name" validate:"required"`
+	Description  string            `json:"description" validate:"required"`
+	Price        float32           `json:"price" validate:"required,gt=0"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Dimensions   []item.Dimension  `json:"dimensions,omitempty"`
+
+	//Media is only part of the JSON format. Products without media keep the
+	//media stored in the database, see Catalog.KeepMedia
+	Media []item.Media `json:"media,omitempty"`
+
+	//Variants is only part of the JSON format. The variants are upserted by
+	//SKU, the variants stored in the database that are not in the file are
+	//kept
+	Variants []item.Variant `json:"variants,omitempty"`
+}
+
+//Catalog contains the categories and items stored in the database
+type Catalog struct {
+	Products []Product
+
+	//Categories contains the name of every category by categoryID
+	Categories map[string]string
+}
+
+//Change describes a product that is different in the file and the database
+type Change struct {
+	Before Product
+	After  Product
+	Fields []string
+}
+
+//Diff contains the changes an import would apply to the database
+type Diff struct {
+	//Categories contains the categories that are created or renamed
+	Categories []string
+	Added      []Product
+	Changed    []Change
+	Unchanged  int
+
+	//Missing contains the products in the database that are not in the file.
+	//The import does not delete them
+	Missing []Product
+}
+
+//RowError describes why a row of the file is not valid
+type RowError struct {
+	Row   int
+	Field string
+	Err   string
+}
+
+//Error returns the row, field and validation error
+func (e RowError) Error() string {
+	return fmt.Sprintf("row %d: %s: %s", e.Row, e.Field, e.Err)
+}
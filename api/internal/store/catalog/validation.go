@@ -0,0 +1,128 @@
+package catalog
+
+import (
+	validator "github.com/go-playground/validator/v10"
+)
+
+const (
+	//ErrItemIDIsEmpty Error describes when itemID is empty
+	ErrItemIDIsEmpty = "ItemIDIsEmpty"
+
+	//ErrItemIDIsDuplicated Error describes when itemID appears in several rows
+	ErrItemIDIsDuplicated = "ItemIDIsDuplicated"
+
+	//ErrCategoryIDIsEmpty Error describes when categoryID is empty
+	ErrCategoryIDIsEmpty = "CategoryIDIsEmpty"
+
+	//ErrCategoryNameIsEmpty Error describes when the category name is empty
+	ErrCategoryNameIsEmpty = "CategoryNameIsEmpty"
+
+	//ErrCategoryNameIsInconsistent Error describes when rows of the same
+	//category have different category names
+	ErrCategoryNameIsInconsistent = "CategoryNameIsInconsistent"
+
+	//ErrDescriptionIsEmpty Error describes when Item description is empty
+	ErrDescriptionIsEmpty = "DescriptionIsEmpty"
+
+	//ErrPriceIsEmpty Error describes when price is empty
+	ErrPriceIsEmpty = "PriceIsEmpty"
+
+	//ErrPriceIsInvalid Error describes when price is not valid number
+	ErrPriceIsInvalid = "PriceIsInvalid"
+
+	//ErrAttributesAreInvalid Error describes when the attributes column is not
+	//a list of name=value pairs
+	ErrAttributesAreInvalid = "AttributesAreInvalid"
+
+	//ErrDimensionsAreInvalid Error describes when the dimensions column is not
+	//a list of name=value|value pairs
+	ErrDimensionsAreInvalid = "DimensionsAreInvalid"
+
+	//ErrSKUIsEmpty Error describes when a variant does not have a SKU
+	ErrSKUIsEmpty = "SKUIsEmpty"
+
+	//ErrSKUIsDuplicated Error describes when a SKU appears in several
+	//variants of the product
+	ErrSKUIsDuplicated = "SKUIsDuplicated"
+)
+
+var validate *validator.Validate
+
+//init instantiates a validator
+func init() {
+	validate = validator.New()
+}
+
+//Validate validates every product of the file and returns all the errors
+//found. Rows are numbered starting at 1
+func Validate(products []Product) []RowError {
+
+	var errs []RowError
+
+	itemRows := map[string]int{}
+	categoryNames := map[string]string{}
+
+	for n, p := range products {
+		row := n + 1
+
+		if err := validate.Struct(p); err != nil {
+			for _, ferr := range err.(validator.ValidationErrors) {
+				errs = append(errs, RowError{row, ferr.Field(), getValidationError(ferr)})
+			}
+		}
+
+		skus := map[string]bool{}
+		for _, v := range p.Variants {
+			switch {
+			case v.SKU == "":
+				errs = append(errs, RowError{row, "SKU", ErrSKUIsEmpty})
+			case skus[v.SKU]:
+				errs = append(errs, RowError{row, "SKU", ErrSKUIsDuplicated})
+			}
+			skus[v.SKU] = true
+			if v.Price <= 0 {
+				errs = append(errs, RowError{row, "VariantPrice", ErrPriceIsInvalid})
+			}
+		}
+
+		if p.ItemID != "" {
+			if _, ok := itemRows[p.ItemID]; ok {
+				errs = append(errs, RowError{row, "ItemID", ErrItemIDIsDuplicated})
+			}
+			itemRows[p.ItemID] = row
+		}
+
+		if p.CategoryID != "" && p.CategoryName != "" {
+			name, ok := categoryNames[p.CategoryID]
+			if ok && name != p.CategoryName {
+				errs = append(errs, RowError{row, "CategoryName",
+					ErrCategoryNameIsInconsistent})
+			}
+			categoryNames[p.CategoryID] = p.CategoryName
+		}
+	}
+
+	return errs
+}
+
+//getValidationError Returns the error code of a field that failed validation
+func getValidationError(err validator.FieldError) string {
+
+	switch err.Field() {
+	case "ItemID":
+		return ErrItemIDIsEmpty
+	case "CategoryID":
+		return ErrCategoryIDIsEmpty
+	case "CategoryName":
+		return ErrCategoryNameIsEmpty
+	case "Description":
+		return ErrDescriptionIsEmpty
+	case "Price":
+		if err.Tag() == "required" {
+			return ErrPriceIsEmpty
+		}
+		return ErrPriceIsInvalid
+	}
+
+	return err.Tag()
+}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/roloum/store/api/internal/blob"
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/roloum/store/api/internal/tracing"
 	"github.com/rs/zerolog/log"
 )
 
@@ -18,6 +22,22 @@ const (
 
 	//DynamoDBPrefixItem Prexix for product item key
 	DynamoDBPrefixItem = "ITEM#"
+
+	//DynamoDBPrefixSKU Prefix for the sort key of an item variant
+	DynamoDBPrefixSKU = "SKU#"
+
+	//DynamoDBRowTypeItem Attribute used to identify a row of type item
+	DynamoDBRowTypeItem = "Item"
+
+	//DynamoDBRowTypeVariant Attribute used to identify a variant of an item
+	DynamoDBRowTypeVariant = "Variant"
+
+	//DynamoDBRowTypePrice Attribute used to identify a price of an item
+	DynamoDBRowTypePrice = "Price"
+
+	//DynamoDBAttributePrices Attribute of the item row with a copy of the
+	//PRICE# rows of the item
+	DynamoDBAttributePrices = "prices"
 )
 
 var (
@@ -29,38 +49,74 @@ var (
 
 	//ErrCategoryIDIsEmpty error returned if the categoryID is empty
 	ErrCategoryIDIsEmpty = errors.New("CategoryIDIsEmpty")
+
+	//ErrItemIDIsEmpty error returned if the itemID is empty
+	ErrItemIDIsEmpty = errors.New("ItemIDIsEmpty")
+
+	//ErrCouldNotLoadItem error returned if we failed to load an item
+	ErrCouldNotLoadItem = errors.New("CouldNotLoadItem")
+
+	//ErrItemNotFound error returned if the item does not exist
+	ErrItemNotFound = errors.New("ItemNotFound")
 )
 
+//Indexer is notified every time the Handler writes an item, so secondary
+//indexes built from the catalog, like the search index, stay up to date.
+//Items removed from the catalog leave the index when it is rebuilt
+type Indexer interface {
+	Put(i Item)
+}
+
 //Handler struct is a handler for executing the actions related to the shopping cart
 type Handler struct {
 	svc       dynamodbiface.DynamoDBAPI
 	tableName string
+	indexers  []Indexer
+	blobs     blob.Store
+}
+
+//Option sets an optional dependency of the Handler
+type Option func(*Handler)
+
+//WithIndexer registers an Indexer that is notified of the item writes
+func WithIndexer(i Indexer) Option {
+	return func(h *Handler) {
+		h.indexers = append(h.indexers, i)
+	}
 }
 
 //New returns pointer to a struct of type Cart, that contains methods
 //For each action that can be executed on this API
-func New(svc dynamodbiface.DynamoDBAPI, tableName string) (*Handler, error) {
+func New(svc dynamodbiface.DynamoDBAPI, tableName string, opts ...Option) (
+	*Handler, error) {
 	if tableName == "" {
 		log.Error().Msg("Table name is empty")
 		return nil, errors.New(ErrStoreTableNameIsEmpty)
 	}
 
-	return &Handler{svc, tableName}, nil
+	h := &Handler{svc: svc, tableName: tableName}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h, nil
 }
 
-//List returns the information of an item
-//Eventuallly, this method will receive a category id
-//For now, it loads all items from category 1
-//It uses a GSI to load the items based on categoryID
-func (h *Handler) List(ctx context.Context, categoryID string) (*List, error) {
+//List returns the items of a category. It uses a GSI to load the items based
+//on categoryID, page by page. The prices are resolved with the copy of the
+//PRICE# rows kept in the item row, so the partition of every item is not read
+func (h *Handler) List(ctx context.Context, categoryID string) (_ *List, err error) {
+
+	ctx, span := tracing.Start(ctx, "item.List")
+	defer func() { span.End(err) }()
 
 	if categoryID == "" {
 		return nil, ErrCategoryIDIsEmpty
 	}
 
-	log.Debug().Msgf("Loading items for categoryID: %s", categoryID)
+	logging.Ctx(ctx).Debug().Str("category_id", categoryID).Msg("Loading items")
 
-	result, err := h.svc.QueryWithContext(ctx, &dynamodb.QueryInput{
+	input := &dynamodb.QueryInput{
 		IndexName: aws.String("gsi1pk"),
 		KeyConditions: map[string]*dynamodb.Condition{
 			"gsi1pk": {
@@ -77,30 +133,232 @@ func (h *Handler) List(ctx context.Context, categoryID string) (*List, error) {
 				},
 			},
 		},
-		ProjectionExpression: aws.String("item_id,description,price"),
+		ExpressionAttributeNames: map[string]*string{
+			"#t": aws.String("type"),
+			"#a": aws.String("attributes"),
+			"#m": aws.String("media"),
+		},
+		//Price rows stored in the GSI by earlier versions are skipped, the
+		//prices are copied in the item row
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":i": {S: aws.String(DynamoDBRowTypeItem)},
+		},
+		FilterExpression:     aws.String("#t = :i"),
+		ProjectionExpression: aws.String("#t,item_id,description,price,#a,#m,prices"),
 		TableName:            aws.String(h.tableName),
-	})
+	}
 
-	if err != nil {
-		log.Error().Msgf("Error loading items: %s", err.Error())
-		return nil, ErrCouldNotLoadItems
+	var items []map[string]*dynamodb.AttributeValue
+	for {
+		result, err := h.svc.QueryWithContext(ctx, input)
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("Error loading items")
+			return nil, ErrCouldNotLoadItems
+		}
+		items = append(items, result.Items...)
+
+		//The query is complete when there is no LastEvaluatedKey
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
 	}
 
 	l := List{Items: []Item{}}
 
-	if *result.Count == int64(0) {
+	if len(items) == 0 {
 		return &l, nil
 	}
 
-	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &l.Items)
+	rows, err := unmarshalRows(items)
 	if err != nil {
-		log.Error().Msgf("Error Unmarshaling items: %s", err.Error())
+		logging.Ctx(ctx).Error().Err(err).Msg("Error Unmarshaling items")
 		return nil, ErrCouldNotLoadItems
 	}
+	l.Items = rows.resolve(time.Now())
 
 	return &l, nil
 }
 
+//Get returns the information of an item, including its variant matrix: the
+//dimensions in which the variants differ and the SKU, price and stock of
+//every variant. The item and its variants share the partition key
+func (h *Handler) Get(ctx context.Context, itemID string) (_ *Item, err error) {
+
+	ctx, span := tracing.Start(ctx, "item.Get")
+	defer func() { span.End(err) }()
+
+	if itemID == "" {
+		return nil, ErrItemIDIsEmpty
+	}
+
+	ctx = logging.WithItem(ctx, itemID)
+	logging.Ctx(ctx).Debug().Msg("Loading item")
+
+	result, err := h.svc.QueryWithContext(ctx, &dynamodb.QueryInput{
+		KeyConditions: map[string]*dynamodb.Condition{
+			"pk": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodb.AttributeValue{
+					{S: aws.String(getItemPK(itemID))},
+				},
+			},
+		},
+		TableName: aws.String(h.tableName),
+	})
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error loading item")
+		return nil, ErrCouldNotLoadItem
+	}
+
+	rows, err := unmarshalRows(result.Items)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error Unmarshaling item")
+		return nil, ErrCouldNotLoadItem
+	}
+
+	items := rows.resolve(time.Now())
+	if len(items) == 0 {
+		return nil, ErrItemNotFound
+	}
+
+	return &items[0], nil
+}
+
+//All returns every item in the catalog. It reads the category GSI, which
+//only has the item rows, with their copy of the prices, so the carts and the
+//other rows of the table are not read. It is meant for building indexes, not
+//for serving requests
+func (h *Handler) All(ctx context.Context) (_ []Item, err error) {
+
+	ctx, span := tracing.Start(ctx, "item.All")
+	defer func() { span.End(err) }()
+
+	logging.Ctx(ctx).Debug().Msg("Loading all items")
+
+	input := &dynamodb.ScanInput{
+		IndexName: aws.String("gsi1pk"),
+		ExpressionAttributeNames: map[string]*string{
+			"#t": aws.String("type"),
+			"#a": aws.String("attributes"),
+			"#m": aws.String("media"),
+		},
+		//Price rows stored in the GSI by earlier versions are skipped
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":i": {S: aws.String(DynamoDBRowTypeItem)},
+		},
+		FilterExpression: aws.String("#t = :i"),
+		ProjectionExpression: aws.String(fmt.Sprintf(
+			"#t,item_id,description,price,#a,#m,%s", DynamoDBAttributePrices)),
+		TableName: aws.String(h.tableName),
+	}
+
+	var items []map[string]*dynamodb.AttributeValue
+	for {
+		result, err := h.svc.ScanWithContext(ctx, input)
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("Error scanning items")
+			return nil, ErrCouldNotLoadItems
+		}
+		items = append(items, result.Items...)
+
+		//The scan is complete when there is no LastEvaluatedKey
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	rows, err := unmarshalRows(items)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error Unmarshaling items")
+		return nil, ErrCouldNotLoadItems
+	}
+
+	return rows.resolve(time.Now()), nil
+}
+
+//rows contains the item, variant and price rows of the catalog, grouped by
+//itemID. itemPrices contains the copy of the prices kept in the item rows
+type rows struct {
+	items      []Item
+	variants   map[string][]Variant
+	prices     map[string][]Price
+	itemPrices map[string][]Price
+}
+
+//unmarshalRows unmarshals the rows of the catalog based on their type.
+//Rows of other types are ignored
+func unmarshalRows(items []map[string]*dynamodb.AttributeValue) (*rows, error) {
+
+	r := &rows{
+		variants:   map[string][]Variant{},
+		prices:     map[string][]Price{},
+		itemPrices: map[string][]Price{},
+	}
+
+	for _, row := range items {
+
+		if row["type"] == nil || row["type"].S == nil ||
+			row["item_id"] == nil || row["item_id"].S == nil {
+			continue
+		}
+		itemID := *row["item_id"].S
+
+		var err error
+		switch *row["type"].S {
+		case DynamoDBRowTypeItem:
+			var i Item
+			err = dynamodbattribute.UnmarshalMap(row, &i)
+			r.items = append(r.items, i)
+			if err == nil && row[DynamoDBAttributePrices] != nil {
+				var prices []Price
+				err = dynamodbattribute.Unmarshal(row[DynamoDBAttributePrices], &prices)
+				r.itemPrices[itemID] = prices
+			}
+		case DynamoDBRowTypeVariant:
+			var v Variant
+			err = dynamodbattribute.UnmarshalMap(row, &v)
+			r.variants[itemID] = append(r.variants[itemID], v)
+		case DynamoDBRowTypePrice:
+			var p Price
+			err = dynamodbattribute.UnmarshalMap(row, &p)
+			r.prices[itemID] = append(r.prices[itemID], p)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+//resolve returns the items with their variants and the price effective at t.
+//The PRICE# rows are used when they were loaded, otherwise the copy of the
+//prices in the item row
+func (r *rows) resolve(t time.Time) []Item {
+
+	items := make([]Item, 0, len(r.items))
+	for _, i := range r.items {
+		if variants := r.variants[i.ItemID]; len(variants) > 0 {
+			i.Variants = variants
+		}
+		prices := r.prices[i.ItemID]
+		if len(prices) == 0 {
+			prices = r.itemPrices[i.ItemID]
+		}
+		i.applyPrices(prices, t)
+		items = append(items, i)
+	}
+
+	return items
+}
+
+//getItemPK returns the itemID formatted for the primary key column
+func getItemPK(itemID string) string {
+	return fmt.Sprintf("%s%s", DynamoDBPrefixItem, itemID)
+}
+
 //getItemGSI1SK returns the categoryID formatted for the gsi1pk
 func getItemGSI1SK(categoryID string) string {
 	return fmt.Sprintf("%s%s", DynamoDBPrefixCategory, categoryID)
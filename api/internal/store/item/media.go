@@ -0,0 +1,231 @@
+package item
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+	"github.com/roloum/store/api/internal/blob"
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/roloum/store/api/internal/tracing"
+)
+
+var (
+	//ErrBlobStoreIsNotConfigured error returned when uploading an image and
+	//the Handler does not have a blob store
+	ErrBlobStoreIsNotConfigured = errors.New("BlobStoreIsNotConfigured")
+
+	//ErrContentTypeIsInvalid error returned when the uploaded content is not
+	//a supported image type
+	ErrContentTypeIsInvalid = errors.New("ContentTypeIsInvalid")
+
+	//ErrCouldNotAttachMedia error returned if we failed to attach the media
+	ErrCouldNotAttachMedia = errors.New("CouldNotAttachMedia")
+
+	//ErrCouldNotReorderMedia error returned if we failed to save the new order
+	ErrCouldNotReorderMedia = errors.New("CouldNotReorderMedia")
+
+	//mediaExtensions contains the file extension of the supported image types
+	mediaExtensions = map[string]string{
+		"image/jpeg": ".jpg",
+		"image/png":  ".png",
+		"image/gif":  ".gif",
+		"image/webp": ".webp",
+	}
+)
+
+//WithBlobStore sets the store where the uploaded images are saved
+func WithBlobStore(s blob.Store) Option {
+	return func(h *Handler) {
+		h.blobs = s
+	}
+}
+
+//AttachMedia adds an image at the end of the media list of the item.
+//If the image is uploaded, it is saved in the blob store first
+func (h *Handler) AttachMedia(ctx context.Context, nm *NewMediaInfo) (_ *Item,
+	err error) {
+
+	ctx, span := tracing.Start(ctx, "item.AttachMedia")
+	defer func() { span.End(err) }()
+
+	ctx = logging.WithItem(ctx, nm.ItemID)
+
+	if err := validate.Struct(nm); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error validating struct")
+		return nil, getValidationError(err)
+	}
+
+	m := Media{
+		MediaID: uuid.New().String(),
+		URL:     nm.URL,
+		Alt:     nm.Alt,
+		Width:   nm.Width,
+		Height:  nm.Height,
+		Role:    nm.Role,
+	}
+
+	if len(nm.Content) > 0 {
+		if h.blobs == nil {
+			return nil, ErrBlobStoreIsNotConfigured
+		}
+
+		ext, ok := mediaExtensions[nm.ContentType]
+		if !ok {
+			return nil, ErrContentTypeIsInvalid
+		}
+
+		m.Key = fmt.Sprintf("items/%s/%s%s", nm.ItemID, m.MediaID, ext)
+		err := h.blobs.Put(ctx, m.Key, nm.ContentType, bytes.NewReader(nm.Content))
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("Error storing media")
+			return nil, ErrCouldNotAttachMedia
+		}
+		m.URL = h.blobs.URL(m.Key)
+	}
+
+	logging.Ctx(ctx).Debug().Str("media_id", m.MediaID).Msg("Attaching media")
+
+	av, err := dynamodbattribute.MarshalMap(m)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error marshaling media")
+		return nil, ErrCouldNotAttachMedia
+	}
+
+	_, err = h.svc.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		ExpressionAttributeNames: map[string]*string{
+			"#m": aws.String("media"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":m":     {L: []*dynamodb.AttributeValue{{M: av}}},
+			":empty": {L: []*dynamodb.AttributeValue{}},
+		},
+		Key: map[string]*dynamodb.AttributeValue{
+			"pk": {S: aws.String(getItemPK(nm.ItemID))},
+			"sk": {S: aws.String(getItemPK(nm.ItemID))},
+		},
+		TableName:           aws.String(h.tableName),
+		UpdateExpression:    aws.String("SET #m = list_append(if_not_exists(#m, :empty), :m)"),
+		ConditionExpression: aws.String("attribute_exists(pk) and attribute_exists(sk)"),
+	})
+	if err != nil {
+		//The image is not referenced by any item
+		if m.Key != "" {
+			h.blobs.Delete(ctx, m.Key)
+		}
+
+		if isConditionalCheckFailed(err) {
+			return nil, ErrItemNotFound
+		}
+		logging.Ctx(ctx).Error().Err(err).Msg("Error attaching media")
+		return nil, ErrCouldNotAttachMedia
+	}
+
+	logging.Ctx(ctx).Info().Str("media_id", m.MediaID).Msg("Media attached")
+
+	return h.reload(ctx, nm.ItemID)
+}
+
+//ReorderMedia sets the display order of the media of the item
+func (h *Handler) ReorderMedia(ctx context.Context, rm *ReorderMediaInfo) (
+	_ *Item, err error) {
+
+	ctx, span := tracing.Start(ctx, "item.ReorderMedia")
+	defer func() { span.End(err) }()
+
+	ctx = logging.WithItem(ctx, rm.ItemID)
+
+	if err := validate.Struct(rm); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error validating struct")
+		return nil, getValidationError(err)
+	}
+
+	i, err := h.Get(ctx, rm.ItemID)
+	if err != nil {
+		return nil, err
+	}
+
+	current := map[string]Media{}
+	for _, m := range i.Media {
+		current[m.MediaID] = m
+	}
+
+	if len(rm.MediaIDs) != len(i.Media) {
+		return nil, errors.New(ErrMediaIDsAreInvalid)
+	}
+
+	media := make([]Media, 0, len(rm.MediaIDs))
+	for _, mediaID := range rm.MediaIDs {
+		m, ok := current[mediaID]
+		if !ok {
+			return nil, errors.New(ErrMediaIDsAreInvalid)
+		}
+		media = append(media, m)
+	}
+
+	av, err := dynamodbattribute.Marshal(media)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error marshaling media")
+		return nil, ErrCouldNotReorderMedia
+	}
+
+	logging.Ctx(ctx).Debug().Msg("Reordering media")
+
+	//The size condition fails if media was attached after loading the item
+	_, err = h.svc.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		ExpressionAttributeNames: map[string]*string{
+			"#m": aws.String("media"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":m": av,
+			":n": {N: aws.String(strconv.Itoa(len(media)))},
+		},
+		Key: map[string]*dynamodb.AttributeValue{
+			"pk": {S: aws.String(getItemPK(rm.ItemID))},
+			"sk": {S: aws.String(getItemPK(rm.ItemID))},
+		},
+		TableName:           aws.String(h.tableName),
+		UpdateExpression:    aws.String("SET #m = :m"),
+		ConditionExpression: aws.String("attribute_exists(pk) and size(#m) = :n"),
+	})
+	if err != nil {
+		if isConditionalCheckFailed(err) {
+			return nil, errors.New(ErrMediaIDsAreInvalid)
+		}
+		logging.Ctx(ctx).Error().Err(err).Msg("Error reordering media")
+		return nil, ErrCouldNotReorderMedia
+	}
+
+	logging.Ctx(ctx).Info().Msg("Media reordered")
+
+	return h.reload(ctx, rm.ItemID)
+}
+
+//reload loads the item after a write and notifies the indexers
+func (h *Handler) reload(ctx context.Context, itemID string) (*Item, error) {
+
+	i, err := h.Get(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, indexer := range h.indexers {
+		indexer.Put(*i)
+	}
+
+	return i, nil
+}
+
+//isConditionalCheckFailed returns true if the condition expression of a
+//write failed
+func isConditionalCheckFailed(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
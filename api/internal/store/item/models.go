@@ -1,10 +1,136 @@
 package item
 
+import "time"
+
 //Item contains the information of an item
+//Price is the price effective at read time. While a sale is active,
+//RegularPrice contains the price without the sale and SaleEndsAt its end
 type Item struct {
-	ItemID      string  `json:"item_id"`
-	Description string  `json:"description"`
-	Price       float32 `json:"price"`
+	ItemID       string     `json:"item_id"`
+	Description  string     `json:"description"`
+	Price        float32    `json:"price"`
+	RegularPrice float32    `json:"regular_price,omitempty"`
+	SaleEndsAt   *time.Time `json:"sale_ends_at,omitempty"`
+
+	//MaxQuantity is the maximum quantity of the item in a cart line. Zero
+	//means the item only has the limits of the cart
+	MaxQuantity int `json:"max_quantity,omitempty"`
+
+	//Attributes are searchable properties of the item, e.g. brand or color
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	//Dimensions are the properties in which the variants of the item differ
+	Dimensions []Dimension `json:"dimensions,omitempty"`
+
+	//Variants contains the purchasable versions of the item
+	Variants []Variant `json:"variants,omitempty"`
+
+	//Media contains the images of the item in display order
+	Media []Media `json:"media,omitempty"`
+}
+
+//PriceOf returns the price of the variant with the SKU, or the price of the
+//item if the SKU is empty. It returns false if the item has no such variant
+func (i *Item) PriceOf(sku string) (float32, bool) {
+	if sku == "" {
+		return i.Price, true
+	}
+	for _, v := range i.Variants {
+		if v.SKU == sku {
+			return v.Price, true
+		}
+	}
+	return 0, false
+}
+
+//Dimension is a property in which the variants of an item differ, e.g. size
+//or color, along with all its possible values
+type Dimension struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+//Variant is a purchasable version of an item, identified by its SKU. Options
+//contains the value of every dimension for this variant
+type Variant struct {
+	SKU     string            `json:"sku"`
+	Options map[string]string `json:"options"`
+	Price   float32           `json:"price"`
+	Stock   int               `json:"stock"`
+
+	//MaxQuantity is the maximum quantity of the variant in a cart line
+	MaxQuantity int `json:"max_quantity,omitempty"`
+}
+
+//Media contains the information of an image of the item.
+//Key is set when the image is saved in the blob store, while URL is always
+//set, so clients can download the image
+type Media struct {
+	MediaID string `json:"media_id"`
+	Key     string `json:"key,omitempty"`
+	URL     string `json:"url"`
+	Alt     string `json:"alt"`
+	Width   int    `json:"width,omitempty"`
+	Height  int    `json:"height,omitempty"`
+	Role    string `json:"role"`
+}
+
+//NewMediaInfo contains the information of an image attached to an item.
+//The image is either hosted elsewhere, URL, or uploaded, Content, in which
+//case it is saved in the blob store. Content is base64 encoded in JSON
+type NewMediaInfo struct {
+	ItemID      string `json:"item_id" validate:"required"`
+	URL         string `json:"url" validate:"required_without=Content,omitempty,url"`
+	Content     []byte `json:"content" validate:"required_without=URL"`
+	ContentType string `json:"content_type" validate:"required_with=Content"`
+	Alt         string `json:"alt" validate:"required"`
+	Width       int    `json:"width" validate:"gte=0"`
+	Height      int    `json:"height" validate:"gte=0"`
+	Role        string `json:"role" validate:"required,oneof=thumbnail gallery"`
+}
+
+//ReorderMediaInfo contains the new display order of the media of an item.
+//MediaIDs must contain every media of the item exactly once
+type ReorderMediaInfo struct {
+	ItemID   string   `json:"item_id" validate:"required"`
+	MediaIDs []string `json:"media_ids" validate:"required,unique"`
+}
+
+//Price is a price of an item effective from a date. A price with an end date
+//is a sale price, which takes precedence over the regular prices while the
+//sale is active
+type Price struct {
+	Price         float32    `json:"price"`
+	EffectiveFrom time.Time  `json:"effective_from"`
+	EffectiveTo   *time.Time `json:"effective_to,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+//NewPriceInfo contains the information of a price change. When
+//EffectiveFrom is not set the price is effective immediately. When
+//EffectiveTo is set, it is a sale price
+type NewPriceInfo struct {
+	ItemID        string     `json:"item_id" validate:"required"`
+	Price         float32    `json:"price" validate:"required,gt=0"`
+	EffectiveFrom *time.Time `json:"effective_from"`
+	EffectiveTo   *time.Time `json:"effective_to"`
+}
+
+//PriceKey identifies an item, or one of its variants when SKU is set, whose
+//current price is requested
+type PriceKey struct {
+	ItemID string
+	SKU    string
+}
+
+//PriceHistory contains the current price of an item along with all its
+//past and scheduled prices, the most recent first
+type PriceHistory struct {
+	ItemID       string     `json:"item_id"`
+	Price        float32    `json:"price"`
+	RegularPrice float32    `json:"regular_price,omitempty"`
+	SaleEndsAt   *time.Time `json:"sale_ends_at,omitempty"`
+	Prices       []Price    `json:"prices"`
 }
 
 //List contains a list of items
@@ -0,0 +1,422 @@
+package item
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	saws "github.com/roloum/store/api/internal/aws"
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/roloum/store/api/internal/tracing"
+)
+
+const (
+	//DynamoDBPrefixPrice Prefix for the sort key of a price of an item
+	DynamoDBPrefixPrice = "PRICE#"
+
+	//priceTimeFormat format of the dates in the sort key of the price rows.
+	//It sorts lexicographically in chronological order
+	priceTimeFormat = "2006-01-02T15:04:05.000Z"
+
+	//batchGetLimit maximum number of keys in a BatchGetItem call
+	batchGetLimit = 100
+
+	//maxReadAttempts maximum number of BatchGetItem calls for a chunk,
+	//including the retries of the unprocessed keys
+	maxReadAttempts = 8
+
+	//retryBaseDelay delay before the first retry of the unprocessed keys.
+	//It doubles with every attempt
+	retryBaseDelay = 50 * time.Millisecond
+)
+
+var (
+	//ErrCouldNotSchedulePrice error returned if we failed to save the price
+	ErrCouldNotSchedulePrice = errors.New("CouldNotSchedulePrice")
+
+	//ErrCouldNotLoadPrices error returned if we failed to load the prices
+	ErrCouldNotLoadPrices = errors.New("CouldNotLoadPrices")
+
+	//ErrUnprocessedKeys error returned if some keys were still unprocessed
+	//after every retry
+	ErrUnprocessedKeys = errors.New("UnprocessedKeys")
+)
+
+//SchedulePrice stores a new price of the item. The price is stored in its
+//own PRICE# row under the item partition, so the history is never lost, and
+//the effective price is resolved when the item is read. The price is also
+//appended to the copy of the prices in the item row
+func (h *Handler) SchedulePrice(ctx context.Context, np *NewPriceInfo) (
+	_ *PriceHistory, err error) {
+
+	ctx, span := tracing.Start(ctx, "item.SchedulePrice")
+	defer func() { span.End(err) }()
+
+	ctx = logging.WithItem(ctx, np.ItemID)
+
+	if err := validate.Struct(np); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error validating struct")
+		return nil, getValidationError(err)
+	}
+
+	now := time.Now().UTC()
+
+	from := now
+	if np.EffectiveFrom != nil {
+		from = np.EffectiveFrom.UTC()
+
+		//Prices can not be changed retroactively
+		if from.Before(now.Add(-time.Minute)) {
+			return nil, errors.New(ErrEffectiveFromIsInThePast)
+		}
+	}
+
+	if np.EffectiveTo != nil && !np.EffectiveTo.After(from) {
+		return nil, errors.New(ErrEffectiveToIsInvalid)
+	}
+
+	price := Price{Price: np.Price, EffectiveFrom: from, CreatedAt: now}
+	if np.EffectiveTo != nil {
+		to := np.EffectiveTo.UTC()
+		price.EffectiveTo = &to
+	}
+
+	row, err := PriceRow(np.ItemID, price)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error marshaling price")
+		return nil, ErrCouldNotSchedulePrice
+	}
+	set, values, err := PriceAppend(price)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error marshaling price")
+		return nil, ErrCouldNotSchedulePrice
+	}
+
+	logging.Ctx(ctx).Debug().
+		Float32("price", np.Price).
+		Time("effective_from", from).
+		Msg("Scheduling price")
+
+	//The PRICE# row and its copy in the item row are written together. The
+	//condition on the item row fails if the item does not exist
+	_, err = h.svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					Item:                row,
+					TableName:           aws.String(h.tableName),
+					ConditionExpression: aws.String("attribute_not_exists(pk) and attribute_not_exists(sk)"),
+				},
+			},
+			{
+				Update: &dynamodb.Update{
+					Key: map[string]*dynamodb.AttributeValue{
+						"pk": {S: aws.String(getItemPK(np.ItemID))},
+						"sk": {S: aws.String(getItemPK(np.ItemID))},
+					},
+					ExpressionAttributeValues: values,
+					UpdateExpression:          aws.String("SET " + set),
+					ConditionExpression:       aws.String("attribute_exists(pk)"),
+					TableName:                 aws.String(h.tableName),
+				},
+			},
+		},
+	})
+	if err != nil {
+		failed := dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed
+		if saws.IsErrorOfType(err, failed, 1) {
+			return nil, ErrItemNotFound
+		}
+		if saws.IsErrorOfType(err, failed, 0) {
+			return nil, errors.New(ErrEffectiveFromIsDuplicated)
+		}
+		logging.Ctx(ctx).Error().Err(err).Msg("Error scheduling price")
+		return nil, ErrCouldNotSchedulePrice
+	}
+
+	logging.Ctx(ctx).Info().
+		Float32("price", np.Price).
+		Time("effective_from", from).
+		Msg("Price scheduled")
+
+	//Notify the indexers if the price is already effective
+	if _, err := h.reload(ctx, np.ItemID); err != nil {
+		return nil, err
+	}
+
+	return h.Prices(ctx, np.ItemID)
+}
+
+//PriceRow returns the PRICE# row of a price of the item
+func PriceRow(itemID string, p Price) (map[string]*dynamodb.AttributeValue, error) {
+
+	row, err := dynamodbattribute.MarshalMap(p)
+	if err != nil {
+		return nil, err
+	}
+	row["pk"] = &dynamodb.AttributeValue{S: aws.String(getItemPK(itemID))}
+	row["sk"] = &dynamodb.AttributeValue{S: aws.String(PriceSK(p.EffectiveFrom))}
+	row["type"] = &dynamodb.AttributeValue{S: aws.String(DynamoDBRowTypePrice)}
+	row["item_id"] = &dynamodb.AttributeValue{S: aws.String(itemID)}
+
+	return row, nil
+}
+
+//PriceAppend returns the SET action, and its values, that appends the price
+//to the copy of the PRICE# rows in the item row. Every PRICE# row must be
+//written along with this action, so lists and carts can resolve the price of
+//an item from its row
+func PriceAppend(p Price) (string, map[string]*dynamodb.AttributeValue, error) {
+
+	price, err := dynamodbattribute.Marshal([]Price{p})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return fmt.Sprintf("%s = list_append(if_not_exists(%s, :noprices), :prices)",
+			DynamoDBAttributePrices, DynamoDBAttributePrices),
+		map[string]*dynamodb.AttributeValue{
+			":prices":   price,
+			":noprices": {L: []*dynamodb.AttributeValue{}},
+		}, nil
+}
+
+//CurrentPrices returns the price effective now of every item, or of its
+//variant when the key has a SKU. Keys whose item or variant is not in the
+//catalog are not in the result. The item rows, with the copy of their
+//prices, and the variant rows are read with BatchGetItem, so the prices of a
+//cart are resolved with one call per 100 rows
+func (h *Handler) CurrentPrices(ctx context.Context, keys []PriceKey) (
+	_ map[PriceKey]float32, err error) {
+
+	ctx, span := tracing.Start(ctx, "item.CurrentPrices")
+	defer func() { span.End(err) }()
+
+	var requested []map[string]*dynamodb.AttributeValue
+	seen := map[string]bool{}
+	request := func(pk, sk string) {
+		if seen[pk+sk] {
+			return
+		}
+		seen[pk+sk] = true
+		requested = append(requested, map[string]*dynamodb.AttributeValue{
+			"pk": {S: aws.String(pk)},
+			"sk": {S: aws.String(sk)},
+		})
+	}
+	for _, k := range keys {
+		request(getItemPK(k.ItemID), getItemPK(k.ItemID))
+		if k.SKU != "" {
+			request(getItemPK(k.ItemID), DynamoDBPrefixSKU+k.SKU)
+		}
+	}
+
+	logging.Ctx(ctx).Debug().Int("keys", len(requested)).Msg("Loading prices")
+
+	var found []map[string]*dynamodb.AttributeValue
+	for start := 0; start < len(requested); start += batchGetLimit {
+		end := start + batchGetLimit
+		if end > len(requested) {
+			end = len(requested)
+		}
+
+		rows, err := h.batchGet(ctx, requested[start:end])
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("Error loading prices")
+			return nil, ErrCouldNotLoadPrices
+		}
+		found = append(found, rows...)
+	}
+
+	rows, err := unmarshalRows(found)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error Unmarshaling prices")
+		return nil, ErrCouldNotLoadPrices
+	}
+
+	items := map[string]*Item{}
+	resolved := rows.resolve(time.Now())
+	for n := range resolved {
+		items[resolved[n].ItemID] = &resolved[n]
+	}
+
+	prices := map[PriceKey]float32{}
+	for _, k := range keys {
+		i, ok := items[k.ItemID]
+		if !ok {
+			continue
+		}
+		if price, ok := i.PriceOf(k.SKU); ok {
+			prices[k] = price
+		}
+	}
+
+	return prices, nil
+}
+
+//batchGet reads a chunk of keys, retrying the unprocessed keys with
+//exponential backoff
+func (h *Handler) batchGet(ctx context.Context,
+	keys []map[string]*dynamodb.AttributeValue) (
+	[]map[string]*dynamodb.AttributeValue, error) {
+
+	var rows []map[string]*dynamodb.AttributeValue
+	pending := map[string]*dynamodb.KeysAndAttributes{
+		h.tableName: {
+			Keys: keys,
+			ExpressionAttributeNames: map[string]*string{
+				"#t": aws.String("type"),
+			},
+			ProjectionExpression: aws.String(fmt.Sprintf(
+				"#t,item_id,sku,price,%s", DynamoDBAttributePrices)),
+		},
+	}
+
+	for attempt := 0; attempt < maxReadAttempts; attempt++ {
+
+		if attempt > 0 {
+			delay := retryBaseDelay * time.Duration(1<<uint(attempt-1))
+			logging.Ctx(ctx).Debug().Int("keys", len(pending[h.tableName].Keys)).
+				Dur("delay", delay).Msg("Retrying unprocessed keys")
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		result, err := h.svc.BatchGetItemWithContext(ctx,
+			&dynamodb.BatchGetItemInput{RequestItems: pending})
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, result.Responses[h.tableName]...)
+
+		if result.UnprocessedKeys[h.tableName] == nil ||
+			len(result.UnprocessedKeys[h.tableName].Keys) == 0 {
+			return rows, nil
+		}
+		pending = result.UnprocessedKeys
+	}
+
+	return nil, ErrUnprocessedKeys
+}
+
+//Prices returns the current price of the item along with its past and
+//scheduled prices
+func (h *Handler) Prices(ctx context.Context, itemID string) (_ *PriceHistory,
+	err error) {
+
+	ctx, span := tracing.Start(ctx, "item.Prices")
+	defer func() { span.End(err) }()
+
+	if itemID == "" {
+		return nil, ErrItemIDIsEmpty
+	}
+
+	ctx = logging.WithItem(ctx, itemID)
+	logging.Ctx(ctx).Debug().Msg("Loading prices")
+
+	result, err := h.svc.QueryWithContext(ctx, &dynamodb.QueryInput{
+		KeyConditions: map[string]*dynamodb.Condition{
+			"pk": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodb.AttributeValue{
+					{S: aws.String(getItemPK(itemID))},
+				},
+			},
+		},
+		TableName: aws.String(h.tableName),
+	})
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error loading prices")
+		return nil, ErrCouldNotLoadPrices
+	}
+
+	rows, err := unmarshalRows(result.Items)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error Unmarshaling prices")
+		return nil, ErrCouldNotLoadPrices
+	}
+
+	items := rows.resolve(time.Now())
+	if len(items) == 0 {
+		return nil, ErrItemNotFound
+	}
+
+	prices := rows.prices[itemID]
+	if prices == nil {
+		prices = []Price{}
+	}
+	sort.Slice(prices, func(a, b int) bool {
+		return prices[a].EffectiveFrom.After(prices[b].EffectiveFrom)
+	})
+
+	return &PriceHistory{
+		ItemID:       itemID,
+		Price:        items[0].Price,
+		RegularPrice: items[0].RegularPrice,
+		SaleEndsAt:   items[0].SaleEndsAt,
+		Prices:       prices,
+	}, nil
+}
+
+//applyPrices sets the price of the item effective at t. The regular price is
+//the latest price without end date that is already effective, or the price of
+//the item row if there is none. An active sale takes precedence over it
+func (i *Item) applyPrices(prices []Price, t time.Time) {
+
+	i.Price = RegularPrice(i.Price, prices, t)
+
+	var sale *Price
+	for n := range prices {
+		p := &prices[n]
+
+		if p.EffectiveFrom.After(t) || p.EffectiveTo == nil {
+			continue
+		}
+
+		if p.EffectiveTo.After(t) &&
+			(sale == nil || p.EffectiveFrom.After(sale.EffectiveFrom)) {
+			sale = p
+		}
+	}
+
+	if sale != nil {
+		i.RegularPrice = i.Price
+		i.Price = sale.Price
+		i.SaleEndsAt = sale.EffectiveTo
+	}
+}
+
+//RegularPrice returns the regular price effective at t, the latest price
+//without end date that is already effective, or base if there is none
+func RegularPrice(base float32, prices []Price, t time.Time) float32 {
+
+	var regular *Price
+	for n := range prices {
+		p := &prices[n]
+		if p.EffectiveFrom.After(t) || p.EffectiveTo != nil {
+			continue
+		}
+		if regular == nil || p.EffectiveFrom.After(regular.EffectiveFrom) {
+			regular = p
+		}
+	}
+
+	if regular == nil {
+		return base
+	}
+	return regular.Price
+}
+
+//PriceSK returns the sort key of a price effective from t
+func PriceSK(t time.Time) string {
+	return fmt.Sprintf("%s%s", DynamoDBPrefixPrice, t.UTC().Format(priceTimeFormat))
+}
@@ -0,0 +1,367 @@
+package item
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/roloum/store/api/internal/test"
+)
+
+//pages is a DynamoDB client that returns the items of the category in pages
+//of one item. Queries of the partition of an item fail, the prices are read
+//from the item rows
+type pages struct {
+	dynamodbiface.DynamoDBAPI
+	items []map[string]*dynamodb.AttributeValue
+}
+
+//QueryWithContext returns a page of the items
+func (p *pages) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput,
+	opts ...request.Option) (*dynamodb.QueryOutput, error) {
+
+	if input.IndexName == nil {
+		return nil, errors.New("UnexpectedQuery")
+	}
+
+	n := 0
+	if input.ExclusiveStartKey != nil {
+		n, _ = strconv.Atoi(aws.StringValue(input.ExclusiveStartKey["n"].N))
+		n++
+	}
+	out := &dynamodb.QueryOutput{Items: p.items[n : n+1]}
+	if n+1 < len(p.items) {
+		out.LastEvaluatedKey = map[string]*dynamodb.AttributeValue{
+			"n": {N: aws.String(strconv.Itoa(n))},
+		}
+	}
+	return out, nil
+}
+
+//TestApplyPrices tests the resolution of the effective price of an item
+func TestApplyPrices(t *testing.T) {
+
+	now := time.Date(2021, 3, 15, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		desc    string
+		prices  []Price
+		price   float32
+		regular float32
+		saleEnd *time.Time
+	}{
+		{
+			desc:  "ItemPrice",
+			price: 10,
+		},
+		{
+			desc: "RegularPrice",
+			prices: []Price{
+				{Price: 12, EffectiveFrom: now.Add(-2 * day)},
+				{Price: 11, EffectiveFrom: now.Add(-day)},
+			},
+			price: 11,
+		},
+		{
+			desc: "ScheduledPrice",
+			prices: []Price{
+				{Price: 11, EffectiveFrom: now.Add(-day)},
+				{Price: 15, EffectiveFrom: now.Add(day)},
+			},
+			price: 11,
+		},
+		{
+			desc: "ActiveSale",
+			prices: []Price{
+				{Price: 11, EffectiveFrom: now.Add(-2 * day)},
+				{Price: 8, EffectiveFrom: now.Add(-day), EffectiveTo: at(day)},
+				{Price: 12, EffectiveFrom: now.Add(-time.Hour)},
+			},
+			price:   8,
+			regular: 12,
+			saleEnd: at(day),
+		},
+		{
+			desc: "EndedSale",
+			prices: []Price{
+				{Price: 8, EffectiveFrom: now.Add(-2 * day), EffectiveTo: at(-day)},
+			},
+			price: 10,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			i := Item{Price: 10}
+			i.applyPrices(tc.prices, now)
+
+			if i.Price != tc.price || i.RegularPrice != tc.regular {
+				t.Errorf("Expected: %v/%v. Received: %v/%v", tc.price, tc.regular,
+					i.Price, i.RegularPrice)
+			}
+			if (i.SaleEndsAt == nil) != (tc.saleEnd == nil) ||
+				(i.SaleEndsAt != nil && !i.SaleEndsAt.Equal(*tc.saleEnd)) {
+				t.Errorf("Expected sale end: %v. Received: %v", tc.saleEnd,
+					i.SaleEndsAt)
+			}
+		})
+	}
+}
+
+//scans is a DynamoDB client that returns the item rows of a scan of the
+//category GSI, and fails the scans of the table
+type scans struct {
+	dynamodbiface.DynamoDBAPI
+	items []map[string]*dynamodb.AttributeValue
+}
+
+//ScanWithContext returns the item rows of the GSI
+func (s *scans) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput,
+	opts ...request.Option) (*dynamodb.ScanOutput, error) {
+
+	if aws.StringValue(input.IndexName) != "gsi1pk" {
+		return nil, errors.New("UnexpectedScan")
+	}
+	return &dynamodb.ScanOutput{Items: s.items}, nil
+}
+
+//TestAll tests that every item is read from the category GSI with the copy
+//of its prices
+func TestAll(t *testing.T) {
+
+	_, prices, err := PriceAppend(Price{Price: 8, EffectiveFrom: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &scans{items: []map[string]*dynamodb.AttributeValue{{
+		"type":                  {S: aws.String(DynamoDBRowTypeItem)},
+		"item_id":               {S: aws.String("1")},
+		"price":                 {N: aws.String("10")},
+		DynamoDBAttributePrices: prices[":prices"],
+	}}}
+	h, _ := New(svc, "Store")
+
+	items, err := h.All(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Price != 8 {
+		t.Errorf("Unexpected items: %+v", items)
+	}
+}
+
+//TestList tests that List loads every page of the category and resolves the
+//prices with the copy in the item rows
+func TestList(t *testing.T) {
+
+	item := func(itemID string, prices ...Price) map[string]*dynamodb.AttributeValue {
+		row := map[string]*dynamodb.AttributeValue{
+			"type":        {S: aws.String(DynamoDBRowTypeItem)},
+			"item_id":     {S: aws.String(itemID)},
+			"description": {S: aws.String("Item " + itemID)},
+			"price":       {N: aws.String("10")},
+		}
+		if len(prices) > 0 {
+			_, values, err := PriceAppend(prices[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			row[DynamoDBAttributePrices] = values[":prices"]
+		}
+		return row
+	}
+	svc := &pages{
+		items: []map[string]*dynamodb.AttributeValue{
+			item("1"),
+			item("2", Price{Price: 8, EffectiveFrom: time.Now().Add(-24 * time.Hour)}),
+		},
+	}
+	h, err := New(svc, "Store")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := h.List(context.Background(), "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Items) != 2 || l.Items[0].Price != 10 || l.Items[1].Price != 8 {
+		t.Errorf("Unexpected items: %+v", l.Items)
+	}
+}
+
+//transactions is a DynamoDB client that records the transactions, which
+//fail with err, and returns the rows of an item for every query
+type transactions struct {
+	test.MockDynamoDB
+	actions [][]*dynamodb.TransactWriteItem
+	err     error
+}
+
+//TransactWriteItemsWithContext records the actions of the transaction
+func (tr *transactions) TransactWriteItemsWithContext(ctx aws.Context,
+	input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (
+	*dynamodb.TransactWriteItemsOutput, error) {
+
+	tr.actions = append(tr.actions, input.TransactItems)
+	return &dynamodb.TransactWriteItemsOutput{}, tr.err
+}
+
+//TestSchedulePrice tests that the price row is written along with its copy
+//in the item row and that the failed conditions are mapped to their errors
+func TestSchedulePrice(t *testing.T) {
+
+	//canceled returns the error of a transaction whose action at idx failed
+	canceled := func(idx int) error {
+		reasons := []*dynamodb.CancellationReason{
+			{Code: aws.String("None")}, {Code: aws.String("None")},
+		}
+		reasons[idx].Code = aws.String(dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed)
+		return &dynamodb.TransactionCanceledException{CancellationReasons: reasons}
+	}
+
+	tests := []struct {
+		desc string
+		err  error
+		exp  error
+	}{
+		{"Success", nil, nil},
+		{ErrItemNotFound.Error(), canceled(1), ErrItemNotFound},
+		{ErrEffectiveFromIsDuplicated, canceled(0), errors.New(ErrEffectiveFromIsDuplicated)},
+		{ErrCouldNotSchedulePrice.Error(), errors.New("InternalServerError"),
+			ErrCouldNotSchedulePrice},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc := &transactions{
+				MockDynamoDB: test.MockDynamoDB{
+					QueryOutput: &dynamodb.QueryOutput{
+						Items: []map[string]*dynamodb.AttributeValue{{
+							"type":    {S: aws.String(DynamoDBRowTypeItem)},
+							"item_id": {S: aws.String("1")},
+							"price":   {N: aws.String("10")},
+						}},
+					},
+				},
+				err: tc.err,
+			}
+			h, _ := New(svc, "Store")
+
+			_, err := h.SchedulePrice(context.Background(),
+				&NewPriceInfo{ItemID: "1", Price: 8})
+			if !reflect.DeepEqual(err, tc.exp) {
+				t.Fatalf("Expected: %v. Received: %v", tc.exp, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(svc.actions) != 1 || len(svc.actions[0]) != 2 {
+				t.Fatalf("Expected 1 transaction of 2 actions. Received: %v", svc.actions)
+			}
+			put, update := svc.actions[0][0].Put, svc.actions[0][1].Update
+			if put == nil || aws.StringValue(put.Item["type"].S) != DynamoDBRowTypePrice {
+				t.Errorf("Expected the put of the price row. Received: %v", put)
+			}
+			if update == nil || !strings.Contains(aws.StringValue(update.UpdateExpression),
+				"list_append") {
+				t.Errorf("Expected the copy of the price in the item row. Received: %v",
+					update)
+			}
+		})
+	}
+}
+
+//batches is a DynamoDB client that returns the rows of the requested keys and
+//leaves the last key of the first call unprocessed
+type batches struct {
+	dynamodbiface.DynamoDBAPI
+	rows  map[string]map[string]*dynamodb.AttributeValue
+	calls []int
+}
+
+//BatchGetItemWithContext returns the rows of the keys
+func (b *batches) BatchGetItemWithContext(ctx aws.Context,
+	input *dynamodb.BatchGetItemInput, opts ...request.Option) (
+	*dynamodb.BatchGetItemOutput, error) {
+
+	ka := input.RequestItems["Store"]
+	keys := ka.Keys
+	b.calls = append(b.calls, len(keys))
+
+	out := &dynamodb.BatchGetItemOutput{}
+	if len(b.calls) == 1 {
+		out.UnprocessedKeys = map[string]*dynamodb.KeysAndAttributes{
+			"Store": {Keys: keys[len(keys)-1:], ProjectionExpression: ka.ProjectionExpression,
+				ExpressionAttributeNames: ka.ExpressionAttributeNames},
+		}
+		keys = keys[:len(keys)-1]
+	}
+
+	out.Responses = map[string][]map[string]*dynamodb.AttributeValue{}
+	for _, k := range keys {
+		if row, ok := b.rows[aws.StringValue(k["pk"].S)+aws.StringValue(k["sk"].S)]; ok {
+			out.Responses["Store"] = append(out.Responses["Store"], row)
+		}
+	}
+	return out, nil
+}
+
+//TestCurrentPrices tests that the prices are read in chunks of keys, that the
+//unprocessed keys are read again and that the missing items and variants are
+//not in the result
+func TestCurrentPrices(t *testing.T) {
+
+	svc := &batches{rows: map[string]map[string]*dynamodb.AttributeValue{}}
+
+	var keys []PriceKey
+	for n := 0; n < 120; n++ {
+		itemID := strconv.Itoa(n)
+		svc.rows[getItemPK(itemID)+getItemPK(itemID)] = map[string]*dynamodb.AttributeValue{
+			"type":    {S: aws.String(DynamoDBRowTypeItem)},
+			"item_id": {S: aws.String(itemID)},
+			"price":   {N: aws.String(itemID)},
+		}
+		keys = append(keys, PriceKey{ItemID: itemID})
+	}
+	svc.rows[getItemPK("0")+DynamoDBPrefixSKU+"S1"] = map[string]*dynamodb.AttributeValue{
+		"type":    {S: aws.String(DynamoDBRowTypeVariant)},
+		"item_id": {S: aws.String("0")},
+		"sku":     {S: aws.String("S1")},
+		"price":   {N: aws.String("5")},
+	}
+	keys = append(keys, PriceKey{ItemID: "0", SKU: "S1"}, PriceKey{ItemID: "0", SKU: "S2"},
+		PriceKey{ItemID: "missing"})
+
+	h, _ := New(svc, "Store")
+	prices, err := h.CurrentPrices(context.Background(), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//123 keys: 100, the retry of the unprocessed key, and 23
+	if !reflect.DeepEqual(svc.calls, []int{100, 1, 23}) {
+		t.Errorf("Expected calls: [100 1 23]. Received: %v", svc.calls)
+	}
+	if len(prices) != 121 || prices[PriceKey{ItemID: "99"}] != 99 ||
+		prices[PriceKey{ItemID: "0", SKU: "S1"}] != 5 {
+		t.Errorf("Unexpected prices: %v", prices)
+	}
+	if _, ok := prices[PriceKey{ItemID: "0", SKU: "S2"}]; ok {
+		t.Errorf("Expected the missing variant to be excluded")
+	}
+}
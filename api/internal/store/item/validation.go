@@ -0,0 +1,95 @@
+package item
+
+import (
+	"errors"
+
+	validator "github.com/go-playground/validator/v10"
+)
+
+const (
+	//MediaRoleThumbnail role of the image displayed in lists of items
+	MediaRoleThumbnail = "thumbnail"
+
+	//MediaRoleGallery role of the images displayed in the item page
+	MediaRoleGallery = "gallery"
+
+	//ErrMediaSourceIsEmpty Error describes when neither URL nor Content is set
+	ErrMediaSourceIsEmpty = "MediaSourceIsEmpty"
+
+	//ErrMediaURLIsInvalid Error describes when the URL of the media is invalid
+	ErrMediaURLIsInvalid = "MediaURLIsInvalid"
+
+	//ErrContentTypeIsEmpty Error describes when Content is set without type
+	ErrContentTypeIsEmpty = "ContentTypeIsEmpty"
+
+	//ErrAltIsEmpty Error describes when the alternative text is empty
+	ErrAltIsEmpty = "AltIsEmpty"
+
+	//ErrMediaSizeIsInvalid Error describes when width or height are negative
+	ErrMediaSizeIsInvalid = "MediaSizeIsInvalid"
+
+	//ErrMediaRoleIsInvalid Error describes when the role is not supported
+	ErrMediaRoleIsInvalid = "MediaRoleIsInvalid"
+
+	//ErrMediaIDsAreInvalid Error describes when the list of media IDs is
+	//empty or contains duplicates
+	ErrMediaIDsAreInvalid = "MediaIDsAreInvalid"
+
+	//ErrPriceIsEmpty Error describes when price is empty
+	ErrPriceIsEmpty = "PriceIsEmpty"
+
+	//ErrPriceIsInvalid Error describes when price is not a positive number
+	ErrPriceIsInvalid = "PriceIsInvalid"
+
+	//ErrEffectiveFromIsInThePast Error describes when a price change is
+	//scheduled in the past
+	ErrEffectiveFromIsInThePast = "EffectiveFromIsInThePast"
+
+	//ErrEffectiveFromIsDuplicated Error describes when there is already a
+	//price effective from the same date
+	ErrEffectiveFromIsDuplicated = "EffectiveFromIsDuplicated"
+
+	//ErrEffectiveToIsInvalid Error describes when the end of a sale is not
+	//after its start
+	ErrEffectiveToIsInvalid = "EffectiveToIsInvalid"
+)
+
+var validate *validator.Validate
+
+//init instantiates a validator
+func init() {
+	validate = validator.New()
+}
+
+//getValidationError Returns the first error reported by the validator
+func getValidationError(verr error) error {
+
+	//Retrieve first error
+	err := verr.(validator.ValidationErrors)[0]
+
+	switch err.Field() {
+	case "ItemID":
+		return ErrItemIDIsEmpty
+	case "URL", "Content":
+		if err.Tag() == "url" {
+			return errors.New(ErrMediaURLIsInvalid)
+		}
+		return errors.New(ErrMediaSourceIsEmpty)
+	case "ContentType":
+		return errors.New(ErrContentTypeIsEmpty)
+	case "Alt":
+		return errors.New(ErrAltIsEmpty)
+	case "Width", "Height":
+		return errors.New(ErrMediaSizeIsInvalid)
+	case "Role":
+		return errors.New(ErrMediaRoleIsInvalid)
+	case "MediaIDs":
+		return errors.New(ErrMediaIDsAreInvalid)
+	case "Price":
+		if err.Tag() == "required" {
+			return errors.New(ErrPriceIsEmpty)
+		}
+		return errors.New(ErrPriceIsInvalid)
+	}
+	return nil
+}
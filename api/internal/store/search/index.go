@@ -0,0 +1,250 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/roloum/store/api/internal/store/item"
+)
+
+const (
+	//weightDescription is the weight of a term found in the item's description
+	weightDescription = 2.0
+
+	//weightAttribute is the weight of a term found in the item's attributes
+	weightAttribute = 1.0
+
+	//weightPrefix is applied to the score of a term that only matches by prefix
+	weightPrefix = 0.5
+)
+
+//Index is an in-memory inverted index of the catalog. It maps every term found
+//in the description and attributes of an item to the items containing it.
+//It is safe for concurrent use
+type Index struct {
+	mu sync.RWMutex
+
+	//items contains the indexed items by itemID
+	items map[string]item.Item
+
+	//postings maps a term to the weighted frequency of the term per itemID
+	postings map[string]map[string]float64
+
+	//terms is the sorted vocabulary used for prefix matching, it is rebuilt
+	//lazily after the index changes
+	terms []string
+
+	builtAt time.Time
+}
+
+//NewIndex returns an empty Index
+func NewIndex() *Index {
+	return &Index{
+		items:    map[string]item.Item{},
+		postings: map[string]map[string]float64{},
+	}
+}
+
+//Replace rebuilds the index with the list of items
+func (idx *Index) Replace(items []item.Item) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.items = map[string]item.Item{}
+	idx.postings = map[string]map[string]float64{}
+	idx.terms = nil
+
+	for _, i := range items {
+		idx.put(i)
+	}
+	idx.builtAt = time.Now()
+}
+
+//BuiltAt returns the time the index was last rebuilt with Replace.
+//It returns the zero time if the index has never been built
+func (idx *Index) BuiltAt() time.Time {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.builtAt
+}
+
+//Put adds an item to the index, replacing any previous version of it
+func (idx *Index) Put(i item.Item) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(i.ItemID)
+	idx.put(i)
+}
+
+//Search returns up to limit items matching every term of the query, sorted by
+//score. The last term of the query is matched as a prefix unless the query
+//ends with a space, so results can be displayed while the user is typing
+func (idx *Index) Search(query string, limit int) []Result {
+
+	tokens := tokenize(query)
+	if len(tokens) == 0 {
+		return []Result{}
+	}
+	prefix := !strings.HasSuffix(query, " ")
+
+	//The write lock is required because the vocabulary might be sorted
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.terms == nil {
+		idx.sortTerms()
+	}
+
+	var scores map[string]float64
+	for n, token := range tokens {
+		tokenScores := idx.score(token, prefix && n == len(tokens)-1)
+
+		//Every token of the query has to match the item
+		if scores == nil {
+			scores = tokenScores
+			continue
+		}
+		for itemID, score := range scores {
+			tokenScore, ok := tokenScores[itemID]
+			if !ok {
+				delete(scores, itemID)
+				continue
+			}
+			scores[itemID] = score + tokenScore
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for itemID, score := range scores {
+		results = append(results, Result{Item: idx.items[itemID], Score: score})
+	}
+
+	sort.Slice(results, func(a, b int) bool {
+		if results[a].Score != results[b].Score {
+			return results[a].Score > results[b].Score
+		}
+		return results[a].Description < results[b].Description
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
+
+//score returns the score of every item that contains the token. If prefix is
+//true, terms starting with the token also match, with a lower weight
+func (idx *Index) score(token string, prefix bool) map[string]float64 {
+
+	scores := map[string]float64{}
+
+	terms := []string{token}
+	if prefix {
+		terms = idx.termsWithPrefix(token)
+	}
+
+	for _, term := range terms {
+		postings, ok := idx.postings[term]
+		if !ok {
+			continue
+		}
+
+		//Rare terms are more relevant than common ones
+		idf := math.Log(1 + float64(len(idx.items))/float64(len(postings)))
+
+		weight := 1.0
+		if term != token {
+			weight = weightPrefix
+		}
+
+		for itemID, tf := range postings {
+			scores[itemID] += tf * idf * weight
+		}
+	}
+
+	return scores
+}
+
+//termsWithPrefix returns the terms of the vocabulary starting with prefix
+func (idx *Index) termsWithPrefix(prefix string) []string {
+	start := sort.SearchStrings(idx.terms, prefix)
+
+	var terms []string
+	for _, term := range idx.terms[start:] {
+		if !strings.HasPrefix(term, prefix) {
+			break
+		}
+		terms = append(terms, term)
+	}
+
+	return terms
+}
+
+//put indexes the description and attributes of the item.
+//The caller must hold the write lock
+func (idx *Index) put(i item.Item) {
+
+	idx.items[i.ItemID] = i
+
+	idx.addTerms(i.ItemID, i.Description, weightDescription)
+	for name, value := range i.Attributes {
+		idx.addTerms(i.ItemID, name, weightAttribute)
+		idx.addTerms(i.ItemID, value, weightAttribute)
+	}
+
+	idx.terms = nil
+}
+
+//remove deletes the item from the postings. The caller must hold the write lock
+func (idx *Index) remove(itemID string) {
+
+	if _, ok := idx.items[itemID]; !ok {
+		return
+	}
+	delete(idx.items, itemID)
+
+	for term, postings := range idx.postings {
+		delete(postings, itemID)
+		if len(postings) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+
+	idx.terms = nil
+}
+
+//addTerms adds the terms found in text to the postings of the item
+func (idx *Index) addTerms(itemID, text string, weight float64) {
+	for _, term := range tokenize(text) {
+		postings, ok := idx.postings[term]
+		if !ok {
+			postings = map[string]float64{}
+			idx.postings[term] = postings
+		}
+		postings[itemID] += weight
+	}
+}
+
+//sortTerms rebuilds the sorted vocabulary. The caller must hold the write lock
+func (idx *Index) sortTerms() {
+	idx.terms = make([]string, 0, len(idx.postings))
+	for term := range idx.postings {
+		idx.terms = append(idx.terms, term)
+	}
+	sort.Strings(idx.terms)
+}
+
+//tokenize splits the text in lower case terms, using any character that is
+//not a letter or a number as separator
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,125 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/roloum/store/api/internal/store/item"
+	"github.com/rs/zerolog"
+)
+
+type (
+	searchTest struct {
+		desc  string
+		query string
+		ids   []string
+	}
+
+	//mockCatalog returns a fixed list of items
+	mockCatalog struct {
+		items []item.Item
+		err   error
+	}
+)
+
+func init() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (m *mockCatalog) All(context.Context) ([]item.Item, error) {
+	return m.items, m.err
+}
+
+//TestSearch tests the matching and ranking of the index
+func TestSearch(t *testing.T) {
+
+	index := NewIndex()
+	index.Replace(getItems())
+
+	tests := []searchTest{
+		{desc: "Empty", query: " ", ids: []string{}},
+		{desc: "NoMatch", query: "keyboard ", ids: []string{}},
+		{desc: "CaseInsensitive", query: "PHONE ", ids: []string{"3", "2"}},
+		{desc: "Attribute", query: "wireless ", ids: []string{"4"}},
+		{desc: "AllTermsMatch", query: "phone charger ", ids: []string{"2"}},
+		{desc: "Prefix", query: "char", ids: []string{"2"}},
+		{desc: "PrefixOnlyLastTerm", query: "cha phone", ids: []string{}},
+		//The description has a higher weight than the attributes
+		{desc: "Ranking", query: "usb ", ids: []string{"1", "2"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ids := []string{}
+			for _, r := range index.Search(tc.query, 0) {
+				ids = append(ids, r.ItemID)
+			}
+			if !reflect.DeepEqual(ids, tc.ids) {
+				t.Errorf("Expected: %v. Received: %v", tc.ids, ids)
+			}
+		})
+	}
+}
+
+//TestPut tests that the index is kept up to date with item writes
+func TestPut(t *testing.T) {
+
+	index := NewIndex()
+	index.Replace(getItems())
+
+	index.Put(item.Item{ItemID: "2", Description: "Wall adapter"})
+	if r := index.Search("charger ", 0); len(r) != 0 {
+		t.Errorf("Expected no results after update. Received: %v", r)
+	}
+	if r := index.Search("adapter ", 0); len(r) != 1 {
+		t.Errorf("Expected 1 result after update. Received: %v", r)
+	}
+}
+
+//TestHandlerSearch tests the validation and the index build of the Handler
+func TestHandlerSearch(t *testing.T) {
+
+	catalogErr := errors.New("ScanFailed")
+
+	tests := []struct {
+		desc    string
+		catalog *mockCatalog
+		query   string
+		limit   int
+		err     error
+	}{
+		{"QueryIsEmpty", &mockCatalog{}, "", 0, ErrQueryIsEmpty},
+		{"LimitIsInvalid", &mockCatalog{}, "phone", MaxLimit + 1, ErrLimitIsInvalid},
+		{"CouldNotBuildIndex", &mockCatalog{err: catalogErr}, "phone", 0,
+			ErrCouldNotBuildIndex},
+		{"Success", &mockCatalog{items: getItems()}, "phone", 1, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			h := New(tc.catalog, NewIndex(), 0)
+			results, err := h.Search(context.Background(), tc.query, tc.limit)
+			if !reflect.DeepEqual(err, tc.err) {
+				t.Errorf("Expected: %v. Received: %v", tc.err, err)
+			}
+			if err == nil && len(results.Items) != tc.limit {
+				t.Errorf("Expected %d results. Received: %d", tc.limit,
+					len(results.Items))
+			}
+		})
+	}
+}
+
+//getItems returns the catalog used by the test cases
+func getItems() []item.Item {
+	return []item.Item{
+		{ItemID: "1", Description: "USB cable", Price: 1.99},
+		{ItemID: "2", Description: "Phone charger", Price: 10.99,
+			Attributes: map[string]string{"connector": "USB"}},
+		{ItemID: "3", Description: "Phone case", Price: 5.99},
+		{ItemID: "4", Description: "Mouse", Price: 4,
+			Attributes: map[string]string{"connectivity": "Wireless"}},
+	}
+}
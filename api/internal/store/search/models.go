@@ -0,0 +1,15 @@
+package search
+
+import "github.com/roloum/store/api/internal/store/item"
+
+//Result is an item matching the search query along with its relevance
+type Result struct {
+	item.Item
+	Score float64 `json:"score"`
+}
+
+//Results contains the items matching a search query
+type Results struct {
+	Query string   `json:"query"`
+	Items []Result `json:"items"`
+}
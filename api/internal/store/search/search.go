@@ -0,0 +1,97 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/roloum/store/api/internal/store/item"
+)
+
+const (
+	//DefaultLimit number of results returned when the limit is not set
+	DefaultLimit = 10
+
+	//MaxLimit maximum number of results returned by a search
+	MaxLimit = 50
+)
+
+var (
+	//ErrQueryIsEmpty error returned when the search query has no terms
+	ErrQueryIsEmpty = errors.New("QueryIsEmpty")
+
+	//ErrLimitIsInvalid error returned when the limit is out of range
+	ErrLimitIsInvalid = errors.New("LimitIsInvalid")
+
+	//ErrCouldNotBuildIndex error returned if we failed to load the catalog
+	ErrCouldNotBuildIndex = errors.New("CouldNotBuildIndex")
+)
+
+//Catalog is the source of the items that are indexed
+type Catalog interface {
+	All(ctx context.Context) ([]item.Item, error)
+}
+
+//Handler struct is a handler for searching the catalog
+type Handler struct {
+	catalog Catalog
+	index   *Index
+	refresh time.Duration
+}
+
+//New returns a Handler that searches the index. The index is rebuilt from
+//the catalog the first time it is used, and every time it is older than
+//refresh. Items written in between reach the index through item.Indexer
+func New(catalog Catalog, index *Index, refresh time.Duration) *Handler {
+	return &Handler{catalog, index, refresh}
+}
+
+//Search returns the items matching the query, sorted by relevance
+func (h *Handler) Search(ctx context.Context, query string, limit int) (
+	*Results, error) {
+
+	if strings.TrimSpace(query) == "" {
+		return nil, ErrQueryIsEmpty
+	}
+
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+	if limit < 0 || limit > MaxLimit {
+		return nil, ErrLimitIsInvalid
+	}
+
+	if err := h.build(ctx); err != nil {
+		return nil, err
+	}
+
+	logging.Ctx(ctx).Debug().Str("query", query).Msg("Searching items")
+
+	return &Results{Query: query, Items: h.index.Search(query, limit)}, nil
+}
+
+//build loads the catalog into the index if it has never been built or if
+//it is stale
+func (h *Handler) build(ctx context.Context) error {
+
+	builtAt := h.index.BuiltAt()
+	if !builtAt.IsZero() && time.Since(builtAt) < h.refresh {
+		return nil
+	}
+
+	logging.Ctx(ctx).Debug().Msg("Building search index")
+
+	items, err := h.catalog.All(ctx)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error building search index")
+		return ErrCouldNotBuildIndex
+	}
+
+	h.index.Replace(items)
+
+	logging.Ctx(ctx).Info().Int("items", len(items)).Msg("Search index built")
+
+	return nil
+}
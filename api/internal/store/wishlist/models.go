@@ -0,0 +1,72 @@
+package wishlist
+
+import (
+	"time"
+
+	"github.com/roloum/store/api/internal/store/cart"
+)
+
+//Wishlist contains the information of a named list of items saved by a user
+type Wishlist struct {
+	WishlistID string    `json:"wishlist_id"`
+	Name       string    `json:"name"`
+	CreatedAt  time.Time `json:"created_at"`
+	Items      []Item    `json:"items"`
+}
+
+//Item contains the information of an item saved in a wishlist.
+//Price is the price of the item when it was saved, CurrentPrice is the price
+//in the catalog when the wishlist is loaded. PriceDropped is set when the
+//current price is lower than the saved one. Available is false when the item
+//or its variant are no longer in the catalog
+type Item struct {
+	ItemID       string    `json:"item_id"`
+	SKU          string    `json:"sku,omitempty"`
+	Description  string    `json:"description"`
+	Price        float32   `json:"price"`
+	Quantity     int       `json:"quantity"`
+	SavedAt      time.Time `json:"saved_at"`
+	CurrentPrice float32   `json:"current_price"`
+	PriceDropped bool      `json:"price_dropped"`
+	Available    bool      `json:"available"`
+}
+
+//List contains the wishlists of a user, without their items
+type List struct {
+	Wishlists []Wishlist `json:"wishlists"`
+}
+
+//NewWishlistInfo contains the information of a new wishlist
+type NewWishlistInfo struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+//NewItemInfo contains the information of an item saved in a wishlist. The
+//description and price are taken from the catalog. Quantity defaults to 1
+type NewItemInfo struct {
+	WishlistID string `json:"wishlist_id" validate:"required"`
+	ItemID     string `json:"item_id" validate:"required"`
+	SKU        string `json:"sku,omitempty"`
+	Quantity   int    `json:"quantity" validate:"gte=0"`
+}
+
+//DeleteItemInfo contains the information to delete an item from a wishlist
+type DeleteItemInfo struct {
+	WishlistID string `json:"wishlist_id" validate:"required"`
+	ItemID     string `json:"item_id" validate:"required"`
+	SKU        string `json:"sku,omitempty"`
+}
+
+//MoveItemInfo identifies a line that is moved between a cart and a wishlist
+type MoveItemInfo struct {
+	CartID     string `json:"cart_id" validate:"required"`
+	WishlistID string `json:"wishlist_id" validate:"required"`
+	ItemID     string `json:"item_id" validate:"required"`
+	SKU        string `json:"sku,omitempty"`
+}
+
+//Move contains the cart and the wishlist after a line is moved between them
+type Move struct {
+	Cart     *cart.Cart `json:"cart"`
+	Wishlist *Wishlist  `json:"wishlist"`
+}
@@ -0,0 +1,59 @@
+package wishlist
+
+import (
+	"errors"
+
+	validator "github.com/go-playground/validator/v10"
+)
+
+const (
+	//ErrWishlistIDIsEmpty Error describes when wishlistID is empty
+	ErrWishlistIDIsEmpty = "WishlistIDIsEmpty"
+
+	//ErrCartIDIsEmpty Error describes when cartID is empty
+	ErrCartIDIsEmpty = "CartIDIsEmpty"
+
+	//ErrItemIDIsEmpty Error describes when itemID is empty
+	ErrItemIDIsEmpty = "ItemIDIsEmpty"
+
+	//ErrNameIsEmpty Error describes when the name of the wishlist is empty
+	ErrNameIsEmpty = "NameIsEmpty"
+
+	//ErrNameIsTooLong Error describes when the name of the wishlist is longer
+	//than 100 characters
+	ErrNameIsTooLong = "NameIsTooLong"
+
+	//ErrQuantityIsInvalid Error describes when quantity is negative
+	ErrQuantityIsInvalid = "QuantityIsInvalid"
+)
+
+var validate *validator.Validate
+
+//init instantiates a validator
+func init() {
+	validate = validator.New()
+}
+
+//getValidationError Returns the first error reported by the validator
+func getValidationError(verr error) error {
+
+	//Retrieve first error
+	err := verr.(validator.ValidationErrors)[0]
+
+	switch err.Field() {
+	case "WishlistID":
+		return errors.New(ErrWishlistIDIsEmpty)
+	case "CartID":
+		return errors.New(ErrCartIDIsEmpty)
+	case "ItemID":
+		return errors.New(ErrItemIDIsEmpty)
+	case "Name":
+		if err.Tag() == "max" {
+			return errors.New(ErrNameIsTooLong)
+		}
+		return errors.New(ErrNameIsEmpty)
+	case "Quantity":
+		return errors.New(ErrQuantityIsInvalid)
+	}
+	return nil
+}
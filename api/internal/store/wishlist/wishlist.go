@@ -0,0 +1,737 @@
+package wishlist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/google/uuid"
+	"github.com/roloum/store/api/internal/auth"
+	saws "github.com/roloum/store/api/internal/aws"
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/roloum/store/api/internal/store/cart"
+	"github.com/roloum/store/api/internal/store/item"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	//DynamoDBRowTypeWishlist Attribute used to identify a row of type wishlist
+	DynamoDBRowTypeWishlist = "Wishlist"
+
+	//DynamoDBRowTypeWishlistItem Attribute used to identify an item in a wishlist
+	DynamoDBRowTypeWishlistItem = "WishlistItem"
+
+	//DynamoDBPrefixWishlist Prefix for the wishlist key
+	DynamoDBPrefixWishlist = "WISHLIST#"
+
+	//ErrStoreTableNameIsEmpty Error describes when DynamoDB table name is empty
+	ErrStoreTableNameIsEmpty = "StoreTableNameIsEmpty"
+
+	//fieldWishlistID field of the wishlist in the log lines
+	fieldWishlistID = "wishlist_id"
+)
+
+var (
+	//ErrUserIsAnonymous error returned when a wishlist is accessed without an
+	//authenticated user
+	ErrUserIsAnonymous = errors.New("UserIsAnonymous")
+
+	//ErrWishlistNotFound error returned when the wishlist does not exist or
+	//belongs to another user
+	ErrWishlistNotFound = errors.New("WishlistNotFound")
+
+	//ErrItemDoesNotExist error returned when the item or its variant are not in
+	//the catalog
+	ErrItemDoesNotExist = errors.New("ItemDoesNotExist")
+
+	//ErrItemNotInCart error returned when the line to move is not in the cart
+	ErrItemNotInCart = errors.New("ItemNotInCart")
+
+	//ErrItemNotInWishlist error returned when the line is not in the wishlist
+	ErrItemNotInWishlist = errors.New("ItemNotInWishlist")
+
+	//ErrCouldNotCreateWishlist error returned if we failed to create the wishlist
+	ErrCouldNotCreateWishlist = errors.New("CouldNotCreateWishlist")
+
+	//ErrCouldNotLoadWishlists error returned if we failed to load the wishlists
+	ErrCouldNotLoadWishlists = errors.New("CouldNotLoadWishlists")
+
+	//ErrCouldNotLoadWishlist error returned if we failed to load a wishlist
+	ErrCouldNotLoadWishlist = errors.New("CouldNotLoadWishlist")
+
+	//ErrCouldNotAddItem error returned if we failed to save the item
+	ErrCouldNotAddItem = errors.New("CouldNotAddItem")
+
+	//ErrCouldNotDeleteItem error returned if we failed to delete the item
+	ErrCouldNotDeleteItem = errors.New("CouldNotDeleteItem")
+
+	//ErrCouldNotMoveItem error returned if we failed to move a line between a
+	//cart and a wishlist
+	ErrCouldNotMoveItem = errors.New("CouldNotMoveItem")
+)
+
+//Catalog returns the items of the catalog with their current price
+type Catalog interface {
+	Get(ctx context.Context, itemID string) (*item.Item, error)
+	CurrentPrices(ctx context.Context, keys []item.PriceKey) (
+		map[item.PriceKey]float32, error)
+}
+
+//Handler struct is a handler for executing the actions related to wishlists
+type Handler struct {
+	svc       dynamodbiface.DynamoDBAPI
+	tableName string
+	catalog   Catalog
+	carts     *cart.Handler
+}
+
+//New returns a Handler for the wishlists. The catalog is used to resolve the
+//price of the saved items. The options configure the carts the lines are
+//moved from and to
+func New(svc dynamodbiface.DynamoDBAPI, tableName string, catalog Catalog,
+	opts ...cart.Option) (*Handler, error) {
+
+	if tableName == "" {
+		log.Error().Msg("Table name is empty")
+		return nil, errors.New(ErrStoreTableNameIsEmpty)
+	}
+
+	//The carts compare their lines with the same catalog
+	opts = append([]cart.Option{cart.WithCatalog(catalog)}, opts...)
+	carts, err := cart.New(svc, tableName, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handler{svc, tableName, catalog, carts}, nil
+}
+
+//Create creates a wishlist for the authenticated user. The wishlist row is
+//stored in the user partition, so the key itself proves the ownership
+func (h *Handler) Create(ctx context.Context, nw *NewWishlistInfo) (*Wishlist,
+	error) {
+
+	userID, err := getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validate.Struct(nw); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error validating struct")
+		return nil, getValidationError(err)
+	}
+
+	w := &Wishlist{
+		WishlistID: uuid.New().String(),
+		Name:       nw.Name,
+		CreatedAt:  time.Now().UTC(),
+		Items:      []Item{},
+	}
+
+	ctx = logging.With(ctx, fieldWishlistID, w.WishlistID)
+	logging.Ctx(ctx).Debug().Msg("Creating wishlist")
+
+	_, err = h.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		Item: map[string]*dynamodb.AttributeValue{
+			"pk":          {S: aws.String(getUserPK(userID))},
+			"sk":          {S: aws.String(getWishlistPK(w.WishlistID))},
+			"type":        {S: aws.String(DynamoDBRowTypeWishlist)},
+			"wishlist_id": {S: aws.String(w.WishlistID)},
+			"name":        {S: aws.String(w.Name)},
+			"created_at":  {S: aws.String(w.CreatedAt.Format(time.RFC3339Nano))},
+		},
+		TableName:           aws.String(h.tableName),
+		ConditionExpression: aws.String("attribute_not_exists(pk) and attribute_not_exists(sk)"),
+	})
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error creating wishlist")
+		return nil, ErrCouldNotCreateWishlist
+	}
+
+	logging.Ctx(ctx).Info().Msg("Wishlist created")
+
+	return w, nil
+}
+
+//Lists returns the wishlists of the authenticated user, without their items
+func (h *Handler) Lists(ctx context.Context) (*List, error) {
+
+	userID, err := getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Ctx(ctx).Debug().Msg("Loading wishlists")
+
+	result, err := h.svc.QueryWithContext(ctx, &dynamodb.QueryInput{
+		KeyConditions: map[string]*dynamodb.Condition{
+			"pk": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodb.AttributeValue{
+					{S: aws.String(getUserPK(userID))},
+				},
+			},
+			"sk": {
+				ComparisonOperator: aws.String("BEGINS_WITH"),
+				AttributeValueList: []*dynamodb.AttributeValue{
+					{S: aws.String(DynamoDBPrefixWishlist)},
+				},
+			},
+		},
+		ExpressionAttributeNames: map[string]*string{
+			"#n": aws.String("name"),
+		},
+		ProjectionExpression: aws.String("wishlist_id,#n,created_at"),
+		TableName:            aws.String(h.tableName),
+	})
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error loading wishlists")
+		return nil, ErrCouldNotLoadWishlists
+	}
+
+	l := List{Wishlists: []Wishlist{}}
+	if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &l.Wishlists); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error Unmarshaling wishlists")
+		return nil, ErrCouldNotLoadWishlists
+	}
+
+	return &l, nil
+}
+
+//Load returns a wishlist of the authenticated user with its items and their
+//current price in the catalog
+func (h *Handler) Load(ctx context.Context, wishlistID string) (*Wishlist,
+	error) {
+
+	userID, err := getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if wishlistID == "" {
+		return nil, errors.New(ErrWishlistIDIsEmpty)
+	}
+
+	ctx = logging.With(ctx, fieldWishlistID, wishlistID)
+	logging.Ctx(ctx).Debug().Msg("Loading wishlist")
+
+	header, err := h.svc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"pk": {S: aws.String(getUserPK(userID))},
+			"sk": {S: aws.String(getWishlistPK(wishlistID))},
+		},
+		TableName: aws.String(h.tableName),
+	})
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error loading wishlist")
+		return nil, ErrCouldNotLoadWishlist
+	}
+	if len(header.Item) == 0 {
+		return nil, ErrWishlistNotFound
+	}
+
+	var w Wishlist
+	if err := dynamodbattribute.UnmarshalMap(header.Item, &w); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error Unmarshaling wishlist")
+		return nil, ErrCouldNotLoadWishlist
+	}
+
+	result, err := h.svc.QueryWithContext(ctx, &dynamodb.QueryInput{
+		KeyConditions: map[string]*dynamodb.Condition{
+			"pk": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodb.AttributeValue{
+					{S: aws.String(getWishlistPK(wishlistID))},
+				},
+			},
+		},
+		ProjectionExpression: aws.String("item_id,sku,description,price,quantity,saved_at"),
+		TableName:            aws.String(h.tableName),
+	})
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error loading wishlist items")
+		return nil, ErrCouldNotLoadWishlist
+	}
+
+	w.Items = []Item{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &w.Items); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error Unmarshaling wishlist items")
+		return nil, ErrCouldNotLoadWishlist
+	}
+
+	if err := h.applyCatalog(ctx, w.Items); err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+//AddItem saves an item in a wishlist of the authenticated user. If the item is
+//already in the wishlist, the quantity is replaced and the saved price is kept
+func (h *Handler) AddItem(ctx context.Context, ni *NewItemInfo) (*Wishlist,
+	error) {
+
+	userID, err := getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = logging.WithItem(logging.With(ctx, fieldWishlistID, ni.WishlistID), ni.ItemID)
+
+	if err := validate.Struct(ni); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error validating struct")
+		return nil, getValidationError(err)
+	}
+	if ni.Quantity == 0 {
+		ni.Quantity = 1
+	}
+
+	i, err := h.catalog.Get(ctx, ni.ItemID)
+	if err != nil {
+		if err == item.ErrItemNotFound {
+			return nil, ErrItemDoesNotExist
+		}
+		return nil, ErrCouldNotAddItem
+	}
+	price, ok := i.PriceOf(ni.SKU)
+	if !ok {
+		return nil, ErrItemDoesNotExist
+	}
+
+	logging.Ctx(ctx).Debug().Str("sku", ni.SKU).Msg("Adding item to wishlist")
+
+	_, err = h.svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			h.getWishlistCheck(userID, ni.WishlistID),
+			h.getLineUpdate(ni.WishlistID, &Item{
+				ItemID:      ni.ItemID,
+				SKU:         ni.SKU,
+				Description: i.Description,
+				Price:       price,
+				Quantity:    ni.Quantity,
+				SavedAt:     time.Now().UTC(),
+			}),
+		},
+	})
+	if err != nil {
+
+		//cancellationIdx is the index of the TransactWriteItem in the
+		//TransactWriteItems array
+		cancellationIdx := 0
+		if isConditionalCheckFailed(err, cancellationIdx) {
+			return nil, ErrWishlistNotFound
+		}
+
+		logging.Ctx(ctx).Error().Err(err).Msg("Error adding item")
+		return nil, ErrCouldNotAddItem
+	}
+
+	logging.Ctx(ctx).Info().Msg("Item added to wishlist")
+
+	return h.Load(ctx, ni.WishlistID)
+}
+
+//DeleteItem deletes an item from a wishlist of the authenticated user
+func (h *Handler) DeleteItem(ctx context.Context, di *DeleteItemInfo) (
+	*Wishlist, error) {
+
+	userID, err := getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = logging.WithItem(logging.With(ctx, fieldWishlistID, di.WishlistID), di.ItemID)
+
+	if err := validate.Struct(di); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error validating struct")
+		return nil, getValidationError(err)
+	}
+
+	logging.Ctx(ctx).Debug().Str("sku", di.SKU).Msg("Deleting item from wishlist")
+
+	_, err = h.svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			h.getWishlistCheck(userID, di.WishlistID),
+			h.getLineDelete(di.WishlistID, di.ItemID, di.SKU),
+		},
+	})
+	if err != nil {
+		if isConditionalCheckFailed(err, 0) {
+			return nil, ErrWishlistNotFound
+		}
+		if isConditionalCheckFailed(err, 1) {
+			return nil, ErrItemNotInWishlist
+		}
+
+		logging.Ctx(ctx).Error().Err(err).Msg("Error deleting item")
+		return nil, ErrCouldNotDeleteItem
+	}
+
+	logging.Ctx(ctx).Info().Msg("Item deleted from wishlist")
+
+	return h.Load(ctx, di.WishlistID)
+}
+
+//MoveFromCart saves a line of the cart for later. The line is deleted from the
+//cart and saved in the wishlist, with the price and quantity it had in the
+//cart, in the same transaction
+func (h *Handler) MoveFromCart(ctx context.Context, mi *MoveItemInfo) (*Move,
+	error) {
+
+	userID, err := getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = logging.With(logging.WithCart(ctx, mi.CartID), fieldWishlistID, mi.WishlistID)
+	ctx = logging.WithItem(ctx, mi.ItemID)
+
+	if err := validate.Struct(mi); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error validating struct")
+		return nil, getValidationError(err)
+	}
+
+	//Load verifies that the user can access the cart
+	c, err := h.carts.Load(ctx, mi.CartID)
+	if err != nil {
+		return nil, err
+	}
+
+	line := findCartLine(c, mi.ItemID, mi.SKU)
+	if line == nil {
+		return nil, ErrItemNotInCart
+	}
+
+	logging.Ctx(ctx).Debug().Str("sku", mi.SKU).Msg("Moving item from cart to wishlist")
+
+	_, err = h.svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			h.getWishlistCheck(userID, mi.WishlistID),
+			{
+				Delete: &dynamodb.Delete{
+					Key: cart.LineKey(mi.CartID, mi.ItemID, mi.SKU),
+					ExpressionAttributeNames: map[string]*string{
+						"#q": aws.String("quantity"),
+					},
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":q": {N: aws.String(strconv.Itoa(line.Quantity))},
+					},
+					ConditionExpression: aws.String("#q = :q"),
+					TableName:           aws.String(h.tableName),
+				},
+			},
+			h.getLineUpdate(mi.WishlistID, &Item{
+				ItemID:      line.ItemID,
+				SKU:         line.SKU,
+				Description: line.Description,
+				Price:       line.Price,
+				Quantity:    line.Quantity,
+				SavedAt:     time.Now().UTC(),
+			}),
+			h.carts.CountersUpdate(ctx, mi.CartID, -1, -line.Quantity),
+		},
+	})
+	if err != nil {
+		if isConditionalCheckFailed(err, 0) {
+			return nil, ErrWishlistNotFound
+		}
+		if cerr := h.carts.CountersError(ctx, err, 3, 0); cerr != nil {
+			return nil, cerr
+		}
+
+		logging.Ctx(ctx).Error().Err(err).Msg("Error moving item")
+		return nil, ErrCouldNotMoveItem
+	}
+
+	logging.Ctx(ctx).Info().Msg("Item moved from cart to wishlist")
+
+	return h.getMove(ctx, mi)
+}
+
+//MoveToCart moves a line of the wishlist back to the cart, at the current
+//price of the catalog. If the item is already in the cart the quantities are
+//added, up to the quantity limit of the lines of the cart. The cart must stay
+//within its limits of lines and units, and the item within its own limit
+func (h *Handler) MoveToCart(ctx context.Context, mi *MoveItemInfo) (*Move,
+	error) {
+
+	userID, err := getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = logging.With(logging.WithCart(ctx, mi.CartID), fieldWishlistID, mi.WishlistID)
+	ctx = logging.WithItem(ctx, mi.ItemID)
+
+	if err := validate.Struct(mi); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error validating struct")
+		return nil, getValidationError(err)
+	}
+
+	w, err := h.Load(ctx, mi.WishlistID)
+	if err != nil {
+		return nil, err
+	}
+
+	var line *Item
+	for n := range w.Items {
+		if w.Items[n].ItemID == mi.ItemID && w.Items[n].SKU == mi.SKU {
+			line = &w.Items[n]
+		}
+	}
+	if line == nil {
+		return nil, ErrItemNotInWishlist
+	}
+	if !line.Available {
+		return nil, ErrItemDoesNotExist
+	}
+
+	c, err := h.carts.Load(ctx, mi.CartID)
+	if err != nil {
+		return nil, err
+	}
+
+	//lines and units are the counters added to the cart
+	existing := findCartLine(c, mi.ItemID, mi.SKU)
+	lines, quantity, units := 1, h.carts.ClampQuantity(line.Quantity), 0
+	if existing != nil {
+		lines = 0
+		quantity = h.carts.ClampQuantity(existing.Quantity + line.Quantity)
+		units = -existing.Quantity
+	}
+	units += quantity
+
+	logging.Ctx(ctx).Debug().Str("sku", mi.SKU).Msg("Moving item from wishlist to cart")
+
+	_, err = h.svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			h.getWishlistCheck(userID, mi.WishlistID),
+			h.getLineDelete(mi.WishlistID, mi.ItemID, mi.SKU),
+			h.getCartLineUpdate(mi.CartID, line, existing, quantity),
+			h.carts.CountersUpdate(ctx, mi.CartID, lines, units),
+			h.carts.CatalogCheck(mi.ItemID, mi.SKU, quantity),
+		},
+	})
+	if err != nil {
+		if isConditionalCheckFailed(err, 0) {
+			return nil, ErrWishlistNotFound
+		}
+		if cerr := h.carts.CountersError(ctx, err, 3, lines); cerr != nil {
+			return nil, cerr
+		}
+		if cerr := h.carts.CatalogError(err, 4); cerr != nil {
+			if cerr == cart.ErrItemDoesNotExist {
+				return nil, ErrItemDoesNotExist
+			}
+			return nil, cerr
+		}
+
+		logging.Ctx(ctx).Error().Err(err).Msg("Error moving item")
+		return nil, ErrCouldNotMoveItem
+	}
+
+	logging.Ctx(ctx).Info().Msg("Item moved from wishlist to cart")
+
+	return h.getMove(ctx, mi)
+}
+
+//applyCatalog sets the current price of the items and flags the ones whose
+//price dropped since they were saved. The prices of every item are resolved
+//at once
+func (h *Handler) applyCatalog(ctx context.Context, items []Item) error {
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	keys := make([]item.PriceKey, 0, len(items))
+	for _, i := range items {
+		keys = append(keys, item.PriceKey{ItemID: i.ItemID, SKU: i.SKU})
+	}
+
+	prices, err := h.catalog.CurrentPrices(ctx, keys)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error loading catalog prices")
+		return ErrCouldNotLoadWishlist
+	}
+
+	for n := range items {
+		i := &items[n]
+
+		i.CurrentPrice, i.Available = prices[item.PriceKey{ItemID: i.ItemID, SKU: i.SKU}]
+		i.PriceDropped = i.Available && i.CurrentPrice < i.Price
+	}
+
+	return nil
+}
+
+//getMove returns the cart and the wishlist after a line is moved
+func (h *Handler) getMove(ctx context.Context, mi *MoveItemInfo) (*Move, error) {
+
+	c, err := h.carts.Load(ctx, mi.CartID)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := h.Load(ctx, mi.WishlistID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Move{Cart: c, Wishlist: w}, nil
+}
+
+//getWishlistCheck returns the condition check that verifies the wishlist
+//exists and belongs to the user
+func (h *Handler) getWishlistCheck(userID, wishlistID string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		ConditionCheck: &dynamodb.ConditionCheck{
+			Key: map[string]*dynamodb.AttributeValue{
+				"pk": {S: aws.String(getUserPK(userID))},
+				"sk": {S: aws.String(getWishlistPK(wishlistID))},
+			},
+			TableName:           aws.String(h.tableName),
+			ConditionExpression: aws.String("attribute_exists(pk) and attribute_exists(sk)"),
+		},
+	}
+}
+
+//getLineUpdate returns the update that saves a line in the wishlist. The
+//price and date of the first save are kept, so price drops are detected
+func (h *Handler) getLineUpdate(wishlistID string, i *Item) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			Key: map[string]*dynamodb.AttributeValue{
+				"pk": {S: aws.String(getWishlistPK(wishlistID))},
+				"sk": {S: aws.String(cart.LineSK(i.ItemID, i.SKU))},
+			},
+			ExpressionAttributeNames: map[string]*string{
+				"#t": aws.String("type"),
+				"#w": aws.String("wishlist_id"),
+				"#i": aws.String("item_id"),
+				"#s": aws.String("sku"),
+				"#d": aws.String("description"),
+				"#p": aws.String("price"),
+				"#q": aws.String("quantity"),
+				"#a": aws.String("saved_at"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":t": {S: aws.String(DynamoDBRowTypeWishlistItem)},
+				":w": {S: aws.String(wishlistID)},
+				":i": {S: aws.String(i.ItemID)},
+				":s": {S: aws.String(i.SKU)},
+				":d": {S: aws.String(i.Description)},
+				":p": {N: aws.String(formatPrice(i.Price))},
+				":q": {N: aws.String(strconv.Itoa(i.Quantity))},
+				":a": {S: aws.String(i.SavedAt.Format(time.RFC3339Nano))},
+			},
+			UpdateExpression: aws.String(
+				"set #t=:t, #w=:w, #i=:i, #s=:s, #d=:d, #q=:q, #p=if_not_exists(#p, :p), #a=if_not_exists(#a, :a)",
+			),
+			TableName: aws.String(h.tableName),
+		},
+	}
+}
+
+//getLineDelete returns the delete of a line of the wishlist
+func (h *Handler) getLineDelete(wishlistID, itemID, sku string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Delete: &dynamodb.Delete{
+			Key: map[string]*dynamodb.AttributeValue{
+				"pk": {S: aws.String(getWishlistPK(wishlistID))},
+				"sk": {S: aws.String(cart.LineSK(itemID, sku))},
+			},
+			ConditionExpression: aws.String("attribute_exists(pk) and attribute_exists(sk)"),
+			TableName:           aws.String(h.tableName),
+		},
+	}
+}
+
+//getCartLineUpdate returns the update that sets the quantity of the cart line
+//of a wishlist line. When the cart already has the line, the condition on its
+//quantity fails the move if the line is modified after the cart was loaded
+func (h *Handler) getCartLineUpdate(cartID string, i *Item,
+	existing *cart.Item, quantity int) *dynamodb.TransactWriteItem {
+
+	u := &dynamodb.Update{
+		Key: cart.LineKey(cartID, i.ItemID, i.SKU),
+		ExpressionAttributeNames: map[string]*string{
+			"#t": aws.String("type"),
+			"#c": aws.String("cart_id"),
+			"#i": aws.String("item_id"),
+			"#s": aws.String("sku"),
+			"#d": aws.String("description"),
+			"#p": aws.String("price"),
+			"#q": aws.String("quantity"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":t": {S: aws.String(cart.DynamoDBRowTypeCartItem)},
+			":c": {S: aws.String(cartID)},
+			":i": {S: aws.String(i.ItemID)},
+			":s": {S: aws.String(i.SKU)},
+			":d": {S: aws.String(i.Description)},
+			":p": {N: aws.String(formatPrice(i.CurrentPrice))},
+			":q": {N: aws.String(strconv.Itoa(quantity))},
+		},
+		UpdateExpression: aws.String(
+			"set #t=:t, #c=:c, #i=:i, #s=:s, #d=:d, #p=:p, #q=:q",
+		),
+		ConditionExpression: aws.String("attribute_not_exists(pk) and attribute_not_exists(sk)"),
+		TableName:           aws.String(h.tableName),
+	}
+
+	if existing != nil {
+		u.ExpressionAttributeValues[":old"] = &dynamodb.AttributeValue{
+			N: aws.String(strconv.Itoa(existing.Quantity)),
+		}
+		u.ConditionExpression = aws.String("#q = :old")
+	}
+
+	return &dynamodb.TransactWriteItem{Update: u}
+}
+
+//findCartLine returns the line of the cart with the item and SKU, if any
+func findCartLine(c *cart.Cart, itemID, sku string) *cart.Item {
+	for n := range c.Items {
+		if c.Items[n].ItemID == itemID && c.Items[n].SKU == sku {
+			return &c.Items[n]
+		}
+	}
+	return nil
+}
+
+//getUserID returns the ID of the authenticated user
+func getUserID(ctx context.Context) (string, error) {
+	userID := auth.UserID(ctx)
+	if userID == "" {
+		return "", ErrUserIsAnonymous
+	}
+	return userID, nil
+}
+
+//getUserPK returns the userID formatted for the primary key column
+func getUserPK(userID string) string {
+	return fmt.Sprintf("%s%s", cart.DynamoDBPrefixUser, userID)
+}
+
+//getWishlistPK returns the wishlistID formatted for the key columns
+func getWishlistPK(wishlistID string) string {
+	return fmt.Sprintf("%s%s", DynamoDBPrefixWishlist, wishlistID)
+}
+
+//formatPrice returns the price formatted for a number attribute
+func formatPrice(price float32) string {
+	return strconv.FormatFloat(float64(price), 'f', -1, 32)
+}
+
+//isConditionalCheckFailed returns true if the transaction was cancelled
+//because the condition of the action at cancellationIdx failed
+func isConditionalCheckFailed(err error, cancellationIdx int) bool {
+	return saws.IsErrorOfType(err,
+		dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed, cancellationIdx)
+}
@@ -0,0 +1,151 @@
+package wishlist
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/roloum/store/api/internal/auth"
+	"github.com/roloum/store/api/internal/store/item"
+	"github.com/roloum/store/api/internal/test"
+	"github.com/rs/zerolog"
+)
+
+const (
+	StoreTable = "Store"
+)
+
+func init() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	test.SetEnvironment()
+}
+
+//mockCatalog returns the items of a map
+type mockCatalog map[string]*item.Item
+
+//Get returns the item or ErrItemNotFound
+func (m mockCatalog) Get(ctx context.Context, itemID string) (*item.Item, error) {
+	if i, ok := m[itemID]; ok {
+		return i, nil
+	}
+	return nil, item.ErrItemNotFound
+}
+
+//CurrentPrices returns the prices of the items and variants of the map
+func (m mockCatalog) CurrentPrices(ctx context.Context, keys []item.PriceKey) (
+	map[item.PriceKey]float32, error) {
+
+	prices := map[item.PriceKey]float32{}
+	for _, k := range keys {
+		if i, ok := m[k.ItemID]; ok {
+			if price, ok := i.PriceOf(k.SKU); ok {
+				prices[k] = price
+			}
+		}
+	}
+	return prices, nil
+}
+
+//getCatalog returns a catalog with an item and an item with variants
+func getCatalog() mockCatalog {
+	return mockCatalog{
+		"11aa": {ItemID: "11aa", Description: "Laptop", Price: 800},
+		"22bb": {ItemID: "22bb", Description: "Charger", Price: 20,
+			Variants: []item.Variant{{SKU: "CHG-USBC", Price: 25}}},
+	}
+}
+
+//TestAddItem tests the validation of the items saved in a wishlist
+func TestAddItem(t *testing.T) {
+
+	handler, _ := New(&test.MockDynamoDB{}, StoreTable, getCatalog())
+	user := auth.NewContext(context.Background(), &auth.Claims{Subject: "u1"})
+
+	tests := []struct {
+		desc string
+		ctx  context.Context
+		item *NewItemInfo
+		err  error
+	}{
+		{
+			desc: ErrUserIsAnonymous.Error(),
+			ctx:  context.Background(),
+			item: &NewItemInfo{WishlistID: "w1", ItemID: "11aa"},
+			err:  ErrUserIsAnonymous,
+		},
+		{
+			desc: ErrWishlistIDIsEmpty,
+			ctx:  user,
+			item: &NewItemInfo{ItemID: "11aa"},
+			err:  errors.New(ErrWishlistIDIsEmpty),
+		},
+		{
+			desc: ErrQuantityIsInvalid,
+			ctx:  user,
+			item: &NewItemInfo{WishlistID: "w1", ItemID: "11aa", Quantity: -1},
+			err:  errors.New(ErrQuantityIsInvalid),
+		},
+		{
+			desc: ErrItemDoesNotExist.Error(),
+			ctx:  user,
+			item: &NewItemInfo{WishlistID: "w1", ItemID: "33cc"},
+			err:  ErrItemDoesNotExist,
+		},
+		{
+			desc: "UnknownSKU",
+			ctx:  user,
+			item: &NewItemInfo{WishlistID: "w1", ItemID: "22bb", SKU: "CHG-LTG"},
+			err:  ErrItemDoesNotExist,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := handler.AddItem(tc.ctx, tc.item)
+			if !reflect.DeepEqual(err, tc.err) {
+				t.Errorf("Expected: %v. Received: %v", tc.err, err)
+			}
+		})
+	}
+}
+
+//TestApplyCatalog tests the current price and the price drop flags of the
+//saved items
+func TestApplyCatalog(t *testing.T) {
+
+	handler, _ := New(&test.MockDynamoDB{}, StoreTable, getCatalog())
+
+	items := []Item{
+		{ItemID: "11aa", Price: 900},
+		{ItemID: "11aa", Price: 700},
+		{ItemID: "22bb", SKU: "CHG-USBC", Price: 30},
+		{ItemID: "22bb", SKU: "CHG-LTG", Price: 30},
+		{ItemID: "33cc", Price: 10},
+	}
+
+	if err := handler.applyCatalog(context.Background(), items); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		price     float32
+		dropped   bool
+		available bool
+	}{
+		{800, true, true},
+		{800, false, true},
+		{25, true, true},
+		{0, false, false},
+		{0, false, false},
+	}
+
+	for n, e := range expected {
+		i := items[n]
+		if i.CurrentPrice != e.price || i.PriceDropped != e.dropped ||
+			i.Available != e.available {
+			t.Errorf("Item %d. Expected: %v. Received: %v/%v/%v", n, e,
+				i.CurrentPrice, i.PriceDropped, i.Available)
+		}
+	}
+}
@@ -14,9 +14,11 @@ type MockDynamoDB struct {
 	dynamodbiface.DynamoDBAPI
 
 	PutItemOutput            *dynamodb.PutItemOutput
+	GetItemOutput            *dynamodb.GetItemOutput
 	UpdateItemOutput         *dynamodb.UpdateItemOutput
 	TransactWriteItemsOutput *dynamodb.TransactWriteItemsOutput
 	QueryOutput              *dynamodb.QueryOutput
+	BatchGetItemOutput       *dynamodb.BatchGetItemOutput
 	OutputError              error
 }
 
@@ -27,6 +29,15 @@ func (m *MockDynamoDB) PutItemWithContext(aws.Context, *dynamodb.PutItemInput,
 	return m.PutItemOutput, m.OutputError
 }
 
+//GetItemWithContext mocks the GetItemWithContext method
+func (m *MockDynamoDB) GetItemWithContext(aws.Context, *dynamodb.GetItemInput,
+	...request.Option) (*dynamodb.GetItemOutput, error) {
+	if m.GetItemOutput != nil {
+		return m.GetItemOutput, m.OutputError
+	}
+	return &dynamodb.GetItemOutput{}, m.OutputError
+}
+
 //TransactWriteItemsWithContext mocks the TransactWriteItemsWithContext method
 func (m *MockDynamoDB) TransactWriteItemsWithContext(aws.Context,
 	*dynamodb.TransactWriteItemsInput, ...request.Option) (
@@ -44,5 +55,18 @@ func (m *MockDynamoDB) UpdateItemWithContext(aws.Context,
 //QueryWithContext mocks the QueryWithContext method
 func (m *MockDynamoDB) QueryWithContext(aws.Context, *dynamodb.QueryInput,
 	...request.Option) (*dynamodb.QueryOutput, error) {
+	if m.QueryOutput != nil {
+		return m.QueryOutput, m.OutputError
+	}
 	return &dynamodb.QueryOutput{Count: aws.Int64(0)}, m.OutputError
 }
+
+//BatchGetItemWithContext mocks the BatchGetItemWithContext method
+func (m *MockDynamoDB) BatchGetItemWithContext(aws.Context,
+	*dynamodb.BatchGetItemInput, ...request.Option) (
+	*dynamodb.BatchGetItemOutput, error) {
+	if m.BatchGetItemOutput != nil {
+		return m.BatchGetItemOutput, m.OutputError
+	}
+	return &dynamodb.BatchGetItemOutput{}, m.OutputError
+}
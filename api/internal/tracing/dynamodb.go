@@ -0,0 +1,145 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+//DynamoDB is a DynamoDB client that records a span for every call of the
+//store, child of the span of the context of the call. The calls that are not
+//used by the store go straight to the client
+type DynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+}
+
+//NewDynamoDB returns a client that records the spans of the calls of svc
+func NewDynamoDB(svc dynamodbiface.DynamoDBAPI) *DynamoDB {
+	return &DynamoDB{DynamoDBAPI: svc}
+}
+
+//start starts the span of a call, with the attributes of the OpenTelemetry
+//conventions of the databases. Calls on several tables do not have a table
+func start(ctx context.Context, call string, table *string) (context.Context,
+	*Span) {
+
+	ctx, span := Start(ctx, "dynamodb."+call)
+	span.SetAttribute("db.system", "dynamodb")
+	span.SetAttribute("db.operation", call)
+	if table != nil {
+		span.SetAttribute("aws.dynamodb.table_names", []string{aws.StringValue(table)})
+	}
+
+	return ctx, span
+}
+
+//GetItemWithContext records the span of GetItem
+func (d *DynamoDB) GetItemWithContext(ctx aws.Context,
+	input *dynamodb.GetItemInput, opts ...request.Option) (
+	*dynamodb.GetItemOutput, error) {
+
+	ctx, span := start(ctx, "GetItem", input.TableName)
+	out, err := d.DynamoDBAPI.GetItemWithContext(ctx, input, opts...)
+	span.End(err)
+
+	return out, err
+}
+
+//PutItemWithContext records the span of PutItem
+func (d *DynamoDB) PutItemWithContext(ctx aws.Context,
+	input *dynamodb.PutItemInput, opts ...request.Option) (
+	*dynamodb.PutItemOutput, error) {
+
+	ctx, span := start(ctx, "PutItem", input.TableName)
+	out, err := d.DynamoDBAPI.PutItemWithContext(ctx, input, opts...)
+	span.End(err)
+
+	return out, err
+}
+
+//UpdateItemWithContext records the span of UpdateItem
+func (d *DynamoDB) UpdateItemWithContext(ctx aws.Context,
+	input *dynamodb.UpdateItemInput, opts ...request.Option) (
+	*dynamodb.UpdateItemOutput, error) {
+
+	ctx, span := start(ctx, "UpdateItem", input.TableName)
+	out, err := d.DynamoDBAPI.UpdateItemWithContext(ctx, input, opts...)
+	span.End(err)
+
+	return out, err
+}
+
+//DeleteItemWithContext records the span of DeleteItem
+func (d *DynamoDB) DeleteItemWithContext(ctx aws.Context,
+	input *dynamodb.DeleteItemInput, opts ...request.Option) (
+	*dynamodb.DeleteItemOutput, error) {
+
+	ctx, span := start(ctx, "DeleteItem", input.TableName)
+	out, err := d.DynamoDBAPI.DeleteItemWithContext(ctx, input, opts...)
+	span.End(err)
+
+	return out, err
+}
+
+//QueryWithContext records the span of Query
+func (d *DynamoDB) QueryWithContext(ctx aws.Context,
+	input *dynamodb.QueryInput, opts ...request.Option) (
+	*dynamodb.QueryOutput, error) {
+
+	ctx, span := start(ctx, "Query", input.TableName)
+	out, err := d.DynamoDBAPI.QueryWithContext(ctx, input, opts...)
+	span.End(err)
+
+	return out, err
+}
+
+//ScanWithContext records the span of Scan
+func (d *DynamoDB) ScanWithContext(ctx aws.Context,
+	input *dynamodb.ScanInput, opts ...request.Option) (
+	*dynamodb.ScanOutput, error) {
+
+	ctx, span := start(ctx, "Scan", input.TableName)
+	out, err := d.DynamoDBAPI.ScanWithContext(ctx, input, opts...)
+	span.End(err)
+
+	return out, err
+}
+
+//BatchGetItemWithContext records the span of BatchGetItem
+func (d *DynamoDB) BatchGetItemWithContext(ctx aws.Context,
+	input *dynamodb.BatchGetItemInput, opts ...request.Option) (
+	*dynamodb.BatchGetItemOutput, error) {
+
+	ctx, span := start(ctx, "BatchGetItem", nil)
+	out, err := d.DynamoDBAPI.BatchGetItemWithContext(ctx, input, opts...)
+	span.End(err)
+
+	return out, err
+}
+
+//BatchWriteItemWithContext records the span of BatchWriteItem
+func (d *DynamoDB) BatchWriteItemWithContext(ctx aws.Context,
+	input *dynamodb.BatchWriteItemInput, opts ...request.Option) (
+	*dynamodb.BatchWriteItemOutput, error) {
+
+	ctx, span := start(ctx, "BatchWriteItem", nil)
+	out, err := d.DynamoDBAPI.BatchWriteItemWithContext(ctx, input, opts...)
+	span.End(err)
+
+	return out, err
+}
+
+//TransactWriteItemsWithContext records the span of TransactWriteItems
+func (d *DynamoDB) TransactWriteItemsWithContext(ctx aws.Context,
+	input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (
+	*dynamodb.TransactWriteItemsOutput, error) {
+
+	ctx, span := start(ctx, "TransactWriteItems", nil)
+	out, err := d.DynamoDBAPI.TransactWriteItemsWithContext(ctx, input, opts...)
+	span.End(err)
+
+	return out, err
+}
@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"errors"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	//ExporterStdout exporter that writes the spans to the standard output
+	ExporterStdout = "stdout"
+
+	//ExporterFile exporter that appends the spans to a file
+	ExporterFile = "file"
+)
+
+var (
+	//ErrTracingExporterIsInvalid error returned when the exporter of the
+	//configuration is not stdout or file
+	ErrTracingExporterIsInvalid = errors.New("TracingExporterIsInvalid")
+
+	//ErrTracingFileIsEmpty error returned when the file exporter does not
+	//have a file
+	ErrTracingFileIsEmpty = errors.New("TracingFileIsEmpty")
+)
+
+//NewFile returns an OpenTelemetry stdout exporter that appends the spans to
+//the file of path, one JSON object per line. The file is open for the life
+//of the container
+func NewFile(path string) (sdktrace.SpanExporter, error) {
+	if path == "" {
+		return nil, ErrTracingFileIsEmpty
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return stdouttrace.New(stdouttrace.WithWriter(file))
+}
+
+//NewExporter returns the exporter of the configuration: stdout or file, with
+//the file of path
+func NewExporter(exporter, path string) (sdktrace.SpanExporter, error) {
+	switch exporter {
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		return NewFile(path)
+	}
+	return nil, ErrTracingExporterIsInvalid
+}
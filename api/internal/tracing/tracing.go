@@ -0,0 +1,161 @@
+//Package tracing records the spans of the requests: the lambda handlers, the
+//methods of the handlers of the store and the DynamoDB calls. The spans are
+//recorded with the OpenTelemetry SDK and the traces are propagated with the
+//W3C Trace Context propagator, so a request keeps the trace of its caller
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	//HeaderTraceparent header that propagates the trace of a request
+	HeaderTraceparent = "traceparent"
+
+	//instrumentationName name of the tracer of the spans of the store
+	instrumentationName = "github.com/roloum/store/api"
+)
+
+//Headers is a carrier of the headers of a request, whose names are case
+//insensitive, e.g. the headers of API Gateway
+type Headers map[string]string
+
+//Get returns the value of the header
+func (h Headers) Get(key string) string {
+	for k, v := range h {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+//Set sets the value of the header
+func (h Headers) Set(key, value string) {
+	h[key] = value
+}
+
+//Keys returns the names of the headers
+func (h Headers) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+//Tracer starts the root spans of the requests and exports the spans of the
+//sampled traces. A nil Tracer does not record spans
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+//New returns a Tracer that exports the spans with the exporter. The spans are
+//exported when they end, so they are not lost when lambda freezes the
+//container between the requests
+func New(exporter sdktrace.SpanExporter) *Tracer {
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	return &Tracer{
+		tracer:     provider.Tracer(instrumentationName),
+		propagator: propagation.TraceContext{},
+	}
+}
+
+//Start starts the root span of a request. When the headers have a valid
+//trace context, the span is its child and keeps its trace and its sampling,
+//otherwise the span starts a sampled trace. The headers can be nil
+func (t *Tracer) Start(ctx context.Context, name string,
+	headers propagation.TextMapCarrier) (context.Context, *Span) {
+
+	if t == nil {
+		return ctx, nil
+	}
+
+	if headers != nil {
+		ctx = t.propagator.Extract(ctx, headers)
+	}
+
+	ctx, s := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+	return ctx, &Span{span: s}
+}
+
+//Start starts a child of the span of ctx. Without span in ctx, the operation
+//is not part of a traced request and the span is not recorded
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+
+	parent := trace.SpanFromContext(ctx)
+	if !parent.SpanContext().IsValid() {
+		return ctx, nil
+	}
+
+	ctx, s := parent.TracerProvider().Tracer(instrumentationName).Start(ctx, name)
+	return ctx, &Span{span: s}
+}
+
+//Span is an operation of a trace. The methods of a nil Span do nothing, so
+//the operations do not check whether they are traced
+type Span struct {
+	span trace.Span
+}
+
+//SpanContext returns the span context of the span
+func (s *Span) SpanContext() trace.SpanContext {
+	if s == nil {
+		return trace.SpanContext{}
+	}
+	return s.span.SpanContext()
+}
+
+//SetAttribute sets an attribute of the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(getAttribute(key, value))
+}
+
+//End ends the span with the error of the operation, which is recorded as an
+//exception event and sets the status of the span. Only the first call ends
+//the span
+func (s *Span) End(err error) {
+	if s == nil || !s.span.IsRecording() {
+		return
+	}
+
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	} else {
+		s.span.SetStatus(codes.Ok, "")
+	}
+	s.span.End()
+}
+
+//getAttribute returns the attribute of the value. The values of other types
+//are formatted as strings
+func getAttribute(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case []string:
+		return attribute.StringSlice(key, v)
+	}
+	return attribute.String(key, fmt.Sprint(value))
+}
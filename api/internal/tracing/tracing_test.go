@@ -0,0 +1,195 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/roloum/store/api/internal/test"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const (
+	//traceID trace of the traceparent header
+	traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	//spanID span of the traceparent header
+	spanID = "00f067aa0ba902b7"
+
+	//traceparent header of a sampled trace
+	traceparent = "00-" + traceID + "-" + spanID + "-01"
+)
+
+//getAttributes returns the attributes as a map
+func getAttributes(kvs []attribute.KeyValue) map[string]interface{} {
+	attributes := map[string]interface{}{}
+	for _, kv := range kvs {
+		attributes[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	return attributes
+}
+
+//TestHeaders tests that the names of the headers are case insensitive
+func TestHeaders(t *testing.T) {
+
+	h := Headers{"Traceparent": traceparent}
+	if h.Get(HeaderTraceparent) != traceparent || h.Get("tracestate") != "" {
+		t.Errorf("Unexpected headers: %v", h)
+	}
+
+	h.Set("tracestate", "vendor=value")
+	keys := h.Keys()
+	if len(keys) != 2 || h.Get("TraceState") != "vendor=value" {
+		t.Errorf("Unexpected headers: %v", keys)
+	}
+}
+
+//TestSpans tests that the spans of a request belong to the trace of the
+//caller, and that only the sampled traces are exported
+func TestSpans(t *testing.T) {
+
+	exported := tracetest.NewInMemoryExporter()
+	tracer := New(exported)
+
+	ctx, root := tracer.Start(context.Background(), "POST /cart",
+		Headers{"Traceparent": traceparent})
+	_, child := Start(ctx, "cart.AddItem")
+	child.SetAttribute("quantity", 2)
+	child.End(errors.New("ItemDoesNotExist"))
+	child.End(nil)
+	root.End(nil)
+
+	spans := exported.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans. Received: %d", len(spans))
+	}
+	c, r := spans[0], spans[1]
+	if r.SpanContext.TraceID().String() != traceID ||
+		c.SpanContext.TraceID() != r.SpanContext.TraceID() {
+		t.Errorf("Expected trace %s. Received: %s %s", traceID,
+			r.SpanContext.TraceID(), c.SpanContext.TraceID())
+	}
+	if r.Parent.SpanID().String() != spanID ||
+		c.Parent.SpanID() != r.SpanContext.SpanID() {
+		t.Errorf("Unexpected parents: %s %s", r.Parent.SpanID(), c.Parent.SpanID())
+	}
+	if c.Status.Code != codes.Error || c.Status.Description != "ItemDoesNotExist" ||
+		len(c.Events) != 1 || !reflect.DeepEqual(getAttributes(c.Attributes),
+		map[string]interface{}{"quantity": int64(2)}) {
+		t.Errorf("Unexpected span: %+v", c)
+	}
+	if r.Status.Code != codes.Ok || r.EndTime.Before(c.EndTime) {
+		t.Errorf("Unexpected span: %+v", r)
+	}
+
+	//A request without a valid trace context starts a sampled trace
+	for _, headers := range []Headers{nil, {"traceparent": strings.ToUpper(traceparent)}} {
+		_, root = tracer.Start(context.Background(), "GET /items", headers)
+		sc := root.SpanContext()
+		if !sc.IsValid() || !sc.IsSampled() || sc.TraceID().String() == traceID {
+			t.Errorf("Expected a new trace: %+v", sc)
+		}
+	}
+
+	//The spans of the traces that are not sampled are not exported
+	exported.Reset()
+	ctx, root = tracer.Start(context.Background(), "GET /items",
+		Headers{"traceparent": strings.TrimSuffix(traceparent, "01") + "00"})
+	_, child = Start(ctx, "item.List")
+	child.End(nil)
+	root.End(nil)
+	if len(exported.GetSpans()) != 0 {
+		t.Errorf("Expected no spans. Received: %d", len(exported.GetSpans()))
+	}
+
+	//Without Tracer and without span in the context there are no spans
+	var none *Tracer
+	ctx, root = none.Start(context.Background(), "GET /items",
+		Headers{"traceparent": traceparent})
+	_, child = Start(ctx, "item.List")
+	if root != nil || child != nil {
+		t.Errorf("Expected no spans")
+	}
+	child.SetAttribute("ignored", true)
+	child.End(nil)
+}
+
+//TestExporter tests that the spans are appended to the file as JSON lines
+func TestExporter(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "tracing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "spans.json")
+	exporter, err := NewExporter(ExporterFile, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := New(exporter).Start(context.Background(), "stream", nil)
+	span.End(nil)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s struct {
+		Name        string
+		SpanContext struct {
+			TraceID string
+		}
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "stream" ||
+		s.SpanContext.TraceID != span.SpanContext().TraceID().String() {
+		t.Errorf("Unexpected span: %+v", s)
+	}
+
+	if _, err := NewExporter("zipkin", ""); err != ErrTracingExporterIsInvalid {
+		t.Errorf("Expected: %v. Received: %v", ErrTracingExporterIsInvalid, err)
+	}
+	if _, err := NewExporter(ExporterFile, ""); err != ErrTracingFileIsEmpty {
+		t.Errorf("Expected: %v. Received: %v", ErrTracingFileIsEmpty, err)
+	}
+}
+
+//TestDynamoDB tests the spans of the DynamoDB calls
+func TestDynamoDB(t *testing.T) {
+
+	exported := tracetest.NewInMemoryExporter()
+	ctx, root := New(exported).Start(context.Background(), "GET /cart", nil)
+	svc := NewDynamoDB(&test.MockDynamoDB{})
+
+	if _, err := svc.QueryWithContext(ctx,
+		&dynamodb.QueryInput{TableName: aws.String("Store")}); err != nil {
+		t.Fatal(err)
+	}
+	root.End(nil)
+
+	spans := exported.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans. Received: %d", len(spans))
+	}
+	q := spans[0]
+	attributes := getAttributes(q.Attributes)
+	if q.Name != "dynamodb.Query" ||
+		q.Parent.SpanID() != root.SpanContext().SpanID() ||
+		attributes["db.operation"] != "Query" ||
+		!reflect.DeepEqual(attributes["aws.dynamodb.table_names"], []string{"Store"}) {
+		t.Errorf("Unexpected span: %+v", q)
+	}
+}
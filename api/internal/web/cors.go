@@ -0,0 +1,146 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	//HeaderOrigin header with the origin of a cross-origin request
+	HeaderOrigin = "Origin"
+
+	//HeaderRequestMethod header of a preflight request with the method of the
+	//request the browser wants to send
+	HeaderRequestMethod = "Access-Control-Request-Method"
+
+	//AnyOrigin allowed origin that matches every origin
+	AnyOrigin = "*"
+)
+
+//CORS is the policy of the cross-origin requests of the browsers. The
+//responses to the allowed origins echo the origin, so the browsers accept
+//them with credentials. Credentials are only allowed to the origins in the
+//list, not to the origins matched by AnyOrigin
+type CORS struct {
+	//AllowedOrigins origins allowed to call the API, e.g.
+	//https://shop.example.com, or AnyOrigin
+	AllowedOrigins []string
+
+	//AllowedMethods methods allowed in the cross-origin requests
+	AllowedMethods []string
+
+	//AllowedHeaders headers that the cross-origin requests can send
+	AllowedHeaders []string
+
+	//ExposedHeaders headers of the responses that the browsers expose
+	ExposedHeaders []string
+
+	//MaxAge how long the browsers cache the response to a preflight request
+	MaxAge time.Duration
+
+	//AllowCredentials allows the requests with cookies or authorization
+	//headers of the listed origins
+	AllowCredentials bool
+}
+
+//allow returns the origin of the request if the policy allows it, and
+//whether the origin is allowed with credentials
+func (c *CORS) allow(request events.APIGatewayProxyRequest) (string, bool) {
+
+	origin := Header(request, HeaderOrigin)
+	if origin == "" {
+		return "", false
+	}
+
+	var any bool
+	for _, o := range c.AllowedOrigins {
+		if strings.EqualFold(o, origin) {
+			return origin, c.AllowCredentials
+		}
+		any = any || o == AnyOrigin
+	}
+	if any {
+		return origin, false
+	}
+
+	return "", false
+}
+
+//headers adds the headers of the response to a cross-origin request. The
+//responses vary by origin, so the caches do not serve them to other origins
+func (c *CORS) headers(request events.APIGatewayProxyRequest,
+	response *events.APIGatewayProxyResponse) {
+
+	if response.Headers == nil {
+		response.Headers = map[string]string{}
+	}
+	response.Headers["Vary"] = HeaderOrigin
+
+	origin, credentials := c.allow(request)
+	if origin == "" {
+		return
+	}
+
+	response.Headers["Access-Control-Allow-Origin"] = origin
+	if credentials {
+		response.Headers["Access-Control-Allow-Credentials"] = "true"
+	}
+	if len(c.ExposedHeaders) > 0 {
+		response.Headers["Access-Control-Expose-Headers"] =
+			strings.Join(c.ExposedHeaders, ", ")
+	}
+}
+
+//preflight returns the response to a preflight request of a path whose routes
+//have the methods. The response allows the methods of the policy that the
+//path has, it does not have CORS headers when the origin or the requested
+//method are not allowed
+func (c *CORS) preflight(request events.APIGatewayProxyRequest,
+	methods []string) events.APIGatewayProxyResponse {
+
+	response := events.APIGatewayProxyResponse{
+		StatusCode: http.StatusNoContent,
+		Headers:    map[string]string{"Vary": HeaderOrigin},
+	}
+
+	var allowed []string
+	for _, m := range methods {
+		for _, a := range c.AllowedMethods {
+			if strings.EqualFold(a, m) {
+				allowed = append(allowed, m)
+				break
+			}
+		}
+	}
+
+	requested := Header(request, HeaderRequestMethod)
+	var ok bool
+	for _, m := range allowed {
+		ok = ok || m == requested
+	}
+
+	origin, credentials := c.allow(request)
+	if origin == "" || !ok {
+		return response
+	}
+
+	response.Headers["Access-Control-Allow-Origin"] = origin
+	response.Headers["Access-Control-Allow-Methods"] = strings.Join(allowed, ", ")
+	if len(c.AllowedHeaders) > 0 {
+		response.Headers["Access-Control-Allow-Headers"] =
+			strings.Join(c.AllowedHeaders, ", ")
+	}
+	if c.MaxAge > 0 {
+		response.Headers["Access-Control-Max-Age"] =
+			strconv.Itoa(int(c.MaxAge / time.Second))
+	}
+	if credentials {
+		response.Headers["Access-Control-Allow-Credentials"] = "true"
+	}
+
+	return response
+}
@@ -0,0 +1,54 @@
+package web
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+//Errors maps the status of a response to the error codes returned with it.
+//The handlers respond to their errors with it, and the OpenAPI document
+//describes the errors of a route with it
+type Errors map[int][]string
+
+//Status returns the status of the error code of err, or def when e does not
+//have the code
+func (e Errors) Status(err error, def int) int {
+	for status, codes := range e {
+		for _, code := range codes {
+			if code == err.Error() {
+				return status
+			}
+		}
+	}
+	return def
+}
+
+//merge adds the error codes of errs that e does not have
+func (e Errors) merge(errs Errors) {
+	for status, codes := range errs {
+		for _, code := range codes {
+			if !e.has(status, code) {
+				e[status] = append(e[status], code)
+			}
+		}
+	}
+}
+
+//has returns true if e has the error code with the status
+func (e Errors) has(status int, code string) bool {
+	for _, c := range e[status] {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+//GetErrorResponse returns the response for err, with the status of its code
+//in errs, or def when errs does not have the code
+func GetErrorResponse(ctx context.Context, err error, errs Errors, def int) (
+	events.APIGatewayProxyResponse, error) {
+
+	return GetResponse(ctx, err.Error(), errs.Status(err, def))
+}
@@ -6,7 +6,7 @@ import (
 	"net/http"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/rs/zerolog/log"
+	"github.com/roloum/store/api/internal/logging"
 )
 
 //GetResponse Returns a struct of type events.APIGatewayProxyResponse
@@ -16,23 +16,24 @@ import (
 func GetResponse(ctx context.Context, data interface{},
 	statusCode int) (events.APIGatewayProxyResponse, error) {
 
+	//The CORS headers are added by the Router, with its policy
 	headers := map[string]string{
 		"Content-Type": "application/json",
-		// Required for CORS support to work
-		"Access-Control-Allow-Origin": "*",
-		// Required for cookies, authorization headers with HTTPS
-		"Access-Control-Allow-Credentials": "true",
 	}
 
 	js, err := json.Marshal(data)
 	if err != nil {
-		log.Debug().Msgf("Error marshalling response: %v", data)
+		logging.Ctx(ctx).Error().Err(err).Interface("data", data).
+			Msg("Error marshalling response")
 		return events.APIGatewayProxyResponse{
 			StatusCode: http.StatusInternalServerError,
 		}, err
 	}
 
-	log.Debug().Msgf("status_code: %d, message: %v", statusCode, data)
+	logging.Ctx(ctx).Debug().
+		Int("status_code", statusCode).
+		Interface("data", data).
+		Msg("Response")
 
 	return events.APIGatewayProxyResponse{
 		Headers:    headers,
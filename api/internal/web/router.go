@@ -0,0 +1,437 @@
+package web
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+	"github.com/roloum/store/api/internal/logging"
+)
+
+const (
+	//HeaderRequestID header of the response with the ID of the request
+	HeaderRequestID = "X-Request-ID"
+
+	//HeaderRetryAfter header of the response with the seconds the client has
+	//to wait before sending the request again
+	HeaderRetryAfter = "Retry-After"
+)
+
+var (
+	//ErrRouteNotFound error returned when no route matches the path
+	ErrRouteNotFound = errors.New("RouteNotFound")
+
+	//ErrMethodNotAllowed error returned when the path matches a route, but
+	//not with the method of the request
+	ErrMethodNotAllowed = errors.New("MethodNotAllowed")
+)
+
+//HandlerFunc handles the requests of a route. The PathParameters of the
+//request are the parameters of the route, and Resource is its path template
+type HandlerFunc func(ctx context.Context, request events.APIGatewayProxyRequest) (
+	events.APIGatewayProxyResponse, error)
+
+//Middleware wraps the HandlerFunc of a route
+type Middleware func(next HandlerFunc) HandlerFunc
+
+//Route is a method and a path template, e.g. /cart/{cart_id}. A segment
+//between braces matches any segment of the path, and its value is the path
+//parameter with the name between the braces
+//The rest of the exported fields describe the route in the OpenAPI document
+type Route struct {
+	Method string
+	Path   string
+
+	//Summary describes what the route does
+	Summary string
+
+	//Query contains the query string parameters, with a value of their type
+	Query map[string]interface{}
+
+	//Body is a value of the type of the request body. Omit are the
+	//properties of Body that are not sent in the body
+	Body interface{}
+	Omit []string
+
+	//Status is the status of a successful response, and Response a value of
+	//the type of its body
+	Status   int
+	Response interface{}
+
+	//Errors contains the error codes of the route
+	Errors Errors
+
+	//Secured is set when the route requires a bearer token
+	Secured bool
+
+	segments    []string
+	handler     HandlerFunc
+	middlewares []Middleware
+}
+
+//Router dispatches the requests to the HandlerFunc of the route that matches
+//the method and the path. The lambda functions and the HTTP server use the
+//same routes, so both dispatch the requests the same way
+type Router struct {
+	routes      []*Route
+	middlewares []Middleware
+	cors        *CORS
+}
+
+//NewRouter returns a Router without routes
+func NewRouter() *Router {
+	return &Router{}
+}
+
+//Use adds middlewares that wrap every route, before the middlewares of the
+//route
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+//AllowCORS sets the policy of the cross-origin requests. The Router answers
+//the preflight requests of the paths of its routes, and adds the CORS headers
+//to the responses of the allowed origins. Without policy, the responses do
+//not have CORS headers and the browsers reject the cross-origin requests
+func (r *Router) AllowCORS(c CORS) {
+	r.cors = &c
+}
+
+//Handle adds a route. The middlewares only wrap this route. The route is
+//returned so it can be described
+func (r *Router) Handle(method, path string, handler HandlerFunc,
+	middlewares ...Middleware) *Route {
+
+	route := &Route{
+		Method:      method,
+		Path:        path,
+		Status:      http.StatusOK,
+		Errors:      Errors{},
+		segments:    splitPath(path),
+		handler:     handler,
+		middlewares: middlewares,
+	}
+	r.routes = append(r.routes, route)
+
+	return route
+}
+
+//Routes returns the routes sorted by path and method
+func (r *Router) Routes() []Route {
+	routes := make([]Route, 0, len(r.routes))
+	for _, route := range r.routes {
+		routes = append(routes, *route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+//Serve dispatches an API Gateway request. It returns 404 when no route
+//matches the path and 405, with the Allow header, when the path matches
+//routes with other methods
+//The logger of the context of the route has the ID of the request, which is
+//returned in the X-Request-ID header
+//The preflight requests are answered with the CORS policy, without calling
+//the handlers
+func (r *Router) Serve(ctx context.Context, request events.APIGatewayProxyRequest) (
+	events.APIGatewayProxyResponse, error) {
+
+	requestID := getRequestID(request)
+	ctx = logging.With(ctx, logging.FieldRequestID, requestID)
+
+	logging.Ctx(ctx).Debug().
+		Str("method", request.HTTPMethod).
+		Str("path", request.Path).
+		Str("body", request.Body).
+		Msg("Executing request")
+
+	response, err := r.dispatch(ctx, request)
+	if response.Headers == nil {
+		response.Headers = map[string]string{}
+	}
+	response.Headers[HeaderRequestID] = requestID
+	if r.cors != nil && !isPreflight(request) {
+		r.cors.headers(request, &response)
+	}
+
+	return response, err
+}
+
+//dispatch calls the HandlerFunc of the route of the request, wrapped by the
+//middlewares
+func (r *Router) dispatch(ctx context.Context, request events.APIGatewayProxyRequest) (
+	events.APIGatewayProxyResponse, error) {
+
+	segments := splitPath(request.Path)
+
+	var match *Route
+	var params map[string]string
+	var allowed []string
+	for _, route := range r.routes {
+		p, ok := route.match(segments)
+		if !ok {
+			continue
+		}
+		if route.Method != request.HTTPMethod {
+			allowed = append(allowed, route.Method)
+			continue
+		}
+
+		//The routes with more static segments are more specific: the path
+		//me/cart prefers the route /me/cart over /{user}/cart
+		if match == nil || route.static() > match.static() {
+			match, params = route, p
+		}
+	}
+
+	if match == nil {
+		if len(allowed) == 0 {
+			return GetResponse(ctx, ErrRouteNotFound.Error(), http.StatusNotFound)
+		}
+		sort.Strings(allowed)
+		if r.cors != nil && isPreflight(request) {
+			return r.cors.preflight(request, allowed), nil
+		}
+		response, err := GetResponse(ctx, ErrMethodNotAllowed.Error(),
+			http.StatusMethodNotAllowed)
+		response.Headers["Allow"] = strings.Join(allowed, ", ")
+		return response, err
+	}
+
+	request.Resource = match.Path
+	request.PathParameters = params
+
+	handler := match.handler
+	for n := len(match.middlewares) - 1; n >= 0; n-- {
+		handler = match.middlewares[n](handler)
+	}
+	for n := len(r.middlewares) - 1; n >= 0; n-- {
+		handler = r.middlewares[n](handler)
+	}
+
+	return handler(ctx, request)
+}
+
+//ServeHTTP dispatches an HTTP request, converted to an API Gateway request,
+//so the Router can be used by a net/http server. The source IP of the request
+//is the address of the client
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	request := events.APIGatewayProxyRequest{
+		HTTPMethod:                      req.Method,
+		Path:                            req.URL.Path,
+		Headers:                         map[string]string{},
+		MultiValueHeaders:               req.Header,
+		QueryStringParameters:           map[string]string{},
+		MultiValueQueryStringParameters: req.URL.Query(),
+		Body:                            string(body),
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		request.RequestContext.Identity.SourceIP = host
+	}
+	for name := range req.Header {
+		request.Headers[name] = req.Header.Get(name)
+	}
+	for name, values := range request.MultiValueQueryStringParameters {
+		request.QueryStringParameters[name] = values[0]
+	}
+
+	response, err := r.Serve(req.Context(), request)
+	if err != nil {
+		logging.Ctx(req.Context()).Error().Err(err).
+			Str("method", req.Method).
+			Str("path", req.URL.Path).
+			Msg("Error serving request")
+		http.Error(w, http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+
+	for name, value := range response.Headers {
+		w.Header().Set(name, value)
+	}
+	for name, values := range response.MultiValueHeaders {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+
+	status := response.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+
+	if response.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(response.Body)
+		if err != nil {
+			logging.Ctx(req.Context()).Error().Err(err).
+				Str(logging.FieldRequestID, response.Headers[HeaderRequestID]).
+				Msg("Error decoding response body")
+			return
+		}
+		w.Write(decoded)
+		return
+	}
+	io.WriteString(w, response.Body)
+}
+
+//getRequestID returns the ID of the API Gateway request. The requests that
+//do not come from API Gateway keep the X-Request-ID header of the client, or
+//get a new ID
+func getRequestID(request events.APIGatewayProxyRequest) string {
+
+	if request.RequestContext.RequestID != "" {
+		return request.RequestContext.RequestID
+	}
+	if id := Header(request, HeaderRequestID); id != "" {
+		return id
+	}
+
+	return uuid.New().String()
+}
+
+//isPreflight returns true if the request is the preflight request that a
+//browser sends before a cross-origin request
+func isPreflight(request events.APIGatewayProxyRequest) bool {
+	return request.HTTPMethod == http.MethodOptions &&
+		Header(request, HeaderRequestMethod) != ""
+}
+
+//Header returns the value of the header of the request. The names of the
+//headers are case insensitive, API Gateway keeps them as the client sent them
+func Header(request events.APIGatewayProxyRequest, name string) string {
+	for n, value := range request.Headers {
+		if strings.EqualFold(n, name) && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+//QueryInt returns the query string parameter as an int, or def when the
+//request does not have it
+func QueryInt(request events.APIGatewayProxyRequest, name string, def int) (
+	int, error) {
+
+	value, ok := request.QueryStringParameters[name]
+	if !ok || value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+//Doc sets the summary of the route
+func (r *Route) Doc(summary string) *Route {
+	r.Summary = summary
+	return r
+}
+
+//WithQuery adds a query string parameter. v is a value of its type
+func (r *Route) WithQuery(name string, v interface{}) *Route {
+	if r.Query == nil {
+		r.Query = map[string]interface{}{}
+	}
+	r.Query[name] = v
+	return r
+}
+
+//Accepts sets the type of the request body. The properties in omit are not
+//sent in the body, e.g. the ones taken from the path
+func (r *Route) Accepts(body interface{}, omit ...string) *Route {
+	r.Body = body
+	r.Omit = omit
+	return r
+}
+
+//Returns sets the status and the type of the body of a successful response
+func (r *Route) Returns(status int, response interface{}) *Route {
+	r.Status = status
+	r.Response = response
+	return r
+}
+
+//Fails adds error codes to the route
+func (r *Route) Fails(errs ...Errors) *Route {
+	for _, e := range errs {
+		r.Errors.merge(e)
+	}
+	return r
+}
+
+//Secure sets that the route requires a bearer token
+func (r *Route) Secure() *Route {
+	r.Secured = true
+	return r
+}
+
+//match returns the path parameters if the route matches the segments of a
+//path
+func (r *Route) match(segments []string) (map[string]string, bool) {
+
+	if len(segments) != len(r.segments) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for n, segment := range r.segments {
+		if isParam(segment) {
+			if segments[n] == "" {
+				return nil, false
+			}
+			params[segment[1:len(segment)-1]] = segments[n]
+			continue
+		}
+		if segment != segments[n] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+//static returns the number of segments of the route that are not parameters
+func (r *Route) static() int {
+	var n int
+	for _, segment := range r.segments {
+		if !isParam(segment) {
+			n++
+		}
+	}
+	return n
+}
+
+//isParam returns true if the segment of a path template is a parameter
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+//splitPath returns the segments of a path, without the empty segments of
+//the leading and trailing slashes
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
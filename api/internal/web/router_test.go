@@ -0,0 +1,315 @@
+package web
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/rs/zerolog"
+)
+
+func init() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+//echo returns a HandlerFunc that responds with the name of the route and its
+//path parameters
+func echo(name string) HandlerFunc {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse, error) {
+
+		body := name
+		for _, p := range []string{"cart_id", "item_id", "user"} {
+			if v, ok := request.PathParameters[p]; ok {
+				body += " " + p + "=" + v
+			}
+		}
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusOK, Body: body}, nil
+	}
+}
+
+//getRouter returns a Router with routes that share their paths
+func getRouter() *Router {
+	r := NewRouter()
+	r.Handle(http.MethodGet, "/cart/{cart_id}", echo("getCart"))
+	r.Handle(http.MethodPost, "/cart", echo("createCart"))
+	r.Handle(http.MethodPost, "/cart/{cart_id}", echo("addItem"))
+	r.Handle(http.MethodDelete, "/cart/{cart_id}/items/{item_id}", echo("deleteItem"))
+	r.Handle(http.MethodGet, "/{user}/cart", echo("userCart"))
+	r.Handle(http.MethodGet, "/me/cart", echo("activeCart"))
+	return r
+}
+
+//TestServe tests the dispatch of the requests to the routes
+func TestServe(t *testing.T) {
+
+	router := getRouter()
+
+	tests := []struct {
+		desc   string
+		method string
+		path   string
+		status int
+		body   string
+		allow  string
+	}{
+		{"Create", http.MethodPost, "/cart", http.StatusOK, "createCart", ""},
+		{"Add", http.MethodPost, "/cart/c1", http.StatusOK, "addItem cart_id=c1", ""},
+		{"TrailingSlash", http.MethodGet, "/cart/c1/", http.StatusOK,
+			"getCart cart_id=c1", ""},
+		{"Params", http.MethodDelete, "/cart/c1/items/i1", http.StatusOK,
+			"deleteItem cart_id=c1 item_id=i1", ""},
+		{"StaticPreferred", http.MethodGet, "/me/cart", http.StatusOK, "activeCart", ""},
+		{"Param", http.MethodGet, "/u1/cart", http.StatusOK, "userCart user=u1", ""},
+		{"NotFound", http.MethodGet, "/carts", http.StatusNotFound,
+			`"RouteNotFound"`, ""},
+		{"EmptyParam", http.MethodDelete, "/cart//items/i1", http.StatusNotFound,
+			`"RouteNotFound"`, ""},
+		{"MethodNotAllowed", http.MethodPut, "/cart/c1", http.StatusMethodNotAllowed,
+			`"MethodNotAllowed"`, "GET, POST"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			response, err := router.Serve(context.Background(),
+				events.APIGatewayProxyRequest{HTTPMethod: tc.method, Path: tc.path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.StatusCode != tc.status || response.Body != tc.body {
+				t.Errorf("Expected: %d %s. Received: %d %s", tc.status, tc.body,
+					response.StatusCode, response.Body)
+			}
+			if response.Headers["Allow"] != tc.allow {
+				t.Errorf("Expected Allow: %q. Received: %q", tc.allow,
+					response.Headers["Allow"])
+			}
+		})
+	}
+}
+
+//TestMiddlewares tests that the middlewares of the router wrap the
+//middlewares of the route
+func TestMiddlewares(t *testing.T) {
+
+	tag := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, request events.APIGatewayProxyRequest) (
+				events.APIGatewayProxyResponse, error) {
+				response, err := next(ctx, request)
+				response.Body = name + "(" + response.Body + ")"
+				return response, err
+			}
+		}
+	}
+
+	r := NewRouter()
+	r.Use(tag("router"))
+	r.Handle(http.MethodGet, "/cart", echo("cart"), tag("route"))
+
+	response, _ := r.Serve(context.Background(),
+		events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Path: "/cart"})
+	if response.Body != "router(route(cart))" {
+		t.Errorf("Expected: router(route(cart)). Received: %s", response.Body)
+	}
+}
+
+//TestServeHTTP tests that an HTTP server dispatches the requests like the
+//lambda functions
+func TestServeHTTP(t *testing.T) {
+
+	server := httptest.NewServer(getRouter())
+	defer server.Close()
+
+	request, _ := http.NewRequest(http.MethodDelete,
+		server.URL+"/cart/c1/items/i1?sku=S1", strings.NewReader(""))
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	body, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK ||
+		string(body) != "deleteItem cart_id=c1 item_id=i1" {
+		t.Errorf("Unexpected response: %d %s", response.StatusCode, body)
+	}
+
+	response, err = http.Post(server.URL+"/cart/c1/items/i1", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusMethodNotAllowed ||
+		response.Header.Get("Allow") != "DELETE" {
+		t.Errorf("Unexpected response: %d %s", response.StatusCode,
+			response.Header.Get("Allow"))
+	}
+}
+
+//TestRequestID tests that the ID of the request is returned in the
+//X-Request-ID header
+func TestRequestID(t *testing.T) {
+
+	router := getRouter()
+
+	tests := []struct {
+		desc     string
+		request  events.APIGatewayProxyRequest
+		expected string
+	}{
+		{"APIGateway", events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet, Path: "/cart/c1",
+			Headers:        map[string]string{"X-Request-Id": "client"},
+			RequestContext: events.APIGatewayProxyRequestContext{RequestID: "apigw"},
+		}, "apigw"},
+		{"Header", events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet, Path: "/cart/c1",
+			Headers: map[string]string{"x-request-id": "client"},
+		}, "client"},
+		{"NotFound", events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet, Path: "/carts",
+			RequestContext: events.APIGatewayProxyRequestContext{RequestID: "apigw"},
+		}, "apigw"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			response, _ := router.Serve(context.Background(), tc.request)
+			if response.Headers[HeaderRequestID] != tc.expected {
+				t.Errorf("Expected: %s. Received: %s", tc.expected,
+					response.Headers[HeaderRequestID])
+			}
+		})
+	}
+
+	//Requests without ID get a new one
+	a, _ := router.Serve(context.Background(),
+		events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Path: "/cart/c1"})
+	b, _ := router.Serve(context.Background(),
+		events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Path: "/cart/c1"})
+	if a.Headers[HeaderRequestID] == "" ||
+		a.Headers[HeaderRequestID] == b.Headers[HeaderRequestID] {
+		t.Errorf("Expected new request IDs. Received: %q and %q",
+			a.Headers[HeaderRequestID], b.Headers[HeaderRequestID])
+	}
+}
+
+//TestCORS tests the preflight requests and the CORS headers of the
+//responses
+func TestCORS(t *testing.T) {
+
+	router := getRouter()
+	router.AllowCORS(CORS{
+		AllowedOrigins:   []string{"https://shop.example.com", AnyOrigin},
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{HeaderRequestID},
+		MaxAge:           10 * time.Minute,
+		AllowCredentials: true,
+	})
+
+	shop, other := "https://shop.example.com", "https://other.example.com"
+
+	tests := []struct {
+		desc     string
+		method   string
+		path     string
+		headers  map[string]string
+		status   int
+		expected map[string]string
+	}{
+		{"Preflight", http.MethodOptions, "/cart/c1",
+			map[string]string{"origin": shop, HeaderRequestMethod: http.MethodPost},
+			http.StatusNoContent, map[string]string{
+				"Access-Control-Allow-Origin":      shop,
+				"Access-Control-Allow-Methods":     "GET, POST",
+				"Access-Control-Allow-Headers":     "Authorization, Content-Type",
+				"Access-Control-Max-Age":           "600",
+				"Access-Control-Allow-Credentials": "true",
+			}},
+		{"PreflightAnyOrigin", http.MethodOptions, "/cart",
+			map[string]string{"Origin": other, HeaderRequestMethod: http.MethodPost},
+			http.StatusNoContent, map[string]string{
+				"Access-Control-Allow-Origin":      other,
+				"Access-Control-Allow-Methods":     "POST",
+				"Access-Control-Allow-Credentials": "",
+			}},
+		{"PreflightMethodNotAllowed", http.MethodOptions, "/cart/c1/items/i1",
+			map[string]string{"Origin": shop, HeaderRequestMethod: http.MethodDelete},
+			http.StatusNoContent, map[string]string{
+				"Access-Control-Allow-Origin": "",
+			}},
+		{"PreflightNotFound", http.MethodOptions, "/carts",
+			map[string]string{"Origin": shop, HeaderRequestMethod: http.MethodGet},
+			http.StatusNotFound, map[string]string{}},
+		{"OptionsWithoutPreflight", http.MethodOptions, "/cart/c1",
+			map[string]string{"Origin": shop},
+			http.StatusMethodNotAllowed, map[string]string{
+				"Access-Control-Allow-Origin": shop,
+			}},
+		{"Request", http.MethodGet, "/cart/c1",
+			map[string]string{"Origin": shop}, http.StatusOK, map[string]string{
+				"Access-Control-Allow-Origin":      shop,
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    HeaderRequestID,
+				"Vary":                             HeaderOrigin,
+			}},
+		{"Error", http.MethodPut, "/cart/c1",
+			map[string]string{"Origin": shop}, http.StatusMethodNotAllowed,
+			map[string]string{"Access-Control-Allow-Origin": shop}},
+		{"SameOrigin", http.MethodGet, "/cart/c1", map[string]string{},
+			http.StatusOK, map[string]string{"Access-Control-Allow-Origin": ""}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			response, err := router.Serve(context.Background(),
+				events.APIGatewayProxyRequest{HTTPMethod: tc.method, Path: tc.path,
+					Headers: tc.headers})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.StatusCode != tc.status {
+				t.Errorf("Expected: %d. Received: %d", tc.status, response.StatusCode)
+			}
+			for name, value := range tc.expected {
+				if response.Headers[name] != value {
+					t.Errorf("Expected %s: %q. Received: %q", name, value,
+						response.Headers[name])
+				}
+			}
+		})
+	}
+
+	//Without policy the responses do not have CORS headers
+	response, _ := getRouter().Serve(context.Background(),
+		events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Path: "/cart/c1",
+			Headers: map[string]string{"Origin": shop}})
+	if _, ok := response.Headers["Access-Control-Allow-Origin"]; ok {
+		t.Errorf("Unexpected CORS headers: %v", response.Headers)
+	}
+}
+
+//TestQueryInt tests the conversion of the query string parameters
+func TestQueryInt(t *testing.T) {
+
+	request := events.APIGatewayProxyRequest{
+		QueryStringParameters: map[string]string{"limit": "20", "page": "x"},
+	}
+
+	if n, err := QueryInt(request, "limit", 10); n != 20 || err != nil {
+		t.Errorf("Expected 20. Received: %d %v", n, err)
+	}
+	if n, err := QueryInt(request, "offset", 10); n != 10 || err != nil {
+		t.Errorf("Expected 10. Received: %d %v", n, err)
+	}
+	if _, err := QueryInt(request, "page", 10); err == nil {
+		t.Errorf("Expected error")
+	}
+}
@@ -0,0 +1,430 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	saws "github.com/roloum/store/api/internal/aws"
+	"github.com/roloum/store/api/internal/events"
+	"github.com/roloum/store/api/internal/logging"
+)
+
+const (
+	//HeaderEvent header with the type of the delivered event
+	HeaderEvent = "X-Store-Event"
+
+	//HeaderDelivery header with the ID of the delivered event, which is the
+	//same in every attempt
+	HeaderDelivery = "X-Store-Delivery"
+
+	//HeaderTimestamp header with the unix time of the attempt
+	HeaderTimestamp = "X-Store-Timestamp"
+
+	//HeaderSignature header with the signature of the timestamp and the body
+	HeaderSignature = "X-Store-Signature"
+
+	//timestampLayout fixed width layout of the attempts in the sort key, so
+	//they sort by time
+	timestampLayout = "2006-01-02T15:04:05.000000000Z"
+
+	//deliveryLease how long a claimed delivery is not attempted by other
+	//workers. It is longer than the timeout of an attempt
+	deliveryLease = 5 * time.Minute
+)
+
+//Publish enqueues a delivery of the events to the subscriptions that accept
+//them, so the Handler can be used as an events.Sink. The deliveries are
+//attempted by DeliverPending, so a slow or failing endpoint does not hold the
+//stream. Only errors storing the deliveries return an error, so the batch is
+//retried. A batch retried by the stream does not enqueue the deliveries twice
+func (h *Handler) Publish(ctx context.Context, evs []events.Event) error {
+
+	if len(evs) == 0 {
+		return nil
+	}
+
+	subscriptions, err := h.subscriptions(ctx)
+	if err != nil {
+		return events.ErrCouldNotPublishEvents
+	}
+
+	now := h.now().UTC()
+	for _, e := range evs {
+		for n := range subscriptions {
+			if !subscriptions[n].accepts(e.Type()) {
+				continue
+			}
+			if err := h.enqueue(ctx, &subscriptions[n], e, now); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+//DeliverPending attempts the pending deliveries that are due. A failed
+//delivery is attempted again after a backoff, which is doubled after every
+//attempt, and the event is stored as a dead letter of the subscription after
+//the last attempt. Deliveries whose state could not be stored are attempted
+//again by the next call, which returns ErrCouldNotDeliverEvents
+func (h *Handler) DeliverPending(ctx context.Context) error {
+
+	subscriptions, err := h.subscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var failed bool
+	for n := range subscriptions {
+		deliveries, err := h.pending(ctx, subscriptions[n].SubscriptionID,
+			h.now().UTC())
+		if err != nil {
+			failed = true
+			continue
+		}
+		for m := range deliveries {
+			if err := h.deliver(ctx, &subscriptions[n], &deliveries[m]); err != nil {
+				failed = true
+			}
+		}
+	}
+
+	if failed {
+		return ErrCouldNotDeliverEvents
+	}
+
+	return nil
+}
+
+//Signature returns the signature of a delivery, the hex encoded HMAC-SHA256 of
+//the timestamp and the body joined by a dot, prefixed by sha256=
+func Signature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//enqueue stores a pending delivery of the event to the subscription, due now.
+//The delivery of an event that is already pending is not stored again
+func (h *Handler) enqueue(ctx context.Context, s *Subscription, e events.Event,
+	now time.Time) error {
+
+	meta := e.Metadata()
+	ctx = logging.With(logging.With(ctx, fieldWebhookID, s.SubscriptionID),
+		fieldEventID, meta.EventID)
+
+	body, err := json.Marshal(payload{EventID: meta.EventID, Type: e.Type(), Event: e})
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error marshalling event")
+		return events.ErrCouldNotPublishEvents
+	}
+
+	p := pending{
+		EventID:   meta.EventID,
+		EventType: e.Type(),
+		Payload:   string(body),
+		DueAt:     now.UnixNano(),
+	}
+	row, err := dynamodbattribute.MarshalMap(p)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error marshalling delivery")
+		return events.ErrCouldNotPublishEvents
+	}
+	row["pk"] = &dynamodb.AttributeValue{S: aws.String(getWebhookPK(s.SubscriptionID))}
+	row["sk"] = &dynamodb.AttributeValue{S: aws.String(DynamoDBPrefixPending + meta.EventID)}
+	row["type"] = &dynamodb.AttributeValue{S: aws.String(DynamoDBRowTypePending)}
+
+	_, err = h.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		Item:                row,
+		TableName:           aws.String(h.tableName),
+		ConditionExpression: aws.String("attribute_not_exists(pk) and attribute_not_exists(sk)"),
+	})
+	if err != nil && !saws.IsErrorOfType(err,
+		dynamodb.ErrCodeConditionalCheckFailedException) {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error enqueuing event")
+		return events.ErrCouldNotPublishEvents
+	}
+
+	return nil
+}
+
+//pending returns the pending deliveries of the subscription that are due
+func (h *Handler) pending(ctx context.Context, webhookID string, now time.Time) (
+	[]pending, error) {
+
+	ctx = logging.With(ctx, fieldWebhookID, webhookID)
+
+	input := &dynamodb.QueryInput{
+		KeyConditionExpression: aws.String("pk = :pk and begins_with(sk, :sk)"),
+		FilterExpression:       aws.String("due_at <= :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pk":  {S: aws.String(getWebhookPK(webhookID))},
+			":sk":  {S: aws.String(DynamoDBPrefixPending)},
+			":now": {N: aws.String(strconv.FormatInt(now.UnixNano(), 10))},
+		},
+		TableName: aws.String(h.tableName),
+	}
+
+	deliveries := []pending{}
+	for {
+		result, err := h.svc.QueryWithContext(ctx, input)
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("Error loading pending deliveries")
+			return nil, ErrCouldNotDeliverEvents
+		}
+
+		page := []pending{}
+		if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			logging.Ctx(ctx).Error().Err(err).
+				Msg("Error unmarshalling pending deliveries")
+			return nil, ErrCouldNotDeliverEvents
+		}
+		deliveries = append(deliveries, page...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return deliveries, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+//deliver claims the pending delivery and attempts it, and then deletes it
+//when it was accepted or it was the last attempt, or schedules the next
+//attempt. A delivery claimed by a concurrent worker is not attempted
+func (h *Handler) deliver(ctx context.Context, s *Subscription, p *pending) error {
+
+	ctx = logging.With(logging.With(ctx, fieldWebhookID, s.SubscriptionID),
+		fieldEventID, p.EventID)
+
+	a := Attempt{
+		EventID:     p.EventID,
+		EventType:   p.EventType,
+		Attempt:     p.Attempt + 1,
+		AttemptedAt: h.now().UTC(),
+	}
+
+	claimed, err := h.claim(ctx, s.SubscriptionID, p, a.AttemptedAt)
+	if err != nil || !claimed {
+		return err
+	}
+
+	a.StatusCode, err = h.send(ctx, s, p.EventType, p.EventID, []byte(p.Payload),
+		a.AttemptedAt)
+	if err == nil {
+		a.Delivered = true
+	} else {
+		a.Error = err.Error()
+		a.DeadLetter = a.Attempt >= h.maxAttempts
+	}
+
+	//The attempts are informative, a failure to store them does not
+	//repeat the delivery
+	if err := h.saveAttempt(ctx, s.SubscriptionID, &a); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error saving delivery attempt")
+	}
+
+	switch {
+	case a.Delivered:
+		logging.Ctx(ctx).Debug().Int("attempt", a.Attempt).Msg("Event delivered")
+	case a.DeadLetter:
+		if err := h.saveDeadLetter(ctx, s, p, a.Attempt); err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("Error saving dead letter")
+			return ErrCouldNotDeliverEvents
+		}
+	default:
+		logging.Ctx(ctx).Warn().Int("attempt", a.Attempt).Str("error", a.Error).
+			Msg("Delivery attempt failed")
+		return h.reschedule(ctx, s.SubscriptionID, p, a.AttemptedAt.Add(
+			h.backoff*time.Duration(1<<uint(a.Attempt-1))))
+	}
+
+	return h.dequeue(ctx, s.SubscriptionID, p)
+}
+
+//claim counts the attempt of the pending delivery before it is sent, and
+//leases it for deliveryLease, unless a concurrent worker claimed it first.
+//A worker that stops before storing the outcome leaves the delivery to be
+//attempted again when the lease expires. The attempt of the claimed delivery
+//is updated, so the following writes are conditioned on it
+func (h *Handler) claim(ctx context.Context, webhookID string, p *pending,
+	now time.Time) (bool, error) {
+
+	_, err := h.svc.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"pk": {S: aws.String(getWebhookPK(webhookID))},
+			"sk": {S: aws.String(DynamoDBPrefixPending + p.EventID)},
+		},
+		UpdateExpression:    aws.String("set attempt = :attempt, due_at = :due_at"),
+		ConditionExpression: aws.String("attempt = :previous"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":attempt":  {N: aws.String(strconv.Itoa(p.Attempt + 1))},
+			":previous": {N: aws.String(strconv.Itoa(p.Attempt))},
+			":due_at": {N: aws.String(strconv.FormatInt(
+				now.Add(deliveryLease).UnixNano(), 10))},
+		},
+		TableName: aws.String(h.tableName),
+	})
+	if err != nil {
+		return false, h.checkPendingWrite(ctx, err)
+	}
+
+	p.Attempt++
+
+	return true, nil
+}
+
+//reschedule stores when the next attempt of the claimed delivery is due,
+//unless a concurrent worker claimed it after its lease expired
+func (h *Handler) reschedule(ctx context.Context, webhookID string, p *pending,
+	dueAt time.Time) error {
+
+	_, err := h.svc.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"pk": {S: aws.String(getWebhookPK(webhookID))},
+			"sk": {S: aws.String(DynamoDBPrefixPending + p.EventID)},
+		},
+		UpdateExpression:    aws.String("set due_at = :due_at"),
+		ConditionExpression: aws.String("attempt = :attempt"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":attempt": {N: aws.String(strconv.Itoa(p.Attempt))},
+			":due_at":  {N: aws.String(strconv.FormatInt(dueAt.UnixNano(), 10))},
+		},
+		TableName: aws.String(h.tableName),
+	})
+
+	return h.checkPendingWrite(ctx, err)
+}
+
+//dequeue deletes the claimed delivery, unless a concurrent worker claimed it
+//after its lease expired
+func (h *Handler) dequeue(ctx context.Context, webhookID string, p *pending) error {
+
+	_, err := h.svc.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"pk": {S: aws.String(getWebhookPK(webhookID))},
+			"sk": {S: aws.String(DynamoDBPrefixPending + p.EventID)},
+		},
+		ConditionExpression: aws.String("attempt = :attempt"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":attempt": {N: aws.String(strconv.Itoa(p.Attempt))},
+		},
+		TableName: aws.String(h.tableName),
+	})
+
+	return h.checkPendingWrite(ctx, err)
+}
+
+//checkPendingWrite maps the error of a write of a pending delivery. A
+//delivery claimed by a concurrent worker is left to it
+func (h *Handler) checkPendingWrite(ctx context.Context, err error) error {
+
+	if err == nil {
+		return nil
+	}
+	if saws.IsErrorOfType(err, dynamodb.ErrCodeConditionalCheckFailedException) {
+		logging.Ctx(ctx).Info().Msg("Delivery was claimed concurrently")
+		return nil
+	}
+
+	logging.Ctx(ctx).Error().Err(err).Msg("Error saving delivery")
+	return ErrCouldNotDeliverEvents
+}
+
+//send posts the body to the subscription and returns the status code of the
+//response. Responses that are not 2xx return an error
+func (h *Handler) send(ctx context.Context, s *Subscription, eventType,
+	eventID string, body []byte, at time.Time) (int, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL,
+		bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, eventType)
+	req.Header.Set(HeaderDelivery, eventID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Signature(s.Secret, timestamp, body))
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	//Drain the body so the connection can be reused
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+//saveAttempt stores a delivery attempt in the partition of the subscription
+func (h *Handler) saveAttempt(ctx context.Context, webhookID string, a *Attempt) error {
+
+	row, err := dynamodbattribute.MarshalMap(a)
+	if err != nil {
+		return err
+	}
+	row["pk"] = &dynamodb.AttributeValue{S: aws.String(getWebhookPK(webhookID))}
+	row["sk"] = &dynamodb.AttributeValue{S: aws.String(fmt.Sprintf("%s%s#%s#%d",
+		DynamoDBPrefixDelivery, a.AttemptedAt.Format(timestampLayout), a.EventID,
+		a.Attempt))}
+	row["type"] = &dynamodb.AttributeValue{S: aws.String(DynamoDBRowTypeDelivery)}
+
+	_, err = h.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		Item:      row,
+		TableName: aws.String(h.tableName),
+	})
+
+	return err
+}
+
+//saveDeadLetter stores the payload of an event that could not be delivered
+//to the subscription, so it can be inspected or replayed
+func (h *Handler) saveDeadLetter(ctx context.Context, s *Subscription,
+	p *pending, attempts int) error {
+
+	_, err := h.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		Item: map[string]*dynamodb.AttributeValue{
+			"pk":         {S: aws.String(getWebhookPK(s.SubscriptionID))},
+			"sk":         {S: aws.String(DynamoDBPrefixDeadLetter + p.EventID)},
+			"type":       {S: aws.String(DynamoDBRowTypeDeadLetter)},
+			"event_id":   {S: aws.String(p.EventID)},
+			"event_type": {S: aws.String(p.EventType)},
+			"url":        {S: aws.String(s.URL)},
+			"attempts":   {N: aws.String(strconv.Itoa(attempts))},
+			"payload":    {S: aws.String(p.Payload)},
+			"created_at": {S: aws.String(h.now().UTC().Format(time.RFC3339))},
+		},
+		TableName: aws.String(h.tableName),
+	})
+	if err != nil {
+		return err
+	}
+
+	logging.Ctx(ctx).Warn().Int("attempts", attempts).Msg("Event stored as dead letter")
+
+	return nil
+}
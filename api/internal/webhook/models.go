@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/roloum/store/api/internal/events"
+)
+
+//Subscription is an endpoint of a partner system that receives the events.
+//EventTypes filters the events, all of them are delivered when it is empty.
+//The Secret signs the deliveries, it is only returned when the subscription
+//is created
+type Subscription struct {
+	SubscriptionID string    `json:"webhook_id"`
+	URL            string    `json:"url"`
+	EventTypes     []string  `json:"event_types,omitempty"`
+	Secret         string    `json:"secret,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+//accepts returns true if the subscription receives events of the type
+func (s *Subscription) accepts(eventType string) bool {
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+//List contains the webhook subscriptions
+type List struct {
+	Subscriptions []Subscription `json:"webhooks"`
+}
+
+//NewSubscriptionInfo contains the information of a new subscription. A
+//secret is generated when it is not set
+type NewSubscriptionInfo struct {
+	URL        string   `json:"url" validate:"required,url"`
+	EventTypes []string `json:"event_types" validate:"dive,oneof=CartCreated ItemAdded QuantityChanged ItemRemoved CartAbandoned"`
+	Secret     string   `json:"secret" validate:"omitempty,min=16"`
+}
+
+//Attempt is a delivery attempt of an event to a subscription. StatusCode is
+//zero when the request failed before receiving a response. DeadLetter is set
+//on the last failed attempt, after which the event is not retried
+type Attempt struct {
+	EventID     string    `json:"event_id"`
+	EventType   string    `json:"event_type"`
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Delivered   bool      `json:"delivered"`
+	DeadLetter  bool      `json:"dead_letter,omitempty"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+//Deliveries contains the latest delivery attempts of a subscription
+type Deliveries struct {
+	SubscriptionID string    `json:"webhook_id"`
+	Attempts       []Attempt `json:"attempts"`
+}
+
+//payload is the body of a delivery
+type payload struct {
+	EventID string       `json:"event_id"`
+	Type    string       `json:"type"`
+	Event   events.Event `json:"event"`
+}
+
+//pending is a delivery of an event to a subscription that has not been
+//accepted yet. Attempt is the number of attempts made, and DueAt the unix
+//time in nanoseconds of the next one
+type pending struct {
+	EventID   string `json:"event_id"`
+	EventType string `json:"event_type"`
+	Payload   string `json:"payload"`
+	Attempt   int    `json:"attempt"`
+	DueAt     int64  `json:"due_at"`
+}
@@ -0,0 +1,43 @@
+package webhook
+
+import (
+	"errors"
+
+	validator "github.com/go-playground/validator/v10"
+)
+
+const (
+	//ErrURLIsInvalid Error describes when the URL of the subscription is
+	//empty or invalid
+	ErrURLIsInvalid = "URLIsInvalid"
+
+	//ErrEventTypeIsInvalid Error describes when an event type is not one of
+	//the cart events
+	ErrEventTypeIsInvalid = "EventTypeIsInvalid"
+
+	//ErrSecretIsTooShort Error describes when the secret has less than 16
+	//characters
+	ErrSecretIsTooShort = "SecretIsTooShort"
+)
+
+var validate *validator.Validate
+
+//init instantiates a validator
+func init() {
+	validate = validator.New()
+}
+
+//getValidationError Returns the first error reported by the validator
+func getValidationError(verr error) error {
+
+	//Retrieve first error
+	err := verr.(validator.ValidationErrors)[0]
+
+	switch err.Field() {
+	case "URL":
+		return errors.New(ErrURLIsInvalid)
+	case "Secret":
+		return errors.New(ErrSecretIsTooShort)
+	}
+	return errors.New(ErrEventTypeIsInvalid)
+}
@@ -0,0 +1,325 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/google/uuid"
+	"github.com/roloum/store/api/internal/logging"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	//DynamoDBRowTypeWebhook Attribute used to identify a webhook subscription
+	DynamoDBRowTypeWebhook = "Webhook"
+
+	//DynamoDBRowTypeDelivery Attribute used to identify a delivery attempt
+	DynamoDBRowTypeDelivery = "WebhookDelivery"
+
+	//DynamoDBRowTypePending Attribute used to identify a delivery of an event
+	//to a subscription that has not been accepted yet
+	DynamoDBRowTypePending = "WebhookPending"
+
+	//DynamoDBRowTypeDeadLetter Attribute used to identify an event that could
+	//not be delivered to a subscription
+	DynamoDBRowTypeDeadLetter = "WebhookDeadLetter"
+
+	//DynamoDBPartitionWebhooks Partition key of the subscriptions
+	DynamoDBPartitionWebhooks = "WEBHOOKS"
+
+	//DynamoDBPrefixWebhook Prefix for the webhook key
+	DynamoDBPrefixWebhook = "WEBHOOK#"
+
+	//DynamoDBPrefixDelivery Prefix for the sort key of a delivery attempt
+	DynamoDBPrefixDelivery = "DELIVERY#"
+
+	//DynamoDBPrefixPending Prefix for the sort key of a pending delivery
+	DynamoDBPrefixPending = "PENDING#"
+
+	//DynamoDBPrefixDeadLetter Prefix for the sort key of a dead letter
+	DynamoDBPrefixDeadLetter = "DEADLETTER#"
+
+	//ErrStoreTableNameIsEmpty Error describes when DynamoDB table name is empty
+	ErrStoreTableNameIsEmpty = "StoreTableNameIsEmpty"
+
+	//deliveriesLimit maximum number of attempts returned by Deliveries
+	deliveriesLimit = 100
+
+	//fieldWebhookID field of the subscription in the log lines
+	fieldWebhookID = "webhook_id"
+
+	//fieldEventID field of the delivered event in the log lines
+	fieldEventID = "event_id"
+)
+
+var (
+	//ErrWebhookIDIsEmpty error returned when the webhook ID is empty
+	ErrWebhookIDIsEmpty = errors.New("WebhookIDIsEmpty")
+
+	//ErrWebhookNotFound error returned when the subscription does not exist
+	ErrWebhookNotFound = errors.New("WebhookNotFound")
+
+	//ErrCouldNotCreateWebhook error returned if we failed to save the
+	//subscription
+	ErrCouldNotCreateWebhook = errors.New("CouldNotCreateWebhook")
+
+	//ErrCouldNotLoadWebhooks error returned if we failed to load the
+	//subscriptions
+	ErrCouldNotLoadWebhooks = errors.New("CouldNotLoadWebhooks")
+
+	//ErrCouldNotDeleteWebhook error returned if we failed to delete the
+	//subscription
+	ErrCouldNotDeleteWebhook = errors.New("CouldNotDeleteWebhook")
+
+	//ErrCouldNotLoadDeliveries error returned if we failed to load the
+	//delivery attempts
+	ErrCouldNotLoadDeliveries = errors.New("CouldNotLoadDeliveries")
+
+	//ErrCouldNotDeliverEvents error returned if we failed to load the pending
+	//deliveries or to store their state
+	ErrCouldNotDeliverEvents = errors.New("CouldNotDeliverEvents")
+)
+
+//Doer sends the HTTP requests of the deliveries. *http.Client satisfies it
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+//Handler struct is a handler for the webhook subscriptions and the delivery
+//of the events to them
+type Handler struct {
+	svc         dynamodbiface.DynamoDBAPI
+	tableName   string
+	client      Doer
+	maxAttempts int
+	backoff     time.Duration
+	now         func() time.Time
+}
+
+//Option configures optional dependencies of the Handler
+type Option func(*Handler)
+
+//WithClient sets the client that sends the deliveries
+func WithClient(c Doer) Option {
+	return func(h *Handler) {
+		h.client = c
+	}
+}
+
+//WithRetry sets the attempts of every delivery and the backoff before the
+//second attempt, which is doubled before every following attempt. The
+//attempts are made by DeliverPending, so the backoff is rounded up to the
+//interval between its calls
+func WithRetry(maxAttempts int, backoff time.Duration) Option {
+	return func(h *Handler) {
+		if maxAttempts > 0 {
+			h.maxAttempts = maxAttempts
+		}
+		h.backoff = backoff
+	}
+}
+
+//New returns a Handler for the webhooks. By default every delivery is
+//attempted 5 times, starting with a backoff of 1 minute
+func New(svc dynamodbiface.DynamoDBAPI, tableName string, opts ...Option) (
+	*Handler, error) {
+
+	if tableName == "" {
+		log.Error().Msg("Table name is empty")
+		return nil, errors.New(ErrStoreTableNameIsEmpty)
+	}
+
+	h := &Handler{
+		svc:         svc,
+		tableName:   tableName,
+		client:      &http.Client{Timeout: 5 * time.Second},
+		maxAttempts: 5,
+		backoff:     time.Minute,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h, nil
+}
+
+//Create stores a subscription. The response is the only one that contains
+//the secret, which partners need to verify the signature of the deliveries
+func (h *Handler) Create(ctx context.Context, ns *NewSubscriptionInfo) (
+	*Subscription, error) {
+
+	if err := validate.Struct(ns); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error validating struct")
+		return nil, getValidationError(err)
+	}
+
+	s := &Subscription{
+		SubscriptionID: uuid.New().String(),
+		URL:            ns.URL,
+		EventTypes:     ns.EventTypes,
+		Secret:         ns.Secret,
+		CreatedAt:      time.Now().UTC(),
+	}
+	ctx = logging.With(ctx, fieldWebhookID, s.SubscriptionID)
+
+	if s.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("Error generating secret")
+			return nil, ErrCouldNotCreateWebhook
+		}
+		s.Secret = secret
+	}
+
+	row, err := dynamodbattribute.MarshalMap(s)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error marshalling webhook")
+		return nil, ErrCouldNotCreateWebhook
+	}
+	row["pk"] = &dynamodb.AttributeValue{S: aws.String(DynamoDBPartitionWebhooks)}
+	row["sk"] = &dynamodb.AttributeValue{S: aws.String(getWebhookPK(s.SubscriptionID))}
+	row["type"] = &dynamodb.AttributeValue{S: aws.String(DynamoDBRowTypeWebhook)}
+
+	_, err = h.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		Item:                row,
+		TableName:           aws.String(h.tableName),
+		ConditionExpression: aws.String("attribute_not_exists(pk) and attribute_not_exists(sk)"),
+	})
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error creating webhook")
+		return nil, ErrCouldNotCreateWebhook
+	}
+
+	logging.Ctx(ctx).Info().Str("url", s.URL).Msg("Webhook created")
+
+	return s, nil
+}
+
+//List returns the subscriptions without their secrets
+func (h *Handler) List(ctx context.Context) (*List, error) {
+
+	subscriptions, err := h.subscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for n := range subscriptions {
+		subscriptions[n].Secret = ""
+	}
+
+	return &List{Subscriptions: subscriptions}, nil
+}
+
+//Delete deletes a subscription. Its delivery attempts are kept
+func (h *Handler) Delete(ctx context.Context, webhookID string) error {
+
+	if webhookID == "" {
+		return ErrWebhookIDIsEmpty
+	}
+	ctx = logging.With(ctx, fieldWebhookID, webhookID)
+
+	_, err := h.svc.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"pk": {S: aws.String(DynamoDBPartitionWebhooks)},
+			"sk": {S: aws.String(getWebhookPK(webhookID))},
+		},
+		ConditionExpression: aws.String("attribute_exists(pk) and attribute_exists(sk)"),
+		TableName:           aws.String(h.tableName),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok &&
+			aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return ErrWebhookNotFound
+		}
+		logging.Ctx(ctx).Error().Err(err).Msg("Error deleting webhook")
+		return ErrCouldNotDeleteWebhook
+	}
+
+	logging.Ctx(ctx).Info().Msg("Webhook deleted")
+
+	return nil
+}
+
+//Deliveries returns the latest delivery attempts of a subscription, the most
+//recent first
+func (h *Handler) Deliveries(ctx context.Context, webhookID string) (
+	*Deliveries, error) {
+
+	if webhookID == "" {
+		return nil, ErrWebhookIDIsEmpty
+	}
+	ctx = logging.With(ctx, fieldWebhookID, webhookID)
+
+	result, err := h.svc.QueryWithContext(ctx, &dynamodb.QueryInput{
+		KeyConditionExpression: aws.String("pk = :pk and begins_with(sk, :sk)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pk": {S: aws.String(getWebhookPK(webhookID))},
+			":sk": {S: aws.String(DynamoDBPrefixDelivery)},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int64(deliveriesLimit),
+		TableName:        aws.String(h.tableName),
+	})
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error loading deliveries")
+		return nil, ErrCouldNotLoadDeliveries
+	}
+
+	d := Deliveries{SubscriptionID: webhookID, Attempts: []Attempt{}}
+	if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &d.Attempts); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error unmarshalling deliveries")
+		return nil, ErrCouldNotLoadDeliveries
+	}
+
+	return &d, nil
+}
+
+//subscriptions returns the subscriptions with their secrets
+func (h *Handler) subscriptions(ctx context.Context) ([]Subscription, error) {
+
+	result, err := h.svc.QueryWithContext(ctx, &dynamodb.QueryInput{
+		KeyConditionExpression: aws.String("pk = :pk and begins_with(sk, :sk)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pk": {S: aws.String(DynamoDBPartitionWebhooks)},
+			":sk": {S: aws.String(DynamoDBPrefixWebhook)},
+		},
+		TableName: aws.String(h.tableName),
+	})
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error loading webhooks")
+		return nil, ErrCouldNotLoadWebhooks
+	}
+
+	subscriptions := []Subscription{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &subscriptions); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Error unmarshalling webhooks")
+		return nil, ErrCouldNotLoadWebhooks
+	}
+
+	return subscriptions, nil
+}
+
+//getWebhookPK returns the webhookID formatted for the key columns
+func getWebhookPK(webhookID string) string {
+	return fmt.Sprintf("%s%s", DynamoDBPrefixWebhook, webhookID)
+}
+
+//newSecret returns a random secret to sign the deliveries
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
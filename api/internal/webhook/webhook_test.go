@@ -0,0 +1,366 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/roloum/store/api/internal/events"
+	"github.com/roloum/store/api/internal/test"
+	"github.com/rs/zerolog"
+)
+
+const (
+	StoreTable = "Store"
+	Secret     = "0123456789abcdef"
+)
+
+func init() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+//TestCreate tests the validation of the subscriptions
+func TestCreate(t *testing.T) {
+
+	handler, _ := New(&test.MockDynamoDB{}, StoreTable)
+
+	tests := []struct {
+		desc string
+		info *NewSubscriptionInfo
+		err  error
+	}{
+		{
+			desc: ErrURLIsInvalid,
+			info: &NewSubscriptionInfo{URL: "partner"},
+			err:  errors.New(ErrURLIsInvalid),
+		},
+		{
+			desc: ErrEventTypeIsInvalid,
+			info: &NewSubscriptionInfo{URL: "https://partner.example.com/hook",
+				EventTypes: []string{"OrderPlaced"}},
+			err: errors.New(ErrEventTypeIsInvalid),
+		},
+		{
+			desc: ErrSecretIsTooShort,
+			info: &NewSubscriptionInfo{URL: "https://partner.example.com/hook",
+				Secret: "short"},
+			err: errors.New(ErrSecretIsTooShort),
+		},
+		{
+			desc: "GeneratedSecret",
+			info: &NewSubscriptionInfo{URL: "https://partner.example.com/hook",
+				EventTypes: []string{events.TypeItemAdded}},
+			err: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			s, err := handler.Create(context.Background(), tc.info)
+			if !reflect.DeepEqual(err, tc.err) {
+				t.Fatalf("Expected error: %v. Got: %v", tc.err, err)
+			}
+			if err == nil && len(s.Secret) != 64 {
+				t.Errorf("Expected generated secret. Got: %q", s.Secret)
+			}
+		})
+	}
+}
+
+//table is a DynamoDB client that returns the rows of the queried partition
+//and records the writes of the deliveries. The puts fail with putErr and the
+//updates with updateErr
+type table struct {
+	dynamodbiface.DynamoDBAPI
+	rows      map[string][]map[string]*dynamodb.AttributeValue
+	putErr    error
+	updateErr error
+	puts      []*dynamodb.PutItemInput
+	updates   []*dynamodb.UpdateItemInput
+	deletes   []*dynamodb.DeleteItemInput
+}
+
+//QueryWithContext returns the rows of the partition
+func (t *table) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput,
+	opts ...request.Option) (*dynamodb.QueryOutput, error) {
+
+	pk := aws.StringValue(input.ExpressionAttributeValues[":pk"].S)
+	return &dynamodb.QueryOutput{Items: t.rows[pk]}, nil
+}
+
+//PutItemWithContext records the row
+func (t *table) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput,
+	opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+
+	t.puts = append(t.puts, input)
+	return &dynamodb.PutItemOutput{}, t.putErr
+}
+
+//UpdateItemWithContext records the update
+func (t *table) UpdateItemWithContext(ctx aws.Context,
+	input *dynamodb.UpdateItemInput, opts ...request.Option) (
+	*dynamodb.UpdateItemOutput, error) {
+
+	t.updates = append(t.updates, input)
+	return &dynamodb.UpdateItemOutput{}, t.updateErr
+}
+
+//DeleteItemWithContext records the deletion
+func (t *table) DeleteItemWithContext(ctx aws.Context,
+	input *dynamodb.DeleteItemInput, opts ...request.Option) (
+	*dynamodb.DeleteItemOutput, error) {
+
+	t.deletes = append(t.deletes, input)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+//rowTypes returns the types of the rows put in the table
+func (t *table) rowTypes() []string {
+	types := []string{}
+	for _, p := range t.puts {
+		types = append(types, aws.StringValue(p.Item["type"].S))
+	}
+	return types
+}
+
+//TestPublish tests that the events are enqueued for the subscriptions that
+//accept them, without being delivered
+func TestPublish(t *testing.T) {
+
+	event := events.ItemAdded{
+		Meta:     events.Meta{EventID: "e1", CartID: "c1"},
+		ItemID:   "11aa",
+		Quantity: 1,
+	}
+
+	tests := []struct {
+		desc       string
+		eventTypes []string
+		dbErr      error
+		types      []string
+		err        error
+	}{
+		{
+			desc:  "Enqueued",
+			types: []string{DynamoDBRowTypePending},
+		},
+		{
+			desc:  "AlreadyEnqueued",
+			dbErr: awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "", nil),
+			types: []string{DynamoDBRowTypePending},
+		},
+		{
+			desc:       "NotSubscribed",
+			eventTypes: []string{events.TypeItemRemoved},
+			types:      []string{},
+		},
+		{
+			desc:  events.ErrCouldNotPublishEvents.Error(),
+			dbErr: errors.New("ProvisionedThroughputExceededException"),
+			types: []string{DynamoDBRowTypePending},
+			err:   events.ErrCouldNotPublishEvents,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&requests, 1)
+				}))
+			defer server.Close()
+
+			row, _ := dynamodbattribute.MarshalMap(Subscription{
+				SubscriptionID: "w1",
+				URL:            server.URL,
+				EventTypes:     tc.eventTypes,
+				Secret:         Secret,
+			})
+			svc := &table{
+				rows: map[string][]map[string]*dynamodb.AttributeValue{
+					DynamoDBPartitionWebhooks: {row},
+				},
+				putErr: tc.dbErr,
+			}
+
+			handler, _ := New(svc, StoreTable)
+
+			err := handler.Publish(context.Background(), []events.Event{event})
+			if !reflect.DeepEqual(err, tc.err) {
+				t.Fatalf("Expected error: %v. Got: %v", tc.err, err)
+			}
+			if requests != 0 {
+				t.Errorf("Expected no requests. Got: %d", requests)
+			}
+			if !reflect.DeepEqual(svc.rowTypes(), tc.types) {
+				t.Errorf("Expected rows: %v. Got: %v", tc.types, svc.rowTypes())
+			}
+		})
+	}
+}
+
+//TestDeliverPending tests the delivery of the pending events, the claim
+//before they are sent, the backoff of the retries, the dead letters and the
+//signature
+func TestDeliverPending(t *testing.T) {
+
+	now := time.Unix(1600000000, 0).UTC()
+
+	tests := []struct {
+		desc     string
+		status   int
+		attempt  int
+		claimErr error
+		types    []string
+		dueAt    time.Duration
+		deleted  bool
+	}{
+		{
+			desc:    "Delivered",
+			status:  http.StatusOK,
+			types:   []string{DynamoDBRowTypeDelivery},
+			deleted: true,
+		},
+		{
+			desc:    "DeliveredAfterRetry",
+			status:  http.StatusAccepted,
+			attempt: 1,
+			types:   []string{DynamoDBRowTypeDelivery},
+			deleted: true,
+		},
+		{
+			desc:    "Retried",
+			status:  http.StatusInternalServerError,
+			attempt: 1,
+			types:   []string{DynamoDBRowTypeDelivery},
+			dueAt:   2 * time.Second,
+		},
+		{
+			desc:    "DeadLetter",
+			status:  http.StatusBadGateway,
+			attempt: 2,
+			types:   []string{DynamoDBRowTypeDelivery, DynamoDBRowTypeDeadLetter},
+			deleted: true,
+		},
+		{
+			desc:    "ClaimedConcurrently",
+			attempt: 1,
+			claimErr: awserr.New(dynamodb.ErrCodeConditionalCheckFailedException,
+				"", nil),
+			types: []string{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+
+			var sent int32
+			server := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&sent, 1)
+					body, _ := ioutil.ReadAll(r.Body)
+					signature := Signature(Secret, r.Header.Get(HeaderTimestamp), body)
+					if r.Header.Get(HeaderSignature) != signature {
+						t.Errorf("Expected signature: %s. Got: %s", signature,
+							r.Header.Get(HeaderSignature))
+					}
+					if r.Header.Get(HeaderDelivery) != "e1" {
+						t.Errorf("Expected delivery e1. Got: %s",
+							r.Header.Get(HeaderDelivery))
+					}
+					if string(body) != `{"event_id":"e1"}` {
+						t.Errorf("Unexpected body: %s", body)
+					}
+					w.WriteHeader(tc.status)
+				}))
+			defer server.Close()
+
+			subscription, _ := dynamodbattribute.MarshalMap(Subscription{
+				SubscriptionID: "w1",
+				URL:            server.URL,
+				Secret:         Secret,
+			})
+			delivery, _ := dynamodbattribute.MarshalMap(pending{
+				EventID:   "e1",
+				EventType: events.TypeItemAdded,
+				Payload:   `{"event_id":"e1"}`,
+				Attempt:   tc.attempt,
+				DueAt:     now.UnixNano(),
+			})
+			svc := &table{
+				rows: map[string][]map[string]*dynamodb.AttributeValue{
+					DynamoDBPartitionWebhooks: {subscription},
+					getWebhookPK("w1"):        {delivery},
+				},
+				updateErr: tc.claimErr,
+			}
+
+			handler, _ := New(svc, StoreTable, WithRetry(3, time.Second))
+			handler.now = func() time.Time { return now }
+
+			if err := handler.DeliverPending(context.Background()); err != nil {
+				t.Fatalf("Expected no error. Got: %v", err)
+			}
+			if !reflect.DeepEqual(svc.rowTypes(), tc.types) {
+				t.Errorf("Expected rows: %v. Got: %v", tc.types, svc.rowTypes())
+			}
+			if deleted := len(svc.deletes) == 1; deleted != tc.deleted {
+				t.Errorf("Expected deleted: %v. Got: %v", tc.deleted, deleted)
+			}
+			if len(svc.updates) == 0 {
+				t.Fatal("Expected the delivery to be claimed")
+			}
+
+			//The delivery is claimed, with its attempt counted and leased,
+			//before it is sent
+			claim := svc.updates[0]
+			if got := aws.StringValue(claim.ExpressionAttributeValues[":attempt"].N); got != strconv.Itoa(tc.attempt+1) {
+				t.Errorf("Expected claim of attempt %d. Got: %s", tc.attempt+1, got)
+			}
+			lease := strconv.FormatInt(now.Add(deliveryLease).UnixNano(), 10)
+			if got := aws.StringValue(claim.ExpressionAttributeValues[":due_at"].N); got != lease {
+				t.Errorf("Expected lease until %s. Got: %s", lease, got)
+			}
+			if tc.claimErr != nil {
+				if sent := atomic.LoadInt32(&sent); sent != 0 || len(svc.updates) != 1 {
+					t.Errorf("Expected no delivery. Got: %d sent, %v", sent, svc.updates)
+				}
+				return
+			}
+			if sent := atomic.LoadInt32(&sent); sent != 1 {
+				t.Errorf("Expected a delivery. Got: %d", sent)
+			}
+
+			if tc.dueAt == 0 {
+				if len(svc.updates) != 1 {
+					t.Errorf("Expected no retry. Got: %v", svc.updates)
+				}
+				return
+			}
+			if len(svc.updates) != 2 {
+				t.Fatalf("Expected a retry. Got: %v", svc.updates)
+			}
+			dueAt := strconv.FormatInt(now.Add(tc.dueAt).UnixNano(), 10)
+			if got := aws.StringValue(
+				svc.updates[1].ExpressionAttributeValues[":due_at"].N); got != dueAt {
+				t.Errorf("Expected retry at %s. Got: %s", dueAt, got)
+			}
+		})
+	}
+}
+
@@ -125,7 +125,10 @@ class ItemsList extends React.Component {
             {this.state.items.map((item) => {
               return (
                 <li className="ItemListRow" key={item.item_id} >
-                  <span className="ItemListDesc">{item.description}</span>
+                  <span className="ItemListDesc">
+                    <Thumbnail media={item.media} />
+                    {item.description}
+                  </span>
                   <span className="ItemListPrice">${item.price}</span>
                   <span className="ItemListBtn">
                     <AddButton onClick={() => this.handleAddClick(item)} />
@@ -145,6 +148,20 @@ class ItemsList extends React.Component {
 
 
 
+//Thumbnail displays the first image of the item with the thumbnail role
+function Thumbnail(props) {
+
+  const thumbnail = (props.media || []).find((m) => m.role === "thumbnail");
+  if (!thumbnail) {
+    return null;
+  }
+
+  return (
+    <img className="ItemListThumbnail" src={thumbnail.url} alt={thumbnail.alt}
+      width={thumbnail.width || undefined} height={thumbnail.height || undefined} />
+  );
+}
+
 class BackButton extends React.Component {
 
   constructor(props) {